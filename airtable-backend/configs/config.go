@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,11 +15,29 @@ type Config struct {
 	ServerPort  string
 	Env         string // 新增环境变量标识
 	CORSOrigin  string // 新增 CORS 配置
+
+	// 附件存储配置
+	StorageDriver    string // local 或 s3
+	StorageLocalPath string // local 驱动的存储目录
+	S3Endpoint       string // S3 兼容服务地址，如 http://localhost:9000
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+
+	// 归档字段可以恢复的时长
+	FieldArchiveRetention time.Duration
 }
 
 const (
 	defaultPort = "8080" // 默认端口分离常量
 	devEnv      = "development"
+
+	defaultStorageDriver    = "local"
+	defaultStorageLocalPath = "./data/attachments"
+	defaultS3Region         = "us-east-1"
+
+	defaultFieldArchiveRetention = 30 * 24 * time.Hour
 )
 
 func LoadConfig() *Config {
@@ -35,6 +54,14 @@ func LoadConfig() *Config {
 		ServerPort:  os.Getenv("SERVER_PORT"),
 		Env:         os.Getenv("APP_ENV"),
 		CORSOrigin:  os.Getenv("CORS_ORIGIN"),
+
+		StorageDriver:    os.Getenv("STORAGE_DRIVER"),
+		StorageLocalPath: os.Getenv("STORAGE_LOCAL_PATH"),
+		S3Endpoint:       os.Getenv("S3_ENDPOINT"),
+		S3Region:         os.Getenv("S3_REGION"),
+		S3Bucket:         os.Getenv("S3_BUCKET"),
+		S3AccessKey:      os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretKey:      os.Getenv("S3_SECRET_ACCESS_KEY"),
 	}
 
 	// 设置默认环境
@@ -58,6 +85,28 @@ func LoadConfig() *Config {
 		}
 	}
 
+	// 附件存储默认值
+	if config.StorageDriver == "" {
+		config.StorageDriver = defaultStorageDriver
+	}
+	if config.StorageLocalPath == "" {
+		config.StorageLocalPath = defaultStorageLocalPath
+	}
+	if config.S3Region == "" {
+		config.S3Region = defaultS3Region
+	}
+
+	// 归档字段保留时长，格式如 720h
+	config.FieldArchiveRetention = defaultFieldArchiveRetention
+	if retention := os.Getenv("FIELD_ARCHIVE_RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil || d <= 0 {
+			log.Printf("Invalid FIELD_ARCHIVE_RETENTION %q, using %s", retention, defaultFieldArchiveRetention)
+		} else {
+			config.FieldArchiveRetention = d
+		}
+	}
+
 	// 端口处理逻辑优化
 	if config.ServerPort == "" {
 		config.ServerPort = ":" + defaultPort
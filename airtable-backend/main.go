@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	"time"
+	_ "time/tzdata" // 日历按 IANA 时区计算，不依赖系统的时区数据
 
 	"airtable-backend/configs"
 	"airtable-backend/pkg/api/handlers"
@@ -9,6 +11,7 @@ import (
 	"airtable-backend/pkg/database"
 	"airtable-backend/pkg/redis"
 	"airtable-backend/pkg/services"
+	"airtable-backend/pkg/storage"
 	"airtable-backend/pkg/websocket"
 
 	"github.com/gin-contrib/cors"
@@ -39,8 +42,25 @@ func main() {
 	tableService := services.NewTableService(database.DB)
 	// Field service is needed by record service
 	fieldService := services.NewFieldService(database.DB)
+	fieldService.ArchiveRetention = cfg.FieldArchiveRetention
 	recordService := services.NewRecordService(database.DB, wsManager, fieldService) // Pass WSManager and FieldService
 	queryService := services.NewQueryService(database.DB)                            // Initialize Query Service
+	searchService := services.NewSearchService(database.DB)
+	viewService := services.NewViewService(database.DB)
+	calendarService := services.NewCalendarService(database.DB)
+	pivotService := services.NewPivotService(database.DB)
+
+	// Attachment storage
+	blobStore, err := storage.NewBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	recordService.BlobStore = blobStore
+	tableService.BlobStore = blobStore
+	fieldService.BlobStore = blobStore
+	// Purge deleted fields and expired field archives in the background
+	go fieldService.RunFieldCleanup(time.Hour)
+	attachmentService := services.NewAttachmentService(database.DB, blobStore, recordService)
 
 	// Initialize Handlers
 	baseHandler := handlers.NewBaseHandler(baseService)
@@ -48,6 +68,11 @@ func main() {
 	fieldHandler := handlers.NewFieldHandler(fieldService, tableService)                             // Pass TableService to FieldHandler
 	recordHandler := handlers.NewRecordHandler(recordService, tableService, wsManager, queryService) // Pass QueryService to RecordHandler
 	websocketHandler := handlers.NewWebSocketHandler(wsManager)                                      // Pass WSManager
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService, recordService)
+	searchHandler := handlers.NewSearchHandler(searchService)
+	viewHandler := handlers.NewViewHandler(viewService)
+	calendarHandler := handlers.NewCalendarHandler(calendarService)
+	pivotHandler := handlers.NewPivotHandler(pivotService)
 
 	// Setup Router
 	r := gin.Default()
@@ -62,7 +87,7 @@ func main() {
 	r.Use(cors.New(config))
 
 	// Setup routes
-	routes.SetupRoutes(r, baseHandler, tableHandler, fieldHandler, recordHandler, websocketHandler)
+	routes.SetupRoutes(r, baseHandler, tableHandler, fieldHandler, recordHandler, attachmentHandler, websocketHandler, searchHandler, viewHandler, calendarHandler, pivotHandler)
 
 	// Start Server
 	log.Printf("Server starting on %s", cfg.ServerPort)
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/services"
+	"airtable-backend/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxUploadSize 单次上传请求的最大字节数
+const maxUploadSize = 100 << 20
+
+type AttachmentHandler struct {
+	Service       *services.AttachmentService
+	RecordService *services.RecordService
+}
+
+func NewAttachmentHandler(s *services.AttachmentService, rs *services.RecordService) *AttachmentHandler {
+	return &AttachmentHandler{Service: s, RecordService: rs}
+}
+
+// recordInTable 检查记录存在且属于路径中的表格
+func (h *AttachmentHandler) recordInTable(c *gin.Context) (uuid.UUID, bool) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return uuid.Nil, false
+	}
+	recordID, err := uuid.Parse(c.Param("recordId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid record ID"})
+		return uuid.Nil, false
+	}
+	record, err := h.RecordService.GetRecordByID(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return uuid.Nil, false
+	}
+	if record == nil || record.TableID != tableID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return uuid.Nil, false
+	}
+	return recordID, true
+}
+
+// UploadAttachments 上传一个或多个文件（multipart 字段 file）到记录的 file 字段（表单字段 field，可为字段 ID 或 key）
+func (h *AttachmentHandler) UploadAttachments(c *gin.Context) {
+	recordID, ok := h.recordInTable(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form"})
+		return
+	}
+	fieldRef := c.PostForm("field")
+	if fieldRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing field"})
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+
+	attachments := make([]*models.Attachment, 0, len(files))
+	for _, fileHeader := range files {
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		attachment, err := h.Service.Upload(c.Request.Context(), recordID, fieldRef, fileHeader.Filename, file, fileHeader.Size)
+		file.Close()
+		if err != nil {
+			var validationErr *models.ValidationError
+			if errors.As(err, &validationErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	c.JSON(http.StatusCreated, attachments)
+}
+
+// DownloadAttachment 下载附件，支持单个 Range 请求
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	recordID, ok := h.recordInTable(c)
+	if !ok {
+		return
+	}
+	attachmentID, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	attachment, key, err := h.Service.Get(recordID, attachmentID)
+	if err != nil {
+		if errors.Is(err, services.ErrAttachmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	offset, length, partial, ok := parseRange(c.GetHeader("Range"), attachment.Size)
+	if !ok {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", attachment.Size))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"error": "Invalid range"})
+		return
+	}
+
+	body, err := h.Service.Open(c.Request.Context(), key, offset, length)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment content not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", strconv.Quote(attachment.Checksum))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	status := http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, attachment.Size))
+	}
+	c.DataFromReader(status, length, attachment.MimeType, body, nil)
+}
+
+// DeleteAttachment 从记录中移除附件并删除文件内容
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	recordID, ok := h.recordInTable(c)
+	if !ok {
+		return
+	}
+	attachmentID, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	if err := h.Service.Delete(c.Request.Context(), recordID, attachmentID); err != nil {
+		if errors.Is(err, services.ErrAttachmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+		log.Printf("Failed to delete attachment %s: %v", attachmentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseRange 解析 Range 请求头。只支持单个范围；多个范围时返回完整内容。
+// ok 为 false 表示范围无法满足（416）。
+func parseRange(header string, size int64) (offset, length int64, partial, ok bool) {
+	if header == "" || !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size, false, true
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false, false
+	}
+
+	var start, end int64
+	var err error
+	switch {
+	case startStr == "":
+		// bytes=-N: the last N bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false, false
+		}
+		if n > size {
+			n = size
+		}
+		start, end = size-n, size-1
+	default:
+		start, err = strconv.ParseInt(startStr, 10, 64)
+		if err != nil || start < 0 {
+			return 0, 0, false, false
+		}
+		end = size - 1
+		if endStr != "" {
+			end, err = strconv.ParseInt(endStr, 10, 64)
+			if err != nil || end < start {
+				return 0, 0, false, false
+			}
+			if end > size-1 {
+				end = size - 1
+			}
+		}
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	return start, end - start + 1, true, true
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/services"
+	"airtable-backend/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachments(t *testing.T) {
+	db := setupTestDB(t)
+
+	root := t.TempDir()
+	store, err := storage.NewLocalStore(root)
+	assert.NoError(t, err)
+
+	fieldService := services.NewFieldService(db)
+	tableService := services.NewTableService(db)
+	recordService := services.NewRecordService(db, nil, fieldService)
+	recordService.BlobStore = store
+	tableService.BlobStore = store
+	handler := NewAttachmentHandler(services.NewAttachmentService(db, store, recordService), recordService)
+
+	router := gin.Default()
+	router.POST("/tables/:tableId/records/:recordId/attachments", handler.UploadAttachments)
+	router.GET("/tables/:tableId/records/:recordId/attachments/:attachmentId", handler.DownloadAttachment)
+	router.DELETE("/tables/:tableId/records/:recordId/attachments/:attachmentId", handler.DeleteAttachment)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Docs"}
+	assert.NoError(t, tableService.CreateTable(table))
+	assert.NoError(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Files", Key: "files", Type: models.FieldTypeFile}))
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{}`))
+	assert.NoError(t, err)
+	base := "/tables/" + table.ID.String() + "/records/" + record.ID.String() + "/attachments"
+
+	// Upload
+	content := []byte("<html><body>hello attachments</body></html>")
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("field", "files")
+	part, _ := writer.CreateFormFile("file", "page.txt")
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", base, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var uploaded []models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+	if !assert.Len(t, uploaded, 1) {
+		t.FailNow()
+	}
+	attachment := uploaded[0]
+	assert.Equal(t, "page.txt", attachment.Filename)
+	assert.Equal(t, int64(len(content)), attachment.Size)
+	assert.Equal(t, "text/html; charset=utf-8", attachment.MimeType)
+	assert.Len(t, attachment.Checksum, 64)
+
+	// The attachment is stored in the cell
+	stored, err := recordService.GetRecordByID(record.ID)
+	assert.NoError(t, err)
+	var data map[string][]models.Attachment
+	assert.NoError(t, json.Unmarshal(stored.Data, &data))
+	assert.Equal(t, attachment.ID, data["files"][0].ID)
+
+	// Full and ranged downloads
+	req, _ = http.NewRequest("GET", base+"/"+attachment.ID.String(), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.Bytes())
+
+	req, _ = http.NewRequest("GET", base+"/"+attachment.ID.String(), nil)
+	req.Header.Set("Range", "bytes=12-16")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, "bytes 12-16/43", w.Header().Get("Content-Range"))
+
+	req, _ = http.NewRequest("GET", base+"/"+attachment.ID.String(), nil)
+	req.Header.Set("Range", "bytes=100-")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+
+	// Deleting the record removes its blobs
+	blobPath := filepath.Join(root, table.ID.String(), record.ID.String(), attachment.ID.String())
+	_, err = os.Stat(blobPath)
+	assert.NoError(t, err)
+	assert.NoError(t, recordService.DeleteRecord(record.ID))
+	_, err = os.Stat(blobPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// So does deleting the table
+	record, err = recordService.CreateRecord(table.ID, json.RawMessage(`{}`))
+	assert.NoError(t, err)
+	body.Reset()
+	writer = multipart.NewWriter(&body)
+	writer.WriteField("field", "files")
+	part, _ = writer.CreateFormFile("file", "page.txt")
+	part.Write(content)
+	writer.Close()
+	req, _ = http.NewRequest("POST", "/tables/"+table.ID.String()+"/records/"+record.ID.String()+"/attachments", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+
+	blobPath = filepath.Join(root, table.ID.String(), record.ID.String(), uploaded[0].ID.String())
+	_, err = os.Stat(blobPath)
+	assert.NoError(t, err)
+	assert.NoError(t, tableService.DeleteTable(table.ID))
+	_, err = os.Stat(blobPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+	"airtable-backend/pkg/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CalendarHandler struct {
+	Service *services.CalendarService
+}
+
+func NewCalendarHandler(s *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{Service: s}
+}
+
+// GetCalendar 返回日期与时间窗口重叠的记录，参数见 calendarQuery
+func (h *CalendarHandler) GetCalendar(c *gin.Context) {
+	tableID, q, ok := calendarQuery(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.Service.Calendar(tableID, q)
+	if err != nil {
+		calendarError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetCalendarICS 以 iCalendar 格式返回与 GetCalendar 相同的事件，供日历应用订阅
+func (h *CalendarHandler) GetCalendarICS(c *gin.Context) {
+	tableID, q, ok := calendarQuery(c)
+	if !ok {
+		return
+	}
+
+	ics, err := h.Service.CalendarICS(tableID, q)
+	if err != nil {
+		calendarError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(ics))
+}
+
+// calendarQuery 读取日历参数：dateField、endDateField、titleField、start、end、timeZone 和 filter（JSON）
+func calendarQuery(c *gin.Context) (uuid.UUID, services.CalendarQuery, bool) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return tableID, services.CalendarQuery{}, false
+	}
+
+	q := services.CalendarQuery{
+		DateField:    c.Query("dateField"),
+		EndDateField: c.Query("endDateField"),
+		TitleField:   c.Query("titleField"),
+		Start:        c.Query("start"),
+		End:          c.Query("end"),
+		TimeZone:     c.Query("timeZone"),
+	}
+	if raw := c.Query("filter"); raw != "" {
+		if q.Filter, err = query.ParseFilterJSON([]byte(raw)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return tableID, q, false
+		}
+	}
+	return tableID, q, true
+}
+
+func calendarError(c *gin.Context, err error) {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+	case errors.Is(err, services.ErrTableNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
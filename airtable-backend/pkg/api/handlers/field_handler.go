@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,6 +11,7 @@ import (
 	"airtable-backend/pkg/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -36,21 +39,33 @@ func (h *FieldHandler) CreateField(c *gin.Context) {
 	}
 	field.TableID = tableID
 
+	table, err := h.TableService.GetTableByID(tableID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if table exists"})
+		return
+	}
+	if table == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		return
+	}
+
 	// 如果没有提供Key，则使用Name的小写形式作为Key
 	if field.Key == "" {
 		field.Key = strings.ToLower(strings.ReplaceAll(field.Name, " ", "_"))
 	}
 
-	switch field.Type {
-	case models.FieldTypeText, models.FieldTypeNumber, models.FieldTypeBoolean, models.FieldTypeDate:
-		// Valid type
-	default:
+	if !field.Type.IsValid() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported field type: %s", field.Type)})
 		return
 	}
 
 	if err := h.Service.CreateField(&field); err != nil {
-		if strings.Contains(err.Error(), "unique constraint") {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrDuplicateFieldKey) || strings.Contains(err.Error(), "unique constraint") {
 			c.JSON(http.StatusConflict, gin.H{"error": "Field with this name or key already exists in this table"})
 			return
 		}
@@ -123,11 +138,20 @@ func (h *FieldHandler) UpdateField(c *gin.Context) {
 	}
 
 	var field models.Field
-	if err := c.ShouldBindJSON(&field); err != nil {
+	if err := c.ShouldBindBodyWith(&field, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 	field.ID = fieldID
+	// 请求中包含 validation 或某个选项时才替换它们
+	var submitted struct {
+		Validation json.RawMessage            `json:"validation"`
+		Options    map[string]json.RawMessage `json:"options"`
+	}
+	if err := c.ShouldBindBodyWith(&submitted, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
 
 	existingField, err := h.Service.GetFieldByID(fieldID)
 	if err != nil {
@@ -143,10 +167,7 @@ func (h *FieldHandler) UpdateField(c *gin.Context) {
 		return
 	}
 
-	switch field.Type {
-	case models.FieldTypeText, models.FieldTypeNumber, models.FieldTypeBoolean, models.FieldTypeDate:
-		// Valid type
-	default:
+	if !field.Type.IsValid() {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported field type: %s", field.Type)})
 		return
 	}
@@ -159,9 +180,34 @@ func (h *FieldHandler) UpdateField(c *gin.Context) {
 	existingField.Name = field.Name
 	existingField.Key = field.Key
 	existingField.Type = field.Type
+	// 未提交的选项保持不变，例如只改名时公式和 lookup 配置不会被清空
+	for key, apply := range map[string]func(){
+		"formula":        func() { existingField.Options.Formula = field.Options.Formula },
+		"linkFieldId":    func() { existingField.Options.LinkFieldID = field.Options.LinkFieldID },
+		"lookupFieldId":  func() { existingField.Options.LookupFieldID = field.Options.LookupFieldID },
+		"rollupFunction": func() { existingField.Options.RollupFunction = field.Options.RollupFunction },
+		"choices":        func() { existingField.Options.Choices = field.Options.Choices },
+		"currencyCode":   func() { existingField.Options.CurrencyCode = field.Options.CurrencyCode },
+		"precision":      func() { existingField.Options.Precision = field.Options.Precision },
+		"max":            func() { existingField.Options.Max = field.Options.Max },
+	} {
+		if _, ok := submitted.Options[key]; ok {
+			apply()
+		}
+	}
+	if submitted.Validation != nil {
+		existingField.Validation = field.Validation
+	}
 
-	if err := h.Service.UpdateField(existingField); err != nil {
-		if strings.Contains(err.Error(), "unique constraint") {
+	// ?dryRun=true 时只预览类型转换的结果，不保存
+	conversion, err := h.Service.ConvertField(existingField, c.Query("dryRun") == "true")
+	if err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrDuplicateFieldKey) || strings.Contains(err.Error(), "unique constraint") {
 			c.JSON(http.StatusConflict, gin.H{"error": "Field with this name or key already exists in this table"})
 			return
 		}
@@ -173,7 +219,13 @@ func (h *FieldHandler) UpdateField(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, existingField)
+	c.JSON(http.StatusOK, fieldUpdateResponse{Field: existingField, Conversion: conversion})
+}
+
+// fieldUpdateResponse 是更新字段的响应：字段本身，类型改变时附带转换结果
+type fieldUpdateResponse struct {
+	*models.Field
+	Conversion *services.ConversionResult `json:"conversion,omitempty"`
 }
 
 func (h *FieldHandler) DeleteField(c *gin.Context) {
@@ -198,12 +250,72 @@ func (h *FieldHandler) DeleteField(c *gin.Context) {
 		return
 	}
 
-	if err := h.Service.DeleteField(fieldID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete field"})
+	// mode=archive 保留字段的值，在保留期内可以恢复
+	switch c.DefaultQuery("mode", "purge") {
+	case "purge":
+		if err := h.Service.DeleteField(fieldID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete field"})
+			return
+		}
+		c.Status(http.StatusOK)
+	case "archive":
+		archive, err := h.Service.ArchiveField(fieldID)
+		if err != nil {
+			var validationErr *models.ValidationError
+			if errors.As(err, &validationErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Message})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to archive field"})
+			return
+		}
+		c.JSON(http.StatusOK, archive)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delete mode"})
+	}
+}
+
+// GetArchivedFields 返回表格中仍可恢复的已归档字段
+func (h *FieldHandler) GetArchivedFields(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	archives, err := h.Service.GetArchivedFields(tableID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get archived fields"})
+		return
+	}
+
+	c.JSON(http.StatusOK, archives)
+}
+
+// RestoreField 恢复已归档的字段及其数据
+func (h *FieldHandler) RestoreField(c *gin.Context) {
+	fieldID, err := uuid.Parse(c.Param("fieldId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field ID"})
 		return
 	}
 
-	c.Status(http.StatusOK)
+	field, err := h.Service.RestoreField(fieldID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrArchiveNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Archived field not found or expired"})
+		case errors.Is(err, services.ErrArchiveIncomplete):
+			c.JSON(http.StatusConflict, gin.H{"error": "Field is still being archived, try again later"})
+		case errors.Is(err, services.ErrDuplicateFieldKey):
+			c.JSON(http.StatusConflict, gin.H{"error": "Another field now uses this key"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore field"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, field)
 }
 
 func (h *FieldHandler) UpdateFieldOrder(c *gin.Context) {
@@ -6,19 +6,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"airtable-backend/pkg/database/dialect"
 	"airtable-backend/pkg/models"
 	"airtable-backend/pkg/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func setupTestDB(t *testing.T) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, err := gorm.Open(dialect.OpenSQLite(":memory:"), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
@@ -29,6 +30,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		base_id TEXT NOT NULL,
 		name TEXT NOT NULL,
 		description TEXT,
+		unknown_fields TEXT NOT NULL DEFAULT 'reject',
 		created_at DATETIME,
 		updated_at DATETIME,
 		deleted_at DATETIME
@@ -46,6 +48,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		type TEXT NOT NULL,
 		description TEXT,
 		validation TEXT,
+		options TEXT,
 		"order" INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME,
 		updated_at DATETIME,
@@ -56,6 +59,74 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to create fields table: %v", err)
 	}
 
+	// Field updates rewrite record data
+	err = db.Exec(`CREATE TABLE IF NOT EXISTS records (
+		id TEXT PRIMARY KEY,
+		table_id TEXT NOT NULL,
+		data TEXT,
+		position REAL NOT NULL DEFAULT 0,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create records table: %v", err)
+	}
+
+	// Deleting fields purges or archives their values
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS field_sequences (
+			field_id TEXT PRIMARY KEY,
+			value INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS field_archives (
+			field_id TEXT PRIMARY KEY,
+			table_id TEXT NOT NULL,
+			value_count INTEGER NOT NULL DEFAULT 0,
+			complete BOOLEAN NOT NULL DEFAULT FALSE,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS archived_values (
+			field_id TEXT NOT NULL,
+			record_id TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (field_id, record_id)
+		)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("Failed to create field deletion tables: %v", err)
+		}
+	}
+
+	// Field and table changes update the table's views
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS views (
+			id TEXT PRIMARY KEY,
+			table_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			filter TEXT,
+			sort TEXT,
+			group_by TEXT,
+			options TEXT,
+			"order" INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME,
+			updated_at DATETIME,
+			deleted_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS view_positions (
+			view_id TEXT NOT NULL,
+			record_id TEXT NOT NULL,
+			position REAL NOT NULL,
+			PRIMARY KEY (view_id, record_id)
+		)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("Failed to create views tables: %v", err)
+		}
+	}
+
 	return db
 }
 
@@ -71,6 +142,8 @@ func setupTestRouter(t *testing.T) (*gin.Engine, *FieldHandler) {
 	router.GET("/fields/:fieldId", handler.GetField)
 	router.PUT("/fields/:fieldId", handler.UpdateField)
 	router.DELETE("/fields/:fieldId", handler.DeleteField)
+	router.POST("/fields/:fieldId/restore", handler.RestoreField)
+	router.GET("/tables/:tableId/fields/archived", handler.GetArchivedFields)
 	router.PUT("/tables/:tableId/fields/order", handler.UpdateFieldOrder)
 
 	return router, handler
@@ -109,6 +182,13 @@ func TestCreateField(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, field.Name, response.Name)
 	assert.Equal(t, field.Type, response.Type)
+
+	// Unknown types are rejected
+	req, _ = http.NewRequest("POST", "/tables/"+table.ID.String()+"/fields", bytes.NewBufferString(`{"name": "Odd", "type": "blob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 func TestGetFieldsByTable(t *testing.T) {
@@ -260,6 +340,47 @@ func TestDeleteField(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestDeleteField_ArchiveAndRestore(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	table := models.Table{BaseID: uuid.New(), Name: "Test Table"}
+	assert.NoError(t, handler.TableService.CreateTable(&table))
+	field := models.Field{TableID: table.ID, Name: "Test Field", Key: "test_field", Type: models.FieldTypeText}
+	assert.NoError(t, handler.Service.CreateField(&field))
+
+	req, _ := http.NewRequest("DELETE", "/fields/"+field.ID.String()+"?mode=shred", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("DELETE", "/fields/"+field.ID.String()+"?mode=archive", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var archive models.FieldArchive
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &archive))
+	assert.Equal(t, field.ID, archive.FieldID)
+	assert.True(t, archive.ExpiresAt.After(time.Now()))
+
+	req, _ = http.NewRequest("GET", "/tables/"+table.ID.String()+"/fields/archived", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var archives []models.FieldArchive
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &archives))
+	assert.Len(t, archives, 1)
+
+	req, _ = http.NewRequest("POST", "/fields/"+field.ID.String()+"/restore", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("POST", "/fields/"+field.ID.String()+"/restore", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestCreateField_WithoutKey(t *testing.T) {
 	router, handler := setupTestRouter(t)
 
@@ -355,6 +476,81 @@ func TestUpdateField_WithoutKey(t *testing.T) {
 	assert.Equal(t, "updated_name", response.Key)
 }
 
+func TestUpdateField_Validation(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	table := models.Table{BaseID: uuid.New(), Name: "Test Table"}
+	assert.NoError(t, handler.TableService.CreateTable(&table))
+	field := models.Field{
+		TableID:    table.ID,
+		Name:       "Code",
+		Key:        "code",
+		Type:       models.FieldTypeText,
+		Validation: models.ValidationRule{Required: true},
+	}
+	assert.NoError(t, handler.Service.CreateField(&field))
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/fields/"+field.ID.String(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Rules are kept when the request has no validation
+	w := update(`{"name": "Code", "key": "code", "type": "text"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	stored, _ := handler.Service.GetFieldByID(field.ID)
+	assert.True(t, stored.Validation.Required)
+
+	w = update(`{"name": "Code", "key": "code", "type": "text", "validation": {"pattern": "^[A-Z]{3}$", "unique": true}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	stored, _ = handler.Service.GetFieldByID(field.ID)
+	assert.Equal(t, "^[A-Z]{3}$", stored.Validation.Pattern)
+	assert.False(t, stored.Validation.Required)
+
+	w = update(`{"name": "Code", "key": "code", "type": "text", "validation": {"pattern": "[A-Z"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUpdateField_KeepsOptions(t *testing.T) {
+	router, handler := setupTestRouter(t)
+
+	table := models.Table{BaseID: uuid.New(), Name: "Test Table"}
+	assert.NoError(t, handler.TableService.CreateTable(&table))
+	hours := models.Field{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber}
+	assert.NoError(t, handler.Service.CreateField(&hours))
+	field := models.Field{
+		TableID: table.ID,
+		Name:    "Days",
+		Key:     "days",
+		Type:    models.FieldTypeFormula,
+		Options: models.FieldOptions{Formula: "{hours} / 8"},
+	}
+	assert.NoError(t, handler.Service.CreateField(&field))
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/fields/"+field.ID.String(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Renaming keeps the formula
+	w := update(`{"name": "Work days", "key": "days", "type": "formula"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	stored, _ := handler.Service.GetFieldByID(field.ID)
+	assert.Equal(t, "Work days", stored.Name)
+	assert.Equal(t, "{hours} / 8", stored.Options.Formula)
+
+	w = update(`{"name": "Work days", "key": "days", "type": "formula", "options": {"formula": "{hours} / 7"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	stored, _ = handler.Service.GetFieldByID(field.ID)
+	assert.Equal(t, "{hours} / 7", stored.Options.Formula)
+}
+
 func TestUpdateFieldOrder_InvalidFields(t *testing.T) {
 	router, handler := setupTestRouter(t)
 
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+	"airtable-backend/pkg/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PivotHandler struct {
+	Service *services.PivotService
+}
+
+func NewPivotHandler(s *services.PivotService) *PivotHandler {
+	return &PivotHandler{Service: s}
+}
+
+// GetPivot 返回透视表，参数通过 URL 传递（rows、columns、measure、filter 为 JSON）
+func (h *PivotHandler) GetPivot(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	p, err := query.ParsePivotValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.pivot(c, tableID, *p)
+}
+
+// QueryPivot 返回透视表，参数放在请求体中，格式与 GetPivot 的参数相同
+func (h *PivotHandler) QueryPivot(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	var p query.Pivot
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pivot parameters"})
+		return
+	}
+
+	h.pivot(c, tableID, p)
+}
+
+func (h *PivotHandler) pivot(c *gin.Context, tableID uuid.UUID, p query.Pivot) {
+	result, err := h.Service.Pivot(tableID, p)
+	if err != nil {
+		var validationErr *models.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		case errors.Is(err, services.ErrTableNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
 	"airtable-backend/pkg/services"
 	"airtable-backend/pkg/websocket" // Need WS Manager to subscribe clients initially
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -44,13 +46,14 @@ func (h *RecordHandler) CreateRecord(c *gin.Context) {
 
 	record, err := h.Service.CreateRecord(tableID, rawData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		recordWriteError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, record)
 }
 
+// GetRecords 查询记录，查询条件通过 URL 参数传递（filter、sort、aggregates 为 JSON）
 func (h *RecordHandler) GetRecords(c *gin.Context) {
 	tableID, err := uuid.Parse(c.Param("tableId"))
 	if err != nil {
@@ -58,15 +61,44 @@ func (h *RecordHandler) GetRecords(c *gin.Context) {
 		return
 	}
 
-	var params models.QueryParams
-	if err := c.ShouldBindJSON(&params); err != nil {
+	req, err := query.ParseValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.queryRecords(c, tableID, *req)
+}
+
+// QueryRecords 查询记录，查询条件放在请求体中，格式与 GetRecords 的参数相同
+func (h *RecordHandler) QueryRecords(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	var req query.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
 		return
 	}
 
-	result, err := h.QueryService.QueryRecords(tableID, params)
+	h.queryRecords(c, tableID, req)
+}
+
+func (h *RecordHandler) queryRecords(c *gin.Context, tableID uuid.UUID, req query.Request) {
+	result, err := h.QueryService.QueryRecords(tableID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var validationErr *models.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		case errors.Is(err, services.ErrTableNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -90,6 +122,14 @@ func (h *RecordHandler) GetRecord(c *gin.Context) {
 		return
 	}
 
+	// ?expand=true 时返回关联记录的主字段值
+	if c.Query("expand") == "true" {
+		if err := h.Service.ExpandLinks(record); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, record)
 }
 
@@ -115,7 +155,7 @@ func (h *RecordHandler) UpdateRecord(c *gin.Context) {
 
 	record, err := h.Service.UpdateRecord(recordID, rawData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		recordWriteError(c, err)
 		return
 	}
 
@@ -136,3 +176,83 @@ func (h *RecordHandler) DeleteRecord(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// MoveRecord 把一条记录移到同一表格中另一条记录之前（before）或之后（after），两者都不传时移到表格末尾
+func (h *RecordHandler) MoveRecord(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+	recordID, err := uuid.Parse(c.Param("recordId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid record ID"})
+		return
+	}
+
+	var move services.RecordMove
+	if err := c.ShouldBindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	move.RecordIDs = []uuid.UUID{recordID}
+
+	if _, err := h.Service.MoveRecords(tableID, move); err != nil {
+		recordWriteError(c, err)
+		return
+	}
+
+	record, err := h.Service.GetRecordByID(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// ReorderRecords 批量移动记录：recordIds 中的记录按列出的顺序连续排列在 before 或 after 指定的记录旁，
+// 两者都不传时排在表格末尾
+func (h *RecordHandler) ReorderRecords(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	var move services.RecordMove
+	if err := c.ShouldBindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	positions, err := h.Service.MoveRecords(tableID, move)
+	if err != nil {
+		recordWriteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"positions": positions})
+}
+
+// recordWriteError 将创建/更新记录的错误转换为响应：字段验证失败返回 422 并列出每个字段的错误
+func recordWriteError(c *gin.Context, err error) {
+	var recordErr *models.RecordValidationError
+	if errors.As(err, &recordErr) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "fields": recordErr.Errors})
+		return
+	}
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTableNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		return
+	}
+	if errors.Is(err, services.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TableReadAccess 按请求返回调用者能否读取某个表格，返回 nil 表示所有表格都可读
+type TableReadAccess func(c *gin.Context) func(models.Table) bool
+
+// AllTablesReadable 是还没有用户认证时使用的 TableReadAccess：所有表格都可读
+func AllTablesReadable(c *gin.Context) func(models.Table) bool {
+	return nil
+}
+
+type SearchHandler struct {
+	Service *services.SearchService
+	// CanRead 决定搜索结果包含哪些表格，默认为 AllTablesReadable；接入用户认证后替换为按调用者判断
+	CanRead TableReadAccess
+}
+
+func NewSearchHandler(s *services.SearchService) *SearchHandler {
+	return &SearchHandler{Service: s, CanRead: AllTablesReadable}
+}
+
+// SearchBase 在整个 Base 中搜索表格名、字段名和记录内容，参数 q 为搜索词，limit 为每个表格返回的记录数
+func (h *SearchHandler) SearchBase(c *gin.Context) {
+	baseID, err := uuid.Parse(c.Param("baseId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid base ID"})
+		return
+	}
+
+	// 结果只包含调用者可读的表格
+	var opts services.BaseSearchOptions
+	if h.CanRead != nil {
+		opts.CanRead = h.CanRead(c)
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if opts.Limit, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	result, err := h.Service.SearchBase(baseID, c.Query("q"), opts)
+	if err != nil {
+		var validationErr *models.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		case errors.Is(err, services.ErrBaseNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Base not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
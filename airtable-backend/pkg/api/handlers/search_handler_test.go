@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+	"airtable-backend/pkg/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchBase(t *testing.T) {
+	db := setupTestDB(t)
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS bases (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		user_id TEXT,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create bases table: %v", err)
+	}
+	if err := dialect.SQLite.CreateSearchIndex(db, query.SearchIndexTypes()); err != nil {
+		t.Fatalf("Failed to create search index: %v", err)
+	}
+	fieldService := services.NewFieldService(db)
+	tableService := services.NewTableService(db)
+	recordService := services.NewRecordService(db, nil, fieldService)
+	handler := NewSearchHandler(services.NewSearchService(db))
+
+	base := &models.Base{Name: "Work"}
+	assert.NoError(t, services.NewBaseService(db).CreateBase(base))
+	tasks := &models.Table{BaseID: base.ID, Name: "Tasks"}
+	secret := &models.Table{BaseID: base.ID, Name: "Keys"}
+	for _, table := range []*models.Table{tasks, secret} {
+		assert.NoError(t, tableService.CreateTable(table))
+		assert.NoError(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}))
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "deploy"}`))
+		assert.NoError(t, err)
+	}
+
+	// The caller is known from the request, here through a header
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("caller", c.GetHeader("X-Caller"))
+	})
+	router.GET("/bases/:baseId/search", handler.SearchBase)
+	search := func(caller string) []uuid.UUID {
+		req, _ := http.NewRequest("GET", "/bases/"+base.ID.String()+"/search?q=deploy", nil)
+		req.Header.Set("X-Caller", caller)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var result models.BaseSearchResult
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		var tables []uuid.UUID
+		for _, table := range result.Tables {
+			tables = append(tables, table.TableID)
+		}
+		return tables
+	}
+
+	// By default every table is searched
+	assert.ElementsMatch(t, []uuid.UUID{tasks.ID, secret.ID}, search("guest"))
+
+	// Tables the caller cannot read are left out
+	handler.CanRead = func(c *gin.Context) func(models.Table) bool {
+		if c.GetString("caller") == "admin" {
+			return nil
+		}
+		return func(table models.Table) bool { return table.ID != secret.ID }
+	}
+	assert.Equal(t, []uuid.UUID{tasks.ID}, search("guest"))
+	assert.ElementsMatch(t, []uuid.UUID{tasks.ID, secret.ID}, search("admin"))
+}
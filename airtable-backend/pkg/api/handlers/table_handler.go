@@ -42,6 +42,10 @@ func (h *TableHandler) CreateTable(c *gin.Context) {
 		return
 	}
 	table.BaseID = baseID
+	if !validUnknownFieldPolicy(&table) {
+		ErrorResponse(c, 400, "Invalid UnknownFields policy")
+		return
+	}
 
 	if err := h.Service.CreateTable(&table); err != nil {
 		ErrorResponse(c, 500, "Failed to create table")
@@ -133,6 +137,13 @@ func (h *TableHandler) UpdateTable(c *gin.Context) {
 	}
 
 	existingTable.Name = table.Name
+	if table.UnknownFields != "" {
+		if !validUnknownFieldPolicy(&table) {
+			ErrorResponse(c, 400, "Invalid UnknownFields policy")
+			return
+		}
+		existingTable.UnknownFields = table.UnknownFields
+	}
 
 	if err := h.Service.UpdateTable(existingTable); err != nil {
 		ErrorResponse(c, 500, "Failed to update table")
@@ -171,3 +182,15 @@ func (h *TableHandler) DeleteTable(c *gin.Context) {
 
 	c.Status(204)
 }
+
+// validUnknownFieldPolicy 检查表格的未知字段策略，未设置时使用 reject
+func validUnknownFieldPolicy(table *models.Table) bool {
+	switch table.UnknownFields {
+	case "":
+		table.UnknownFields = models.UnknownFieldsReject
+	case models.UnknownFieldsReject, models.UnknownFieldsIgnore:
+	default:
+		return false
+	}
+	return true
+}
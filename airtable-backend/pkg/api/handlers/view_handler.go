@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+	"airtable-backend/pkg/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ViewHandler struct {
+	Service *services.ViewService
+}
+
+func NewViewHandler(s *services.ViewService) *ViewHandler {
+	return &ViewHandler{Service: s}
+}
+
+func (h *ViewHandler) CreateView(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	var view models.View
+	if err := c.ShouldBindJSON(&view); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	view.ID = uuid.Nil
+	view.TableID = tableID
+
+	if err := h.Service.CreateView(&view); err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, view)
+}
+
+func (h *ViewHandler) GetViewsByTable(c *gin.Context) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	views, err := h.Service.GetViewsByTableID(tableID)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, views)
+}
+
+func (h *ViewHandler) GetView(c *gin.Context) {
+	view, ok := h.viewInTable(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *ViewHandler) UpdateView(c *gin.Context) {
+	existing, ok := h.viewInTable(c)
+	if !ok {
+		return
+	}
+
+	var view models.View
+	if err := c.ShouldBindJSON(&view); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	view.ID = existing.ID
+
+	if err := h.Service.UpdateView(&view); err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *ViewHandler) DeleteView(c *gin.Context) {
+	view, ok := h.viewInTable(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DeleteView(view.ID); err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetViewRecords 按视图保存的过滤、排序和分组查询记录；分页、search 和 aggregates 参数与 GetRecords 相同
+func (h *ViewHandler) GetViewRecords(c *gin.Context) {
+	viewID, err := uuid.Parse(c.Param("viewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view ID"})
+		return
+	}
+
+	req, err := query.ParseValues(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.Service.QueryViewRecords(viewID, *req)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetKanbanStacks 按看板视图的单选字段分堆返回记录；cursor 为某个堆的 nextCursor 时只返回该堆的后续记录
+func (h *ViewHandler) GetKanbanStacks(c *gin.Context) {
+	viewID, err := uuid.Parse(c.Param("viewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view ID"})
+		return
+	}
+
+	opts := services.KanbanOptions{Cursor: c.Query("cursor")}
+	if raw := c.Query("pageSize"); raw != "" {
+		if opts.PageSize, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pageSize"})
+			return
+		}
+	}
+
+	result, err := h.Service.KanbanStacks(viewID, opts)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// MoveKanbanRecord 把记录拖到看板的某个堆中，同时修改选项和堆内位置
+func (h *ViewHandler) MoveKanbanRecord(c *gin.Context) {
+	viewID, err := uuid.Parse(c.Param("viewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view ID"})
+		return
+	}
+	recordID, err := uuid.Parse(c.Param("recordId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid record ID"})
+		return
+	}
+
+	var move services.KanbanMove
+	if err := c.ShouldBindJSON(&move); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	record, err := h.Service.MoveKanbanRecord(viewID, recordID, move)
+	if err != nil {
+		viewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+// viewInTable 读取路径中的视图，视图不属于路径中的表格时按不存在处理
+func (h *ViewHandler) viewInTable(c *gin.Context) (*models.View, bool) {
+	tableID, err := uuid.Parse(c.Param("tableId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return nil, false
+	}
+	viewID, err := uuid.Parse(c.Param("viewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view ID"})
+		return nil, false
+	}
+
+	view, err := h.Service.GetViewByID(viewID)
+	if err == nil && view.TableID != tableID {
+		err = services.ErrViewNotFound
+	}
+	if err != nil {
+		viewError(c, err)
+		return nil, false
+	}
+	return view, true
+}
+
+func viewError(c *gin.Context, err error) {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+	case errors.Is(err, services.ErrViewNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "View not found"})
+	case errors.Is(err, services.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+	case errors.Is(err, services.ErrTableNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
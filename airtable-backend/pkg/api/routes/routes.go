@@ -12,7 +12,12 @@ func SetupRoutes(
 	tableHandler *handlers.TableHandler,
 	fieldHandler *handlers.FieldHandler,
 	recordHandler *handlers.RecordHandler,
+	attachmentHandler *handlers.AttachmentHandler,
 	websocketHandler *handlers.WebSocketHandler,
+	searchHandler *handlers.SearchHandler,
+	viewHandler *handlers.ViewHandler,
+	calendarHandler *handlers.CalendarHandler,
+	pivotHandler *handlers.PivotHandler,
 ) {
 	api := r.Group("/api/v1")
 
@@ -22,6 +27,7 @@ func SetupRoutes(
 	api.GET("/bases/:baseId", baseHandler.GetBase)
 	api.PUT("/bases/:baseId", baseHandler.UpdateBase)
 	api.DELETE("/bases/:baseId", baseHandler.DeleteBase)
+	api.GET("/bases/:baseId/search", searchHandler.SearchBase)
 
 	// Table routes (nested under base)
 	api.POST("/bases/:baseId/tables", tableHandler.CreateTable)
@@ -37,14 +43,42 @@ func SetupRoutes(
 	api.PUT("/bases/:baseId/tables/:tableId/fields/:fieldId", fieldHandler.UpdateField)
 	api.DELETE("/bases/:baseId/tables/:tableId/fields/:fieldId", fieldHandler.DeleteField)
 	api.PUT("/bases/:baseId/tables/:tableId/fields/order", fieldHandler.UpdateFieldOrder)
+	api.GET("/bases/:baseId/tables/:tableId/fields/archived", fieldHandler.GetArchivedFields)
+	api.POST("/bases/:baseId/tables/:tableId/fields/:fieldId/restore", fieldHandler.RestoreField)
 	api.POST("/bases/:baseId/tables/:tableId/fields/:fieldId/validate", fieldHandler.ValidateFieldValue)
 
 	// Record routes (nested under table)
 	api.POST("/bases/:baseId/tables/:tableId/records", recordHandler.CreateRecord)
 	api.GET("/bases/:baseId/tables/:tableId/records", recordHandler.GetRecords)
+	api.POST("/bases/:baseId/tables/:tableId/records/query", recordHandler.QueryRecords)
+	api.POST("/bases/:baseId/tables/:tableId/records/reorder", recordHandler.ReorderRecords)
 	api.GET("/bases/:baseId/tables/:tableId/records/:recordId", recordHandler.GetRecord)
 	api.PUT("/bases/:baseId/tables/:tableId/records/:recordId", recordHandler.UpdateRecord)
 	api.DELETE("/bases/:baseId/tables/:tableId/records/:recordId", recordHandler.DeleteRecord)
+	api.POST("/bases/:baseId/tables/:tableId/records/:recordId/move", recordHandler.MoveRecord)
+
+	// Calendar routes (nested under table)
+	api.GET("/bases/:baseId/tables/:tableId/calendar", calendarHandler.GetCalendar)
+	api.GET("/bases/:baseId/tables/:tableId/calendar.ics", calendarHandler.GetCalendarICS)
+
+	// Pivot routes (nested under table)
+	api.GET("/bases/:baseId/tables/:tableId/pivot", pivotHandler.GetPivot)
+	api.POST("/bases/:baseId/tables/:tableId/pivot", pivotHandler.QueryPivot)
+
+	// View routes (nested under table)
+	api.POST("/bases/:baseId/tables/:tableId/views", viewHandler.CreateView)
+	api.GET("/bases/:baseId/tables/:tableId/views", viewHandler.GetViewsByTable)
+	api.GET("/bases/:baseId/tables/:tableId/views/:viewId", viewHandler.GetView)
+	api.PUT("/bases/:baseId/tables/:tableId/views/:viewId", viewHandler.UpdateView)
+	api.DELETE("/bases/:baseId/tables/:tableId/views/:viewId", viewHandler.DeleteView)
+	api.GET("/views/:viewId/records", viewHandler.GetViewRecords)
+	api.GET("/views/:viewId/stacks", viewHandler.GetKanbanStacks)
+	api.POST("/views/:viewId/records/:recordId/move", viewHandler.MoveKanbanRecord)
+
+	// Attachment routes (nested under record)
+	api.POST("/bases/:baseId/tables/:tableId/records/:recordId/attachments", attachmentHandler.UploadAttachments)
+	api.GET("/bases/:baseId/tables/:tableId/records/:recordId/attachments/:attachmentId", attachmentHandler.DownloadAttachment)
+	api.DELETE("/bases/:baseId/tables/:tableId/records/:recordId/attachments/:attachmentId", attachmentHandler.DeleteAttachment)
 
 	// WebSocket endpoint
 	r.GET("/ws", websocketHandler.ServeWS)
@@ -5,62 +5,67 @@ import (
 	"strings"
 
 	"airtable-backend/configs"
+	"airtable-backend/pkg/database/dialect"
 	"airtable-backend/pkg/database/migrations"
 	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
 
 	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// openDialector picks the database driver from the database URL. SQLite is
+// used for "sqlite://<path>" and "file:" URLs, PostgreSQL for anything else.
+func openDialector(databaseURL string) gorm.Dialector {
+	switch {
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		return dialect.OpenSQLite(strings.TrimPrefix(databaseURL, "sqlite://"))
+	case strings.HasPrefix(databaseURL, "file:"):
+		return dialect.OpenSQLite(databaseURL)
+	}
+	return postgres.Open(databaseURL)
+}
+
 func ConnectDB(cfg *configs.Config) {
 	var err error
-	var dialector gorm.Dialector
 
-	// Use SQLite for testing
-	if strings.HasPrefix(cfg.DatabaseURL, "file::memory:") {
-		dialector = sqlite.Open(cfg.DatabaseURL)
-	} else {
-		dialector = postgres.Open(cfg.DatabaseURL)
-	}
-
-	DB, err = gorm.Open(dialector, &gorm.Config{})
+	DB, err = gorm.Open(openDialector(cfg.DatabaseURL), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	log.Println("Database connected successfully")
+	log.Printf("Database connected successfully (%s)", DB.Dialector.Name())
 
 	// Run migrations
 	err = migrations.AddFieldKey(DB)
 	if err != nil {
 		log.Fatalf("Failed to run field key migration: %v", err)
 	}
+	err = migrations.AddRecordPosition(DB)
+	if err != nil {
+		log.Fatalf("Failed to run record position migration: %v", err)
+	}
 
 	// AutoMigrate models
-	err = DB.AutoMigrate(&models.User{}, &models.Base{}, &models.Table{}, &models.Field{}, &models.Record{})
+	err = DB.AutoMigrate(&models.User{}, &models.Base{}, &models.Table{}, &models.Field{}, &models.Record{}, &models.FieldSequence{},
+		&models.FieldArchive{}, &models.ArchivedValue{}, &models.View{}, &models.ViewPosition{})
 	if err != nil {
 		log.Fatalf("Failed to auto migrate database: %v", err)
 	}
 	log.Println("Database migration completed")
 
-	// Only create GIN index for PostgreSQL
-	if !strings.HasPrefix(cfg.DatabaseURL, "file::memory:") {
-		// Manually add GIN index for JSONB data field
-		// This is crucial for performance on querying JSONB
-		// Check if index exists first (optional but good practice)
-		var count int64
-		DB.Raw("SELECT count(*) FROM pg_indexes WHERE tablename = 'records' AND indexname = 'idx_records_data_gin'").Scan(&count)
-		if count == 0 {
-			err = DB.Exec("CREATE INDEX idx_records_data_gin ON records USING GIN (data)").Error
-			if err != nil {
-				log.Fatalf("Failed to create GIN index on records.data: %v", err)
-			}
-			log.Println("GIN index on records.data created")
-		} else {
-			log.Println("GIN index on records.data already exists")
-		}
+	// Index the JSONB data field where the database supports it
+	// This is crucial for performance on querying JSONB
+	err = dialect.For(DB).CreateJSONIndex(DB, "records", "data", "idx_records_data_gin")
+	if err != nil {
+		log.Fatalf("Failed to create index on records.data: %v", err)
+	}
+
+	// 全文搜索索引，由触发器在写入记录时维护
+	err = dialect.For(DB).CreateSearchIndex(DB, query.SearchIndexTypes())
+	if err != nil {
+		log.Fatalf("Failed to create search index: %v", err)
 	}
 }
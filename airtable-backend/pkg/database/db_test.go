@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"airtable-backend/configs"
+	"airtable-backend/pkg/database/dialect"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -53,7 +54,7 @@ func TestConnectDB(t *testing.T) {
 	}
 }
 
-func TestGINIndex(t *testing.T) {
+func TestJSONIndex(t *testing.T) {
 	// Create test config
 	cfg := &configs.Config{
 		DatabaseURL: "file::memory:?cache=shared",
@@ -62,14 +63,18 @@ func TestGINIndex(t *testing.T) {
 	// Test connection
 	ConnectDB(cfg)
 
-	// Verify GIN index
+	if got := dialect.For(DB); got != dialect.SQLite {
+		t.Fatalf("Expected the SQLite dialect, got %s", got.Name())
+	}
+
+	// SQLite has no index for arbitrary JSON keys, so none is created
 	var count int64
 	err := DB.Raw("SELECT count(*) FROM sqlite_master WHERE type='index' AND name='idx_records_data_gin'").Scan(&count).Error
 	if err != nil {
 		t.Fatalf("Failed to query indexes: %v", err)
 	}
 
-	if count == 0 {
-		t.Error("Expected GIN index to be created")
+	if count != 0 {
+		t.Error("Expected no JSON index on SQLite")
 	}
 }
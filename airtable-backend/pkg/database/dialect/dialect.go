@@ -0,0 +1,109 @@
+// Package dialect hides the differences between the SQL databases the
+// service runs on. Record data is stored as JSON, and reading, casting and
+// indexing it is spelled differently by each database.
+package dialect
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Type is a SQL type a JSON value is cast to before it is compared, sorted
+// or aggregated.
+type Type int
+
+const (
+	Numeric   Type = iota // exact numbers, used for comparisons and sorting
+	Float                 // floating point results of aggregates
+	Boolean               // true/false
+	Timestamp             // dates and times
+	Text                  // text, e.g. to group values of any type
+)
+
+// Dialect produces the database specific parts of queries and migrations.
+// SQL fragments may contain ? placeholders; keys and values are always bound
+// as arguments, never written into the SQL.
+type Dialect interface {
+	// Name is the name of the gorm dialector the dialect belongs to.
+	Name() string
+
+	// JSONText reads the key bound to its placeholder from a JSON column,
+	// as text. Missing keys and JSON null read as NULL.
+	JSONText(column string) string
+	// JSONValue reads the key bound to its placeholder from a JSON column,
+	// as JSON.
+	JSONValue(column string) string
+	// Cast converts the result of expr to t.
+	Cast(expr string, t Type) string
+	// SafeCast converts the text read by expr to t like Cast, but gives
+	// NULL instead of failing when the text is not a value of t. expr may
+	// appear more than once in the result.
+	SafeCast(expr string, t Type) string
+	// Median is the aggregate computing the median of the numbers read by
+	// expr.
+	Median(expr string) string
+	// DateBucket truncates the date or time read by expr to the start of
+	// its day, week (starting on Monday), month or year and formats it as
+	// YYYY-MM-DD. unit must be one of "day", "week", "month" and "year".
+	// Like SafeCast, text that is not a date gives NULL and expr may appear
+	// more than once.
+	DateBucket(expr string, unit string) string
+	// Param is the placeholder of a value compared against Cast(expr, t).
+	Param(t Type) string
+	// ArrayContains is a condition that holds when the JSON array read by
+	// array contains the value bound to its placeholder. The value must be
+	// encoded with ArrayElement.
+	ArrayContains(array string) string
+	// ArrayElement encodes a value for ArrayContains.
+	ArrayElement(value string) interface{}
+
+	// ColumnExists reports whether table has column.
+	ColumnExists(db *gorm.DB, table, column string) (bool, error)
+	// CreateJSONIndex creates an index over a JSON column, if the database
+	// has a kind of index that helps queries on JSON keys.
+	CreateJSONIndex(db *gorm.DB, table, column, name string) error
+	// SetNotNull adds a NOT NULL constraint to an existing column, if the
+	// database can alter columns in place.
+	SetNotNull(db *gorm.DB, table, column string) error
+
+	// CreateSearchIndex creates the records_search table, which holds the
+	// text of every record's fields of the given types, and the triggers
+	// that keep it up to date as records are written. Records written before
+	// are indexed too. Updating a record's data, even to the same value,
+	// indexes it again.
+	CreateSearchIndex(db *gorm.DB, fieldTypes []string) error
+	// Search is a query listing the records matching a full-text search as
+	// record_id and score, higher scores matching better. Every placeholder
+	// takes the search encoded with SearchQuery.
+	Search() string
+	// SearchQuery encodes a search for Search.
+	SearchQuery(search string) interface{}
+}
+
+var (
+	// Postgres is the dialect of PostgreSQL, the production database.
+	Postgres Dialect = postgresDialect{}
+	// SQLite is the dialect of SQLite, used for tests, local development
+	// and small single-binary deployments.
+	SQLite Dialect = sqliteDialect{}
+)
+
+// For returns the dialect of the database db is connected to. Unknown
+// databases are treated as PostgreSQL.
+func For(db *gorm.DB) Dialect {
+	if db != nil && db.Dialector != nil && db.Dialector.Name() == SQLite.Name() {
+		return SQLite
+	}
+	return Postgres
+}
+
+// literalList writes values as a list of SQL string literals, for DDL that
+// cannot bind arguments.
+func literalList(values []string) string {
+	literals := make([]string, len(values))
+	for i, value := range values {
+		literals[i] = "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return strings.Join(literals, ", ")
+}
@@ -0,0 +1,156 @@
+package dialect
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) JSONText(column string) string { return column + " ->> ?" }
+
+func (postgresDialect) JSONValue(column string) string { return column + " -> ?" }
+
+func (postgresDialect) Cast(expr string, t Type) string {
+	switch t {
+	case Numeric:
+		return "(" + expr + ")::numeric"
+	case Float:
+		return "(" + expr + ")::float8"
+	case Boolean:
+		return "(" + expr + ")::boolean"
+	case Timestamp:
+		return "(" + expr + ")::timestamp"
+	case Text:
+		return "(" + expr + ")::text"
+	}
+	return expr
+}
+
+// Patterns of the text SafeCast accepts. They avoid ? so that it is not
+// taken for a placeholder.
+const (
+	numberPattern = `'^-{0,1}[0-9]+(\.[0-9]+){0,1}([eE][-+]{0,1}[0-9]+){0,1}$'`
+	datePattern   = `'^[0-9]{4}-[0-9]{2}-[0-9]{2}'`
+)
+
+func (d postgresDialect) SafeCast(expr string, t Type) string {
+	switch t {
+	case Numeric, Float:
+		return "CASE WHEN " + expr + " ~ " + numberPattern + " THEN " + d.Cast(expr, t) + " END"
+	case Boolean:
+		return "CASE WHEN " + expr + " IN ('true', 'false') THEN " + d.Cast(expr, t) + " END"
+	case Timestamp:
+		return "CASE WHEN " + expr + " ~ " + datePattern + " THEN " + d.Cast(expr, t) + " END"
+	}
+	return d.Cast(expr, t)
+}
+
+func (postgresDialect) Median(expr string) string {
+	return "percentile_cont(0.5) WITHIN GROUP (ORDER BY " + expr + ")"
+}
+
+func (d postgresDialect) DateBucket(expr string, unit string) string {
+	return "to_char(date_trunc('" + unit + "', " + d.SafeCast(expr, Timestamp) + "), 'YYYY-MM-DD')"
+}
+
+func (postgresDialect) Param(Type) string { return "?" }
+
+func (postgresDialect) ArrayContains(array string) string {
+	return "COALESCE(" + array + ", '[]'::jsonb) @> ?::jsonb"
+}
+
+func (postgresDialect) ArrayElement(value string) interface{} {
+	encoded, _ := json.Marshal([]string{value})
+	return string(encoded)
+}
+
+func (postgresDialect) ColumnExists(db *gorm.DB, table, column string) (bool, error) {
+	var count int64
+	err := db.Raw(`
+		SELECT COUNT(*)
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+		AND table_name = ?
+		AND column_name = ?
+	`, table, column).Scan(&count).Error
+	return count > 0, err
+}
+
+// CreateJSONIndex creates a GIN index, which serves containment and key
+// existence queries on jsonb.
+func (postgresDialect) CreateJSONIndex(db *gorm.DB, table, column, name string) error {
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM pg_indexes WHERE tablename = ? AND indexname = ?", table, name).Scan(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s USING GIN (%s)", name, table, column)).Error
+}
+
+func (postgresDialect) SetNotNull(db *gorm.DB, table, column string) error {
+	return db.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", table, column)).Error
+}
+
+// CreateSearchIndex keeps a tsvector of each record's text for word
+// searches and the text itself, trigram indexed, for fuzzy ones.
+func (postgresDialect) CreateSearchIndex(db *gorm.DB, fieldTypes []string) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE TABLE IF NOT EXISTS records_search (
+			record_id uuid PRIMARY KEY REFERENCES records (id) ON DELETE CASCADE,
+			document text NOT NULL,
+			vector tsvector NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_records_search_vector ON records_search USING GIN (vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_records_search_document ON records_search USING GIN (document gin_trgm_ops)`,
+		// Strings and lists of strings stored under the keys of the
+		// table's fields of the searched types
+		`CREATE OR REPLACE FUNCTION records_search_refresh() RETURNS trigger AS $$
+		DECLARE
+			doc text;
+		BEGIN
+			SELECT coalesce(string_agg(v.value, ' '), '') INTO doc
+			FROM fields f
+			CROSS JOIN LATERAL jsonb_array_elements_text(
+				CASE jsonb_typeof(NEW.data -> f.key)
+					WHEN 'array' THEN NEW.data -> f.key
+					WHEN 'string' THEN jsonb_build_array(NEW.data -> f.key)
+					ELSE '[]'::jsonb
+				END) AS v(value)
+			WHERE f.table_id = NEW.table_id AND f.deleted_at IS NULL
+			AND f.type IN (` + literalList(fieldTypes) + `);
+
+			INSERT INTO records_search (record_id, document, vector)
+			VALUES (NEW.id, doc, to_tsvector('simple', doc))
+			ON CONFLICT (record_id) DO UPDATE SET document = EXCLUDED.document, vector = EXCLUDED.vector;
+			RETURN NULL;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS records_search_refresh ON records`,
+		`CREATE TRIGGER records_search_refresh AFTER INSERT OR UPDATE OF data ON records
+			FOR EACH ROW EXECUTE FUNCTION records_search_refresh()`,
+		`UPDATE records SET data = data WHERE id NOT IN (SELECT record_id FROM records_search)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search matches whole words, ranked by ts_rank, and falls back to trigram
+// word similarity for misspellings and partial words.
+func (postgresDialect) Search() string {
+	return "SELECT record_id, ts_rank(vector, plainto_tsquery('simple', ?)) + word_similarity(?, document) AS score " +
+		"FROM records_search WHERE vector @@ plainto_tsquery('simple', ?) OR ? <% document"
+}
+
+func (postgresDialect) SearchQuery(search string) interface{} { return search }
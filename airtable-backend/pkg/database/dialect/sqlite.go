@@ -0,0 +1,116 @@
+package dialect
+
+import (
+	"gorm.io/gorm"
+)
+
+// sqliteDialect relies on the JSON functions built into SQLite 3.38 and
+// later. ->> returns JSON numbers and booleans as SQL numbers, true and
+// false being 1 and 0.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) JSONText(column string) string { return column + " ->> ?" }
+
+func (sqliteDialect) JSONValue(column string) string { return column + " -> ?" }
+
+func (sqliteDialect) Cast(expr string, t Type) string {
+	switch t {
+	case Numeric, Float:
+		return "CAST(" + expr + " AS REAL)"
+	case Timestamp:
+		// datetime normalises the ISO 8601 forms so they compare as text
+		return "datetime(" + expr + ")"
+	case Text:
+		return "CAST(" + expr + " AS TEXT)"
+	}
+	// Booleans already read as 1 and 0, which is how Go's bool is bound
+	return expr
+}
+
+func (d sqliteDialect) SafeCast(expr string, t Type) string {
+	switch t {
+	case Numeric, Float:
+		// Only JSON numbers, which ->> reads as integer or real
+		return "CASE WHEN typeof(" + expr + ") IN ('integer', 'real') THEN " + expr + " END"
+	}
+	// datetime gives NULL for text that is not a date
+	return d.Cast(expr, t)
+}
+
+// Median uses the median aggregate registered by OpenSQLite.
+func (sqliteDialect) Median(expr string) string { return "median(" + expr + ")" }
+
+func (sqliteDialect) DateBucket(expr string, unit string) string {
+	switch unit {
+	case "week":
+		// The next Sunday (or the day itself), then back to its Monday
+		return "date(" + expr + ", 'weekday 0', '-6 days')"
+	case "month":
+		return "strftime('%Y-%m-01', " + expr + ")"
+	case "year":
+		return "strftime('%Y-01-01', " + expr + ")"
+	}
+	return "date(" + expr + ")"
+}
+
+func (d sqliteDialect) Param(t Type) string {
+	if t == Timestamp {
+		return d.Cast("?", t)
+	}
+	return "?"
+}
+
+func (sqliteDialect) ArrayContains(array string) string {
+	return "EXISTS (SELECT 1 FROM json_each(" + array + ") WHERE value = ?)"
+}
+
+func (sqliteDialect) ArrayElement(value string) interface{} { return value }
+
+func (sqliteDialect) ColumnExists(db *gorm.DB, table, column string) (bool, error) {
+	var count int64
+	err := db.Raw("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count).Error
+	return count > 0, err
+}
+
+// CreateJSONIndex does nothing: SQLite can only index expressions over a
+// fixed key, and field keys are only known at run time.
+func (sqliteDialect) CreateJSONIndex(*gorm.DB, string, string, string) error { return nil }
+
+// SetNotNull does nothing: SQLite cannot change the constraints of an
+// existing column.
+func (sqliteDialect) SetNotNull(*gorm.DB, string, string) error { return nil }
+
+// searchDocument is the text of the searched fields of the record NEW, for
+// the triggers maintaining records_search.
+func searchDocument(fieldTypes []string) string {
+	fields := `JOIN fields f ON f.key = e.key AND f.table_id = NEW.table_id AND f.deleted_at IS NULL
+		AND f.type IN (` + literalList(fieldTypes) + `)`
+	return `(SELECT coalesce(group_concat(value, ' '), '') FROM (
+		SELECT e.value FROM json_each(NEW.data) e ` + fields + ` WHERE e.type = 'text'
+		UNION ALL
+		SELECT a.value FROM json_each(NEW.data) e ` + fields + `, json_each(e.value) a
+		WHERE e.type = 'array' AND a.type = 'text'))`
+}
+
+// CreateSearchIndex creates records_search as described by
+// searchTableSchema and fills it from triggers on records.
+func (sqliteDialect) CreateSearchIndex(db *gorm.DB, fieldTypes []string) error {
+	insert := `INSERT INTO records_search (record_id, content) SELECT NEW.id, ` + searchDocument(fieldTypes) + `;`
+	statements := []string{
+		searchTableSchema,
+		`CREATE TRIGGER IF NOT EXISTS records_search_insert AFTER INSERT ON records BEGIN ` + insert + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS records_search_update AFTER UPDATE OF data ON records BEGIN
+			DELETE FROM records_search WHERE record_id = OLD.id; ` + insert + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS records_search_delete AFTER DELETE ON records BEGIN
+			DELETE FROM records_search WHERE record_id = OLD.id; END`,
+		`UPDATE records SET data = data WHERE id NOT IN (SELECT record_id FROM records_search)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
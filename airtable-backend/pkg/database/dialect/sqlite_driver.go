@@ -0,0 +1,125 @@
+package dialect
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SQLiteDriverName is the database/sql driver OpenSQLite connects with:
+// go-sqlite3 plus the aggregate functions PostgreSQL has and SQLite lacks.
+const SQLiteDriverName = "sqlite3_airtable"
+
+var registerSQLiteDriver sync.Once
+
+// OpenSQLite returns a gorm dialector for the SQLite database dsn. Use it
+// instead of sqlite.Open so that queries can use median, stddev and
+// search_rank.
+func OpenSQLite(dsn string) gorm.Dialector {
+	registerSQLiteDriver.Do(func() {
+		sql.Register(SQLiteDriverName, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := conn.RegisterAggregator("median", newMedianAggregate, true); err != nil {
+					return err
+				}
+				if err := conn.RegisterAggregator("stddev", newStddevAggregate, true); err != nil {
+					return err
+				}
+				return conn.RegisterFunc("search_rank", searchRank, true)
+			},
+		})
+	})
+	return sqlite.New(sqlite.Config{DriverName: SQLiteDriverName, DSN: dsn})
+}
+
+// numericValue reports the value of a numeric SQL value; NULL and text are
+// skipped the way PostgreSQL's aggregates skip NULL.
+func numericValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// medianAggregate is median(x): the middle value, or the mean of the two
+// middle values, like PostgreSQL's percentile_cont(0.5).
+type medianAggregate struct {
+	values []float64
+}
+
+func newMedianAggregate() *medianAggregate { return &medianAggregate{} }
+
+func (a *medianAggregate) Step(v interface{}) {
+	if n, ok := numericValue(v); ok {
+		a.values = append(a.values, n)
+	}
+}
+
+func (a *medianAggregate) Done() interface{} {
+	if len(a.values) == 0 {
+		return nil
+	}
+	sort.Float64s(a.values)
+	mid := len(a.values) / 2
+	if len(a.values)%2 == 1 {
+		return a.values[mid]
+	}
+	return (a.values[mid-1] + a.values[mid]) / 2
+}
+
+// stddevAggregate is stddev(x): the sample standard deviation, like
+// PostgreSQL's stddev. It is computed with Welford's method.
+type stddevAggregate struct {
+	count    int
+	mean, m2 float64
+}
+
+func newStddevAggregate() *stddevAggregate { return &stddevAggregate{} }
+
+func (a *stddevAggregate) Step(v interface{}) {
+	n, ok := numericValue(v)
+	if !ok {
+		return
+	}
+	a.count++
+	delta := n - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (n - a.mean)
+}
+
+func (a *stddevAggregate) Done() interface{} {
+	if a.count < 2 {
+		return nil
+	}
+	return math.Sqrt(a.m2 / float64(a.count-1))
+}
+
+// searchRank is search_rank(content, search), which ranks content for a
+// search when FTS5 is not available: 0 unless every word of search occurs
+// in content, ignoring case, and otherwise the number of occurrences
+// relative to the length of content.
+func searchRank(content, search string) float64 {
+	content = strings.ToLower(content)
+	words := strings.Fields(strings.ToLower(search))
+	if len(words) == 0 {
+		return 0
+	}
+	hits := 0
+	for _, word := range words {
+		n := strings.Count(content, word)
+		if n == 0 {
+			return 0
+		}
+		hits += n
+	}
+	return float64(hits) / float64(1+len(strings.Fields(content)))
+}
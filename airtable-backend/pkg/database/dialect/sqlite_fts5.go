@@ -0,0 +1,27 @@
+//go:build sqlite_fts5 || fts5
+
+package dialect
+
+import (
+	"strings"
+)
+
+// With the FTS5 extension compiled into go-sqlite3, records_search is a
+// full-text index ranked with BM25. Record IDs are stored but not indexed.
+const searchTableSchema = `CREATE VIRTUAL TABLE IF NOT EXISTS records_search USING fts5(
+	record_id UNINDEXED, content, tokenize = 'unicode61 remove_diacritics 2')`
+
+// bm25 is lower for better matches.
+func (sqliteDialect) Search() string {
+	return "SELECT record_id, -bm25(records_search) AS score FROM records_search WHERE records_search MATCH ?"
+}
+
+// SearchQuery quotes every word of the search so that FTS5 does not read
+// it as query syntax, and matches it as a prefix. All words must match.
+func (sqliteDialect) SearchQuery(search string) interface{} {
+	words := strings.Fields(search)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,14 @@
+//go:build !(sqlite_fts5 || fts5)
+
+package dialect
+
+// go-sqlite3 leaves FTS5 out unless built with the sqlite_fts5 tag. Without
+// it, records_search is a plain table searched with search_rank.
+const searchTableSchema = `CREATE TABLE IF NOT EXISTS records_search (
+	record_id TEXT PRIMARY KEY, content TEXT NOT NULL)`
+
+func (sqliteDialect) Search() string {
+	return "SELECT record_id, score FROM (SELECT record_id, search_rank(content, ?) AS score FROM records_search) WHERE score > 0"
+}
+
+func (sqliteDialect) SearchQuery(search string) interface{} { return search }
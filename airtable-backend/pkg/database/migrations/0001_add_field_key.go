@@ -3,25 +3,26 @@ package migrations
 import (
 	"log"
 
+	"airtable-backend/pkg/database/dialect"
+
 	"gorm.io/gorm"
 )
 
 // AddFieldKey adds the key column to the fields table
 func AddFieldKey(db *gorm.DB) error {
-	// Check if the column exists using PostgreSQL information_schema
-	var count int
-	err := db.Raw(`
-		SELECT COUNT(*)
-		FROM information_schema.columns
-		WHERE table_name = 'fields'
-		AND column_name = 'key'
-	`).Scan(&count).Error
+	// A new database gets the column when the fields table is created
+	if !db.Migrator().HasTable("fields") {
+		return nil
+	}
+
+	d := dialect.For(db)
+	exists, err := d.ColumnExists(db, "fields", "key")
 	if err != nil {
 		log.Printf("Failed to check if key column exists: %v", err)
 		return err
 	}
 
-	if count == 0 {
+	if !exists {
 		err = db.Exec("ALTER TABLE fields ADD COLUMN key VARCHAR(255)").Error
 		if err != nil {
 			log.Printf("Failed to add key column: %v", err)
@@ -42,10 +43,5 @@ func AddFieldKey(db *gorm.DB) error {
 	}
 
 	// Step 4: Make the column NOT NULL
-	err = db.Exec(`ALTER TABLE fields ALTER COLUMN key SET NOT NULL`).Error
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return d.SetNotNull(db, "fields", "key")
 }
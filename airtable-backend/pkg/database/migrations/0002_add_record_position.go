@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"log"
+
+	"airtable-backend/pkg/database/dialect"
+
+	"gorm.io/gorm"
+)
+
+// AddRecordPosition adds the position column to the records table and
+// numbers the records of each table in the order they were created. The
+// unique index over table_id and position is left to AutoMigrate.
+func AddRecordPosition(db *gorm.DB) error {
+	// A new database gets the column when the records table is created
+	if !db.Migrator().HasTable("records") {
+		return nil
+	}
+
+	exists, err := dialect.For(db).ColumnExists(db, "records", "position")
+	if err != nil {
+		log.Printf("Failed to check if position column exists: %v", err)
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("ALTER TABLE records ADD COLUMN position DOUBLE PRECISION NOT NULL DEFAULT 0").Error
+		if err != nil {
+			log.Printf("Failed to add position column: %v", err)
+			return err
+		}
+
+		return tx.Exec(`UPDATE records SET position = ranked.n
+			FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY table_id ORDER BY created_at, id) AS n FROM records) AS ranked
+			WHERE records.id = ranked.id`).Error
+	})
+}
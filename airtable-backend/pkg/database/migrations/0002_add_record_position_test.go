@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAddRecordPosition(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Create records table without the position column
+	err := db.Exec(`CREATE TABLE records (
+		id TEXT PRIMARY KEY,
+		table_id TEXT NOT NULL,
+		data TEXT,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create records table: %v", err)
+	}
+
+	// Two tables, records inserted out of creation order
+	first, second := uuid.NewString(), uuid.NewString()
+	records := []struct {
+		id, tableID, createdAt string
+	}{
+		{uuid.NewString(), first, "2024-01-03 00:00:00"},
+		{uuid.NewString(), first, "2024-01-01 00:00:00"},
+		{uuid.NewString(), second, "2024-01-02 00:00:00"},
+		{uuid.NewString(), first, "2024-01-02 00:00:00"},
+	}
+	for _, record := range records {
+		err := db.Exec("INSERT INTO records (id, table_id, data, created_at) VALUES (?, ?, '{}', ?)",
+			record.id, record.tableID, record.createdAt).Error
+		if err != nil {
+			t.Fatalf("Failed to create test record: %v", err)
+		}
+	}
+
+	// Run migration twice; the second run leaves the positions alone
+	for i := 0; i < 2; i++ {
+		if err := AddRecordPosition(db); err != nil {
+			t.Fatalf("Migration failed: %v", err)
+		}
+	}
+
+	expected := []float64{3, 1, 1, 2}
+	for i, record := range records {
+		var position float64
+		if err := db.Raw("SELECT position FROM records WHERE id = ?", record.id).Scan(&position).Error; err != nil {
+			t.Fatalf("Failed to read position: %v", err)
+		}
+		if position != expected[i] {
+			t.Errorf("Expected record %d at position %v, got %v", i, expected[i], position)
+		}
+	}
+}
@@ -16,6 +16,7 @@ func RunMigrations(db *gorm.DB) error {
 	// Run subsequent migrations
 	migrations := []func(*gorm.DB) error{
 		AddFieldKey,
+		AddRecordPosition,
 		// Add more migrations here as needed
 	}
 
@@ -3,11 +3,12 @@ package migrations
 import (
 	"testing"
 
+	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func setupTestDB(t *testing.T) *gorm.DB {
+func setupMigratedDB(t *testing.T) *gorm.DB {
 	// Create a temporary test database
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
@@ -23,7 +24,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 }
 
 func TestInitialSchema(t *testing.T) {
-	db := setupTestDB(t)
+	db := setupMigratedDB(t)
 
 	// Verify tables were created
 	var tables []struct {
@@ -51,41 +52,44 @@ func TestInitialSchema(t *testing.T) {
 	}
 }
 
-func TestAddFieldKey(t *testing.T) {
-	db := setupTestDB(t)
+func TestRunMigrations_AddFieldKeyAgain(t *testing.T) {
+	db := setupMigratedDB(t)
 
 	// Create a test table
 	table := struct {
-		ID   uint
+		ID   string
 		Name string
 	}{
+		ID:   uuid.NewString(),
 		Name: "Test Table",
 	}
 	if err := db.Table("tables").Create(&table).Error; err != nil {
 		t.Fatalf("Failed to create test table: %v", err)
 	}
 
-	// Create a test field without a key
+	// The initial schema already has the key column
 	field := struct {
-		ID      uint
-		TableID uint
+		ID      string
+		TableID string
 		Name    string
+		Key     string
 		Type    string
 	}{
+		ID:      uuid.NewString(),
 		TableID: table.ID,
 		Name:    "Test Field",
+		Key:     "test_field",
 		Type:    "text",
 	}
 	if err := db.Table("fields").Create(&field).Error; err != nil {
 		t.Fatalf("Failed to create test field: %v", err)
 	}
 
-	// Run the migration
+	// Running the migration again keeps existing keys
 	if err := AddFieldKey(db); err != nil {
 		t.Fatalf("Failed to run AddFieldKey migration: %v", err)
 	}
 
-	// Verify the field has a key
 	var updatedField struct {
 		Key string
 	}
@@ -93,7 +97,7 @@ func TestAddFieldKey(t *testing.T) {
 		t.Fatalf("Failed to query updated field: %v", err)
 	}
 
-	if updatedField.Key == "" {
-		t.Error("Field key was not set after migration")
+	if updatedField.Key != field.Key {
+		t.Errorf("Expected key %s, got %s", field.Key, updatedField.Key)
 	}
 }
@@ -0,0 +1,116 @@
+package formula
+
+import "fmt"
+
+type checker struct {
+	fields map[string]Type
+}
+
+func (c *checker) check(n node) (Type, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return TypeNumber, nil
+	case *stringLit:
+		return TypeText, nil
+	case *boolLit:
+		return TypeBoolean, nil
+
+	case *fieldRef:
+		t, ok := c.fields[n.key]
+		if !ok {
+			return "", fmt.Errorf("unknown field {%s}", n.key)
+		}
+		return t, nil
+
+	case *unaryExpr:
+		t, err := c.check(n.operand)
+		if err != nil {
+			return "", err
+		}
+		if t != TypeNumber {
+			return "", fmt.Errorf("unary %s expects a number, got %s", n.op, t)
+		}
+		return TypeNumber, nil
+
+	case *binaryExpr:
+		left, err := c.check(n.left)
+		if err != nil {
+			return "", err
+		}
+		right, err := c.check(n.right)
+		if err != nil {
+			return "", err
+		}
+		n.leftType = left
+		return checkBinary(n.op, left, right)
+
+	case *callExpr:
+		fn, ok := functions[n.name]
+		if !ok {
+			return "", fmt.Errorf("unknown function %s", n.name)
+		}
+		if len(n.args) < fn.minArgs || (fn.maxArgs >= 0 && len(n.args) > fn.maxArgs) {
+			return "", fmt.Errorf("%s expects %s, got %d", n.name, arityString(fn.minArgs, fn.maxArgs), len(n.args))
+		}
+		argTypes := make([]Type, len(n.args))
+		for i, arg := range n.args {
+			t, err := c.check(arg)
+			if err != nil {
+				return "", err
+			}
+			argTypes[i] = t
+		}
+		t, err := fn.check(argTypes)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", n.name, err)
+		}
+		return t, nil
+	}
+
+	return "", fmt.Errorf("unsupported expression")
+}
+
+func checkBinary(op string, left, right Type) (Type, error) {
+	switch op {
+	case "&":
+		return TypeText, nil
+
+	case "+", "-":
+		switch {
+		case left == TypeNumber && right == TypeNumber:
+			return TypeNumber, nil
+		case left == TypeDate && right == TypeNumber:
+			return TypeDate, nil
+		case op == "-" && left == TypeDate && right == TypeDate:
+			return TypeNumber, nil
+		}
+
+	case "*", "/", "%":
+		if left == TypeNumber && right == TypeNumber {
+			return TypeNumber, nil
+		}
+
+	case "=", "!=":
+		if left == right {
+			return TypeBoolean, nil
+		}
+
+	case "<", ">", "<=", ">=":
+		if left == right && left != TypeBoolean {
+			return TypeBoolean, nil
+		}
+	}
+
+	return "", fmt.Errorf("operator %s cannot be applied to %s and %s", op, left, right)
+}
+
+func arityString(min, max int) string {
+	switch {
+	case max < 0:
+		return fmt.Sprintf("at least %d argument(s)", min)
+	case min == max:
+		return fmt.Sprintf("%d argument(s)", min)
+	default:
+		return fmt.Sprintf("%d to %d arguments", min, max)
+	}
+}
@@ -0,0 +1,275 @@
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDivisionByZero is returned when a formula divides by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// dateLayouts are the formats accepted when reading date field values.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+type evaluator struct {
+	values     map[string]interface{}
+	fieldTypes map[string]Type
+}
+
+// eval returns float64, string, bool, time.Time or nil (blank).
+func (ev *evaluator) eval(n node) (interface{}, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return n.value, nil
+	case *stringLit:
+		return n.value, nil
+	case *boolLit:
+		return n.value, nil
+
+	case *fieldRef:
+		return coerceFieldValue(ev.values[n.key], ev.fieldTypes[n.key])
+
+	case *unaryExpr:
+		v, err := ev.eval(n.operand)
+		if err != nil {
+			return nil, err
+		}
+		num := toNumber(v)
+		if n.op == "-" {
+			return -num, nil
+		}
+		return num, nil
+
+	case *binaryExpr:
+		left, err := ev.eval(n.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := ev.eval(n.right)
+		if err != nil {
+			return nil, err
+		}
+		if n.leftType == TypeDate && (n.op == "+" || n.op == "-") && (left == nil || right == nil) {
+			return nil, nil // arithmetic on a blank date stays blank
+		}
+		return evalBinary(n.op, left, right)
+
+	case *callExpr:
+		return functions[n.name].eval(ev, n.args)
+	}
+
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+func evalBinary(op string, left, right interface{}) (interface{}, error) {
+	if op == "&" {
+		return toText(left) + toText(right), nil
+	}
+
+	// Date arithmetic: date ± days, date - date
+	if lt, ok := left.(time.Time); ok {
+		switch r := right.(type) {
+		case time.Time:
+			if op == "-" {
+				return lt.Sub(r).Hours() / 24, nil
+			}
+		default:
+			if op == "+" || op == "-" {
+				days := toNumber(r)
+				if op == "-" {
+					days = -days
+				}
+				return lt.Add(time.Duration(days * float64(24*time.Hour))), nil
+			}
+		}
+	}
+
+	switch op {
+	case "+", "-", "*", "/", "%":
+		a, b := toNumber(left), toNumber(right)
+		switch op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/":
+			if b == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return a / b, nil
+		case "%":
+			if b == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return math.Mod(a, b), nil
+		}
+
+	case "=", "!=", "<", ">", "<=", ">=":
+		cmp := compare(left, right)
+		switch op {
+		case "=":
+			return cmp == 0, nil
+		case "!=":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case ">":
+			return cmp > 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+// compare orders two values of the same formula type. Blank values compare as
+// the zero value of the other operand's type.
+func compare(left, right interface{}) int {
+	switch l := left.(type) {
+	case time.Time:
+		r, _ := right.(time.Time)
+		return l.Compare(r)
+	case bool:
+		if l == toBool(right) {
+			return 0
+		}
+		return 1
+	case string:
+		return strings.Compare(l, toText(right))
+	case nil:
+		switch right.(type) {
+		case nil:
+			return 0
+		case string:
+			return strings.Compare("", right.(string))
+		case time.Time:
+			return -1
+		case bool:
+			return compare(false, right)
+		}
+	}
+	a, b := toNumber(left), toNumber(right)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// coerceFieldValue converts a decoded JSON cell value to the runtime
+// representation of the field's formula type.
+func coerceFieldValue(v interface{}, t Type) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch t {
+	case TypeNumber:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case string:
+			if n == "" {
+				return nil, nil
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil {
+				return nil, fmt.Errorf("value %q is not a number", n)
+			}
+			return f, nil
+		case bool:
+			return toNumber(n), nil
+		}
+	case TypeText:
+		return toText(v), nil
+	case TypeBoolean:
+		return toBool(v), nil
+	case TypeDate:
+		switch d := v.(type) {
+		case time.Time:
+			return d, nil
+		case string:
+			if d == "" {
+				return nil, nil
+			}
+			return parseDate(d)
+		}
+	}
+	return nil, fmt.Errorf("value %v cannot be used as %s", v, t)
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("value %q is not a date", s)
+}
+
+func toNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case bool:
+		if n {
+			return 1
+		}
+		return 0
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f
+	}
+	return 0
+}
+
+func toText(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	case bool:
+		if s {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return s.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+func toBool(v interface{}) bool {
+	switch b := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return b
+	case float64:
+		return b != 0
+	case string:
+		return b != ""
+	case time.Time:
+		return !b.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+// Package formula implements the expression language used by formula fields.
+//
+// A formula references other fields of the same table by key using braces,
+// e.g. `IF({price} * {qty} > 100, "bulk", "retail")`. Formulas are parsed and
+// type-checked once when the field is saved and evaluated per record on read.
+package formula
+
+import (
+	"fmt"
+	"time"
+)
+
+// Type is the static type of a formula expression.
+type Type string
+
+const (
+	TypeNumber  Type = "number"
+	TypeText    Type = "text"
+	TypeBoolean Type = "boolean"
+	TypeDate    Type = "date"
+)
+
+// now is overridden in tests to get deterministic NOW()/TODAY() results.
+var now = time.Now
+
+// Expression is a parsed formula.
+type Expression struct {
+	source     string
+	root       node
+	fieldTypes map[string]Type
+	resultType Type
+}
+
+// Parse parses a formula source string. The result must be type-checked with
+// Check before it can be evaluated.
+func Parse(source string) (*Expression, error) {
+	root, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// Source returns the original formula text.
+func (e *Expression) Source() string {
+	return e.source
+}
+
+// References returns the unique field keys referenced by the formula, in
+// order of first appearance.
+func (e *Expression) References() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *fieldRef:
+			if !seen[n.key] {
+				seen[n.key] = true
+				keys = append(keys, n.key)
+			}
+		case *unaryExpr:
+			walk(n.operand)
+		case *binaryExpr:
+			walk(n.left)
+			walk(n.right)
+		case *callExpr:
+			for _, arg := range n.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e.root)
+	return keys
+}
+
+// Check type-checks the formula against the types of the fields it may
+// reference and returns the result type.
+func (e *Expression) Check(fields map[string]Type) (Type, error) {
+	c := &checker{fields: fields}
+	t, err := c.check(e.root)
+	if err != nil {
+		return "", err
+	}
+	e.fieldTypes = fields
+	e.resultType = t
+	return t, nil
+}
+
+// ResultType returns the type computed by Check.
+func (e *Expression) ResultType() Type {
+	return e.resultType
+}
+
+// Eval evaluates the formula against a record's values keyed by field key.
+// Dates are returned as RFC 3339 strings so the result can be placed directly
+// into a record's JSON data.
+func (e *Expression) Eval(values map[string]interface{}) (interface{}, error) {
+	if e.fieldTypes == nil {
+		return nil, fmt.Errorf("formula has not been type-checked")
+	}
+	ev := &evaluator{values: values, fieldTypes: e.fieldTypes}
+	result, err := ev.eval(e.root)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := result.(time.Time); ok {
+		return t.Format(time.RFC3339), nil
+	}
+	return result, nil
+}
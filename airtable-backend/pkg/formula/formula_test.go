@@ -0,0 +1,121 @@
+package formula
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFields = map[string]Type{
+	"price":  TypeNumber,
+	"qty":    TypeNumber,
+	"name":   TypeText,
+	"active": TypeBoolean,
+	"due":    TypeDate,
+	"start":  TypeDate,
+}
+
+func evalFormula(t *testing.T, source string, values map[string]interface{}) (interface{}, error) {
+	t.Helper()
+	expr, err := Parse(source)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = expr.Check(testFields)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return expr.Eval(values)
+}
+
+func TestEval_Arithmetic(t *testing.T) {
+	result, err := evalFormula(t, "{price} * {qty} + 10 / 4 - -1", map[string]interface{}{"price": 2.5, "qty": 4.0})
+	assert.NoError(t, err)
+	assert.Equal(t, 13.5, result)
+
+	result, err = evalFormula(t, "({price} + 1) * 2", map[string]interface{}{"price": "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, 8.0, result)
+
+	// Blank numbers behave as zero
+	result, err = evalFormula(t, "{price} + 1", map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, result)
+}
+
+func TestEval_DivisionByZero(t *testing.T) {
+	_, err := evalFormula(t, "{price} / {qty}", map[string]interface{}{"price": 1.0, "qty": 0.0})
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+}
+
+func TestEval_TextAndLogic(t *testing.T) {
+	result, err := evalFormula(t, `"Hello, " & UPPER({name}) & "!"`, map[string]interface{}{"name": "ada"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, ADA!", result)
+
+	result, err = evalFormula(t, `IF(AND({active}, {qty} >= 10), "bulk", "retail")`, map[string]interface{}{"active": true, "qty": 12.0})
+	assert.NoError(t, err)
+	assert.Equal(t, "bulk", result)
+
+	result, err = evalFormula(t, `IF(OR(NOT({active}), BLANK({name})), "skip")`, map[string]interface{}{"active": true})
+	assert.NoError(t, err)
+	assert.Equal(t, "skip", result)
+
+	result, err = evalFormula(t, `CONCAT({name}, "-", LEN({name}))`, map[string]interface{}{"name": "héllo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "héllo-5", result)
+}
+
+func TestEval_Dates(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	result, err := evalFormula(t, `DATEADD({due}, 1, "months")`, map[string]interface{}{"due": "2024-01-31"})
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-02T00:00:00Z", result)
+
+	result, err = evalFormula(t, `DATETIME_DIFF({due}, {start}, "days")`, map[string]interface{}{"due": "2024-01-10", "start": "2024-01-01T00:00:00Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, 9.0, result)
+
+	result, err = evalFormula(t, `YEAR(TODAY()) * 100 + MONTH(NOW())`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 202403.0, result)
+
+	result, err = evalFormula(t, `{due} + 1`, map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestCheck_Errors(t *testing.T) {
+	cases := map[string]string{
+		`{missing} + 1`:              "unknown field {missing}",
+		`{name} * 2`:                 "operator * cannot be applied to text and number",
+		`IF({active}, 1, "x")`:       "IF: branches must have the same type, got number and text",
+		`ROUND()`:                    "ROUND expects 1 to 2 arguments, got 0",
+		`NOPE(1)`:                    "unknown function NOPE",
+		`DATEADD({name}, 1, "days")`: "DATEADD: argument 1 must be date, got text",
+	}
+	for source, want := range cases {
+		expr, err := Parse(source)
+		if !assert.NoError(t, err, source) {
+			continue
+		}
+		_, err = expr.Check(testFields)
+		assert.EqualError(t, err, want, source)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, source := range []string{`1 +`, `"open`, `{open`, `(1 + 2`, `IF(1 2)`, `price`, `1 $ 2`} {
+		_, err := Parse(source)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	expr, err := Parse(`IF({a} > {b}, {a}, { c })`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, expr.References())
+}
@@ -0,0 +1,353 @@
+package formula
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// function describes a built-in formula function. Arguments are passed to
+// eval unevaluated so IF/AND/OR can short-circuit.
+type function struct {
+	minArgs int
+	maxArgs int // -1 for variadic
+	check   func(args []Type) (Type, error)
+	eval    func(ev *evaluator, args []node) (interface{}, error)
+}
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		// Logical
+		"IF": {minArgs: 2, maxArgs: 3, check: checkIf, eval: evalIf},
+		"AND": {minArgs: 1, maxArgs: -1, check: returns(TypeBoolean), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			for _, arg := range args {
+				v, err := ev.eval(arg)
+				if err != nil {
+					return nil, err
+				}
+				if !toBool(v) {
+					return false, nil
+				}
+			}
+			return true, nil
+		}},
+		"OR": {minArgs: 1, maxArgs: -1, check: returns(TypeBoolean), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			for _, arg := range args {
+				v, err := ev.eval(arg)
+				if err != nil {
+					return nil, err
+				}
+				if toBool(v) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}},
+		"NOT": {minArgs: 1, maxArgs: 1, check: returns(TypeBoolean), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			v, err := ev.eval(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return !toBool(v), nil
+		}},
+		"BLANK": {minArgs: 1, maxArgs: 1, check: returns(TypeBoolean), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			v, err := ev.eval(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return v == nil || v == "", nil
+		}},
+
+		// Text
+		"CONCAT": {minArgs: 1, maxArgs: -1, check: returns(TypeText), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			values, err := ev.evalAll(args)
+			if err != nil {
+				return nil, err
+			}
+			var sb strings.Builder
+			for _, v := range values {
+				sb.WriteString(toText(v))
+			}
+			return sb.String(), nil
+		}},
+		"LEN":   {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeText), eval: textFunc(func(s string) interface{} { return float64(len([]rune(s))) })},
+		"UPPER": {minArgs: 1, maxArgs: 1, check: expect(TypeText, TypeText), eval: textFunc(func(s string) interface{} { return strings.ToUpper(s) })},
+		"LOWER": {minArgs: 1, maxArgs: 1, check: expect(TypeText, TypeText), eval: textFunc(func(s string) interface{} { return strings.ToLower(s) })},
+		"TRIM":  {minArgs: 1, maxArgs: 1, check: expect(TypeText, TypeText), eval: textFunc(func(s string) interface{} { return strings.TrimSpace(s) })},
+		"LEFT": {minArgs: 2, maxArgs: 2, check: expect(TypeText, TypeText, TypeNumber), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			values, err := ev.evalAll(args)
+			if err != nil {
+				return nil, err
+			}
+			runes := []rune(toText(values[0]))
+			n := clampIndex(toNumber(values[1]), len(runes))
+			return string(runes[:n]), nil
+		}},
+		"RIGHT": {minArgs: 2, maxArgs: 2, check: expect(TypeText, TypeText, TypeNumber), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			values, err := ev.evalAll(args)
+			if err != nil {
+				return nil, err
+			}
+			runes := []rune(toText(values[0]))
+			n := clampIndex(toNumber(values[1]), len(runes))
+			return string(runes[len(runes)-n:]), nil
+		}},
+
+		// Numeric
+		"ROUND": {minArgs: 1, maxArgs: 2, check: expect(TypeNumber, TypeNumber, TypeNumber), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			values, err := ev.evalAll(args)
+			if err != nil {
+				return nil, err
+			}
+			precision := 0.0
+			if len(values) > 1 {
+				precision = toNumber(values[1])
+			}
+			scale := math.Pow(10, precision)
+			return math.Round(toNumber(values[0])*scale) / scale, nil
+		}},
+		"ABS":     {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeNumber), eval: numberFunc(math.Abs)},
+		"FLOOR":   {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeNumber), eval: numberFunc(math.Floor)},
+		"CEILING": {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeNumber), eval: numberFunc(math.Ceil)},
+		"SUM": {minArgs: 1, maxArgs: -1, check: allOf(TypeNumber), eval: reduceNumbers(func(values []float64) float64 {
+			sum := 0.0
+			for _, v := range values {
+				sum += v
+			}
+			return sum
+		})},
+		"AVERAGE": {minArgs: 1, maxArgs: -1, check: allOf(TypeNumber), eval: reduceNumbers(func(values []float64) float64 {
+			sum := 0.0
+			for _, v := range values {
+				sum += v
+			}
+			return sum / float64(len(values))
+		})},
+		"MIN": {minArgs: 1, maxArgs: -1, check: allOf(TypeNumber), eval: reduceNumbers(func(values []float64) float64 {
+			min := values[0]
+			for _, v := range values[1:] {
+				min = math.Min(min, v)
+			}
+			return min
+		})},
+		"MAX": {minArgs: 1, maxArgs: -1, check: allOf(TypeNumber), eval: reduceNumbers(func(values []float64) float64 {
+			max := values[0]
+			for _, v := range values[1:] {
+				max = math.Max(max, v)
+			}
+			return max
+		})},
+
+		// Date
+		"NOW": {minArgs: 0, maxArgs: 0, check: returns(TypeDate), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			return now().UTC(), nil
+		}},
+		"TODAY": {minArgs: 0, maxArgs: 0, check: returns(TypeDate), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			return now().UTC().Truncate(24 * time.Hour), nil
+		}},
+		"YEAR":    {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeDate), eval: datePart(func(t time.Time) int { return t.Year() })},
+		"MONTH":   {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeDate), eval: datePart(func(t time.Time) int { return int(t.Month()) })},
+		"DAY":     {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeDate), eval: datePart(func(t time.Time) int { return t.Day() })},
+		"WEEKDAY": {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeDate), eval: datePart(func(t time.Time) int { return int(t.Weekday()) })},
+		"HOUR":    {minArgs: 1, maxArgs: 1, check: expect(TypeNumber, TypeDate), eval: datePart(func(t time.Time) int { return t.Hour() })},
+		"DATEADD": {minArgs: 3, maxArgs: 3, check: expect(TypeDate, TypeDate, TypeNumber, TypeText), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			values, err := ev.evalAll(args)
+			if err != nil {
+				return nil, err
+			}
+			date, ok := values[0].(time.Time)
+			if !ok {
+				return nil, nil
+			}
+			return addToDate(date, int(toNumber(values[1])), toText(values[2]))
+		}},
+		"DATETIME_DIFF": {minArgs: 2, maxArgs: 3, check: expect(TypeNumber, TypeDate, TypeDate, TypeText), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			values, err := ev.evalAll(args)
+			if err != nil {
+				return nil, err
+			}
+			a, okA := values[0].(time.Time)
+			b, okB := values[1].(time.Time)
+			if !okA || !okB {
+				return nil, nil
+			}
+			unit := "days"
+			if len(values) > 2 {
+				unit = toText(values[2])
+			}
+			return dateDiff(a, b, unit)
+		}},
+		"DATESTR": {minArgs: 1, maxArgs: 1, check: expect(TypeText, TypeDate), eval: func(ev *evaluator, args []node) (interface{}, error) {
+			v, err := ev.eval(args[0])
+			if err != nil {
+				return nil, err
+			}
+			date, ok := v.(time.Time)
+			if !ok {
+				return "", nil
+			}
+			return date.Format("2006-01-02"), nil
+		}},
+	}
+}
+
+func (ev *evaluator) evalAll(args []node) ([]interface{}, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		v, err := ev.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func checkIf(args []Type) (Type, error) {
+	if len(args) == 3 && args[1] != args[2] {
+		return "", fmt.Errorf("branches must have the same type, got %s and %s", args[1], args[2])
+	}
+	return args[1], nil
+}
+
+func evalIf(ev *evaluator, args []node) (interface{}, error) {
+	cond, err := ev.eval(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if toBool(cond) {
+		return ev.eval(args[1])
+	}
+	if len(args) == 3 {
+		return ev.eval(args[2])
+	}
+	return nil, nil
+}
+
+// returns accepts any argument types and yields a fixed result type.
+func returns(result Type) func([]Type) (Type, error) {
+	return func([]Type) (Type, error) { return result, nil }
+}
+
+// expect checks positional argument types and yields a fixed result type.
+func expect(result Type, params ...Type) func([]Type) (Type, error) {
+	return func(args []Type) (Type, error) {
+		for i, arg := range args {
+			if i < len(params) && arg != params[i] {
+				return "", fmt.Errorf("argument %d must be %s, got %s", i+1, params[i], arg)
+			}
+		}
+		return result, nil
+	}
+}
+
+// allOf requires every argument to have the given type, which is also the result type.
+func allOf(t Type) func([]Type) (Type, error) {
+	return func(args []Type) (Type, error) {
+		for i, arg := range args {
+			if arg != t {
+				return "", fmt.Errorf("argument %d must be %s, got %s", i+1, t, arg)
+			}
+		}
+		return t, nil
+	}
+}
+
+func textFunc(fn func(string) interface{}) func(*evaluator, []node) (interface{}, error) {
+	return func(ev *evaluator, args []node) (interface{}, error) {
+		v, err := ev.eval(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(toText(v)), nil
+	}
+}
+
+func numberFunc(fn func(float64) float64) func(*evaluator, []node) (interface{}, error) {
+	return func(ev *evaluator, args []node) (interface{}, error) {
+		v, err := ev.eval(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(toNumber(v)), nil
+	}
+}
+
+func reduceNumbers(fn func([]float64) float64) func(*evaluator, []node) (interface{}, error) {
+	return func(ev *evaluator, args []node) (interface{}, error) {
+		values, err := ev.evalAll(args)
+		if err != nil {
+			return nil, err
+		}
+		numbers := make([]float64, len(values))
+		for i, v := range values {
+			numbers[i] = toNumber(v)
+		}
+		return fn(numbers), nil
+	}
+}
+
+func datePart(fn func(time.Time) int) func(*evaluator, []node) (interface{}, error) {
+	return func(ev *evaluator, args []node) (interface{}, error) {
+		v, err := ev.eval(args[0])
+		if err != nil {
+			return nil, err
+		}
+		date, ok := v.(time.Time)
+		if !ok {
+			return nil, nil
+		}
+		return float64(fn(date)), nil
+	}
+}
+
+func clampIndex(n float64, length int) int {
+	i := int(n)
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+func addToDate(date time.Time, n int, unit string) (interface{}, error) {
+	switch strings.ToLower(unit) {
+	case "years", "year":
+		return date.AddDate(n, 0, 0), nil
+	case "months", "month":
+		return date.AddDate(0, n, 0), nil
+	case "weeks", "week":
+		return date.AddDate(0, 0, 7*n), nil
+	case "days", "day":
+		return date.AddDate(0, 0, n), nil
+	case "hours", "hour":
+		return date.Add(time.Duration(n) * time.Hour), nil
+	case "minutes", "minute":
+		return date.Add(time.Duration(n) * time.Minute), nil
+	}
+	return nil, fmt.Errorf("unknown date unit %q", unit)
+}
+
+func dateDiff(a, b time.Time, unit string) (interface{}, error) {
+	d := a.Sub(b)
+	switch strings.ToLower(unit) {
+	case "years", "year":
+		return float64(a.Year() - b.Year()), nil
+	case "months", "month":
+		return float64((a.Year()-b.Year())*12 + int(a.Month()) - int(b.Month())), nil
+	case "weeks", "week":
+		return math.Trunc(d.Hours() / (24 * 7)), nil
+	case "days", "day":
+		return math.Trunc(d.Hours() / 24), nil
+	case "hours", "hour":
+		return math.Trunc(d.Hours()), nil
+	case "minutes", "minute":
+		return math.Trunc(d.Minutes()), nil
+	}
+	return nil, fmt.Errorf("unknown date unit %q", unit)
+}
@@ -0,0 +1,176 @@
+package formula
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// node is an element of the parsed formula syntax tree.
+type node interface{}
+
+type numberLit struct{ value float64 }
+type stringLit struct{ value string }
+type boolLit struct{ value bool }
+type fieldRef struct{ key string }
+
+type unaryExpr struct {
+	op      string
+	operand node
+}
+
+type binaryExpr struct {
+	op          string
+	left, right node
+	// leftType is filled in by the checker so evaluation can tell a blank
+	// date operand apart from a blank number.
+	leftType Type
+}
+
+type callExpr struct {
+	name string
+	args []node
+}
+
+// binaryPrecedence defines operator binding strength; higher binds tighter.
+var binaryPrecedence = map[string]int{
+	"=": 1, "!=": 1, "<": 1, ">": 1, "<=": 1, ">=": 1,
+	"&": 2,
+	"+": 3, "-": 3,
+	"*": 4, "/": 4, "%": 4,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseExpression implements precedence climbing for binary operators.
+func (p *parser) parseExpression(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if tok.kind != tokOperator {
+			return left, nil
+		}
+		prec, ok := binaryPrecedence[tok.text]
+		if !ok || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpression(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if tok.kind == tokOperator && (tok.text == "-" || tok.text == "+") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: tok.text, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return &numberLit{value: value}, nil
+
+	case tokString:
+		return &stringLit{value: tok.text}, nil
+
+	case tokField:
+		return &fieldRef{key: tok.text}, nil
+
+	case tokIdent:
+		if p.peek().kind != tokLParen {
+			switch tok.text {
+			case "TRUE":
+				return &boolLit{value: true}, nil
+			case "FALSE":
+				return &boolLit{value: false}, nil
+			}
+			return nil, fmt.Errorf("unknown identifier %q at position %d (field references must be wrapped in braces)", tok.text, tok.pos)
+		}
+		p.next() // consume '('
+		call := &callExpr{name: tok.text}
+		if p.peek().kind == tokRParen {
+			p.next()
+			return call, nil
+		}
+		for {
+			arg, err := p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			sep := p.next()
+			if sep.kind == tokRParen {
+				return call, nil
+			}
+			if sep.kind != tokComma {
+				return nil, fmt.Errorf("expected ',' or ')' in call to %s at position %d", tok.text, sep.pos)
+			}
+		}
+
+	case tokLParen:
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at position %d", closing.pos)
+		}
+		return inner, nil
+
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of formula")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
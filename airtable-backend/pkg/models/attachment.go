@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment 描述 file 字段单元格中的一个附件，文件内容保存在 BlobStore 中
+type Attachment struct {
+	ID        uuid.UUID `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mimeType"` // 根据文件内容识别
+	Checksum  string    `json:"checksum"` // 内容的 SHA-256（十六进制）
+	CreatedAt time.Time `json:"createdAt"`
+}
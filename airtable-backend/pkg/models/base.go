@@ -7,7 +7,7 @@ import (
 
 type Base struct {
 	gorm.Model
-	ID     uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey"` // 由 BeforeCreate 生成
 	Name   string
 	UserID uuid.UUID
 	Tables []Table // Has Many Tables
@@ -0,0 +1,40 @@
+package models
+
+import "github.com/google/uuid"
+
+// CalendarEvent 是日历中的一条记录。全天事件的 Start、End 为 YYYY-MM-DD（End 为最后一天），
+// 其他事件为所选时区的 RFC 3339 时间
+type CalendarEvent struct {
+	RecordID uuid.UUID `json:"recordId"`
+	Title    string    `json:"title"`
+	Start    string    `json:"start"`
+	End      string    `json:"end"`
+	AllDay   bool      `json:"allDay"`
+	Record   Record    `json:"record"`
+}
+
+// CalendarSpan 是事件在某一天中显示的部分，跨天的事件在每一天都有一段
+type CalendarSpan struct {
+	RecordID        uuid.UUID `json:"recordId"`
+	Start           string    `json:"start,omitempty"` // 当天的开始时间，全天事件为空
+	End             string    `json:"end,omitempty"`   // 当天的结束时间，全天事件为空
+	AllDay          bool      `json:"allDay"`
+	ContinuesBefore bool      `json:"continuesBefore"` // 事件在前一天已经开始
+	ContinuesAfter  bool      `json:"continuesAfter"`  // 事件持续到下一天
+}
+
+// CalendarDay 是日历中有事件的一天
+type CalendarDay struct {
+	Date   string         `json:"date"` // YYYY-MM-DD
+	Events []CalendarSpan `json:"events"`
+}
+
+// CalendarResult 是日历查询的结果：与时间窗口重叠的事件，以及按天展开的事件
+type CalendarResult struct {
+	TableID  uuid.UUID       `json:"tableId"`
+	TimeZone string          `json:"timeZone"`
+	Start    string          `json:"start"` // 窗口的第一天
+	End      string          `json:"end"`   // 窗口的最后一天
+	Events   []CalendarEvent `json:"events"`
+	Days     []CalendarDay   `json:"days"`
+}
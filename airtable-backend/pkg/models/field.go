@@ -1,7 +1,13 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -21,30 +27,143 @@ const (
 	FieldTypeLink    FieldType = "link"    // 新增：关联
 	FieldTypeFormula FieldType = "formula" // 新增：公式
 	FieldTypeAuto    FieldType = "auto"    // 新增：自动编号
+	FieldTypeLookup  FieldType = "lookup"  // 新增：查找关联记录的字段值
+	FieldTypeRollup  FieldType = "rollup"  // 新增：汇总关联记录的字段值
+
+	FieldTypeCurrency FieldType = "currency" // 金额，options.currencyCode / options.precision
+	FieldTypePercent  FieldType = "percent"  // 百分比，按小数存储（0.25 表示 25%）
+	FieldTypeRating   FieldType = "rating"   // 评分，1 到 options.max 的整数
+	FieldTypeEmail    FieldType = "email"
+	FieldTypeURL      FieldType = "url"
+	FieldTypePhone    FieldType = "phone"
+	FieldTypeDuration FieldType = "duration" // 时长，按秒存储
 )
 
+// ValueType 返回字段值的基础类型：currency、percent、rating、duration 和 auto 按 number
+// 存储和比较，email、url、phone 按 text
+func (t FieldType) ValueType() FieldType {
+	switch t {
+	case FieldTypeCurrency, FieldTypePercent, FieldTypeRating, FieldTypeDuration, FieldTypeAuto:
+		return FieldTypeNumber
+	case FieldTypeEmail, FieldTypeURL, FieldTypePhone:
+		return FieldTypeText
+	}
+	return t
+}
+
+// IsValid 判断是否为支持的字段类型
+func (t FieldType) IsValid() bool {
+	switch t {
+	case FieldTypeText, FieldTypeNumber, FieldTypeBoolean, FieldTypeDate,
+		FieldTypeFormula, FieldTypeLink, FieldTypeLookup, FieldTypeRollup,
+		FieldTypeAuto, FieldTypeFile, FieldTypeSelect, FieldTypeMulti,
+		FieldTypeCurrency, FieldTypePercent, FieldTypeRating, FieldTypeEmail,
+		FieldTypeURL, FieldTypePhone, FieldTypeDuration:
+		return true
+	}
+	return false
+}
+
 // ValidationRule 定义字段验证规则
 type ValidationRule struct {
 	Required    bool        `json:"required"`
-	MinLength   int         `json:"minLength,omitempty"`
+	MinLength   int         `json:"minLength,omitempty"` // 按字符（rune）计算
 	MaxLength   int         `json:"maxLength,omitempty"`
-	MinValue    float64     `json:"minValue,omitempty"`
-	MaxValue    float64     `json:"maxValue,omitempty"`
-	Pattern     string      `json:"pattern,omitempty"`
+	MinValue    *float64    `json:"minValue,omitempty"` // nil 表示不限制
+	MaxValue    *float64    `json:"maxValue,omitempty"`
+	MinDate     string      `json:"minDate,omitempty"` // date 类型：最早日期
+	MaxDate     string      `json:"maxDate,omitempty"` // date 类型：最晚日期
+	Pattern     string      `json:"pattern,omitempty"` // text 类型：正则表达式
+	Format      ValueFormat `json:"format,omitempty"`  // text 类型：email、url 或 phone
+	Unique      bool        `json:"unique,omitempty"`  // 同一表格中值不能重复
 	CustomError string      `json:"customError,omitempty"`
 	Options     []string    `json:"options,omitempty"` // 用于 select 和 multi 类型
 	Default     interface{} `json:"default,omitempty"` // 默认值
 }
 
+// Value implements driver.Valuer so the rule is stored as JSON.
+func (v ValidationRule) Value() (driver.Value, error) {
+	return marshalJSONColumn(v)
+}
+
+// Scan implements sql.Scanner for reading the JSON column back.
+func (v *ValidationRule) Scan(src interface{}) error {
+	return unmarshalJSONColumn(src, v)
+}
+
+// FieldOptions 保存字段类型相关的配置
+type FieldOptions struct {
+	Formula    string    `json:"formula,omitempty"`    // formula 类型：公式表达式
+	ResultType FieldType `json:"resultType,omitempty"` // formula 类型：类型检查得到的结果类型
+
+	LinkedTableID  *uuid.UUID `json:"linkedTableId,omitempty"`  // link 类型：关联的目标表
+	InverseFieldID *uuid.UUID `json:"inverseFieldId,omitempty"` // link 类型：目标表上的反向关联字段
+
+	LinkFieldID    *uuid.UUID        `json:"linkFieldId,omitempty"`    // lookup/rollup 类型：本表中的关联字段
+	LookupFieldID  *uuid.UUID        `json:"lookupFieldId,omitempty"`  // lookup/rollup 类型：关联表中被引用的字段
+	RollupFunction AggregateFunction `json:"rollupFunction,omitempty"` // rollup 类型：汇总函数
+
+	Choices []SelectOption `json:"choices,omitempty"` // select/multi 类型：可选项
+
+	CurrencyCode string `json:"currencyCode,omitempty"` // currency 类型：ISO 4217 货币代码
+	Precision    *int   `json:"precision,omitempty"`    // currency/percent 类型：保留的小数位数
+	Max          int    `json:"max,omitempty"`          // rating 类型：最高分
+}
+
+// SelectOption 是 select/multi 字段的一个选项，单元格中保存选项的 label
+type SelectOption struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Color string `json:"color,omitempty"`
+}
+
+// Value implements driver.Valuer so the options are stored as JSON.
+func (o FieldOptions) Value() (driver.Value, error) {
+	return marshalJSONColumn(o)
+}
+
+// Scan implements sql.Scanner for reading the JSON column back.
+func (o *FieldOptions) Scan(src interface{}) error {
+	return unmarshalJSONColumn(src, o)
+}
+
+func marshalJSONColumn(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func unmarshalJSONColumn(src interface{}, dest interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if len(data) == 0 {
+			return nil
+		}
+		return json.Unmarshal(data, dest)
+	case string:
+		if data == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(data), dest)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+}
+
 // Field 表示表格中的字段
 type Field struct {
 	ID          uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
-	TableID     uuid.UUID      `gorm:"type:uuid;not null" json:"tableId"`
+	TableID     uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_table_key" json:"tableId"`
 	Name        string         `gorm:"size:255;not null" json:"name"`
 	Key         string         `gorm:"size:255;not null;uniqueIndex:idx_table_key" json:"key"`
 	Type        FieldType      `gorm:"size:50;not null" json:"type"`
 	Description string         `gorm:"size:500" json:"description"`
 	Validation  ValidationRule `gorm:"type:jsonb" json:"validation"`
+	Options     FieldOptions   `gorm:"type:jsonb" json:"options"`
 	Order       int            `gorm:"not null;default:0" json:"order"` // 新增：排序字段
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
@@ -62,65 +181,99 @@ func (f *Field) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// Validate 验证字段值是否符合规则
+// Validate 验证字段值是否符合规则。设置了 CustomError 时用它代替默认的错误信息。
 func (f *Field) Validate(value interface{}) error {
+	if err := f.validate(value); err != nil {
+		if f.Validation.CustomError != "" {
+			return &ValidationError{Message: f.Validation.CustomError}
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *Field) validate(value interface{}) error {
+	rule := f.Validation
 	// 检查必填
-	if f.Validation.Required && value == nil {
+	if rule.Required && value == nil {
 		return &ValidationError{Message: "Field is required"}
 	}
 
 	// 根据字段类型进行验证
-	switch f.Type {
+	switch f.Type.ValueType() {
 	case FieldTypeText:
 		if str, ok := value.(string); ok {
-			if f.Validation.MinLength > 0 && len(str) < f.Validation.MinLength {
+			length := utf8.RuneCountInString(str)
+			if rule.MinLength > 0 && length < rule.MinLength {
 				return &ValidationError{Message: "Text is too short"}
 			}
-			if f.Validation.MaxLength > 0 && len(str) > f.Validation.MaxLength {
+			if rule.MaxLength > 0 && length > rule.MaxLength {
 				return &ValidationError{Message: "Text is too long"}
 			}
-			if f.Validation.Pattern != "" {
-				// TODO: 实现正则表达式验证
+			if rule.Pattern != "" {
+				re, err := compilePattern(rule.Pattern)
+				if err != nil {
+					return &ValidationError{Message: "Invalid validation pattern"}
+				}
+				if !re.MatchString(str) {
+					return &ValidationError{Message: "Text does not match the required pattern"}
+				}
+			}
+			if format := f.format(); format != "" {
+				if err := format.Check(str); err != nil {
+					return err
+				}
 			}
 		}
 	case FieldTypeNumber:
 		if num, ok := value.(float64); ok {
-			if f.Validation.MinValue != 0 && num < f.Validation.MinValue {
+			if rule.MinValue != nil && num < *rule.MinValue {
 				return &ValidationError{Message: "Number is too small"}
 			}
-			if f.Validation.MaxValue != 0 && num > f.Validation.MaxValue {
+			if rule.MaxValue != nil && num > *rule.MaxValue {
 				return &ValidationError{Message: "Number is too large"}
 			}
+			switch f.Type {
+			case FieldTypeRating:
+				if num != math.Trunc(num) || num < 1 || num > float64(f.RatingMax()) {
+					return &ValidationError{Message: fmt.Sprintf("Rating must be a whole number from 1 to %d", f.RatingMax())}
+				}
+			case FieldTypeDuration:
+				if num < 0 {
+					return &ValidationError{Message: "Duration cannot be negative"}
+				}
+			}
 		}
-	case FieldTypeSelect, FieldTypeMulti:
-		if options := f.Validation.Options; len(options) > 0 {
-			if f.Type == FieldTypeSelect {
-				if str, ok := value.(string); ok {
-					valid := false
-					for _, option := range options {
-						if str == option {
-							valid = true
-							break
-						}
-					}
-					if !valid {
-						return &ValidationError{Message: "Invalid option selected"}
-					}
+	case FieldTypeDate:
+		if str, ok := value.(string); ok {
+			date, err := ParseDate(str)
+			if err != nil {
+				return &ValidationError{Message: "Invalid date"}
+			}
+			if rule.MinDate != "" && dateBefore(date, rule.MinDate) {
+				return &ValidationError{Message: "Date is too early"}
+			}
+			if rule.MaxDate != "" && dateAfter(date, rule.MaxDate) {
+				return &ValidationError{Message: "Date is too late"}
+			}
+		}
+	case FieldTypeSelect:
+		if str, ok := value.(string); ok && str != "" && !f.hasOption(str) {
+			return &ValidationError{Message: "Invalid option selected"}
+		}
+	case FieldTypeMulti:
+		switch arr := value.(type) {
+		case []interface{}:
+			for _, item := range arr {
+				str, ok := item.(string)
+				if !ok || !f.hasOption(str) {
+					return &ValidationError{Message: "Invalid option selected"}
 				}
-			} else if f.Type == FieldTypeMulti {
-				if arr, ok := value.([]string); ok {
-					for _, val := range arr {
-						valid := false
-						for _, option := range options {
-							if val == option {
-								valid = true
-								break
-							}
-						}
-						if !valid {
-							return &ValidationError{Message: "Invalid option selected"}
-						}
-					}
+			}
+		case []string:
+			for _, str := range arr {
+				if !f.hasOption(str) {
+					return &ValidationError{Message: "Invalid option selected"}
 				}
 			}
 		}
@@ -129,6 +282,73 @@ func (f *Field) Validate(value interface{}) error {
 	return nil
 }
 
+// format 返回文本值需要满足的格式：email、url、phone 类型自带格式，其余使用 validation.format
+func (f *Field) format() ValueFormat {
+	switch f.Type {
+	case FieldTypeEmail:
+		return FormatEmail
+	case FieldTypeURL:
+		return FormatURL
+	case FieldTypePhone:
+		return FormatPhone
+	}
+	return f.Validation.Format
+}
+
+// RatingMax 返回 rating 字段的最高分，未设置时为 5
+func (f *Field) RatingMax() int {
+	if f.Options.Max > 0 {
+		return f.Options.Max
+	}
+	return 5
+}
+
+// DecimalPlaces 返回 currency/percent 字段保留的小数位数：金额默认 2 位，百分比默认 4 位（即百分数 2 位）
+func (f *Field) DecimalPlaces() int {
+	if f.Options.Precision != nil {
+		return *f.Options.Precision
+	}
+	if f.Type == FieldTypePercent {
+		return 4
+	}
+	return 2
+}
+
+// hasOption 判断 label 是否为 select/multi 字段的可选项。未配置选项时不做限制。
+func (f *Field) hasOption(label string) bool {
+	if len(f.Options.Choices) > 0 {
+		for _, choice := range f.Options.Choices {
+			if choice.Label == label {
+				return true
+			}
+		}
+		return false
+	}
+	if len(f.Validation.Options) > 0 {
+		for _, option := range f.Validation.Options {
+			if option == label {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// IsComputed 判断字段值是否由服务端计算（不可写入）
+func (f *Field) IsComputed() bool {
+	switch f.Type {
+	case FieldTypeFormula, FieldTypeLookup, FieldTypeRollup, FieldTypeAuto:
+		return true
+	}
+	return false
+}
+
+// IsReadOnly 判断字段值是否不能通过记录接口直接写入；file 字段只能通过附件接口修改
+func (f *Field) IsReadOnly() bool {
+	return f.IsComputed() || f.Type == FieldTypeFile
+}
+
 // ValidationError 表示验证错误
 type ValidationError struct {
 	Message string
@@ -137,3 +357,22 @@ type ValidationError struct {
 func (e *ValidationError) Error() string {
 	return e.Message
 }
+
+// FieldError 描述记录中单个字段的验证失败
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// RecordValidationError 汇总一次记录写入中所有字段的验证错误
+type RecordValidationError struct {
+	Errors []FieldError
+}
+
+func (e *RecordValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message))
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
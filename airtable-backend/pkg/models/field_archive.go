@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FieldArchive 记录以归档方式删除的字段，字段在记录中的值保存在 ArchivedValue 中，
+// 过期前可以连同数据一起恢复
+type FieldArchive struct {
+	FieldID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"fieldId"`
+	TableID    uuid.UUID `gorm:"type:uuid;not null;index" json:"tableId"`
+	Field      *Field    `gorm:"-" json:"field,omitempty"`
+	ValueCount int       `gorm:"not null;default:0" json:"valueCount"`   // 已归档的值的数量
+	Complete   bool      `gorm:"not null;default:false" json:"complete"` // 所有值都已从记录移入归档
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ArchivedValue 归档字段在一条记录中的值
+type ArchivedValue struct {
+	FieldID  uuid.UUID       `gorm:"type:uuid;primaryKey"`
+	RecordID uuid.UUID       `gorm:"type:uuid;primaryKey"`
+	Value    json.RawMessage `gorm:"type:jsonb;not null"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// PivotHeader 是透视表的一行或一列：分组值，以及该行或该列全部记录的记录数和度量
+type PivotHeader struct {
+	Value interface{} `json:"value"` // 与记录分组的 value 相同，空值为 null
+	Count int64       `json:"count"`
+	Total *float64    `json:"total"` // 平均值没有可计算的数字时为 null
+}
+
+// PivotResult 是透视查询的结果。Values[i][j] 是第 i 行、第 j 列单元格的度量，
+// Counts[i][j] 是其中的记录数；没有记录的单元格计数和求和为 0，平均值为 null
+type PivotResult struct {
+	RowField    string        `json:"rowField"`
+	ColumnField string        `json:"columnField"`
+	Measure     string        `json:"measure"` // 例如 "count"、"sum:amount"
+	Rows        []PivotHeader `json:"rows"`
+	Columns     []PivotHeader `json:"columns"`
+	Values      [][]*float64  `json:"values"`
+	Counts      [][]int64     `json:"counts"`
+	Count       int64         `json:"count"` // 全部记录数
+	Total       *float64      `json:"total"` // 全部记录的度量
+}
@@ -1,72 +1,48 @@
 package models
 
-// FilterOperator 定义过滤操作符
-type FilterOperator string
-
-const (
-	FilterEqual        FilterOperator = "eq"
-	FilterNotEqual     FilterOperator = "neq"
-	FilterGreaterThan  FilterOperator = "gt"
-	FilterLessThan     FilterOperator = "lt"
-	FilterGreaterEqual FilterOperator = "gte"
-	FilterLessEqual    FilterOperator = "lte"
-	FilterContains     FilterOperator = "contains"
-	FilterIn           FilterOperator = "in"
-	FilterNotIn        FilterOperator = "notIn"
-	FilterIsNull       FilterOperator = "isNull"
-	FilterIsNotNull    FilterOperator = "isNotNull"
-)
-
-// SortDirection 定义排序方向
-type SortDirection string
-
-const (
-	SortAsc  SortDirection = "asc"
-	SortDesc SortDirection = "desc"
-)
-
-// FilterCondition 定义过滤条件
-type FilterCondition struct {
-	Field    string         `json:"field"`
-	Operator FilterOperator `json:"operator"`
-	Value    interface{}    `json:"value"`
-}
-
-// SortCondition 定义排序条件
-type SortCondition struct {
-	Field     string        `json:"field"`
-	Direction SortDirection `json:"direction"`
-}
-
-// QueryParams 定义查询参数
-type QueryParams struct {
-	Filters    []FilterCondition `json:"filters,omitempty"`
-	Sort       []SortCondition   `json:"sort,omitempty"`
-	Page       int               `json:"page,omitempty"`
-	PageSize   int               `json:"pageSize,omitempty"`
-	GroupBy    []string          `json:"groupBy,omitempty"`
-	Aggregates []string          `json:"aggregates,omitempty"`
-	Joins      []string          `json:"joins,omitempty"`
-}
-
-// QueryResult 定义查询结果
+// QueryResult 定义查询结果，请求格式见 query.Request
 type QueryResult struct {
 	Records    []Record               `json:"records"`
 	Total      int64                  `json:"total"`
 	Page       int                    `json:"page"`
 	PageSize   int                    `json:"pageSize"`
 	Aggregates map[string]interface{} `json:"aggregates,omitempty"`
+	// Groups 仅在分组查询时返回，此时记录放在最内层分组中
+	Groups []RecordGroup `json:"groups,omitempty"`
+	// NextCursor 和 PrevCursor 用于翻到下一页和上一页，没有更多记录时为空
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// RecordGroup 是分组查询结果中的一个分组
+type RecordGroup struct {
+	Field      string                 `json:"field"` // 分组字段的 key
+	Value      interface{}            `json:"value"` // 空单元格的分组为 null；日期为分桶的第一天 YYYY-MM-DD
+	Count      int64                  `json:"count"` // 分组中符合过滤条件的记录数
+	Aggregates map[string]interface{} `json:"aggregates,omitempty"`
+	Groups     []RecordGroup          `json:"groups,omitempty"`  // 下一层分组
+	Records    []Record               `json:"records,omitempty"` // 仅最内层分组：当前页的记录
 }
 
 // AggregateFunction 定义聚合函数
 type AggregateFunction string
 
 const (
-	AggregateCount AggregateFunction = "count"
-	AggregateSum   AggregateFunction = "sum"
-	AggregateAvg   AggregateFunction = "avg"
-	AggregateMin   AggregateFunction = "min"
-	AggregateMax   AggregateFunction = "max"
+	AggregateCount  AggregateFunction = "count"
+	AggregateSum    AggregateFunction = "sum"
+	AggregateAvg    AggregateFunction = "avg"
+	AggregateMin    AggregateFunction = "min"
+	AggregateMax    AggregateFunction = "max"
+	AggregateConcat AggregateFunction = "concat" // 仅用于 rollup 字段
+
+	// 以下仅用于记录查询的聚合
+	AggregateCountEmpty    AggregateFunction = "count_empty"    // 空单元格数
+	AggregateCountUnique   AggregateFunction = "count_unique"   // 不同的非空值个数
+	AggregatePercentFilled AggregateFunction = "percent_filled" // 非空单元格的百分比，0 到 100
+	AggregateMedian        AggregateFunction = "median"
+	AggregateStddev        AggregateFunction = "stddev"   // 样本标准差
+	AggregateEarliest      AggregateFunction = "earliest" // 仅日期字段
+	AggregateLatest        AggregateFunction = "latest"   // 仅日期字段
 )
 
 // AggregateResult 定义聚合结果
@@ -9,10 +9,34 @@ import (
 
 type Record struct {
 	gorm.Model
-	ID      uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	TableID uuid.UUID
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey"` // 由 BeforeCreate 生成
+	TableID uuid.UUID `gorm:"uniqueIndex:idx_records_table_position,where:deleted_at IS NULL"`
 	Table   Table
 	Data    json.RawMessage `gorm:"type:jsonb"` // Use json.RawMessage for raw JSONB storage
+
+	// Position 是记录在表格中的手动顺序，未指定排序时记录按它排列。
+	// 同一表格中未删除的记录位置各不相同，移动记录时取两侧记录位置的中间值
+	Position float64 `gorm:"type:double precision;not null;default:0;uniqueIndex:idx_records_table_position,where:deleted_at IS NULL" json:"position"`
+
+	// CellErrors holds per-field errors for computed cells (e.g. a formula
+	// dividing by zero). It is filled in on read and never persisted.
+	CellErrors map[string]string `gorm:"-" json:"cellErrors,omitempty"`
+
+	// Expanded maps link field keys to the linked records' primary values.
+	// Only filled in when a caller asks for expansion.
+	Expanded map[string][]LinkedRecord `gorm:"-" json:"expanded,omitempty"`
+
+	// SearchScore and Highlights are only filled in for searches. Highlights
+	// maps the keys of the fields containing the search to snippets of
+	// their text.
+	SearchScore float64           `gorm:"-" json:"searchScore,omitempty"`
+	Highlights  map[string]string `gorm:"-" json:"highlights,omitempty"`
+}
+
+// LinkedRecord is a linked record reduced to its primary field value.
+type LinkedRecord struct {
+	ID           uuid.UUID   `json:"id"`
+	PrimaryValue interface{} `json:"primaryValue"`
 }
 
 func (r *Record) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,36 @@
+package models
+
+import "github.com/google/uuid"
+
+// BaseSearchResult 是在整个 Base 中搜索的结果，按表格分组
+type BaseSearchResult struct {
+	Query  string           `json:"query"`
+	Tables []TableSearchHit `json:"tables"` // 只包含有命中的表格，最匹配的在前
+}
+
+// TableSearchHit 是一个表格中的命中：表格名、字段名和记录内容
+type TableSearchHit struct {
+	TableID uuid.UUID `json:"tableId"`
+	Name    string    `json:"name"`
+	// Score 为表格名的匹配分数，表格名不匹配时为 0
+	Score   float64           `json:"score"`
+	Fields  []FieldSearchHit  `json:"fields"`
+	Records []RecordSearchHit `json:"records"` // 最多 limit 条，最匹配的在前
+	// TotalRecords 为该表格中匹配的记录总数
+	TotalRecords int64 `json:"totalRecords"`
+}
+
+// FieldSearchHit 是名称匹配的字段
+type FieldSearchHit struct {
+	FieldID uuid.UUID `json:"fieldId"`
+	Key     string    `json:"key"`
+	Name    string    `json:"name"`
+	Score   float64   `json:"score"`
+}
+
+// RecordSearchHit 是内容匹配的记录，Highlights 为字段 key 到匹配片段的映射
+type RecordSearchHit struct {
+	RecordID   uuid.UUID         `json:"recordId"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// FieldSequence 保存自动编号字段最近分配的编号
+type FieldSequence struct {
+	FieldID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Value   int64     `gorm:"not null;default:0"`
+}
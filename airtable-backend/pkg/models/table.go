@@ -5,13 +5,23 @@ import (
 	"gorm.io/gorm"
 )
 
+// UnknownFieldPolicy 决定记录写入时如何处理不属于任何字段的 key
+type UnknownFieldPolicy string
+
+const (
+	UnknownFieldsReject UnknownFieldPolicy = "reject" // 默认：返回验证错误
+	UnknownFieldsIgnore UnknownFieldPolicy = "ignore" // 丢弃未知 key
+)
+
 type Table struct {
 	gorm.Model
-	ID     uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey"` // 由 BeforeCreate 生成
 	Name   string
 	BaseID uuid.UUID
 	Base   Base
 	Fields []Field // Has Many Fields
+	// UnknownFields 为空时按 reject 处理
+	UnknownFields UnknownFieldPolicy `gorm:"size:20;not null;default:'reject'"`
 	// Records []Record // Has Many Records - GORM doesn't map JSONB field directly like this relation
 }
 
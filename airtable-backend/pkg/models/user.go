@@ -7,7 +7,7 @@ import (
 
 type User struct {
 	gorm.Model
-	ID   uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	ID   uuid.UUID `gorm:"type:uuid;primaryKey"` // 由 BeforeCreate 生成
 	Name string
 	// Add auth fields later (e.g., Email, PasswordHash)
 }
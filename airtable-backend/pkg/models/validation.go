@@ -0,0 +1,152 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValueFormat 内置的语义校验
+type ValueFormat string
+
+const (
+	FormatEmail ValueFormat = "email"
+	FormatURL   ValueFormat = "url"
+	FormatPhone ValueFormat = "phone"
+)
+
+// dateLayouts 是日期值可接受的格式，越具体越靠前
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseDate 解析 date 字段的值
+func ParseDate(value string) (time.Time, error) {
+	return ParseDateIn(value, time.UTC)
+}
+
+// ParseDateIn 解析 date 字段的值，不带时区的值按 loc 中的时间解释
+func ParseDateIn(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// IsDateOnly 判断日期值是否只包含日期部分
+func IsDateOnly(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+// patternCache 缓存已编译的正则表达式，key 为表达式本身
+var patternCache sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// phonePattern 允许国际区号和常见分隔符
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()\-.]*[0-9]$`)
+
+// Check 验证值是否符合格式
+func (f ValueFormat) Check(value string) error {
+	switch f {
+	case FormatEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value || addr.Name != "" {
+			return &ValidationError{Message: "Invalid email address"}
+		}
+	case FormatURL:
+		u, err := url.ParseRequestURI(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &ValidationError{Message: "Invalid URL"}
+		}
+	case FormatPhone:
+		digits := 0
+		for _, r := range value {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		if !phonePattern.MatchString(value) || digits < 7 || digits > 15 {
+			return &ValidationError{Message: "Invalid phone number"}
+		}
+	default:
+		return &ValidationError{Message: fmt.Sprintf("Unknown format %q", string(f))}
+	}
+	return nil
+}
+
+// Check 检查验证规则本身的配置，在保存字段时调用
+func (v ValidationRule) Check(fieldType FieldType) error {
+	if v.MinLength < 0 || v.MaxLength < 0 || (v.MaxLength > 0 && v.MinLength > v.MaxLength) {
+		return &ValidationError{Message: "invalid length bounds"}
+	}
+	if v.MinValue != nil && v.MaxValue != nil && *v.MinValue > *v.MaxValue {
+		return &ValidationError{Message: "minValue cannot be greater than maxValue"}
+	}
+	var minDate, maxDate time.Time
+	var err error
+	if v.MinDate != "" {
+		if minDate, err = ParseDate(v.MinDate); err != nil {
+			return &ValidationError{Message: fmt.Sprintf("invalid minDate: %v", err)}
+		}
+	}
+	if v.MaxDate != "" {
+		if maxDate, err = ParseDate(v.MaxDate); err != nil {
+			return &ValidationError{Message: fmt.Sprintf("invalid maxDate: %v", err)}
+		}
+		if v.MinDate != "" && minDate.After(maxDate) {
+			return &ValidationError{Message: "minDate cannot be later than maxDate"}
+		}
+	}
+	if v.Pattern != "" {
+		if _, err := compilePattern(v.Pattern); err != nil {
+			return &ValidationError{Message: fmt.Sprintf("invalid pattern: %v", err)}
+		}
+	}
+	switch v.Format {
+	case "", FormatEmail, FormatURL, FormatPhone:
+	default:
+		return &ValidationError{Message: fmt.Sprintf("unknown format %q", string(v.Format))}
+	}
+	if v.Unique {
+		switch fieldType.ValueType() {
+		case FieldTypeText, FieldTypeNumber, FieldTypeDate, FieldTypeSelect:
+		default:
+			return &ValidationError{Message: fmt.Sprintf("fields of type %s cannot be unique", fieldType)}
+		}
+	}
+	return nil
+}
+
+// dateBefore 判断 date 是否早于下限 min
+func dateBefore(date time.Time, min string) bool {
+	bound, err := ParseDate(min)
+	return err == nil && date.Before(bound)
+}
+
+// dateAfter 判断 date 是否晚于上限 max。只有日期部分的上限包含当天全天。
+func dateAfter(date time.Time, max string) bool {
+	bound, err := ParseDate(max)
+	if err != nil {
+		return false
+	}
+	if IsDateOnly(strings.TrimSpace(max)) {
+		return !date.Before(bound.AddDate(0, 0, 1))
+	}
+	return date.After(bound)
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestFieldValidate(t *testing.T) {
+	text := Field{Type: FieldTypeText, Validation: ValidationRule{MinLength: 2, MaxLength: 4, Pattern: `^[a-zé]+$`}}
+	assert.NoError(t, text.Validate("café")) // four runes, five bytes
+	assert.Error(t, text.Validate("cafés"))
+	assert.Error(t, text.Validate("a"))
+	assert.Error(t, text.Validate("ABC"))
+
+	// Zero is a valid bound
+	number := Field{Type: FieldTypeNumber, Validation: ValidationRule{MinValue: float(0), MaxValue: float(10)}}
+	assert.NoError(t, number.Validate(0.0))
+	assert.Error(t, number.Validate(-1.0))
+	assert.Error(t, number.Validate(10.5))
+
+	date := Field{Type: FieldTypeDate, Validation: ValidationRule{MinDate: "2024-01-01", MaxDate: "2024-12-31"}}
+	assert.NoError(t, date.Validate("2024-12-31T23:00:00Z"))
+	assert.Error(t, date.Validate("2025-01-01"))
+	assert.Error(t, date.Validate("2023-12-31T23:59:59Z"))
+
+	custom := Field{Type: FieldTypeText, Validation: ValidationRule{Format: FormatEmail, CustomError: "Enter a work email"}}
+	err := custom.Validate("nope")
+	if assert.Error(t, err) {
+		assert.Equal(t, "Enter a work email", err.Error())
+	}
+}
+
+func TestValueFormats(t *testing.T) {
+	cases := []struct {
+		format ValueFormat
+		value  string
+		valid  bool
+	}{
+		{FormatEmail, "ann@example.com", true},
+		{FormatEmail, "Ann <ann@example.com>", false},
+		{FormatEmail, "ann@", false},
+		{FormatURL, "https://example.com/path?q=1", true},
+		{FormatURL, "ftp://example.com", false},
+		{FormatURL, "example.com", false},
+		{FormatPhone, "+1 (555) 010-9999", true},
+		{FormatPhone, "12345", false},
+		{FormatPhone, "555-CALL-NOW", false},
+	}
+	for _, c := range cases {
+		err := c.format.Check(c.value)
+		assert.Equal(t, c.valid, err == nil, "%s %q", c.format, c.value)
+	}
+}
+
+func TestValidationRuleCheck(t *testing.T) {
+	assert.NoError(t, ValidationRule{Pattern: `^\d+$`, MinValue: float(1), MaxValue: float(1)}.Check(FieldTypeNumber))
+	assert.Error(t, ValidationRule{Pattern: `(`}.Check(FieldTypeText))
+	assert.Error(t, ValidationRule{MinValue: float(2), MaxValue: float(1)}.Check(FieldTypeNumber))
+	assert.Error(t, ValidationRule{MinDate: "2024-02-01", MaxDate: "2024-01-01"}.Check(FieldTypeDate))
+	assert.Error(t, ValidationRule{Format: "zip"}.Check(FieldTypeText))
+	assert.Error(t, ValidationRule{Unique: true}.Check(FieldTypeMulti))
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ViewType 定义视图类型
+type ViewType string
+
+const (
+	ViewTypeGrid     ViewType = "grid" // 默认
+	ViewTypeKanban   ViewType = "kanban"
+	ViewTypeCalendar ViewType = "calendar"
+	ViewTypeGallery  ViewType = "gallery"
+)
+
+// RowHeight 定义表格视图的行高
+type RowHeight string
+
+const (
+	RowHeightShort     RowHeight = "short" // 默认
+	RowHeightMedium    RowHeight = "medium"
+	RowHeightTall      RowHeight = "tall"
+	RowHeightExtraTall RowHeight = "extra_tall"
+)
+
+// View 是表格上保存的视图：记录的过滤、排序和分组，以及字段的显示方式。
+// Filter、Sort、GroupBy 的格式与 query.Request 中对应的字段相同，保存时按表格字段检查，并把字段 key 转换为字段 ID
+type View struct {
+	ID      uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"` // 由 BeforeCreate 生成
+	TableID uuid.UUID       `gorm:"type:uuid;not null;index" json:"tableId"`
+	Name    string          `gorm:"size:255;not null" json:"name"`
+	Type    ViewType        `gorm:"size:20;not null" json:"type"`
+	Filter  json.RawMessage `gorm:"type:jsonb" json:"filter,omitempty"`
+	Sort    json.RawMessage `gorm:"type:jsonb" json:"sort,omitempty"`
+	GroupBy json.RawMessage `gorm:"type:jsonb" json:"groupBy,omitempty"`
+	Options ViewOptions     `gorm:"type:jsonb" json:"options"`
+	Order   int             `gorm:"not null;default:0" json:"order"` // 视图在表格中的顺序
+
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (v *View) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+// ViewOptions 保存视图的显示设置，字段都用字段 ID 引用
+type ViewOptions struct {
+	HiddenFields []uuid.UUID       `json:"hiddenFields,omitempty"`
+	FieldOrder   []uuid.UUID       `json:"fieldOrder,omitempty"`   // 未列出的字段按 Field.Order 排在后面
+	ColumnWidths map[uuid.UUID]int `json:"columnWidths,omitempty"` // 列宽，单位为像素
+	RowHeight    RowHeight         `json:"rowHeight,omitempty"`
+
+	StackFieldID   *uuid.UUID `json:"stackFieldId,omitempty"`   // kanban 类型：按此单选字段分列
+	DateFieldID    *uuid.UUID `json:"dateFieldId,omitempty"`    // calendar 类型：开始日期字段
+	EndDateFieldID *uuid.UUID `json:"endDateFieldId,omitempty"` // calendar 类型：可选的结束日期字段
+	CoverFieldID   *uuid.UUID `json:"coverFieldId,omitempty"`   // gallery 类型：可选的封面附件字段
+}
+
+// Value implements driver.Valuer so the options are stored as JSON.
+func (o ViewOptions) Value() (driver.Value, error) {
+	return marshalJSONColumn(o)
+}
+
+// Scan implements sql.Scanner for reading the JSON column back.
+func (o *ViewOptions) Scan(src interface{}) error {
+	return unmarshalJSONColumn(src, o)
+}
+
+// ViewRecords 是按视图查询记录的结果：视图本身、按视图顺序排列的可见字段和查询结果
+type ViewRecords struct {
+	View   *View   `json:"view"`
+	Fields []Field `json:"fields"`
+	QueryResult
+}
+
+// ViewPosition 是记录在视图中手动拖动到的位置，目前用于看板堆内的顺序。
+// 位置是分数索引：移动记录时取两侧记录位置的中间值，没有位置的记录排在最后
+type ViewPosition struct {
+	ViewID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"viewId"`
+	RecordID uuid.UUID `gorm:"type:uuid;primaryKey" json:"recordId"`
+	Position float64   `gorm:"not null" json:"position"`
+}
+
+// KanbanStack 是看板中单选字段的一个选项下的记录，Value 为 nil 的是未填写选项的记录
+type KanbanStack struct {
+	Value      *string  `json:"value"`
+	Color      string   `json:"color,omitempty"`
+	Count      int64    `json:"count"` // 堆中符合视图过滤条件的记录数
+	Records    []Record `json:"records"`
+	NextCursor string   `json:"nextCursor,omitempty"` // 读取堆中后续记录的游标
+}
+
+// KanbanStacks 是看板视图的内容：每个选项一个堆，按选项顺序排列，空值堆在最后
+type KanbanStacks struct {
+	View   *View         `json:"view"`
+	Fields []Field       `json:"fields"`
+	Stacks []KanbanStack `json:"stacks"`
+}
@@ -0,0 +1,102 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+)
+
+// Aggregate asks for a summary of one field over the filtered records.
+// FieldID may also be a field key.
+type Aggregate struct {
+	FieldID  string                   `json:"fieldId"`
+	Function models.AggregateFunction `json:"function"`
+}
+
+// Name is the key under which the aggregate is returned, e.g. "sum:amount".
+func (a Aggregate) Name(field models.Field) string {
+	return fmt.Sprintf("%s:%s", a.Function, field.Key)
+}
+
+// BuildAggregateExpr returns the SQL expression in dialect d that computes fn
+// over a field and the arguments it binds. The counting functions work on any
+// stored field; sum, avg, median and stddev need a numeric field; min and max
+// work on numbers and dates, earliest and latest on dates. Cells that do not
+// hold a value of the field's type are left out rather than failing the
+// query.
+func BuildAggregateExpr(d dialect.Dialect, field models.Field, fn models.AggregateFunction) (string, []interface{}, error) {
+	e, err := aggregateExpr(d, field, fn)
+	if err != nil {
+		return "", nil, err
+	}
+	return e.sql, e.args, nil
+}
+
+func aggregateExpr(d dialect.Dialect, field models.Field, fn models.AggregateFunction) (expr, error) {
+	valueType := fieldValueType(field)
+	if valueType == models.FieldTypeFormula {
+		// Formula values are computed after the query and never stored
+		return expr{}, fmt.Errorf("aggregates are not supported for formula field %s", field.Name)
+	}
+	numeric := valueType == models.FieldTypeNumber
+	date := valueType == models.FieldTypeDate
+
+	switch fn {
+	case models.AggregateCount:
+		return sqlf("COUNT(CASE WHEN NOT %s THEN 1 END)", emptyCheck(d, field)), nil
+	case models.AggregateCountEmpty:
+		return sqlf("COUNT(CASE WHEN %s THEN 1 END)", emptyCheck(d, field)), nil
+	case models.AggregateCountUnique:
+		return sqlf("COUNT(DISTINCT CASE WHEN NOT %s THEN %s END)", emptyCheck(d, field), textAccessor(d, field)), nil
+	case models.AggregatePercentFilled:
+		return sqlf(d.Cast("100.0 * COUNT(CASE WHEN NOT %s THEN 1 END) / NULLIF(COUNT(*), 0)", dialect.Float), emptyCheck(d, field)), nil
+	case models.AggregateSum:
+		if numeric {
+			return sqlf(d.Cast("COALESCE(SUM(%s), 0)", dialect.Float), typedAccessor(d, field)), nil
+		}
+	case models.AggregateAvg:
+		if numeric {
+			return sqlf(d.Cast("AVG(%s)", dialect.Float), typedAccessor(d, field)), nil
+		}
+	case models.AggregateMedian:
+		if numeric {
+			return sqlf(d.Cast(d.Median("%s"), dialect.Float), typedAccessor(d, field)), nil
+		}
+	case models.AggregateStddev:
+		if numeric {
+			return sqlf(d.Cast("stddev(%s)", dialect.Float), typedAccessor(d, field)), nil
+		}
+	case models.AggregateMin, models.AggregateMax:
+		sqlFn := strings.ToUpper(string(fn))
+		switch {
+		case numeric:
+			return sqlf(d.Cast(sqlFn+"(%s)", dialect.Float), typedAccessor(d, field)), nil
+		case date:
+			return sqlf(sqlFn+"(%s)", typedAccessor(d, field)), nil
+		}
+	case models.AggregateEarliest:
+		if date {
+			return sqlf("MIN(%s)", typedAccessor(d, field)), nil
+		}
+	case models.AggregateLatest:
+		if date {
+			return sqlf("MAX(%s)", typedAccessor(d, field)), nil
+		}
+	default:
+		return expr{}, fmt.Errorf("unsupported aggregate function: %s", fn)
+	}
+	return expr{}, fmt.Errorf("aggregate %s is not supported for field %s of type %s", fn, field.Name, field.Type)
+}
+
+// emptyCheck is a condition that holds for empty cells: missing keys, null,
+// empty strings and, for lists, empty lists.
+func emptyCheck(d dialect.Dialect, field models.Field) expr {
+	acc := textAccessor(d, field)
+	switch fieldValueType(field) {
+	case models.FieldTypeMulti, models.FieldTypeLink, models.FieldTypeFile:
+		return sqlf("(%s IS NULL OR %s IN ('', '[]'))", acc, acc)
+	}
+	return sqlf("(%s IS NULL OR %s = '')", acc, acc)
+}
@@ -0,0 +1,29 @@
+package query
+
+import (
+	"time"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+)
+
+// BuildOverlapClause returns the condition selecting the records whose
+// dates overlap the window [from, to), and the arguments it binds. A record
+// spans from the value of start to the value of end, or is at the value of
+// start when end is nil or empty. Values compare as timestamps; offsets
+// stored with the values are not taken into account by every dialect, so
+// callers widen the window by a day and check the exact times themselves.
+func BuildOverlapClause(d dialect.Dialect, start models.Field, end *models.Field, from, to time.Time) (string, []interface{}) {
+	fromValue := from.UTC().Format(time.RFC3339)
+	toValue := to.UTC().Format(time.RFC3339)
+	startKey := typedAccessor(d, start)
+	startsBefore := sqlf("%s < "+typedParam(d, start), startKey, toValue)
+	endsAfter := sqlf("%s >= "+typedParam(d, start), startKey, fromValue)
+	if end != nil {
+		// Ranges that end before they start count from their start
+		endKey := typedAccessor(d, *end)
+		endsAfter = or([]expr{endsAfter, sqlf("%s >= "+typedParam(d, *end), endKey, fromValue)})
+	}
+	clause := and([]expr{startsBefore, endsAfter})
+	return clause.sql, clause.args
+}
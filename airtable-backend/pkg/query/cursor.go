@@ -0,0 +1,153 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// Cursor marks a position in a sorted record listing: the sort values,
+// table position and ID of the record at the edge of a page. Clients
+// receive cursors encoded (see Encode) and pass them back unchanged.
+type Cursor struct {
+	Sort     string        `json:"s"`           // SortSignature of the listing
+	Values   []interface{} `json:"v,omitempty"` // sort values of the record
+	Position float64       `json:"p"`           // position of the record in the table
+	ID       uuid.UUID     `json:"id"`
+	// Before asks for the page ending just before the record rather than
+	// the page starting just after it.
+	Before bool `json:"b,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor reads a cursor produced by Encode and checks that it belongs
+// to a listing sorted by sorts.
+func DecodeCursor(encoded string, sorts []Sort) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if cursor.Sort != SortSignature(sorts) || len(cursor.Values) != len(sorts) {
+		return nil, fmt.Errorf("cursor does not match the sort of the request")
+	}
+	return &cursor, nil
+}
+
+// SortSignature identifies an ordering, so that a cursor is not used with
+// a different one.
+func SortSignature(sorts []Sort) string {
+	parts := make([]string, len(sorts))
+	for i, sort := range sorts {
+		direction, _ := sort.direction()
+		parts[i] = sort.FieldID + ":" + direction
+	}
+	return strings.Join(parts, ",")
+}
+
+// CursorValue converts a sort value read from the database to a value that
+// survives the JSON of a cursor and can be bound again.
+func CursorValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// BuildKeysetClause returns the condition selecting the records after the
+// cursor (or before it, for a Before cursor) in the order of sorts followed
+// by position and id, and the arguments it binds. Nulls sort last
+// ascending and first descending, as in BuildOrderClause.
+func BuildKeysetClause(d dialect.Dialect, fields map[string]models.Field, sorts []Sort, cursor *Cursor) (string, []interface{}, error) {
+	var terms []expr
+	var equal []expr
+	for i, sort := range sorts {
+		field, ok := fields[sort.FieldID]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown sort field: %s", sort.FieldID)
+		}
+		direction, err := sort.direction()
+		if err != nil {
+			return "", nil, err
+		}
+		ascending := (direction == "ASC") != cursor.Before
+		key := typedAccessor(d, field)
+		value := cursor.Values[i]
+		param := typedParam(d, field)
+
+		// The records sorting strictly beyond the value of this key
+		var beyond expr
+		switch {
+		case value == nil && ascending:
+			// Nulls come last, nothing sorts beyond them
+			beyond = sqlf("1 = 0")
+		case value == nil:
+			beyond = sqlf("%s IS NOT NULL", key)
+		case ascending:
+			beyond = sqlf("(%s > "+param+" OR %s IS NULL)", key, value, key)
+		default:
+			beyond = sqlf("%s < "+param, key, value)
+		}
+		terms = append(terms, and(append(equal, beyond)))
+
+		if value == nil {
+			equal = append(equal, sqlf("%s IS NULL", key))
+		} else {
+			equal = append(equal, sqlf("%s = "+param, key, value))
+		}
+	}
+
+	// Records with equal sort values keep their order in the table. The
+	// cursor carries the record's position, so it works after the record
+	// has moved or been deleted
+	tiebreak := ">"
+	if cursor.Before {
+		tiebreak = "<"
+	}
+	terms = append(terms, and(append(equal,
+		sqlf("(position, id) "+tiebreak+" (?, ?)", cursor.Position, cursor.ID))))
+
+	clause := or(terms)
+	return clause.sql, clause.args, nil
+}
+
+// and joins conditions with AND.
+func and(conditions []expr) expr {
+	return join(conditions, " AND ")
+}
+
+// or joins conditions with OR.
+func or(conditions []expr) expr {
+	return join(conditions, " OR ")
+}
+
+func join(conditions []expr, operator string) expr {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	parts := make([]string, len(conditions))
+	var args []interface{}
+	for i, condition := range conditions {
+		parts[i] = condition.sql
+		args = append(args, condition.args...)
+	}
+	return expr{sql: "(" + strings.Join(parts, operator) + ")", args: args}
+}
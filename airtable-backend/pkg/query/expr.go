@@ -0,0 +1,107 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+)
+
+// expr is a fragment of SQL together with the arguments bound to its
+// placeholders. Field keys only ever reach the database as arguments, so a
+// key can hold any text without changing the statement.
+type expr struct {
+	sql  string
+	args []interface{}
+}
+
+// sqlf builds an expr from format. Each %s is replaced by the SQL of the next
+// part, which must be an expr, and each ? binds the next part as a value;
+// parts are consumed in the order the two appear in format.
+func sqlf(format string, parts ...interface{}) expr {
+	var sql strings.Builder
+	var args []interface{}
+	next := func() interface{} {
+		if len(parts) == 0 {
+			panic(fmt.Sprintf("sqlf: too few parts for %q", format))
+		}
+		part := parts[0]
+		parts = parts[1:]
+		return part
+	}
+	for i := 0; i < len(format); i++ {
+		switch {
+		case strings.HasPrefix(format[i:], "%s"):
+			fragment, ok := next().(expr)
+			if !ok {
+				panic(fmt.Sprintf("sqlf: %%s needs an expr in %q", format))
+			}
+			sql.WriteString(fragment.sql)
+			args = append(args, fragment.args...)
+			i++
+		case format[i] == '?':
+			sql.WriteByte('?')
+			args = append(args, next())
+		default:
+			sql.WriteByte(format[i])
+		}
+	}
+	if len(parts) > 0 {
+		panic(fmt.Sprintf("sqlf: too many parts for %q", format))
+	}
+	return expr{sql: sql.String(), args: args}
+}
+
+// wrap builds an expr from format, replacing every %s with e. It fills in
+// the formats of dialect.Dialect, which may repeat their operand.
+func wrap(format string, e expr) expr {
+	parts := make([]interface{}, strings.Count(format, "%s"))
+	for i := range parts {
+		parts[i] = e
+	}
+	return sqlf(format, parts...)
+}
+
+// textAccessor reads a field's value from the record data as text.
+func textAccessor(d dialect.Dialect, field models.Field) expr {
+	return expr{sql: d.JSONText("data"), args: []interface{}{field.Key}}
+}
+
+// jsonAccessor reads a field's value from the record data as JSON, e.g. to
+// test array containment.
+func jsonAccessor(d dialect.Dialect, field models.Field) expr {
+	return expr{sql: d.JSONValue("data"), args: []interface{}{field.Key}}
+}
+
+// valueCast returns the type a field's values are cast to so that they
+// compare by the field's value type. Types without a cast compare as text.
+func valueCast(field models.Field) (dialect.Type, bool) {
+	switch fieldValueType(field) {
+	case models.FieldTypeNumber:
+		return dialect.Numeric, true
+	case models.FieldTypeBoolean:
+		return dialect.Boolean, true
+	case models.FieldTypeDate:
+		return dialect.Timestamp, true
+	}
+	return 0, false
+}
+
+// typedAccessor reads a field's value from the record data, cast to the
+// field's value type (see valueCast). Cells that do not hold a value of the
+// type read as NULL.
+func typedAccessor(d dialect.Dialect, field models.Field) expr {
+	if t, ok := valueCast(field); ok {
+		return wrap(d.SafeCast("%s", t), textAccessor(d, field))
+	}
+	return textAccessor(d, field)
+}
+
+// typedParam is the placeholder of a value compared against typedAccessor.
+func typedParam(d dialect.Dialect, field models.Field) string {
+	if t, ok := valueCast(field); ok {
+		return d.Param(t)
+	}
+	return "?"
+}
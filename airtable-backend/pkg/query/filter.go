@@ -7,6 +7,7 @@ import (
 
 	"gorm.io/gorm"
 
+	"airtable-backend/pkg/database/dialect"
 	"airtable-backend/pkg/models"
 )
 
@@ -16,141 +17,53 @@ type FilterGroup struct {
 	Conditions []json.RawMessage `json:"conditions"` // Can be Condition or nested FilterGroup
 }
 
-// Condition represents a single filter condition.
+// Condition represents a single filter condition. FieldID may also be a field key.
 type Condition struct {
 	FieldID  string          `json:"fieldId"`
-	Operator string          `json:"operator"` // e.g., "=", "!=", ">", "<", ">=", "<=", "contains", "is_empty"
+	Operator string          `json:"operator"` // e.g., "=", "!=", ">", "<", ">=", "<=", "contains", "is_empty", "has_any_of"
 	Value    json.RawMessage `json:"value"`    // Raw value, interpretation depends on FieldType
 }
 
-// BuildGormFilter recursively builds GORM WHERE clauses from a FilterGroup.
-// It requires the map of fields to get KeyName and Type.
+// BuildGormFilter adds the WHERE clause of a FilterGroup to db. fields maps
+// field IDs and keys to fields (see FieldMap).
 func BuildGormFilter(db *gorm.DB, fields map[string]models.Field, filter *FilterGroup) (*gorm.DB, error) {
-	if filter == nil || (filter.Operator == "" && len(filter.Conditions) == 0) {
-		return db, nil // No filter applied
-	}
-
-	// Validate operator
-	if filter.Operator != "AND" && filter.Operator != "OR" {
-		return nil, fmt.Errorf("invalid filter operator: %s", filter.Operator)
+	clause, args, err := BuildFilterClause(dialect.For(db), fields, filter)
+	if err != nil {
+		return nil, err
 	}
-
-	// GORM needs separate OR clauses
-	// We will build individual clause strings and combine them
-	var clauses []string
-	var args []interface{}
-
-	for _, rawCondition := range filter.Conditions {
-		// Try unmarshalling as a simple condition first
-		var cond Condition
-		if err := json.Unmarshal(rawCondition, &cond); err == nil {
-			// Successfully unmarshalled as a condition
-			field, ok := fields[cond.FieldID]
-			if !ok {
-				return nil, fmt.Errorf("field with ID %s not found", cond.FieldID)
-			}
-
-			clause, conditionArgs, err := buildConditionClause(field, cond)
-			if err != nil {
-				return nil, fmt.Errorf("failed to build condition clause for field %s: %v", field.Name, err)
-			}
-			clauses = append(clauses, clause)
-			args = append(args, conditionArgs...)
-
-		} else {
-			// If not a condition, try unmarshalling as a nested group
-			var nestedGroup FilterGroup
-			if err := json.Unmarshal(rawCondition, &nestedGroup); err == nil {
-				// Successfully unmarshalled as a nested group
-				// Recursively build the nested clause
-				nestedDB, err := BuildGormFilter(db.Session(&gorm.Session{}), fields, &nestedGroup)
-				if err != nil {
-					return nil, fmt.Errorf("failed to build nested filter group: %v", err)
-				}
-				// GORM returns a DB object with the WHERE clause applied. We need the SQL string and args.
-				// This requires GORM internals or re-implementing part of it.
-				// A simpler approach for this example: return the DB object directly and combine.
-				// However, combining nested WHERE clauses with different operators (AND/OR) is tricky
-				// when GORM applies them sequentially.
-				// A more robust approach: build pure SQL clause strings and args here.
-
-				// --- Re-thinking combining clauses ---
-				// GORM's `Where` accepts strings and args, OR `func(*gorm.DB) *gorm.DB`.
-				// For complex nested structures, passing functions is cleaner.
-				// Let's return a function that applies the filter.
-
-				// This requires changing the function signature.
-				// New plan: BuildGormFilter returns a function `func(*gorm.DB) *gorm.DB`
-				// Let's refactor this...
-
-				// --- Refactored approach using GORM function ---
-				// This function will return the modified *gorm.DB object directly.
-				// The complexity of combining AND/OR needs careful handling.
-				// GORM's `Or()` applies an OR condition *after* any preceding WHERE.
-				// For `(A AND B) OR (C AND D)`, you might need `Where(A).Where(B).Or(Where(C).Where(D))`.
-				// For `(A OR B) AND (C OR D)`, you need `Where(Where(A).Or(B)).Where(Where(C).Or(D))`.
-
-				// Let's simplify the JSON structure mapping to GORM:
-				// Top-level operator applies to all immediate conditions/groups.
-				// `{"operator": "AND", "conditions": [Cond1, Cond2, Group1]}` -> `WHERE Cond1 AND Cond2 AND (Group1_Clause)`
-				// `{"operator": "OR", "conditions": [Cond1, Cond2, Group1]}` -> `WHERE Cond1 OR Cond2 OR (Group1_Clause)`
-				// This means we need to build the clause for each condition/group and then combine them with the group's operator.
-
-				nestedDB, err = BuildGormFilter(db.Session(&gorm.Session{}), fields, &nestedGroup) // Use a session to avoid modifying the original db instance immediately
-				if err != nil {
-					return nil, fmt.Errorf("failed to build nested filter group: %v", err)
-				}
-
-				// GORM doesn't easily exposes the generated SQL WHERE clause string and args from a DB object *before* execution.
-				// We need to build the raw SQL clause parts.
-
-				// Let's reconsider the return type. Returning a function seems most GORM-idiomatic for composition.
-				// `func(*gorm.DB) *gorm.DB` represents a scope.
-				// BuildGormFilter will return `func(*gorm.DB) *gorm.DB`.
-
-				// This is getting complex quickly. For a practical example while keeping it reasonable,
-				// let's implement parsing into *our* internal filter struct first, then build the GORM query.
-				// And handle the AND/OR structure iteratively, applying GORM's `.Where()` and `.Or()` methods.
-				// GORM's `.Where(clause, args...).Where(clause2, args2...)` creates `clause AND clause2`.
-				// GORM's `.Where(clause, args...).Or(clause2, args2...)` creates `(clause) OR (clause2)`.
-				// This is not quite what we need for nested `AND` within `OR`, etc.
-
-				// A better approach for arbitrary nesting: build the entire SQL string and args for the WHERE clause.
-				// This bypasses some of GORM's query builder but gives full control.
-
-				// --- Re-attempt: Build raw SQL string and args ---
-				fmt.Println(nestedDB)
-				// This recursive function will build the SQL clause and collect args.
-				clause, conditionArgs, err := buildGroupClause(fields, &nestedGroup)
-				if err != nil {
-					return nil, err
-				}
-				clauses = append(clauses, clause)
-				args = append(args, conditionArgs...)
-			} else {
-				// Failed to unmarshal as either Condition or FilterGroup
-				return nil, fmt.Errorf("invalid filter condition format: %s", string(rawCondition))
-			}
-		}
+	if clause == "" {
+		return db, nil // No filter applied
 	}
+	return db.Where(clause, args...), nil
+}
 
-	// Combine the individual clauses using the group's operator
-	combinedClause := strings.Join(clauses, fmt.Sprintf(" %s ", filter.Operator))
-	if len(clauses) > 1 {
-		combinedClause = "(" + combinedClause + ")" // Wrap in parentheses for nesting correctness
-	}
+// BuildFilterClause returns the SQL condition and arguments of a FilterGroup
+// in dialect d, or an empty clause when the group has no conditions.
+func BuildFilterClause(d dialect.Dialect, fields map[string]models.Field, group *FilterGroup) (string, []interface{}, error) {
+	return buildGroupClause(d, fields, group)
+}
 
-	// Apply the final combined clause to the DB object
-	return db.Where(combinedClause, args...), nil
+// BuildEqualsClause returns the condition selecting the records whose value
+// in field equals value, and the arguments it binds. Values compare by the
+// field's value type as in filters, so the number 5 matches a stored 5.0.
+func BuildEqualsClause(d dialect.Dialect, field models.Field, value interface{}) (string, []interface{}) {
+	clause := sqlf("%s = "+typedParam(d, field), typedAccessor(d, field), value)
+	return clause.sql, clause.args
 }
 
 // buildGroupClause recursively builds the SQL string and arguments for a filter group.
-func buildGroupClause(fields map[string]models.Field, group *FilterGroup) (string, []interface{}, error) {
-	if group == nil || (group.Operator == "" && len(group.Conditions) == 0) {
+// Conditions and nested groups are combined with the group's operator; an
+// empty operator means AND.
+func buildGroupClause(d dialect.Dialect, fields map[string]models.Field, group *FilterGroup) (string, []interface{}, error) {
+	if group == nil || len(group.Conditions) == 0 {
 		return "", nil, nil
 	}
 
-	if group.Operator != "AND" && group.Operator != "OR" {
+	operator := strings.ToUpper(group.Operator)
+	if operator == "" {
+		operator = "AND"
+	}
+	if operator != "AND" && operator != "OR" {
 		return "", nil, fmt.Errorf("invalid filter operator: %s", group.Operator)
 	}
 
@@ -158,37 +71,32 @@ func buildGroupClause(fields map[string]models.Field, group *FilterGroup) (strin
 	var args []interface{}
 
 	for _, rawCondition := range group.Conditions {
-		var cond Condition
-		if err := json.Unmarshal(rawCondition, &cond); err == nil {
-			// It's a simple condition
-			field, ok := fields[cond.FieldID]
-			if !ok {
-				return "", nil, fmt.Errorf("field with ID %s not found", cond.FieldID)
-			}
-			clause, conditionArgs, err := buildConditionClause(field, cond)
+		cond, nestedGroup, err := parseFilterItem(rawCondition)
+		if err != nil {
+			return "", nil, err
+		}
+		if nestedGroup != nil {
+			nestedClause, nestedArgs, err := buildGroupClause(d, fields, nestedGroup)
 			if err != nil {
-				return "", nil, fmt.Errorf("failed to build condition clause for field %s: %v", field.Name, err)
+				return "", nil, err
 			}
-			clauses = append(clauses, clause)
-			args = append(args, conditionArgs...)
-		} else {
-			// Try as a nested group
-			var nestedGroup FilterGroup
-			if err := json.Unmarshal(rawCondition, &nestedGroup); err == nil {
-				// It's a nested group
-				nestedClause, nestedArgs, err := buildGroupClause(fields, &nestedGroup)
-				if err != nil {
-					return "", nil, err
-				}
-				if nestedClause != "" {
-					clauses = append(clauses, nestedClause)
-					args = append(args, nestedArgs...)
-				}
-			} else {
-				// Neither a condition nor a group
-				return "", nil, fmt.Errorf("invalid filter condition format: %s", string(rawCondition))
+			if nestedClause != "" {
+				clauses = append(clauses, nestedClause)
+				args = append(args, nestedArgs...)
 			}
+			continue
+		}
+
+		field, ok := fields[cond.FieldID]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown field: %s", cond.FieldID)
 		}
+		clause, conditionArgs, err := buildConditionClause(d, field, *cond)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to build condition clause for field %s: %v", field.Name, err)
+		}
+		clauses = append(clauses, clause)
+		args = append(args, conditionArgs...)
 	}
 
 	if len(clauses) == 0 {
@@ -196,7 +104,7 @@ func buildGroupClause(fields map[string]models.Field, group *FilterGroup) (strin
 	}
 
 	// Combine with the group's operator
-	combinedClause := strings.Join(clauses, fmt.Sprintf(" %s ", group.Operator))
+	combinedClause := strings.Join(clauses, fmt.Sprintf(" %s ", operator))
 	if len(clauses) > 1 {
 		combinedClause = "(" + combinedClause + ")" // Wrap if more than one clause
 	}
@@ -204,18 +112,49 @@ func buildGroupClause(fields map[string]models.Field, group *FilterGroup) (strin
 	return combinedClause, args, nil
 }
 
-// buildConditionClause builds the SQL string and arguments for a single condition.
-// Assumes value is passed as JSON raw message.
-func buildConditionClause(field models.Field, cond Condition) (string, []interface{}, error) {
-	// Base SQL template for accessing JSONB field value as text
-	// We use ->> 'key' to get the value as TEXT. Casting is needed for non-text comparisons.
-	keyAccessor := fmt.Sprintf("data ->> '%s'", field.Key)
+// parseFilterItem decodes an entry of a group's conditions, which is either
+// a nested group (it has "conditions") or a single condition.
+func parseFilterItem(raw json.RawMessage) (*Condition, *FilterGroup, error) {
+	var probe struct {
+		Conditions json.RawMessage `json:"conditions"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, nil, fmt.Errorf("invalid filter condition format: %s", string(raw))
+	}
+	if probe.Conditions != nil {
+		var group FilterGroup
+		if err := json.Unmarshal(raw, &group); err != nil {
+			return nil, nil, fmt.Errorf("invalid filter group format: %s", string(raw))
+		}
+		return nil, &group, nil
+	}
+	var cond Condition
+	if err := json.Unmarshal(raw, &cond); err != nil {
+		return nil, nil, fmt.Errorf("invalid filter condition format: %s", string(raw))
+	}
+	return &cond, nil, nil
+}
 
-	var clause string
-	var args []interface{}
+// comparisonOperators are the operators numbers and dates are compared with.
+var comparisonOperators = map[string]bool{"=": true, "!=": true, ">": true, "<": true, ">=": true, "<=": true}
 
+// buildConditionClause builds the SQL string and arguments for a single condition.
+// Assumes value is passed as JSON raw message. The field key and the value
+// are always bound as arguments.
+func buildConditionClause(d dialect.Dialect, field models.Field, cond Condition) (string, []interface{}, error) {
+	// ->> reads the value as TEXT. Casting is needed for non-text comparisons.
+	keyAccessor := textAccessor(d, field)
+
+	// is_empty and is_not_empty take no value
+	if cond.Operator == "is_empty" || cond.Operator == "is_not_empty" {
+		cond.Value = json.RawMessage("null")
+	} else if len(cond.Value) == 0 {
+		return "", nil, fmt.Errorf("operator %s needs a value", cond.Operator)
+	}
+
+	var clause expr
 	// Determine comparison operator and value handling based on field type
-	switch field.Type {
+	switch fieldValueType(field) {
 	case models.FieldTypeText:
 		var value string
 		// Unmarshal value assuming it's a string
@@ -225,28 +164,22 @@ func buildConditionClause(field models.Field, cond Condition) (string, []interfa
 
 		switch cond.Operator {
 		case "=":
-			clause = fmt.Sprintf("%s = ?", keyAccessor)
-			args = append(args, value)
+			clause = sqlf("%s = ?", keyAccessor, value)
 		case "!=":
-			clause = fmt.Sprintf("%s != ?", keyAccessor)
-			args = append(args, value)
+			clause = sqlf("%s != ?", keyAccessor, value)
 		case "contains":
-			clause = fmt.Sprintf("%s LIKE ?", keyAccessor)
-			args = append(args, "%"+value+"%")
+			clause = sqlf("%s LIKE ?", keyAccessor, "%"+value+"%")
 		case "not_contains":
-			clause = fmt.Sprintf("%s NOT LIKE ?", keyAccessor)
-			args = append(args, "%"+value+"%")
+			clause = sqlf("%s NOT LIKE ?", keyAccessor, "%"+value+"%")
 		case "starts_with":
-			clause = fmt.Sprintf("%s LIKE ?", keyAccessor)
-			args = append(args, value+"%")
+			clause = sqlf("%s LIKE ?", keyAccessor, value+"%")
 		case "ends_with":
-			clause = fmt.Sprintf("%s LIKE ?", keyAccessor)
-			args = append(args, "%"+value)
+			clause = sqlf("%s LIKE ?", keyAccessor, "%"+value)
 		case "is_empty":
 			// Consider both NULL (missing key) and empty string
-			clause = fmt.Sprintf("(%s IS NULL OR %s = '')", keyAccessor, keyAccessor)
+			clause = sqlf("(%s IS NULL OR %s = '')", keyAccessor, keyAccessor)
 		case "is_not_empty":
-			clause = fmt.Sprintf("(%s IS NOT NULL AND %s != '')", keyAccessor, keyAccessor)
+			clause = sqlf("(%s IS NOT NULL AND %s != '')", keyAccessor, keyAccessor)
 		default:
 			return "", nil, fmt.Errorf("unsupported operator for text field: %s", cond.Operator)
 		}
@@ -255,78 +188,147 @@ func buildConditionClause(field models.Field, cond Condition) (string, []interfa
 		if err := json.Unmarshal(cond.Value, &value); err != nil {
 			return "", nil, fmt.Errorf("invalid value format for number field %s: %v", field.Name, err)
 		}
-
-		switch cond.Operator {
-		case "=":
-			clause = fmt.Sprintf("(%s)::numeric = ?", keyAccessor)
-			args = append(args, value)
-		case "!=":
-			clause = fmt.Sprintf("(%s)::numeric != ?", keyAccessor)
-			args = append(args, value)
-		case ">":
-			clause = fmt.Sprintf("(%s)::numeric > ?", keyAccessor)
-			args = append(args, value)
-		case "<":
-			clause = fmt.Sprintf("(%s)::numeric < ?", keyAccessor)
-			args = append(args, value)
-		case ">=":
-			clause = fmt.Sprintf("(%s)::numeric >= ?", keyAccessor)
-			args = append(args, value)
-		case "<=":
-			clause = fmt.Sprintf("(%s)::numeric <= ?", keyAccessor)
-			args = append(args, value)
-		default:
+		if !comparisonOperators[cond.Operator] {
 			return "", nil, fmt.Errorf("unsupported operator for number field: %s", cond.Operator)
 		}
+		clause = sqlf("%s "+cond.Operator+" "+typedParam(d, field), typedAccessor(d, field), value)
 	case models.FieldTypeBoolean:
 		var value bool
 		if err := json.Unmarshal(cond.Value, &value); err != nil {
 			return "", nil, fmt.Errorf("invalid value format for boolean field %s: %v", field.Name, err)
 		}
-
-		switch cond.Operator {
-		case "=":
-			clause = fmt.Sprintf("(%s)::boolean = ?", keyAccessor)
-			args = append(args, value)
-		case "!=":
-			clause = fmt.Sprintf("(%s)::boolean != ?", keyAccessor)
-			args = append(args, value)
-		default:
+		if cond.Operator != "=" && cond.Operator != "!=" {
 			return "", nil, fmt.Errorf("unsupported operator for boolean field: %s", cond.Operator)
 		}
+		clause = sqlf("%s "+cond.Operator+" "+typedParam(d, field), typedAccessor(d, field), value)
 	case models.FieldTypeDate:
 		var value string
 		if err := json.Unmarshal(cond.Value, &value); err != nil {
 			return "", nil, fmt.Errorf("invalid value format for date field %s: %v", field.Name, err)
 		}
-
+		if !comparisonOperators[cond.Operator] {
+			return "", nil, fmt.Errorf("unsupported operator for date field: %s", cond.Operator)
+		}
+		clause = sqlf("%s "+cond.Operator+" "+typedParam(d, field), typedAccessor(d, field), value)
+	case models.FieldTypeSelect:
 		switch cond.Operator {
-		case "=":
-			clause = fmt.Sprintf("(%s)::timestamp = ?", keyAccessor)
-			args = append(args, value)
-		case "!=":
-			clause = fmt.Sprintf("(%s)::timestamp != ?", keyAccessor)
-			args = append(args, value)
-		case ">":
-			clause = fmt.Sprintf("(%s)::timestamp > ?", keyAccessor)
-			args = append(args, value)
-		case "<":
-			clause = fmt.Sprintf("(%s)::timestamp < ?", keyAccessor)
-			args = append(args, value)
-		case ">=":
-			clause = fmt.Sprintf("(%s)::timestamp >= ?", keyAccessor)
-			args = append(args, value)
-		case "<=":
-			clause = fmt.Sprintf("(%s)::timestamp <= ?", keyAccessor)
-			args = append(args, value)
+		case "=", "!=":
+			var value string
+			if err := json.Unmarshal(cond.Value, &value); err != nil {
+				return "", nil, fmt.Errorf("invalid value format for select field %s: %v", field.Name, err)
+			}
+			clause = sqlf("%s "+cond.Operator+" ?", keyAccessor, value)
+		case "has_any_of", "has_none_of", "has_all_of":
+			values, err := optionValues(field, cond)
+			if err != nil {
+				return "", nil, err
+			}
+			clause = selectOptionClause(keyAccessor, cond.Operator, values)
+		case "is_empty":
+			clause = sqlf("(%s IS NULL OR %s = '')", keyAccessor, keyAccessor)
+		case "is_not_empty":
+			clause = sqlf("(%s IS NOT NULL AND %s != '')", keyAccessor, keyAccessor)
 		default:
-			return "", nil, fmt.Errorf("unsupported operator for date field: %s", cond.Operator)
+			return "", nil, fmt.Errorf("unsupported operator for select field: %s", cond.Operator)
+		}
+	case models.FieldTypeMulti:
+		switch cond.Operator {
+		case "has_any_of", "has_none_of", "has_all_of":
+			values, err := optionValues(field, cond)
+			if err != nil {
+				return "", nil, err
+			}
+			// -> keeps the value as jsonb so array containment can be used
+			clause = multiOptionClause(d, jsonAccessor(d, field), cond.Operator, values)
+		case "is_empty":
+			clause = sqlf("(%s IS NULL OR %s IN ('[]', 'null'))", keyAccessor, keyAccessor)
+		case "is_not_empty":
+			clause = sqlf("(%s IS NOT NULL AND %s NOT IN ('[]', 'null'))", keyAccessor, keyAccessor)
+		default:
+			return "", nil, fmt.Errorf("unsupported operator for multi-select field: %s", cond.Operator)
 		}
 	default:
 		return "", nil, fmt.Errorf("unsupported field type: %s", field.Type)
 	}
 
-	return clause, args, nil
+	return clause.sql, clause.args, nil
+}
+
+// optionValues reads the list of option labels of a has_*_of condition.
+func optionValues(field models.Field, cond Condition) ([]string, error) {
+	var values []string
+	if err := json.Unmarshal(cond.Value, &values); err != nil {
+		return nil, fmt.Errorf("invalid value format for %s on field %s: expected an array of options", cond.Operator, field.Name)
+	}
+	return values, nil
+}
+
+// selectOptionClause matches a single-select cell against a list of options.
+// A cell holds at most one option, so has_all_of only matches when the list
+// names a single option.
+func selectOptionClause(keyAccessor expr, operator string, values []string) expr {
+	distinct := make(map[string]bool)
+	for _, value := range values {
+		distinct[value] = true
+	}
+	switch operator {
+	case "has_any_of":
+		if len(values) == 0 {
+			return sqlf("1 = 0")
+		}
+		return sqlf("%s IN ?", keyAccessor, values)
+	case "has_none_of":
+		if len(values) == 0 {
+			return sqlf("1 = 1")
+		}
+		return sqlf("(%s IS NULL OR %s NOT IN ?)", keyAccessor, keyAccessor, values)
+	default: // has_all_of
+		switch len(distinct) {
+		case 0:
+			return sqlf("1 = 1")
+		case 1:
+			return sqlf("%s = ?", keyAccessor, values[0])
+		}
+		return sqlf("1 = 0")
+	}
+}
+
+// multiOptionClause matches a multi-select cell (a JSON array of labels)
+// against a list of options, testing array containment one option at a time.
+func multiOptionClause(d dialect.Dialect, arrayAccessor expr, operator string, values []string) expr {
+	terms := make([]string, 0, len(values))
+	var args []interface{}
+	for _, value := range values {
+		term := sqlf(d.ArrayContains("%s"), arrayAccessor, d.ArrayElement(value))
+		terms = append(terms, term.sql)
+		args = append(args, term.args...)
+	}
+	switch {
+	case len(terms) == 0 && operator == "has_any_of":
+		return sqlf("1 = 0")
+	case len(terms) == 0:
+		return sqlf("1 = 1")
+	case operator == "has_all_of":
+		return expr{sql: "(" + strings.Join(terms, " AND ") + ")", args: args}
+	case operator == "has_any_of":
+		return expr{sql: "(" + strings.Join(terms, " OR ") + ")", args: args}
+	}
+	// has_none_of
+	return expr{sql: "NOT (" + strings.Join(terms, " OR ") + ")", args: args}
+}
+
+// fieldValueType returns the type whose comparison rules apply to a field.
+// Rollups are stored as their result type; lookups hold arrays of values and
+// are matched as text; other types compare as their base value type, e.g.
+// currency as a number and email as text.
+func fieldValueType(field models.Field) models.FieldType {
+	switch field.Type {
+	case models.FieldTypeRollup:
+		return field.Options.ResultType.ValueType()
+	case models.FieldTypeLookup:
+		return models.FieldTypeText
+	}
+	return field.Type.ValueType()
 }
 
 // ParseFilterJSON parses a JSON byte slice into a FilterGroup.
@@ -340,3 +342,29 @@ func ParseFilterJSON(filterJSON []byte) (*FilterGroup, error) {
 	}
 	return &filter, nil
 }
+
+// MapFields replaces the field of every condition in the group and its
+// nested groups with what ref returns for it.
+func (g *FilterGroup) MapFields(ref func(string) string) error {
+	for i, rawCondition := range g.Conditions {
+		cond, nestedGroup, err := parseFilterItem(rawCondition)
+		if err != nil {
+			return err
+		}
+		var mapped []byte
+		if nestedGroup != nil {
+			if err := nestedGroup.MapFields(ref); err != nil {
+				return err
+			}
+			mapped, err = json.Marshal(nestedGroup)
+		} else {
+			cond.FieldID = ref(cond.FieldID)
+			mapped, err = json.Marshal(cond)
+		}
+		if err != nil {
+			return err
+		}
+		g.Conditions[i] = mapped
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildConditionClause(t *testing.T) {
+	number := dialect.Postgres.SafeCast("data ->> ?", dialect.Numeric)
+	cases := []struct {
+		field    models.Field
+		operator string
+		value    string
+		clause   string
+		args     []interface{}
+	}{
+		{models.Field{Key: "price", Type: models.FieldTypeCurrency}, ">=", `10`, number + " >= ?", []interface{}{"price", "price", 10.0}},
+		{models.Field{Key: "call", Type: models.FieldTypeDuration}, "<", `60`, number + " < ?", []interface{}{"call", "call", 60.0}},
+		{models.Field{Key: "contact", Type: models.FieldTypeEmail}, "ends_with", `"@example.com"`, "data ->> ? LIKE ?", []interface{}{"contact", "%@example.com"}},
+		{models.Field{Key: "status", Type: models.FieldTypeSelect}, "has_any_of", `["a", "b"]`, "data ->> ? IN ?", []interface{}{"status", []string{"a", "b"}}},
+		{models.Field{Key: "status", Type: models.FieldTypeSelect}, "has_all_of", `["a", "b"]`, "1 = 0", nil},
+		{models.Field{Key: "x' OR '1'='1", Type: models.FieldTypeText}, "is_empty", ``, "(data ->> ? IS NULL OR data ->> ? = '')", []interface{}{"x' OR '1'='1", "x' OR '1'='1"}},
+		{models.Field{Key: "tags", Type: models.FieldTypeMulti}, "has_all_of", `["a", "b"]`, "(COALESCE(data -> ?, '[]'::jsonb) @> ?::jsonb AND COALESCE(data -> ?, '[]'::jsonb) @> ?::jsonb)", []interface{}{"tags", `["a"]`, "tags", `["b"]`}},
+	}
+	for _, c := range cases {
+		clause, args, err := buildConditionClause(dialect.Postgres, c.field, Condition{Operator: c.operator, Value: json.RawMessage(c.value)})
+		if assert.NoError(t, err, "%s %s", c.field.Type, c.operator) {
+			assert.Equal(t, c.clause, clause)
+			assert.Equal(t, c.args, args)
+		}
+	}
+
+	_, _, err := buildConditionClause(dialect.Postgres, models.Field{Key: "site", Type: models.FieldTypeURL}, Condition{Operator: ">", Value: json.RawMessage(`"x"`)})
+	assert.Error(t, err)
+}
+
+func TestBuildConditionClause_SQLite(t *testing.T) {
+	// Only JSON numbers are compared; text in a number cell reads as NULL
+	number := "CASE WHEN typeof(data ->> ?) IN ('integer', 'real') THEN data ->> ? END"
+	cases := []struct {
+		field    models.Field
+		operator string
+		value    string
+		clause   string
+		args     []interface{}
+	}{
+		{models.Field{Key: "price", Type: models.FieldTypeCurrency}, ">=", `10`, number + " >= ?", []interface{}{"price", "price", 10.0}},
+		{models.Field{Key: "due", Type: models.FieldTypeDate}, "<", `"2024-05-01"`, "datetime(data ->> ?) < datetime(?)", []interface{}{"due", "2024-05-01"}},
+		{models.Field{Key: "done", Type: models.FieldTypeBoolean}, "=", `true`, "data ->> ? = ?", []interface{}{"done", true}},
+		{models.Field{Key: "tags", Type: models.FieldTypeMulti}, "has_none_of", `["a"]`, "NOT (EXISTS (SELECT 1 FROM json_each(data -> ?) WHERE value = ?))", []interface{}{"tags", "a"}},
+	}
+	for _, c := range cases {
+		clause, args, err := buildConditionClause(dialect.SQLite, c.field, Condition{Operator: c.operator, Value: json.RawMessage(c.value)})
+		if assert.NoError(t, err, "%s %s", c.field.Type, c.operator) {
+			assert.Equal(t, c.clause, clause)
+			assert.Equal(t, c.args, args)
+		}
+	}
+}
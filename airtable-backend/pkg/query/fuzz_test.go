@@ -0,0 +1,105 @@
+package query
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// sqlTokens matches SQL made only of the fragments the builders emit
+// themselves. Keys and values must reach the database as arguments, so any
+// text taken from the request or the field set fails to match.
+var sqlTokens = regexp.MustCompile(`^(?:\s+|data|->>|->|~|::(?:numeric|boolean|timestamp|jsonb|float8)|` +
+	`IS|NOT|NULL|AND|OR|IN|LIKE|COALESCE|SUM|AVG|MIN|MAX|COUNT|CASE|WHEN|THEN|END|ASC|DESC|NULLS|FIRST|LAST|` +
+	`CAST|AS|REAL|datetime|typeof|EXISTS|SELECT|FROM|json_each|WHERE|value|` +
+	dialectLiterals() + `|@>|!=|>=|<=|[=<>?(),]|\d+)*$`)
+
+// dialectLiterals matches the string literals the dialects write into SQL.
+func dialectLiterals() string {
+	literal := regexp.MustCompile(`'[^']*'`)
+	alternatives := []string{`''`, `'\[\]'`, `'null'`}
+	for _, d := range []dialect.Dialect{dialect.Postgres, dialect.SQLite} {
+		for _, t := range []dialect.Type{dialect.Numeric, dialect.Float, dialect.Boolean, dialect.Timestamp} {
+			for _, l := range literal.FindAllString(d.SafeCast("x", t), -1) {
+				alternatives = append(alternatives, regexp.QuoteMeta(l))
+			}
+		}
+	}
+	return strings.Join(alternatives, "|")
+}
+
+func FuzzBuildQuery(f *testing.F) {
+	f.Add(`{"filter": {"operator": "OR", "conditions": [{"fieldId": "title", "operator": "contains", "value": "a"}, {"conditions": [{"fieldId": "hours", "operator": ">=", "value": 2}]}]}}`, "x'); DROP TABLE records; --")
+	f.Add(`{"filter": {"conditions": [{"fieldId": "tags", "operator": "has_none_of", "value": ["a", "b"]}, {"fieldId": "status", "operator": "has_any_of", "value": ["x"]}]}, "sort": [{"fieldId": "due", "direction": "desc"}]}`, "tags")
+	f.Add(`{"filter": {"conditions": [{"fieldId": "custom", "operator": "is_empty"}]}, "sort": [{"fieldId": "custom"}], "aggregates": [{"fieldId": "custom", "function": "count"}]}`, "a' = 'a' OR 1=1 --")
+	f.Add(`{"filter": {"conditions": [{"fieldId": "done", "operator": "=", "value": true}]}, "aggregates": [{"fieldId": "hours", "function": "max"}]}`, "\"quoted\" ? ->> data")
+	f.Add(`{"filter": {"operator": "and) OR (1=1", "conditions": [{"fieldId": "hours", "operator": "> 0 OR 1", "value": 1}]}}`, "")
+
+	f.Fuzz(func(t *testing.T, body string, key string) {
+		var req Request
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			return
+		}
+		fields := FieldMap([]models.Field{
+			{ID: uuid.New(), Key: "title", Type: models.FieldTypeText},
+			{ID: uuid.New(), Key: "hours", Type: models.FieldTypeNumber},
+			{ID: uuid.New(), Key: "done", Type: models.FieldTypeBoolean},
+			{ID: uuid.New(), Key: "due", Type: models.FieldTypeDate},
+			{ID: uuid.New(), Key: "status", Type: models.FieldTypeSelect},
+			{ID: uuid.New(), Key: "tags", Type: models.FieldTypeMulti},
+			{ID: uuid.New(), Key: key, Type: models.FieldTypeText},
+		})
+		fields["custom"] = fields[key]
+
+		for _, d := range []dialect.Dialect{dialect.Postgres, dialect.SQLite} {
+			if clause, args, err := BuildFilterClause(d, fields, req.Filter); err == nil {
+				checkSQL(t, clause, args)
+			}
+			if clause, args, err := BuildOrderClause(d, fields, req.Sort); err == nil {
+				checkSQL(t, clause, args)
+			}
+			for _, agg := range req.Aggregates {
+				field, ok := fields[agg.FieldID]
+				if !ok {
+					continue
+				}
+				if expr, args, err := BuildAggregateExpr(d, field, agg.Function); err == nil {
+					checkSQL(t, expr, args)
+				}
+			}
+		}
+	})
+}
+
+// checkSQL fails t unless sql is built only from known tokens, binds exactly
+// one argument per placeholder and has balanced parentheses.
+func checkSQL(t *testing.T, sql string, args []interface{}) {
+	t.Helper()
+	if !sqlTokens.MatchString(sql) {
+		t.Fatalf("unexpected text in SQL: %q", sql)
+	}
+	if n := strings.Count(sql, "?"); n != len(args) {
+		t.Fatalf("SQL %q has %d placeholders but %d arguments", sql, n, len(args))
+	}
+	depth := 0
+	for _, r := range sql {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		t.Fatalf("unbalanced parentheses in SQL: %q", sql)
+	}
+}
@@ -0,0 +1,164 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+)
+
+// MaxGroupLevels is the number of nested groups a request may ask for.
+const MaxGroupLevels = 3
+
+// DateBucket is the period date values are grouped by.
+type DateBucket string
+
+const (
+	BucketDay   DateBucket = "day"
+	BucketWeek  DateBucket = "week" // weeks start on Monday
+	BucketMonth DateBucket = "month"
+	BucketYear  DateBucket = "year"
+)
+
+// GroupBy is one level of grouping. FieldID may also be a field key.
+type GroupBy struct {
+	FieldID   string     `json:"fieldId"`
+	Bucket    DateBucket `json:"bucket,omitempty"`    // date fields only, BucketDay when empty
+	Direction string     `json:"direction,omitempty"` // "asc" (default) or "desc"
+}
+
+// Descending reports whether the groups of this level are sorted in
+// descending order, checking the direction.
+func (g GroupBy) Descending() (bool, error) {
+	switch strings.ToUpper(g.Direction) {
+	case "", "ASC":
+		return false, nil
+	case "DESC":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid group direction for field %s: %s", g.FieldID, g.Direction)
+}
+
+// BuildGroupKey returns the SQL expression in dialect d that records are
+// grouped by for a field, and the arguments it binds. The key is text, or
+// NULL for empty cells. Dates are grouped by the first day of their bucket.
+func BuildGroupKey(d dialect.Dialect, field models.Field, bucket DateBucket) (string, []interface{}, error) {
+	valueType := fieldValueType(field)
+	if bucket != "" && valueType != models.FieldTypeDate {
+		return "", nil, fmt.Errorf("bucket is only supported for date fields, field %s is %s", field.Name, field.Type)
+	}
+
+	value := sqlf("NULLIF(%s, '')", textAccessor(d, field))
+	var key expr
+	switch valueType {
+	case models.FieldTypeDate:
+		switch bucket {
+		case "":
+			bucket = BucketDay
+		case BucketDay, BucketWeek, BucketMonth, BucketYear:
+		default:
+			return "", nil, fmt.Errorf("invalid date bucket: %s", bucket)
+		}
+		key = wrap(d.DateBucket("%s", string(bucket)), value)
+	case models.FieldTypeMulti, models.FieldTypeLink:
+		// The whole list is the key; an empty list is an empty cell
+		key = sqlf("NULLIF(%s, '[]')", sqlf(d.Cast("%s", dialect.Text), value))
+	case models.FieldTypeText, models.FieldTypeNumber, models.FieldTypeBoolean, models.FieldTypeSelect:
+		key = sqlf(d.Cast("%s", dialect.Text), value)
+	default:
+		return "", nil, fmt.Errorf("cannot group by field %s of type %s", field.Name, field.Type)
+	}
+	return key.sql, key.args, nil
+}
+
+// GroupValue converts a group key read from the database back to the
+// field's value type: numbers, booleans, lists for multi-select and link
+// fields, and strings otherwise. Empty groups have a nil value.
+func GroupValue(field models.Field, key *string) interface{} {
+	if key == nil {
+		return nil
+	}
+	switch fieldValueType(field) {
+	case models.FieldTypeNumber:
+		if n, err := strconv.ParseFloat(*key, 64); err == nil {
+			return n
+		}
+	case models.FieldTypeBoolean:
+		// SQLite reads JSON booleans as 1 and 0
+		return *key == "true" || *key == "1"
+	case models.FieldTypeMulti, models.FieldTypeLink:
+		var values []interface{}
+		if err := json.Unmarshal([]byte(*key), &values); err == nil {
+			return values
+		}
+	}
+	return *key
+}
+
+// CompareGroupValues orders two group values of a field as returned by
+// GroupValue: select options in the field's option order, numbers
+// numerically, false before true and everything else as text. Empty groups
+// sort after all others.
+func CompareGroupValues(field models.Field, a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			return compareOrdered(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return compareOrdered(boolRank(x), boolRank(y))
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			if fieldValueType(field) == models.FieldTypeSelect {
+				if c := compareOrdered(choiceRank(field, x), choiceRank(field, y)); c != 0 {
+					return c
+				}
+			}
+			return strings.Compare(x, y)
+		}
+	}
+	// Lists, and values of mixed types
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareOrdered[T int | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// choiceRank is the position of a select option; labels that are not an
+// option of the field come after all options.
+func choiceRank(field models.Field, label string) int {
+	for i, choice := range field.Options.Choices {
+		if choice.Label == label {
+			return i
+		}
+	}
+	return len(field.Options.Choices)
+}
@@ -0,0 +1,102 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+)
+
+// Pivot is a cross tabulation of the records of a table: the filtered
+// records are grouped by Rows and by Columns, and Measure summarises every
+// cell, every row, every column and all the records. The same schema is
+// read from the query string of GET /pivot (see ParsePivotValues) and from
+// the body of POST /pivot.
+type Pivot struct {
+	Rows    GroupBy      `json:"rows"`
+	Columns GroupBy      `json:"columns"`
+	Measure Measure      `json:"measure"`
+	Filter  *FilterGroup `json:"filter,omitempty"`
+}
+
+// Measure is what a pivot shows for a set of records: their count, or the
+// sum or average of a number field. A count with a field only counts the
+// records with a value in it. FieldID may also be a field key.
+type Measure struct {
+	Function models.AggregateFunction `json:"function"` // count (default), sum or avg
+	FieldID  string                   `json:"fieldId,omitempty"`
+}
+
+// Name is the key identifying the measure, e.g. "count" or "sum:amount".
+// field is nil for a count of records.
+func (m Measure) Name(field *models.Field) string {
+	fn := m.Function
+	if fn == "" {
+		fn = models.AggregateCount
+	}
+	if field == nil {
+		return string(fn)
+	}
+	return fmt.Sprintf("%s:%s", fn, field.Key)
+}
+
+// ParsePivotValues reads a Pivot from URL query parameters. rows, columns,
+// measure and filter hold the JSON of the corresponding pivot fields.
+func ParsePivotValues(values url.Values) (*Pivot, error) {
+	var pivot Pivot
+	for name, target := range map[string]interface{}{"rows": &pivot.Rows, "columns": &pivot.Columns, "measure": &pivot.Measure} {
+		if raw := values.Get(name); raw != "" {
+			if err := json.Unmarshal([]byte(raw), target); err != nil {
+				return nil, fmt.Errorf("invalid %s JSON format: %v", name, err)
+			}
+		}
+	}
+	if raw := values.Get("filter"); raw != "" {
+		filter, err := ParseFilterJSON([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		pivot.Filter = filter
+	}
+	return &pivot, nil
+}
+
+// BuildMeasure returns the SQL expression in dialect d of the value a
+// measure reads from each record, with the arguments it binds, and the
+// aggregate summarising those values, with %s standing for them. field is
+// the measured field, nil for a count of records. Cells that do not hold a
+// number are left out of sums and averages.
+func BuildMeasure(d dialect.Dialect, field *models.Field, m Measure) (string, []interface{}, string, error) {
+	fn := m.Function
+	if fn == "" {
+		fn = models.AggregateCount
+	}
+
+	var value expr
+	var aggregate string
+	switch fn {
+	case models.AggregateCount:
+		if field == nil {
+			return "NULL", nil, "COUNT(*)", nil
+		}
+		value = sqlf("CASE WHEN NOT %s THEN 1 END", emptyCheck(d, *field))
+		aggregate = "COUNT(%s)"
+	case models.AggregateSum, models.AggregateAvg:
+		if field == nil {
+			return "", nil, "", fmt.Errorf("measure %s needs a field", fn)
+		}
+		if fieldValueType(*field) != models.FieldTypeNumber {
+			return "", nil, "", fmt.Errorf("measure %s is not supported for field %s of type %s", fn, field.Name, field.Type)
+		}
+		value = typedAccessor(d, *field)
+		aggregate = d.Cast("COALESCE(SUM(%s), 0)", dialect.Float)
+		if fn == models.AggregateAvg {
+			aggregate = d.Cast("AVG(%s)", dialect.Float)
+		}
+	default:
+		return "", nil, "", fmt.Errorf("unsupported measure function: %s", fn)
+	}
+	return value.sql, value.args, aggregate, nil
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"airtable-backend/pkg/models"
+)
+
+const (
+	// DefaultPageSize is the page size used when a request does not set one.
+	DefaultPageSize = 100
+	// MaxPageSize is the largest page size a request may ask for.
+	MaxPageSize = 1000
+)
+
+// Request is a record query: a filter, sorts, a page and aggregates over the
+// filtered records, optionally grouped. When GroupBy is set, the page is
+// taken within every innermost group. Instead of a page number, a request
+// may continue from a Cursor returned with an earlier result. The same
+// schema is read from the query string of GET /records (see ParseValues) and
+// from the body of POST /records/query.
+type Request struct {
+	Filter     *FilterGroup `json:"filter,omitempty"`
+	Sort       []Sort       `json:"sort,omitempty"`
+	Page       int          `json:"page,omitempty"`     // 1-based
+	PageSize   int          `json:"pageSize,omitempty"` // DefaultPageSize when 0
+	Aggregates []Aggregate  `json:"aggregates,omitempty"`
+	GroupBy    []GroupBy    `json:"groupBy,omitempty"` // at most MaxGroupLevels
+	Cursor     string       `json:"cursor,omitempty"`  // nextCursor or prevCursor of a result
+	// Search selects the records whose searchable fields (see IsSearchable)
+	// contain its words. Without Sort, matches are ordered best first.
+	Search string `json:"search,omitempty"`
+}
+
+// Normalize fills in the default page and page size and checks their bounds
+// and the options that cannot be combined.
+func (r *Request) Normalize() error {
+	if r.Page == 0 {
+		r.Page = 1
+	}
+	if r.PageSize == 0 {
+		r.PageSize = DefaultPageSize
+	}
+	if r.Page < 1 {
+		return fmt.Errorf("page must be at least 1")
+	}
+	if r.PageSize < 1 || r.PageSize > MaxPageSize {
+		return fmt.Errorf("pageSize must be between 1 and %d", MaxPageSize)
+	}
+	if len(r.GroupBy) > MaxGroupLevels {
+		return fmt.Errorf("at most %d group levels are supported", MaxGroupLevels)
+	}
+	if r.Cursor != "" && r.Page > 1 {
+		return fmt.Errorf("cursor and page cannot be used together")
+	}
+	if r.Cursor != "" && len(r.GroupBy) > 0 {
+		return fmt.Errorf("cursor is not supported for grouped queries")
+	}
+	r.Search = strings.TrimSpace(r.Search)
+	if r.Cursor != "" && r.RankedBySearch() {
+		return fmt.Errorf("cursor needs a sort when searching")
+	}
+	return nil
+}
+
+// RankedBySearch reports whether records are ordered by how well they
+// match Search rather than by Sort.
+func (r *Request) RankedBySearch() bool {
+	return r.Search != "" && len(r.Sort) == 0
+}
+
+// Offset returns the number of records before the requested page.
+func (r *Request) Offset() int {
+	return (r.Page - 1) * r.PageSize
+}
+
+// ParseValues reads a Request from URL query parameters. filter, sort,
+// aggregates and groupBy hold the JSON of the corresponding request fields.
+func ParseValues(values url.Values) (*Request, error) {
+	var req Request
+	if raw := values.Get("filter"); raw != "" {
+		filter, err := ParseFilterJSON([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		req.Filter = filter
+	}
+	if raw := values.Get("sort"); raw != "" {
+		sorts, err := ParseSortJSON([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		req.Sort = sorts
+	}
+	if raw := values.Get("aggregates"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req.Aggregates); err != nil {
+			return nil, fmt.Errorf("invalid aggregates JSON format: %v", err)
+		}
+	}
+	if raw := values.Get("groupBy"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &req.GroupBy); err != nil {
+			return nil, fmt.Errorf("invalid groupBy JSON format: %v", err)
+		}
+	}
+	req.Cursor = values.Get("cursor")
+	req.Search = values.Get("search")
+	for name, target := range map[string]*int{"page": &req.Page, "pageSize": &req.PageSize} {
+		if raw := values.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", name, raw)
+			}
+			*target = n
+		}
+	}
+	return &req, nil
+}
+
+// FieldMap indexes a table's fields by ID and by key, which are the two ways
+// filters, sorts and aggregates may refer to a field.
+func FieldMap(fields []models.Field) map[string]models.Field {
+	fieldMap := make(map[string]models.Field, 2*len(fields))
+	for _, field := range fields {
+		fieldMap[field.Key] = field
+	}
+	// IDs win over keys that happen to look like one
+	for _, field := range fields {
+		fieldMap[field.ID.String()] = field
+	}
+	return fieldMap
+}
@@ -0,0 +1,204 @@
+package query
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFilterClause_NestedGroups(t *testing.T) {
+	status := models.Field{ID: uuid.New(), Key: "status", Type: models.FieldTypeText}
+	hours := models.Field{ID: uuid.New(), Key: "hours", Type: models.FieldTypeNumber}
+	fields := FieldMap([]models.Field{status, hours})
+
+	filter, err := ParseFilterJSON([]byte(`{
+		"operator": "or",
+		"conditions": [
+			{"fieldId": "status", "operator": "=", "value": "Open"},
+			{"conditions": [
+				{"fieldId": "` + hours.ID.String() + `", "operator": ">", "value": 4},
+				{"fieldId": "status", "operator": "!=", "value": "Done"}
+			]}
+		]
+	}`))
+	assert.NoError(t, err)
+	clause, args, err := BuildFilterClause(dialect.Postgres, fields, filter)
+	assert.NoError(t, err)
+	number := dialect.Postgres.SafeCast("data ->> ?", dialect.Numeric)
+	assert.Equal(t, "(data ->> ? = ? OR ("+number+" > ? AND data ->> ? != ?))", clause)
+	assert.Equal(t, []interface{}{"status", "Open", "hours", "hours", 4.0, "status", "Done"}, args)
+
+	clause, _, err = BuildFilterClause(dialect.Postgres, fields, &FilterGroup{})
+	assert.NoError(t, err)
+	assert.Empty(t, clause)
+
+	_, _, err = BuildFilterClause(dialect.Postgres, fields, &FilterGroup{Conditions: []json.RawMessage{json.RawMessage(`{"fieldId": "missing", "operator": "=", "value": 1}`)}})
+	assert.Error(t, err)
+	_, _, err = BuildFilterClause(dialect.Postgres, fields, &FilterGroup{Operator: "XOR", Conditions: []json.RawMessage{json.RawMessage(`{"fieldId": "status", "operator": "=", "value": "x"}`)}})
+	assert.Error(t, err)
+}
+
+func TestBuildOrderClause(t *testing.T) {
+	fields := FieldMap([]models.Field{
+		{ID: uuid.New(), Key: "due", Type: models.FieldTypeDate},
+		{ID: uuid.New(), Key: "title", Type: models.FieldTypeText},
+	})
+	clause, args, err := BuildOrderClause(dialect.Postgres, fields, []Sort{{FieldID: "due", Direction: "desc"}, {FieldID: "title"}})
+	assert.NoError(t, err)
+	due := dialect.Postgres.SafeCast("data ->> ?", dialect.Timestamp)
+	assert.Equal(t, due+" DESC NULLS FIRST, data ->> ? ASC NULLS LAST", clause)
+	assert.Equal(t, []interface{}{"due", "due", "title"}, args)
+
+	_, _, err = BuildOrderClause(dialect.Postgres, fields, []Sort{{FieldID: "title", Direction: "sideways"}})
+	assert.Error(t, err)
+}
+
+func TestBuildAggregateExpr(t *testing.T) {
+	hours := models.Field{Key: "hours", Type: models.FieldTypeNumber}
+	title := models.Field{Key: "title", Type: models.FieldTypeText}
+
+	expr, args, err := BuildAggregateExpr(dialect.Postgres, hours, models.AggregateSum)
+	assert.NoError(t, err)
+	assert.Equal(t, "(COALESCE(SUM("+dialect.Postgres.SafeCast("data ->> ?", dialect.Numeric)+"), 0))::float8", expr)
+	assert.Equal(t, []interface{}{"hours", "hours"}, args)
+	expr, args, err = BuildAggregateExpr(dialect.Postgres, title, models.AggregateCount)
+	assert.NoError(t, err)
+	assert.Equal(t, "COUNT(CASE WHEN NOT (data ->> ? IS NULL OR data ->> ? = '') THEN 1 END)", expr)
+	assert.Equal(t, []interface{}{"title", "title"}, args)
+
+	_, _, err = BuildAggregateExpr(dialect.Postgres, title, models.AggregateAvg)
+	assert.Error(t, err)
+	_, _, err = BuildAggregateExpr(dialect.Postgres, hours, models.AggregateConcat)
+	assert.Error(t, err)
+}
+
+func TestParseValues(t *testing.T) {
+	values := url.Values{
+		"filter":     {`{"operator": "AND", "conditions": [{"fieldId": "status", "operator": "=", "value": "Open"}]}`},
+		"sort":       {`[{"fieldId": "title", "direction": "asc"}]`},
+		"aggregates": {`[{"fieldId": "hours", "function": "sum"}]`},
+		"page":       {"2"},
+		"pageSize":   {"25"},
+		"groupBy":    {`[{"fieldId": "due", "bucket": "month"}]`},
+	}
+	req, err := ParseValues(values)
+	assert.NoError(t, err)
+	assert.Len(t, req.Filter.Conditions, 1)
+	assert.Equal(t, []Sort{{FieldID: "title", Direction: "asc"}}, req.Sort)
+	assert.Equal(t, []Aggregate{{FieldID: "hours", Function: models.AggregateSum}}, req.Aggregates)
+	assert.Equal(t, []GroupBy{{FieldID: "due", Bucket: BucketMonth}}, req.GroupBy)
+	assert.NoError(t, req.Normalize())
+	assert.Equal(t, 25, req.Offset())
+
+	_, err = ParseValues(url.Values{"page": {"two"}})
+	assert.Error(t, err)
+
+	req = &Request{}
+	assert.NoError(t, req.Normalize())
+	assert.Equal(t, DefaultPageSize, req.PageSize)
+	assert.Error(t, (&Request{PageSize: MaxPageSize + 1}).Normalize())
+}
+
+func TestBuildGroupKey(t *testing.T) {
+	due := models.Field{Key: "due", Type: models.FieldTypeDate}
+	tags := models.Field{Key: "tags", Type: models.FieldTypeMulti}
+	note := models.Field{Key: "note", Type: models.FieldTypeFormula}
+
+	key, args, err := BuildGroupKey(dialect.Postgres, due, BucketWeek)
+	assert.NoError(t, err)
+	assert.Equal(t, "to_char(date_trunc('week', "+dialect.Postgres.SafeCast("NULLIF(data ->> ?, '')", dialect.Timestamp)+"), 'YYYY-MM-DD')", key)
+	assert.Equal(t, []interface{}{"due", "due"}, args)
+	key, _, err = BuildGroupKey(dialect.SQLite, due, BucketMonth)
+	assert.NoError(t, err)
+	assert.Equal(t, "strftime('%Y-%m-01', NULLIF(data ->> ?, ''))", key)
+	key, _, err = BuildGroupKey(dialect.Postgres, tags, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "NULLIF((NULLIF(data ->> ?, ''))::text, '[]')", key)
+
+	_, _, err = BuildGroupKey(dialect.Postgres, due, "fortnight")
+	assert.Error(t, err)
+	_, _, err = BuildGroupKey(dialect.Postgres, tags, BucketDay)
+	assert.Error(t, err)
+	_, _, err = BuildGroupKey(dialect.Postgres, note, "")
+	assert.Error(t, err)
+}
+
+func TestGroupValue(t *testing.T) {
+	text := func(s string) *string { return &s }
+	status := models.Field{Key: "status", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Todo"}, {Label: "Done"}}}}
+
+	assert.Equal(t, 2.5, GroupValue(models.Field{Type: models.FieldTypeCurrency}, text("2.5")))
+	assert.Equal(t, true, GroupValue(models.Field{Type: models.FieldTypeBoolean}, text("1")))
+	assert.Equal(t, []interface{}{"a", "b"}, GroupValue(models.Field{Type: models.FieldTypeMulti}, text(`["a", "b"]`)))
+	assert.Nil(t, GroupValue(status, nil))
+
+	// Option order wins over the alphabet; empty groups go last
+	assert.Equal(t, -1, CompareGroupValues(status, "Todo", "Done"))
+	assert.Equal(t, 1, CompareGroupValues(status, nil, "Done"))
+	assert.Equal(t, -1, CompareGroupValues(models.Field{Type: models.FieldTypeNumber}, 9.0, 10.0))
+}
+
+func TestBuildKeysetClause(t *testing.T) {
+	fields := FieldMap([]models.Field{
+		{ID: uuid.New(), Key: "title", Type: models.FieldTypeText},
+		{ID: uuid.New(), Key: "hours", Type: models.FieldTypeNumber},
+	})
+	sorts := []Sort{{FieldID: "title"}, {FieldID: "hours", Direction: "desc"}}
+	id := uuid.New()
+	hours := dialect.Postgres.SafeCast("data ->> ?", dialect.Numeric)
+	tiebreak := "(position, id) > (?, ?)"
+
+	clause, args, err := BuildKeysetClause(dialect.Postgres, fields, sorts, &Cursor{Values: []interface{}{"b", 2.0}, Position: 3, ID: id})
+	assert.NoError(t, err)
+	assert.Equal(t, "((data ->> ? > ? OR data ->> ? IS NULL) OR (data ->> ? = ? AND "+hours+" < ?) OR "+
+		"(data ->> ? = ? AND "+hours+" = ? AND "+tiebreak+"))", clause)
+	assert.Equal(t, []interface{}{"title", "b", "title", "title", "b", "hours", "hours", 2.0, "title", "b", "hours", "hours", 2.0, 3.0, id}, args)
+
+	// Going backwards from empty cells, descending becomes ascending with
+	// nulls last and the other way round
+	clause, _, err = BuildKeysetClause(dialect.Postgres, fields, sorts, &Cursor{Values: []interface{}{nil, nil}, ID: id, Before: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "(data ->> ? IS NOT NULL OR (data ->> ? IS NULL AND 1 = 0) OR "+
+		"(data ->> ? IS NULL AND "+hours+" IS NULL AND (position, id) < (?, ?)))", clause)
+}
+
+func TestDecodeCursor(t *testing.T) {
+	sorts := []Sort{{FieldID: "title"}, {FieldID: "hours", Direction: "desc"}}
+	cursor := Cursor{Sort: SortSignature(sorts), Values: []interface{}{"b", 2.0}, Position: 1.5, ID: uuid.New(), Before: true}
+	decoded, err := DecodeCursor(cursor.Encode(), []Sort{{FieldID: "title", Direction: "asc"}, {FieldID: "hours", Direction: "DESC"}})
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	_, err = DecodeCursor(cursor.Encode(), sorts[:1])
+	assert.Error(t, err)
+	_, err = DecodeCursor(cursor.Encode(), ReverseSorts(sorts))
+	assert.Error(t, err)
+	_, err = DecodeCursor("%%%", sorts)
+	assert.Error(t, err)
+}
+
+func TestHighlight(t *testing.T) {
+	snippet, ok := Highlight("Ship it & deploy; DEPLOYMENT later", "deploy")
+	assert.True(t, ok)
+	assert.Equal(t, "Ship it &amp; <mark>deploy</mark>; <mark>DEPLOY</mark>MENT later", snippet)
+
+	// Long text is cut around the first match, at a word boundary
+	text := strings.Repeat("lorem ipsum ", 10) + "needle" + strings.Repeat(" dolor sit", 20)
+	snippet, ok = Highlight(text, "needle")
+	assert.True(t, ok)
+	assert.True(t, strings.HasPrefix(snippet, "…ipsum lorem ipsum lorem ipsum <mark>needle</mark> dolor"), snippet)
+	assert.True(t, strings.HasSuffix(snippet, "…"), snippet)
+
+	_, ok = Highlight("nothing here", "needle")
+	assert.False(t, ok)
+	_, ok = Highlight("nothing here", "  ")
+	assert.False(t, ok)
+}
@@ -0,0 +1,166 @@
+package query
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+)
+
+// SearchableFieldTypes are the types of the fields a search looks at: the
+// fields holding text or lists of text.
+var SearchableFieldTypes = []models.FieldType{
+	models.FieldTypeText,
+	models.FieldTypeSelect,
+	models.FieldTypeMulti,
+	models.FieldTypeEmail,
+	models.FieldTypeURL,
+	models.FieldTypePhone,
+}
+
+// SearchIndexTypes returns SearchableFieldTypes for
+// dialect.Dialect.CreateSearchIndex.
+func SearchIndexTypes() []string {
+	types := make([]string, len(SearchableFieldTypes))
+	for i, t := range SearchableFieldTypes {
+		types[i] = string(t)
+	}
+	return types
+}
+
+// IsSearchable reports whether a search looks at field.
+func IsSearchable(field models.Field) bool {
+	for _, t := range SearchableFieldTypes {
+		if field.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildSearchQuery returns the query in dialect d listing the records that
+// match search as record_id and score, and the arguments it binds.
+func BuildSearchQuery(d dialect.Dialect, search string) (string, []interface{}) {
+	sql := d.Search()
+	args := make([]interface{}, strings.Count(sql, "?"))
+	for i := range args {
+		args[i] = d.SearchQuery(search)
+	}
+	return sql, args
+}
+
+const (
+	// snippetContext is the number of characters a snippet shows before the
+	// first match.
+	snippetContext = 30
+	// snippetLength is the number of characters a snippet shows at most.
+	snippetLength = 120
+)
+
+// Highlight returns a snippet of text around the first word of search it
+// contains, ignoring case, with every occurrence of the words wrapped in
+// <mark> and the rest of the text HTML escaped. ok is false when text
+// contains none of the words.
+func Highlight(text, search string) (snippet string, ok bool) {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Lowercasing changed the length; match the text as it is
+		lower = runes
+	}
+	var words [][]rune
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		words = append(words, []rune(word))
+	}
+
+	// marked[i] is set for every character that is part of a match
+	marked := make([]bool, len(runes))
+	first := -1
+	for i := range lower {
+		for _, word := range words {
+			if hasRunePrefix(lower[i:], word) {
+				for j := range word {
+					marked[i+j] = true
+				}
+				if first < 0 {
+					first = i
+				}
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start := first - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	// Start and end at word boundaries where there is one close by
+	for i := start; i > 0 && i > start-10; i-- {
+		if unicode.IsSpace(runes[i-1]) {
+			start = i
+			break
+		}
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			b.WriteString("<mark>")
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			b.WriteString("</mark>")
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	if len(prefix) == 0 || len(s) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// NameScore scores how well a name, such as a table or field name, matches
+// search: 0 unless it contains every word of search, ignoring case, and
+// otherwise the share of the name the words cover, 1 for an exact match.
+func NameScore(name, search string) float64 {
+	lower := strings.ToLower(name)
+	words := strings.Fields(strings.ToLower(search))
+	if len(words) == 0 || lower == "" {
+		return 0
+	}
+	covered := 0
+	for _, word := range words {
+		if !strings.Contains(lower, word) {
+			return 0
+		}
+		covered += len([]rune(word))
+	}
+	score := float64(covered) / float64(len([]rune(lower)))
+	if score > 1 {
+		// Overlapping words
+		score = 1
+	}
+	return score
+}
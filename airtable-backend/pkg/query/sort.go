@@ -6,55 +6,55 @@ import (
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"airtable-backend/pkg/database/dialect"
 	"airtable-backend/pkg/models"
 )
 
-// Sort represents a single sort definition.
+// Sort represents a single sort definition. FieldID may also be a field key.
 type Sort struct {
 	FieldID   string `json:"fieldId"`
-	Direction string `json:"direction"` // "asc" or "desc"
+	Direction string `json:"direction"` // "asc" (default) or "desc"
 }
 
 // BuildGormSort builds GORM ORDER BY clauses from a slice of Sort structs.
 // It requires the map of fields to get KeyName and Type for proper casting.
 func BuildGormSort(db *gorm.DB, fields map[string]models.Field, sorts []Sort) (*gorm.DB, error) {
-	if len(sorts) == 0 {
+	orderClause, args, err := BuildOrderClause(dialect.For(db), fields, sorts)
+	if err != nil {
+		return nil, err
+	}
+	if orderClause == "" {
 		return db, nil // No sorting applied
 	}
+	return db.Order(OrderExpression(orderClause, args)), nil
+}
+
+// OrderExpression wraps an ORDER BY expression list and its arguments so it
+// can be passed to gorm's Order, which does not bind arguments itself. A
+// later Order call on the same query replaces the expression, so it has to
+// hold the complete ordering.
+func OrderExpression(orderClause string, args []interface{}) clause.OrderBy {
+	return clause.OrderBy{Expression: clause.Expr{SQL: orderClause, Vars: args, WithoutParentheses: true}}
+}
 
+// BuildOrderClause returns the ORDER BY expression list for sorts in dialect
+// d and the arguments it binds, or "" when there are none.
+func BuildOrderClause(d dialect.Dialect, fields map[string]models.Field, sorts []Sort) (string, []interface{}, error) {
 	var orderClauses []string
+	var args []interface{}
 
 	for _, sort := range sorts {
 		field, ok := fields[sort.FieldID]
 		if !ok {
-			return nil, fmt.Errorf("field with ID %s not found for sorting", sort.FieldID)
+			return "", nil, fmt.Errorf("unknown sort field: %s", sort.FieldID)
 		}
 
 		// Validate direction
-		direction := strings.ToUpper(sort.Direction)
-		if direction != "ASC" && direction != "DESC" {
-			return nil, fmt.Errorf("invalid sort direction for field %s: %s", field.Name, sort.Direction)
-		}
-
-		// Build the order clause with type casting for the JSONB field
-		keyAccessor := fmt.Sprintf("data ->> '%s'", field.Key)
-		var typedAccessor string
-
-		// Determine casting based on field type
-		switch field.Type {
-		case models.FieldTypeText:
-			typedAccessor = keyAccessor // No specific cast needed for text comparison/ordering
-		case models.FieldTypeNumber:
-			typedAccessor = fmt.Sprintf("(%s)::numeric", keyAccessor)
-		case models.FieldTypeBoolean:
-			typedAccessor = fmt.Sprintf("(%s)::boolean", keyAccessor)
-		case models.FieldTypeDate:
-			typedAccessor = fmt.Sprintf("(%s)::timestamp", keyAccessor)
-		default:
-			// For unsupported types, sort as text or skip? Sorting as text is safer.
-			typedAccessor = keyAccessor
-			// Or error: return nil, fmt.Errorf("unsupported field type for sorting: %s (field: %s)", field.Type, field.Name)
+		direction, err := sort.direction()
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid sort direction for field %s: %s", field.Name, sort.Direction)
 		}
 
 		// Add NULLs LAST or FIRST? Default is NULLS LAST for ASC, NULLS FIRST for DESC.
@@ -64,14 +64,45 @@ func BuildGormSort(db *gorm.DB, fields map[string]models.Field, sorts []Sort) (*
 			nullOrder = "NULLS FIRST"
 		}
 
-		orderClause := fmt.Sprintf("%s %s %s", typedAccessor, direction, nullOrder)
-		orderClauses = append(orderClauses, orderClause)
+		orderClause := sqlf("%s "+direction+" "+nullOrder, typedAccessor(d, field))
+		orderClauses = append(orderClauses, orderClause.sql)
+		args = append(args, orderClause.args...)
 	}
 
 	// Combine all order clauses
-	finalOrderClause := strings.Join(orderClauses, ", ")
+	return strings.Join(orderClauses, ", "), args, nil
+}
+
+// direction returns the SQL direction of the sort, ASC or DESC.
+func (s Sort) direction() (string, error) {
+	switch direction := strings.ToUpper(s.Direction); direction {
+	case "":
+		return "ASC", nil
+	case "ASC", "DESC":
+		return direction, nil
+	}
+	return "", fmt.Errorf("invalid sort direction: %s", s.Direction)
+}
+
+// ReverseSorts returns sorts with every direction flipped. Because nulls
+// sort last ascending and first descending, the result orders records
+// exactly backwards.
+func ReverseSorts(sorts []Sort) []Sort {
+	reversed := make([]Sort, len(sorts))
+	for i, sort := range sorts {
+		reversed[i] = Sort{FieldID: sort.FieldID, Direction: "desc"}
+		if direction, _ := sort.direction(); direction == "DESC" {
+			reversed[i].Direction = "asc"
+		}
+	}
+	return reversed
+}
 
-	return db.Order(finalOrderClause), nil
+// BuildSortKey returns the expression a field is sorted by in dialect d,
+// and the arguments it binds.
+func BuildSortKey(d dialect.Dialect, field models.Field) (string, []interface{}) {
+	key := typedAccessor(d, field)
+	return key.sql, key.args
 }
 
 // ParseSortJSON parses a JSON byte slice into a slice of Sort.
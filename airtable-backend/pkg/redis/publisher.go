@@ -5,6 +5,10 @@ import (
 )
 
 func Publish(channel string, message string) {
+	if RDB == nil {
+		log.Printf("Redis not initialized, dropping message for channel %s", channel)
+		return
+	}
 	err := RDB.Publish(Ctx, channel, message).Err()
 	if err != nil {
 		log.Printf("Error publishing message to channel %s: %v", channel, err)
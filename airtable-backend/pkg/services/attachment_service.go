@@ -0,0 +1,289 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAttachmentNotFound is returned when a record has no attachment with the given ID.
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+type AttachmentService struct {
+	db            *gorm.DB
+	store         storage.BlobStore
+	recordService *RecordService
+}
+
+func NewAttachmentService(db *gorm.DB, store storage.BlobStore, recordService *RecordService) *AttachmentService {
+	return &AttachmentService{db: db, store: store, recordService: recordService}
+}
+
+// attachmentKey is the blob key of an attachment.
+func attachmentKey(record *models.Record, attachmentID uuid.UUID) string {
+	return fmt.Sprintf("%s/%s/%s", record.TableID, record.ID, attachmentID)
+}
+
+// findFileField resolves a file field of the table by ID or key.
+func (s *AttachmentService) findFileField(tableID uuid.UUID, fieldRef string) (*models.Field, error) {
+	fields, err := s.recordService.FieldService.GetFieldsByTableID(tableID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range fields {
+		if fields[i].ID.String() == fieldRef || fields[i].Key == fieldRef {
+			if fields[i].Type != models.FieldTypeFile {
+				return nil, &models.ValidationError{Message: fmt.Sprintf("field %s is not a file field", fieldRef)}
+			}
+			return &fields[i], nil
+		}
+	}
+	return nil, &models.ValidationError{Message: fmt.Sprintf("field %s not found", fieldRef)}
+}
+
+// Upload stores the content of body as a new attachment in the file field
+// fieldRef (ID or key) of a record and returns the attachment.
+func (s *AttachmentService) Upload(ctx context.Context, recordID uuid.UUID, fieldRef, filename string, body io.Reader, size int64) (*models.Attachment, error) {
+	record, err := s.recordService.findRecord(recordID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("record with ID %s not found", recordID)
+	}
+	field, err := s.findFileField(record.TableID, fieldRef)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sniff the type from the first bytes and hash the content as it streams
+	buffered := bufio.NewReaderSize(body, 512)
+	head, _ := buffered.Peek(512)
+	hash := sha256.New()
+
+	attachment := models.Attachment{
+		ID:        uuid.New(),
+		Filename:  filename,
+		Size:      size,
+		MimeType:  http.DetectContentType(head),
+		CreatedAt: time.Now().UTC(),
+	}
+	key := attachmentKey(record, attachment.ID)
+	if err := s.store.Put(ctx, key, io.TeeReader(buffered, hash), size, attachment.MimeType); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	attachment.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	err = s.updateCell(record.ID, field.Key, func(attachments []models.Attachment) ([]models.Attachment, error) {
+		return append(attachments, attachment), nil
+	})
+	if err != nil {
+		if delErr := s.store.Delete(ctx, key); delErr != nil {
+			log.Printf("Failed to remove blob %s after failed upload: %v", key, delErr)
+		}
+		return nil, err
+	}
+	s.publishRecord(record.ID)
+	return &attachment, nil
+}
+
+// Get returns an attachment's metadata together with the blob key.
+func (s *AttachmentService) Get(recordID, attachmentID uuid.UUID) (*models.Attachment, string, error) {
+	record, err := s.recordService.findRecord(recordID)
+	if err != nil {
+		return nil, "", err
+	}
+	if record == nil {
+		return nil, "", ErrAttachmentNotFound
+	}
+	fields, err := s.recordService.FieldService.GetFieldsByTableID(record.TableID)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := decodeRecordData(record.Data)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, field := range fields {
+		if field.Type != models.FieldTypeFile {
+			continue
+		}
+		for _, attachment := range attachmentsFromValue(data[field.Key]) {
+			if attachment.ID == attachmentID {
+				return &attachment, attachmentKey(record, attachmentID), nil
+			}
+		}
+	}
+	return nil, "", ErrAttachmentNotFound
+}
+
+// Open reads length bytes of an attachment starting at offset; a negative
+// length reads to the end.
+func (s *AttachmentService) Open(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	return s.store.Get(ctx, key, offset, length)
+}
+
+// Delete removes an attachment from its record and deletes its content.
+func (s *AttachmentService) Delete(ctx context.Context, recordID, attachmentID uuid.UUID) error {
+	record, err := s.recordService.findRecord(recordID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrAttachmentNotFound
+	}
+	fields, err := s.recordService.FieldService.GetFieldsByTableID(record.TableID)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for _, field := range fields {
+		if field.Type != models.FieldTypeFile || removed {
+			continue
+		}
+		err := s.updateCell(recordID, field.Key, func(attachments []models.Attachment) ([]models.Attachment, error) {
+			kept := attachments[:0]
+			for _, attachment := range attachments {
+				if attachment.ID == attachmentID {
+					removed = true
+					continue
+				}
+				kept = append(kept, attachment)
+			}
+			return kept, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !removed {
+		return ErrAttachmentNotFound
+	}
+
+	if err := s.store.Delete(ctx, attachmentKey(record, attachmentID)); err != nil {
+		log.Printf("Failed to delete blob for attachment %s: %v", attachmentID, err)
+	}
+	s.publishRecord(recordID)
+	return nil
+}
+
+// updateCell rewrites the attachment list of one cell under a row lock.
+func (s *AttachmentService) updateCell(recordID uuid.UUID, key string, fn func([]models.Attachment) ([]models.Attachment, error)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var record models.Record
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, "id = ?", recordID).Error; err != nil {
+			return err
+		}
+		data, err := decodeRecordData(record.Data)
+		if err != nil {
+			return err
+		}
+		attachments, err := fn(attachmentsFromValue(data[key]))
+		if err != nil {
+			return err
+		}
+		data[key] = attachments
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Record{}).Where("id = ?", recordID).Update("data", json.RawMessage(encoded)).Error
+	})
+}
+
+func (s *AttachmentService) publishRecord(recordID uuid.UUID) {
+	record, err := s.recordService.GetRecordByID(recordID)
+	if err != nil || record == nil {
+		log.Printf("Failed to load record %s for update notification: %v", recordID, err)
+		return
+	}
+	s.recordService.publishUpdate(record.TableID, RecordUpdateMessage{
+		Type:     "record_updated",
+		TableID:  record.TableID,
+		RecordID: record.ID,
+		Record:   record,
+	})
+}
+
+// attachmentsFromValue reads a decoded file cell.
+func attachmentsFromValue(value interface{}) []models.Attachment {
+	if value == nil {
+		return []models.Attachment{}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return []models.Attachment{}
+	}
+	var attachments []models.Attachment
+	if err := json.Unmarshal(encoded, &attachments); err != nil {
+		return []models.Attachment{}
+	}
+	return attachments
+}
+
+// recordsWithAttachments returns the records of a table that hold
+// attachments in one of the given file fields, so that their blobs can be
+// removed once the records are deleted.
+func recordsWithAttachments(tx *gorm.DB, tableID uuid.UUID, fields []models.Field) ([]models.Record, error) {
+	var records, batch []models.Record
+	result := tx.Select("id", "table_id", "data").Where("table_id = ?", tableID).FindInBatches(&batch, recordBatchSize, func(_ *gorm.DB, _ int) error {
+		for _, record := range batch {
+			data, err := decodeRecordData(record.Data)
+			if err != nil {
+				return fmt.Errorf("record %s: %w", record.ID, err)
+			}
+			for _, field := range fields {
+				if field.Type == models.FieldTypeFile && len(attachmentsFromValue(data[field.Key])) > 0 {
+					records = append(records, record)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	return records, result.Error
+}
+
+// deleteAttachmentBlobs removes the stored content of every attachment of a
+// deleted record. Failures are logged; the record is already gone.
+func deleteAttachmentBlobs(store storage.BlobStore, record *models.Record, fields []models.Field) {
+	if store == nil {
+		return
+	}
+	data, err := decodeRecordData(record.Data)
+	if err != nil {
+		log.Printf("Failed to read attachments of deleted record %s: %v", record.ID, err)
+		return
+	}
+	for _, field := range fields {
+		if field.Type == models.FieldTypeFile {
+			deleteCellBlobs(store, record, data[field.Key])
+		}
+	}
+}
+
+// deleteCellBlobs removes the stored content of the attachments in a file
+// cell of record. Failures are logged.
+func deleteCellBlobs(store storage.BlobStore, record *models.Record, value interface{}) {
+	for _, attachment := range attachmentsFromValue(value) {
+		if err := store.Delete(context.Background(), attachmentKey(record, attachment.ID)); err != nil {
+			log.Printf("Failed to delete blob for attachment %s: %v", attachment.ID, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// saveAutoNumberField saves a field that becomes an auto-number field and
+// numbers the table's existing records in creation order.
+func (s *FieldService) saveAutoNumberField(field *models.Field, create bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		save := tx.Save
+		if create {
+			save = tx.Create
+		}
+		if err := save(field).Error; err != nil {
+			return err
+		}
+		return backfillAutoNumbers(tx, *field)
+	})
+}
+
+// backfillAutoNumbers assigns 1..n to the records of the field's table,
+// oldest first, and starts the field's sequence after the last number.
+func backfillAutoNumbers(tx *gorm.DB, field models.Field) error {
+	var ids []uuid.UUID
+	if err := tx.Model(&models.Record{}).
+		Where("table_id = ?", field.TableID).
+		Order("created_at asc, id asc").
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for start := 0; start < len(ids); start += recordBatchSize {
+		end := start + recordBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var batch []models.Record
+		if err := tx.Where("id IN ?", ids[start:end]).Find(&batch).Error; err != nil {
+			return err
+		}
+		byID := make(map[uuid.UUID]models.Record, len(batch))
+		for _, record := range batch {
+			byID[record.ID] = record
+		}
+		for i, id := range ids[start:end] {
+			data, err := decodeRecordData(byID[id].Data)
+			if err != nil {
+				return fmt.Errorf("record %s: %w", id, err)
+			}
+			data[field.Key] = start + i + 1
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Record{}).Where("id = ?", id).Update("data", json.RawMessage(encoded)).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Delete(&models.FieldSequence{}, "field_id = ?", field.ID).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.FieldSequence{FieldID: field.ID, Value: int64(len(ids))}).Error
+}
+
+// nextAutoNumber increments the field's sequence and returns the new value.
+// The sequence row stays locked until the surrounding transaction ends, so
+// concurrent inserts are numbered one after another and a rolled back insert
+// does not leave a gap.
+func nextAutoNumber(tx *gorm.DB, field models.Field) (int64, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var values []int64
+		err := tx.Raw("UPDATE field_sequences SET value = value + 1 WHERE field_id = ? RETURNING value", field.ID).
+			Scan(&values).Error
+		if err != nil {
+			return 0, fmt.Errorf("failed to advance sequence for field %s: %w", field.Key, err)
+		}
+		if len(values) > 0 {
+			return values[0], nil
+		}
+		// Auto-number fields created before sequences existed were never
+		// numbered; number their records now and retry
+		if err := backfillAutoNumbers(tx, field); err != nil {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("sequence for field %s is missing", field.Key)
+}
+
+// assignAutoNumbers sets the value of every auto-number field on a new record.
+func assignAutoNumbers(tx *gorm.DB, fields []models.Field, data map[string]json.RawMessage) error {
+	for _, field := range fields {
+		if field.Type != models.FieldTypeAuto {
+			continue
+		}
+		value, err := nextAutoNumber(tx, field)
+		if err != nil {
+			return err
+		}
+		data[field.Key] = json.RawMessage(fmt.Sprintf("%d", value))
+	}
+	return nil
+}
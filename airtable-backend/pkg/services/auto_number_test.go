@@ -0,0 +1,52 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoNumberField(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tickets"}
+	assert.NoError(t, tableService.CreateTable(table))
+	assert.NoError(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}))
+
+	// Existing records are numbered in creation order
+	older := models.Record{TableID: table.ID, Position: 2, Data: json.RawMessage(`{"title": "older"}`)}
+	older.CreatedAt = time.Now().Add(-time.Hour)
+	newer := models.Record{TableID: table.ID, Position: 1, Data: json.RawMessage(`{"title": "newer"}`)}
+	newer.CreatedAt = time.Now()
+	assert.NoError(t, db.Create(&newer).Error)
+	assert.NoError(t, db.Create(&older).Error)
+
+	number := &models.Field{TableID: table.ID, Name: "Number", Key: "number", Type: models.FieldTypeAuto}
+	assert.NoError(t, fieldService.CreateField(number))
+	assert.Equal(t, 1.0, recordData(t, recordService, older.ID)["number"])
+	assert.Equal(t, 2.0, recordData(t, recordService, newer.ID)["number"])
+
+	// New records continue the sequence, ignoring client values
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "third", "number": 99}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, recordData(t, recordService, record.ID)["number"])
+
+	// The number is read-only
+	_, err = recordService.UpdateRecord(record.ID, json.RawMessage(`{"number": 1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, recordData(t, recordService, record.ID)["number"])
+
+	// Deleting a record does not reuse its number
+	assert.NoError(t, recordService.DeleteRecord(record.ID))
+	record, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "fourth"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, recordData(t, recordService, record.ID)["number"])
+}
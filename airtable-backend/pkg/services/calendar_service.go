@@ -0,0 +1,431 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxCalendarDays is the longest window a calendar query may cover.
+	MaxCalendarDays = 731
+	// MaxCalendarEvents is the largest number of records a calendar query
+	// may return; larger windows have to be narrowed.
+	MaxCalendarEvents = 5000
+
+	// dayLayout is how the days of a calendar are written.
+	dayLayout = "2006-01-02"
+)
+
+// CalendarQuery selects the records shown in a calendar.
+type CalendarQuery struct {
+	// DateField is the ID or key of the date field events start at.
+	DateField string
+	// EndDateField is the ID or key of the date field events end at. Events
+	// without it, or without a value for it, last one day or no time.
+	EndDateField string
+	// TitleField is the ID or key of the field titling events, the first
+	// text field of the table when empty.
+	TitleField string
+	// Start and End are the first and last day of the window, YYYY-MM-DD.
+	// They default to 90 days before and 365 days after today.
+	Start, End string
+	// TimeZone is the IANA name of the zone days are counted in and dates
+	// without an offset are read in, UTC when empty.
+	TimeZone string
+	// Filter narrows the records further, as in query.Request.
+	Filter *query.FilterGroup
+}
+
+type CalendarService struct {
+	db *gorm.DB
+}
+
+func NewCalendarService(db *gorm.DB) *CalendarService {
+	return &CalendarService{db: db}
+}
+
+// calendarWindow is a calendar query resolved against its table.
+type calendarWindow struct {
+	table    *models.Table
+	loc      *time.Location
+	from, to time.Time // the window, from midnight of its first day to midnight after its last
+}
+
+// calendarEvent is a record placed in time. Its end is exclusive: all-day
+// events end at midnight after their last day.
+type calendarEvent struct {
+	record     models.Record
+	title      string
+	start, end time.Time
+	allDay     bool
+}
+
+// Calendar returns the records of a table whose dates overlap the window
+// of q, as events and expanded into the days they cover. Problems with the
+// query are reported as *models.ValidationError.
+func (s *CalendarService) Calendar(tableID uuid.UUID, q CalendarQuery) (*models.CalendarResult, error) {
+	window, events, err := s.events(tableID, q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.CalendarResult{
+		TableID:  tableID,
+		TimeZone: window.loc.String(),
+		Start:    window.from.Format(dayLayout),
+		End:      window.to.AddDate(0, 0, -1).Format(dayLayout),
+		Events:   make([]models.CalendarEvent, 0, len(events)),
+		Days:     []models.CalendarDay{},
+	}
+	days := make(map[string]*models.CalendarDay)
+	var dates []string
+	for _, event := range events {
+		result.Events = append(result.Events, event.model(window.loc))
+		for _, span := range event.spans(window) {
+			date := span.date
+			if days[date] == nil {
+				days[date] = &models.CalendarDay{Date: date}
+				dates = append(dates, date)
+			}
+			days[date].Events = append(days[date].Events, span.CalendarSpan)
+		}
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		result.Days = append(result.Days, *days[date])
+	}
+	return result, nil
+}
+
+// events reads the records of a table overlapping the window of q and
+// places them in time, ordered by start.
+func (s *CalendarService) events(tableID uuid.UUID, q CalendarQuery, now time.Time) (*calendarWindow, []calendarEvent, error) {
+	table, err := loadTable(s.db, tableID)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := q.TimeZone
+	if name == "" {
+		name = "UTC"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, nil, &models.ValidationError{Message: fmt.Sprintf("unknown time zone: %s", q.TimeZone)}
+	}
+	window := &calendarWindow{table: table, loc: loc}
+	if window.from, window.to, err = windowDays(q.Start, q.End, now.In(loc)); err != nil {
+		return nil, nil, err
+	}
+
+	fields, err := NewFieldService(s.db).GetFieldsByTableID(tableID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get fields for table %s: %w", tableID, err)
+	}
+	fieldMap := query.FieldMap(fields)
+	startField, err := calendarField(fieldMap, "dateField", q.DateField, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	endField, err := calendarField(fieldMap, "endDateField", q.EndDateField, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var titleField *models.Field
+	if q.TitleField != "" {
+		field, ok := fieldMap[q.TitleField]
+		if !ok {
+			return nil, nil, &models.ValidationError{Message: fmt.Sprintf("unknown title field: %s", q.TitleField)}
+		}
+		titleField = &field
+	} else {
+		for i := range fields {
+			if fields[i].Type == models.FieldTypeText {
+				titleField = &fields[i]
+				break
+			}
+		}
+	}
+
+	// The database narrows the records down to about the window; offsets
+	// make a day of difference at most
+	d := dialect.For(s.db)
+	overlap, overlapArgs := query.BuildOverlapClause(d, *startField, endField, window.from.AddDate(0, 0, -1), window.to.AddDate(0, 0, 1))
+	filterClause, filterArgs, err := query.BuildFilterClause(d, fieldMap, q.Filter)
+	if err != nil {
+		return nil, nil, &models.ValidationError{Message: err.Error()}
+	}
+	db := s.db.Model(&models.Record{}).Where("table_id = ?", tableID).Where(overlap, overlapArgs...)
+	if filterClause != "" {
+		db = db.Where(filterClause, filterArgs...)
+	}
+	var records []models.Record
+	if err := db.Order("position ASC, id ASC").Limit(MaxCalendarEvents + 1).Find(&records).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve records: %w", err)
+	}
+	if len(records) > MaxCalendarEvents {
+		return nil, nil, &models.ValidationError{Message: fmt.Sprintf("more than %d events in the window, narrow it down", MaxCalendarEvents)}
+	}
+	if err := prepareRecords(records, fieldMap, fields); err != nil {
+		return nil, nil, err
+	}
+
+	events := make([]calendarEvent, 0, len(records))
+	for _, record := range records {
+		data, err := decodeRecordData(record.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+		start, _ := data[startField.Key].(string)
+		var end string
+		if endField != nil {
+			end, _ = data[endField.Key].(string)
+		}
+		event, ok := placeEvent(start, end, loc)
+		if !ok || !event.overlaps(window.from, window.to) {
+			continue
+		}
+		event.record = record
+		if titleField != nil {
+			event.title = eventTitle(data[titleField.Key])
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+	return window, events, nil
+}
+
+// windowDays resolves the first and last day of a window to the times it
+// runs between, in the zone of now.
+func windowDays(start, end string, now time.Time) (time.Time, time.Time, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	from, to := today.AddDate(0, 0, -90), today.AddDate(0, 0, 366)
+	if start != "" {
+		day, err := time.ParseInLocation(dayLayout, start, loc)
+		if err != nil {
+			return from, to, &models.ValidationError{Message: "start must be a date (YYYY-MM-DD)"}
+		}
+		from = day
+	}
+	if end != "" {
+		day, err := time.ParseInLocation(dayLayout, end, loc)
+		if err != nil {
+			return from, to, &models.ValidationError{Message: "end must be a date (YYYY-MM-DD)"}
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, &models.ValidationError{Message: "end must not be before start"}
+	}
+	if to.After(from.AddDate(0, 0, MaxCalendarDays)) {
+		return from, to, &models.ValidationError{Message: fmt.Sprintf("the window can span at most %d days", MaxCalendarDays)}
+	}
+	return from, to, nil
+}
+
+// calendarField resolves a date field of a calendar query.
+func calendarField(fieldMap map[string]models.Field, name, id string, required bool) (*models.Field, error) {
+	if id == "" {
+		if required {
+			return nil, &models.ValidationError{Message: fmt.Sprintf("%s is required", name)}
+		}
+		return nil, nil
+	}
+	field, ok := fieldMap[id]
+	if !ok {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("%s: unknown field %s", name, id)}
+	}
+	if field.Type != models.FieldTypeDate {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("%s: field %s is %s, not date", name, field.Name, field.Type)}
+	}
+	return &field, nil
+}
+
+// placeEvent places a record in time from the values of its start and end
+// fields. Dates without a time make all-day events that include their last
+// day; times without an offset are read in loc. An end before the start is
+// ignored.
+func placeEvent(startValue, endValue string, loc *time.Location) (calendarEvent, bool) {
+	start, err := models.ParseDateIn(startValue, loc)
+	if err != nil {
+		return calendarEvent{}, false
+	}
+	event := calendarEvent{start: start, end: start, allDay: models.IsDateOnly(startValue)}
+	if event.allDay {
+		event.end = start.AddDate(0, 0, 1)
+	}
+	end, err := models.ParseDateIn(endValue, loc)
+	if err != nil {
+		return event, true
+	}
+	if models.IsDateOnly(endValue) {
+		end = end.AddDate(0, 0, 1)
+	} else {
+		event.allDay = false
+	}
+	if end.After(start) {
+		event.end = end
+	}
+	return event, true
+}
+
+// overlaps reports whether the event happens in [from, to). Events without
+// a duration happen at their start.
+func (e calendarEvent) overlaps(from, to time.Time) bool {
+	if !e.start.Before(to) {
+		return false
+	}
+	if e.end.Equal(e.start) {
+		return !e.start.Before(from)
+	}
+	return e.end.After(from)
+}
+
+func (e calendarEvent) model(loc *time.Location) models.CalendarEvent {
+	event := models.CalendarEvent{RecordID: e.record.ID, Title: e.title, AllDay: e.allDay, Record: e.record}
+	if e.allDay {
+		event.Start = e.start.Format(dayLayout)
+		event.End = e.end.AddDate(0, 0, -1).Format(dayLayout)
+	} else {
+		event.Start = e.start.In(loc).Format(time.RFC3339)
+		event.End = e.end.In(loc).Format(time.RFC3339)
+	}
+	return event
+}
+
+// daySpan is the part of an event shown on a day.
+type daySpan struct {
+	date string
+	models.CalendarSpan
+}
+
+// spans expands an event into the days of the window it covers.
+func (e calendarEvent) spans(window *calendarWindow) []daySpan {
+	start := e.start.In(window.loc)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, window.loc)
+	if day.Before(window.from) {
+		day = window.from
+	}
+	var spans []daySpan
+	for ; day.Before(window.to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		if !e.overlaps(day, next) {
+			break
+		}
+		span := models.CalendarSpan{
+			RecordID:        e.record.ID,
+			AllDay:          e.allDay,
+			ContinuesBefore: e.start.Before(day),
+			ContinuesAfter:  e.end.After(next),
+		}
+		if !e.allDay {
+			span.Start = latest(e.start, day).In(window.loc).Format(time.RFC3339)
+			span.End = earliest(e.end, next).In(window.loc).Format(time.RFC3339)
+		}
+		spans = append(spans, daySpan{date: day.Format(dayLayout), CalendarSpan: span})
+	}
+	return spans
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// eventTitle is the text of a cell as an event title.
+func eventTitle(value interface{}) string {
+	if text, ok := searchText(value); ok {
+		return text
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// CalendarICS returns the events of a calendar query as an iCalendar
+// (RFC 5545) feed, for calendar applications to subscribe to.
+func (s *CalendarService) CalendarICS(tableID uuid.UUID, q CalendarQuery) (string, error) {
+	window, events, err := s.events(tableID, q, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	var ics strings.Builder
+	line := func(text string) { writeICSLine(&ics, text) }
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//airtable-backend//calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICSText(window.table.Name))
+	line("X-WR-TIMEZONE:" + window.loc.String())
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.record.ID.String() + "@airtable-backend")
+		line("DTSTAMP:" + icsTime(event.record.UpdatedAt))
+		if event.allDay {
+			line("DTSTART;VALUE=DATE:" + event.start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + event.end.Format("20060102"))
+		} else {
+			line("DTSTART:" + icsTime(event.start))
+			line("DTEND:" + icsTime(event.end))
+		}
+		if event.title != "" {
+			line("SUMMARY:" + escapeICSText(event.title))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return ics.String(), nil
+}
+
+// icsTime writes a time in UTC, as iCalendar does without time zone
+// definitions.
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsTextEscaper escapes the characters iCalendar text values reserve.
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeICSText writes text as an iCalendar text value.
+func escapeICSText(text string) string {
+	return icsTextEscaper.Replace(text)
+}
+
+// writeICSLine writes a content line, folded after every 75 octets without
+// splitting a UTF-8 character, and ended with CRLF.
+func writeICSLine(b *strings.Builder, text string) {
+	const limit = 75
+	width := 0
+	for _, r := range text {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			// The space starting a continuation counts towards its length
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendar(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	calendarService := NewCalendarService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Events"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	starts := &models.Field{TableID: table.ID, Name: "Starts", Key: "starts", Type: models.FieldTypeDate}
+	ends := &models.Field{TableID: table.ID, Name: "Ends", Key: "ends", Type: models.FieldTypeDate}
+	for _, field := range []*models.Field{title, starts, ends} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	for _, data := range []string{
+		`{"title": "Offsite, day 1; day 2", "starts": "2024-03-09", "ends": "2024-03-11"}`,
+		`{"title": "Standup", "starts": "2024-03-10T09:30:00", "ends": "2024-03-10T09:45:00"}`,
+		`{"title": "Launch", "starts": "2024-03-12T23:30:00Z"}`,
+		`{"title": "Night shift", "starts": "2024-03-10T22:00:00+01:00", "ends": "2024-03-11T06:00:00+01:00"}`,
+		`{"title": "Earlier", "starts": "2024-02-01"}`,
+		`{"title": "Later", "starts": "2024-04-01"}`,
+		`{"title": "Undated"}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	result, err := calendarService.Calendar(table.ID, CalendarQuery{
+		DateField:    "starts",
+		EndDateField: ends.ID.String(),
+		Start:        "2024-03-10",
+		End:          "2024-03-12",
+		TimeZone:     "Europe/Berlin",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Europe/Berlin", result.TimeZone)
+	assert.Equal(t, "2024-03-12", result.End)
+
+	var titles []string
+	events := make(map[string]models.CalendarEvent)
+	for _, event := range result.Events {
+		titles = append(titles, event.Title)
+		events[event.Title] = event
+	}
+	// The launch is on the 13th in Berlin
+	assert.Equal(t, []string{"Offsite, day 1; day 2", "Standup", "Night shift"}, titles)
+	assert.True(t, events["Offsite, day 1; day 2"].AllDay)
+	assert.Equal(t, "2024-03-11", events["Offsite, day 1; day 2"].End)
+	assert.Equal(t, "2024-03-10T09:30:00+01:00", events["Standup"].Start)
+	assert.Equal(t, "2024-03-10T22:00:00+01:00", events["Night shift"].Start)
+
+	// Multi-day events show on every day of the window they cover
+	if assert.Len(t, result.Days, 2) {
+		assert.Equal(t, "2024-03-10", result.Days[0].Date)
+		assert.Len(t, result.Days[0].Events, 3)
+		offsite := result.Days[0].Events[0]
+		assert.True(t, offsite.ContinuesBefore)
+		assert.True(t, offsite.ContinuesAfter)
+		night := result.Days[1].Events[1]
+		assert.Equal(t, events["Night shift"].RecordID, night.RecordID)
+		assert.True(t, night.ContinuesBefore)
+		assert.Equal(t, "2024-03-11T00:00:00+01:00", night.Start)
+		assert.Equal(t, "2024-03-11T06:00:00+01:00", night.End)
+	}
+
+	// The launch moves into the window in UTC
+	result, err = calendarService.Calendar(table.ID, CalendarQuery{DateField: "starts", Start: "2024-03-12", End: "2024-03-12"})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Events, 1) {
+		assert.Equal(t, "Launch", result.Events[0].Title)
+	}
+
+	ics, err := calendarService.CalendarICS(table.ID, CalendarQuery{
+		DateField:    "starts",
+		EndDateField: "ends",
+		Start:        "2024-03-01",
+		End:          "2024-03-31",
+	})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "X-WR-CALNAME:Events\r\n")
+	assert.Contains(t, ics, "DTSTART;VALUE=DATE:20240309\r\nDTEND;VALUE=DATE:20240312\r\nSUMMARY:Offsite\\, day 1\\; day 2\r\n")
+	assert.Contains(t, ics, "DTSTART:20240310T210000Z\r\nDTEND:20240311T050000Z\r\n")
+	assert.Equal(t, 4, strings.Count(ics, "BEGIN:VEVENT"))
+
+	var validationErr *models.ValidationError
+	for name, q := range map[string]CalendarQuery{
+		"no date field":  {Start: "2024-03-01"},
+		"not a date":     {DateField: "title"},
+		"unknown field":  {DateField: "missing"},
+		"bad time zone":  {DateField: "starts", TimeZone: "Mars/Olympus"},
+		"bad start":      {DateField: "starts", Start: "March"},
+		"end first":      {DateField: "starts", Start: "2024-03-02", End: "2024-03-01"},
+		"window too big": {DateField: "starts", Start: "2020-01-01", End: "2024-01-01"},
+	} {
+		_, err := calendarService.Calendar(table.ID, q)
+		assert.ErrorAs(t, err, &validationErr, name)
+	}
+	_, err = calendarService.Calendar(uuid.New(), CalendarQuery{DateField: "starts"})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestPlaceEvent(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	event, ok := placeEvent("2024-03-30", "2024-03-31", berlin)
+	assert.True(t, ok)
+	assert.True(t, event.allDay)
+	// The clocks change on the 31st, the event still ends at midnight
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, berlin), event.end)
+
+	event, _ = placeEvent("2024-03-30", "2024-03-30T12:00:00", berlin)
+	assert.False(t, event.allDay)
+	assert.Equal(t, 12*time.Hour, event.end.Sub(event.start))
+
+	// Ends before the start are ignored
+	event, _ = placeEvent("2024-03-30T12:00:00Z", "2024-03-29T12:00:00Z", berlin)
+	assert.Equal(t, event.start, event.end)
+
+	_, ok = placeEvent("soon", "", berlin)
+	assert.False(t, ok)
+}
+
+func TestWriteICSLine(t *testing.T) {
+	var b strings.Builder
+	writeICSLine(&b, "SUMMARY:"+strings.Repeat("é", 40))
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	if assert.Len(t, lines, 2) {
+		assert.LessOrEqual(t, len(lines[0]), 75)
+		assert.True(t, strings.HasPrefix(lines[1], " "))
+	}
+	assert.Equal(t, "SUMMARY:"+strings.Repeat("é", 40), strings.ReplaceAll(strings.TrimSuffix(b.String(), "\r\n"), "\r\n ", ""))
+}
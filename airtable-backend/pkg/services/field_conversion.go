@@ -0,0 +1,311 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/redis"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxConversionFailures is the number of failed cells listed in a conversion result.
+const maxConversionFailures = 20
+
+// conversionDateLayouts are the extra formats recognised when text is
+// converted to dates, besides the formats date fields accept.
+var conversionDateLayouts = []string{
+	"2006/01/02",
+	"01/02/2006",
+	"1/2/2006",
+	"02.01.2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// ConversionResult reports how the values of a field were converted to its new type.
+type ConversionResult struct {
+	DryRun       bool                `json:"dryRun"`
+	Converted    int                 `json:"converted"`
+	Failed       int                 `json:"failed"`
+	Failures     []ConversionFailure `json:"failures,omitempty"` // the first failed cells
+	AddedOptions []string            `json:"addedOptions,omitempty"`
+}
+
+// ConversionFailure is a cell whose value could not be converted. The cell is cleared.
+type ConversionFailure struct {
+	RecordID uuid.UUID   `json:"recordId"`
+	Value    interface{} `json:"value"`
+	Error    string      `json:"error"`
+}
+
+// SchemaUpdateMessage is published on the table's channel when a field changes
+// in a way that affects stored records.
+type SchemaUpdateMessage struct {
+	Type       string            `json:"type"` // e.g., "field_converted"
+	TableID    uuid.UUID         `json:"tableId"`
+	FieldID    uuid.UUID         `json:"fieldId"`
+	Field      *models.Field     `json:"field,omitempty"`
+	OldKey     string            `json:"oldKey,omitempty"`  // set when the field's key changed
+	Records    int               `json:"records,omitempty"` // records whose data was rewritten
+	Conversion *ConversionResult `json:"conversion,omitempty"`
+}
+
+// convertField converts the stored values of a field whose type changed and
+// saves the field in the same transaction. Text converted to select or multi
+// adds the labels it finds as new options.
+func (s *FieldService) convertField(existing, field *models.Field, dryRun bool) (*ConversionResult, error) {
+	result := &ConversionResult{DryRun: dryRun}
+	known := make(map[string]bool)
+	for _, choice := range field.Options.Choices {
+		known[choice.Label] = true
+	}
+	addLabel := func(label string) {
+		if !known[label] {
+			known[label] = true
+			result.AddedOptions = append(result.AddedOptions, label)
+		}
+	}
+
+	var conflict uuid.UUID
+	moved := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		records, err := rewriteRecordData(tx, field.TableID, func(recordID uuid.UUID, data map[string]interface{}) bool {
+			if existing.Key != field.Key && conflict == uuid.Nil {
+				if _, taken := data[field.Key]; taken {
+					conflict = recordID
+				}
+			}
+			if conflict != uuid.Nil {
+				return false
+			}
+			value, ok := data[existing.Key]
+			if !ok {
+				return false
+			}
+			delete(data, existing.Key)
+			if value == nil {
+				return !dryRun
+			}
+			converted, err := convertValue(*field, value)
+			if err != nil {
+				result.Failed++
+				if len(result.Failures) < maxConversionFailures {
+					result.Failures = append(result.Failures, ConversionFailure{RecordID: recordID, Value: value, Error: err.Error()})
+				}
+				return !dryRun
+			}
+			if converted == nil {
+				return !dryRun
+			}
+			switch v := converted.(type) {
+			case string:
+				if field.Type == models.FieldTypeSelect {
+					addLabel(v)
+				}
+			case []interface{}:
+				for _, item := range v {
+					addLabel(item.(string))
+				}
+			}
+			result.Converted++
+			data[field.Key] = converted
+			return !dryRun
+		})
+		if err != nil {
+			return err
+		}
+		if conflict != uuid.Nil {
+			return fmt.Errorf("%w: record %s already has data under %s", ErrDuplicateFieldKey, conflict, field.Key)
+		}
+		moved = records
+
+		if len(result.AddedOptions) > 0 {
+			for _, label := range result.AddedOptions {
+				field.Options.Choices = append(field.Options.Choices, models.SelectOption{Label: label})
+			}
+			if err := prepareChoices(field); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return nil
+		}
+		if err := tx.Save(field).Error; err != nil {
+			return err
+		}
+		return refreshSearchDocuments(tx, field.TableID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert field %s: %w", field.Key, err)
+	}
+
+	if !dryRun {
+		message := SchemaUpdateMessage{
+			Type:       "field_converted",
+			TableID:    field.TableID,
+			FieldID:    field.ID,
+			Field:      field,
+			Records:    moved,
+			Conversion: result,
+		}
+		if existing.Key != field.Key {
+			message.OldKey = existing.Key
+		}
+		publishSchemaUpdate(field.TableID, message)
+	}
+	return result, nil
+}
+
+// convertValue converts a stored value to the type of field. A nil result
+// clears the cell.
+func convertValue(field models.Field, value interface{}) (interface{}, error) {
+	var converted interface{}
+	var err error
+	switch {
+	case field.Type == models.FieldTypeMulti:
+		converted, err = splitLabels(value)
+	case field.Type == models.FieldTypeSelect:
+		var text string
+		if text, err = joinText(value, true); err == nil {
+			converted = strings.TrimSpace(text)
+		}
+	case field.Type.ValueType() == models.FieldTypeText:
+		var text string
+		if text, err = joinText(value, false); err == nil {
+			converted, err = coerceFieldValue(field, text)
+		}
+	case field.Type == models.FieldTypeDate:
+		converted, err = convertDate(value)
+	default:
+		if arr, ok := value.([]interface{}); ok {
+			if len(arr) != 1 {
+				return nil, fmt.Errorf("cannot convert %d values to %s", len(arr), field.Type)
+			}
+			value = arr[0]
+		}
+		converted, err = coerceFieldValue(field, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isEmptyValue(converted) {
+		return nil, nil
+	}
+	if !isSelectField(field) {
+		// Options are added for new labels, so only other types are validated
+		if err := field.Validate(converted); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// textOf formats a scalar value as text.
+func textOf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// joinText formats a value as text, joining arrays (multi-select or lookup
+// values) with ", ". With single set, arrays of more than one value fail.
+func joinText(value interface{}, single bool) (string, error) {
+	if arr, ok := value.([]interface{}); ok {
+		if single && len(arr) > 1 {
+			return "", fmt.Errorf("cannot convert %d values to a single option", len(arr))
+		}
+		parts := make([]string, 0, len(arr))
+		for _, item := range arr {
+			text, ok := textOf(item)
+			if !ok {
+				return "", fmt.Errorf("cannot convert %v to text", item)
+			}
+			parts = append(parts, text)
+		}
+		return strings.Join(parts, ", "), nil
+	}
+	if text, ok := textOf(value); ok {
+		return text, nil
+	}
+	return "", fmt.Errorf("cannot convert %v to text", value)
+}
+
+// splitLabels converts a value to multi-select labels, splitting text on commas.
+func splitLabels(value interface{}) ([]interface{}, error) {
+	var parts []string
+	if arr, ok := value.([]interface{}); ok {
+		for _, item := range arr {
+			text, ok := textOf(item)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %v to an option", item)
+			}
+			parts = append(parts, text)
+		}
+	} else {
+		text, ok := textOf(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %v to options", value)
+		}
+		parts = strings.Split(text, ",")
+	}
+
+	labels := make([]interface{}, 0, len(parts))
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		label := strings.TrimSpace(part)
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+// convertDate parses text as a date. Values in a format date fields accept
+// are kept as they are; other recognised formats become YYYY-MM-DD.
+func convertDate(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %v to a date", value)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	if _, err := models.ParseDate(text); err == nil {
+		return text, nil
+	}
+	for _, layout := range conversionDateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot parse %q as a date", text)
+}
+
+// publishSchemaUpdate notifies subscribers of a table about a schema change.
+func publishSchemaUpdate(tableID uuid.UUID, message SchemaUpdateMessage) {
+	channel := fmt.Sprintf("table_updates:%s", tableID.String())
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to marshal schema update for table %s: %v", tableID, err)
+		return
+	}
+	redis.Publish(channel, string(messageBytes))
+}
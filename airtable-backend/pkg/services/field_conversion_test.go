@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertField(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Orders"}
+	assert.NoError(t, tableService.CreateTable(table))
+	amount := &models.Field{TableID: table.ID, Name: "Amount", Key: "amount", Type: models.FieldTypeText}
+	status := &models.Field{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeText}
+	tags := &models.Field{TableID: table.ID, Name: "Tags", Key: "tags", Type: models.FieldTypeText}
+	shipped := &models.Field{TableID: table.ID, Name: "Shipped", Key: "shipped", Type: models.FieldTypeText}
+	for _, field := range []*models.Field{amount, status, tags, shipped} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+
+	first, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"amount": "12.50", "status": "Open", "tags": "red, blue", "shipped": "03/15/2024"}`))
+	assert.NoError(t, err)
+	second, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"amount": "a lot", "status": "Closed", "tags": "blue", "shipped": "2024-04-01"}`))
+	assert.NoError(t, err)
+
+	// A dry run reports the outcome without changing anything
+	preview := *amount
+	preview.Type = models.FieldTypeNumber
+	result, err := fieldService.ConvertField(&preview, true)
+	assert.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 1, result.Converted)
+	assert.Equal(t, 1, result.Failed)
+	if assert.Len(t, result.Failures, 1) {
+		assert.Equal(t, second.ID, result.Failures[0].RecordID)
+		assert.Equal(t, "a lot", result.Failures[0].Value)
+	}
+	stored, err := fieldService.GetFieldByID(amount.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.FieldTypeText, stored.Type)
+	assert.Equal(t, "12.50", recordData(t, recordService, first.ID)["amount"])
+
+	// Converting rewrites the values and clears the ones that fail
+	stored.Type = models.FieldTypeNumber
+	assert.NoError(t, fieldService.UpdateField(stored))
+	assert.Equal(t, 12.5, recordData(t, recordService, first.ID)["amount"])
+	_, ok := recordData(t, recordService, second.ID)["amount"]
+	assert.False(t, ok)
+
+	// Text becomes options, split on commas for multi-select
+	status.Type = models.FieldTypeSelect
+	result, err = fieldService.ConvertField(status, false)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Open", "Closed"}, result.AddedOptions)
+	assert.Len(t, status.Options.Choices, 2)
+
+	tags.Type = models.FieldTypeMulti
+	assert.NoError(t, fieldService.UpdateField(tags))
+	assert.Equal(t, []interface{}{"red", "blue"}, recordData(t, recordService, first.ID)["tags"])
+
+	tags.Type = models.FieldTypeText
+	assert.NoError(t, fieldService.UpdateField(tags))
+	assert.Equal(t, "red, blue", recordData(t, recordService, first.ID)["tags"])
+
+	shipped.Type = models.FieldTypeDate
+	result, err = fieldService.ConvertField(shipped, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Converted)
+	assert.Equal(t, "2024-03-15", recordData(t, recordService, first.ID)["shipped"])
+	assert.Equal(t, "2024-04-01", recordData(t, recordService, second.ID)["shipped"])
+
+	// Number back to text
+	stored.Type = models.FieldTypeText
+	assert.NoError(t, fieldService.UpdateField(stored))
+	assert.Equal(t, "12.5", recordData(t, recordService, first.ID)["amount"])
+}
@@ -0,0 +1,447 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// defaultArchiveRetention is how long an archived field can be restored.
+	defaultArchiveRetention = 30 * 24 * time.Hour
+	// backgroundPurgeThreshold is the number of records above which a deleted
+	// field's values are removed in the background.
+	backgroundPurgeThreshold = 5 * recordBatchSize
+)
+
+var (
+	// ErrArchiveNotFound is returned when a field has no archive or its
+	// archive has expired.
+	ErrArchiveNotFound = errors.New("archived field not found")
+	// ErrArchiveIncomplete is returned when a field is restored before all
+	// of its values have been archived.
+	ErrArchiveIncomplete = errors.New("field is still being archived")
+)
+
+// DeleteField deletes a field and removes its values from the table's
+// records. Large tables are cleaned up in the background. Deleting a link
+// field also deletes its inverse.
+func (s *FieldService) DeleteField(id uuid.UUID) error {
+	_, err := s.removeField(id, false)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ArchiveField deletes a field but keeps its values in an archive, so that
+// RestoreField can bring the field back with its data until the archive
+// expires.
+func (s *FieldService) ArchiveField(id uuid.UUID) (*models.FieldArchive, error) {
+	return s.removeField(id, true)
+}
+
+// removeField deletes a field and starts moving its values out of the
+// records. The field row is kept, soft-deleted, until that is done so that
+// its key cannot be reused in the meantime.
+func (s *FieldService) removeField(id uuid.UUID, archive bool) (*models.FieldArchive, error) {
+	var field models.Field
+	var archived *models.FieldArchive
+	var purge []models.Field
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&field, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if archive && field.Type == models.FieldTypeLink {
+			return &models.ValidationError{Message: "link fields cannot be archived"}
+		}
+		purge = append(purge, field)
+
+		if field.Type == models.FieldTypeLink && field.Options.InverseFieldID != nil {
+			var inverse models.Field
+			err := tx.First(&inverse, "id = ?", *field.Options.InverseFieldID).Error
+			if err == nil {
+				purge = append(purge, inverse)
+			} else if err != gorm.ErrRecordNotFound {
+				return err
+			}
+		}
+		if err := s.deleteInverseField(tx, &field); err != nil {
+			return err
+		}
+		// An archived auto number field keeps its sequence for a restore
+		if field.Type == models.FieldTypeAuto && !archive {
+			if err := tx.Delete(&models.FieldSequence{}, "field_id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+		if archive {
+			archived = &models.FieldArchive{
+				FieldID:   field.ID,
+				TableID:   field.TableID,
+				ExpiresAt: time.Now().Add(s.ArchiveRetention),
+			}
+			if err := tx.Create(archived).Error; err != nil {
+				return err
+			}
+		}
+		// Views must not pick up a later field that reuses the key
+		if err := storeViewFieldIDs(tx, field.TableID); err != nil {
+			return err
+		}
+		return tx.Delete(&models.Field{}, id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range purge {
+		s.startPurge(f, archive && f.ID == field.ID)
+	}
+	if archived != nil {
+		// Small tables are archived by now
+		if err := s.db.First(archived, "field_id = ?", field.ID).Error; err != nil {
+			return nil, err
+		}
+		archived.Field = &field
+	}
+	return archived, nil
+}
+
+// startPurge removes a deleted field's values from its table, in the
+// background when the table is large. Failures are logged; the cleanup job
+// picks up purges that did not finish.
+func (s *FieldService) startPurge(field models.Field, archive bool) {
+	var count int64
+	if err := s.db.Unscoped().Model(&models.Record{}).Where("table_id = ?", field.TableID).Count(&count).Error; err != nil {
+		log.Printf("Failed to count records of table %s: %v", field.TableID, err)
+		return
+	}
+	if count > backgroundPurgeThreshold {
+		go func() {
+			if err := s.purgeFieldData(field, archive); err != nil {
+				log.Printf("Failed to purge values of deleted field %s: %v", field.ID, err)
+			}
+		}()
+		return
+	}
+	if err := s.purgeFieldData(field, archive); err != nil {
+		log.Printf("Failed to purge values of deleted field %s: %v", field.ID, err)
+	}
+}
+
+// purgeFieldData strips a deleted field's key from the records of its table,
+// one batch per transaction, copying the values to the field's archive when
+// archive is set. Records are locked while their batch is rewritten. A purged
+// field is then removed for good, freeing its key, together with the blobs
+// of a file field's attachments; an archived one has its archive marked
+// complete.
+func (s *FieldService) purgeFieldData(field models.Field, archive bool) error {
+	lastID := uuid.Nil
+	for {
+		done := false
+		var attached []models.Record
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var batch []models.Record
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("table_id = ? AND id > ?", field.TableID, lastID).
+				Order("id").Limit(recordBatchSize).
+				Find(&batch).Error; err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				done = true
+				return nil
+			}
+			lastID = batch[len(batch)-1].ID
+
+			var values []models.ArchivedValue
+			for _, record := range batch {
+				data, err := decodeRecordData(record.Data)
+				if err != nil {
+					return fmt.Errorf("record %s: %w", record.ID, err)
+				}
+				value, ok := data[field.Key]
+				if !ok {
+					continue
+				}
+				// Deleted records had their blobs removed with them
+				if field.Type == models.FieldTypeFile && !archive && !record.DeletedAt.Valid {
+					attached = append(attached, record)
+				}
+				if archive {
+					encoded, err := json.Marshal(value)
+					if err != nil {
+						return fmt.Errorf("record %s: failed to marshal value: %w", record.ID, err)
+					}
+					values = append(values, models.ArchivedValue{FieldID: field.ID, RecordID: record.ID, Value: encoded})
+				}
+				delete(data, field.Key)
+				encoded, err := json.Marshal(data)
+				if err != nil {
+					return fmt.Errorf("record %s: failed to marshal data: %w", record.ID, err)
+				}
+				if err := tx.Unscoped().Model(&models.Record{}).Where("id = ?", record.ID).Update("data", json.RawMessage(encoded)).Error; err != nil {
+					return fmt.Errorf("record %s: failed to update data: %w", record.ID, err)
+				}
+			}
+			if len(values) == 0 {
+				return nil
+			}
+			// A resumed purge may archive a value twice
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&values).Error
+		})
+		if err != nil {
+			return err
+		}
+		for i := range attached {
+			deleteAttachmentBlobs(s.BlobStore, &attached[i], []models.Field{field})
+		}
+		if done {
+			break
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if !archive {
+			if err := tx.Delete(&models.FieldSequence{}, "field_id = ?", field.ID).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(&models.Field{}, "id = ?", field.ID).Error
+		}
+		var count int64
+		if err := tx.Model(&models.ArchivedValue{}).Where("field_id = ?", field.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.FieldArchive{}).Where("field_id = ?", field.ID).
+			Updates(map[string]interface{}{"value_count": count, "complete": true}).Error
+	})
+}
+
+// RestoreField brings back an archived field and writes its archived values
+// back into the records that still exist.
+func (s *FieldService) RestoreField(id uuid.UUID) (*models.Field, error) {
+	var archive models.FieldArchive
+	if err := s.db.First(&archive, "field_id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrArchiveNotFound
+		}
+		return nil, err
+	}
+	if time.Now().After(archive.ExpiresAt) {
+		return nil, ErrArchiveNotFound
+	}
+	if !archive.Complete {
+		return nil, ErrArchiveIncomplete
+	}
+
+	var field models.Field
+	if err := s.db.Unscoped().First(&field, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrArchiveNotFound
+		}
+		return nil, err
+	}
+	if err := s.ensureKeyAvailable(&field); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var batch []models.ArchivedValue
+		result := tx.Where("field_id = ?", id).FindInBatches(&batch, recordBatchSize, func(batchTx *gorm.DB, _ int) error {
+			return restoreArchivedValues(tx, field.Key, batch)
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := tx.Unscoped().Model(&models.Field{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.ArchivedValue{}, "field_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.FieldArchive{}, "field_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := refreshSearchDocuments(tx, field.TableID); err != nil {
+			return err
+		}
+		if !isLinkedValueField(field) {
+			return nil
+		}
+		// Lookup and rollup values may be stale, so they are recomputed
+		var ids []uuid.UUID
+		if err := tx.Model(&models.Record{}).Where("table_id = ?", field.TableID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		_, err := newLinkedValueRefresher(tx).refresh(nil, ids)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore field %s: %w", field.Key, err)
+	}
+	field.DeletedAt = gorm.DeletedAt{}
+	return &field, nil
+}
+
+// restoreArchivedValues writes archived values back under key. Records that
+// gained a value under the key since are left as they are.
+func restoreArchivedValues(tx *gorm.DB, key string, values []models.ArchivedValue) error {
+	ids := make([]uuid.UUID, 0, len(values))
+	for _, value := range values {
+		ids = append(ids, value.RecordID)
+	}
+	var records []models.Record
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Find(&records).Error; err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]models.Record, len(records))
+	for _, record := range records {
+		byID[record.ID] = record
+	}
+
+	for _, value := range values {
+		record, ok := byID[value.RecordID]
+		if !ok {
+			continue
+		}
+		data, err := decodeRecordData(record.Data)
+		if err != nil {
+			return fmt.Errorf("record %s: %w", record.ID, err)
+		}
+		if _, taken := data[key]; taken {
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(value.Value, &decoded); err != nil {
+			return fmt.Errorf("record %s: failed to unmarshal archived value: %w", record.ID, err)
+		}
+		data[key] = decoded
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("record %s: failed to marshal data: %w", record.ID, err)
+		}
+		if err := tx.Unscoped().Model(&models.Record{}).Where("id = ?", record.ID).Update("data", json.RawMessage(encoded)).Error; err != nil {
+			return fmt.Errorf("record %s: failed to update data: %w", record.ID, err)
+		}
+	}
+	return nil
+}
+
+// GetArchivedFields lists the archived fields of a table that can still be
+// restored, most recently deleted first.
+func (s *FieldService) GetArchivedFields(tableID uuid.UUID) ([]models.FieldArchive, error) {
+	var archives []models.FieldArchive
+	if err := s.db.Where("table_id = ? AND expires_at > ?", tableID, time.Now()).
+		Order("created_at desc").Find(&archives).Error; err != nil {
+		return nil, err
+	}
+	for i := range archives {
+		var field models.Field
+		if err := s.db.Unscoped().First(&field, "id = ?", archives[i].FieldID).Error; err != nil {
+			return nil, err
+		}
+		archives[i].Field = &field
+	}
+	return archives, nil
+}
+
+// CleanupDeletedFields finishes purges that were interrupted and removes
+// archives that expired before now, together with their fields and the
+// blobs of archived attachments. An archive that expires before its
+// values were all moved out of the records has the rest purged first; if
+// that fails the archive is kept for the next run.
+func (s *FieldService) CleanupDeletedFields(now time.Time) error {
+	var expired []models.FieldArchive
+	if err := s.db.Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return err
+	}
+	var failed []error
+	for _, archive := range expired {
+		var field models.Field
+		if err := s.db.Unscoped().First(&field, "id = ?", archive.FieldID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if !archive.Complete && field.ID != uuid.Nil {
+			if err := s.purgeFieldData(field, false); err != nil {
+				failed = append(failed, fmt.Errorf("failed to purge expired field %s: %w", field.ID, err))
+				continue
+			}
+		}
+		var attachments []models.ArchivedValue
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if s.BlobStore != nil && field.Type == models.FieldTypeFile {
+				if err := tx.Where("field_id = ?", archive.FieldID).Find(&attachments).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Delete(&models.ArchivedValue{}, "field_id = ?", archive.FieldID).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&models.FieldSequence{}, "field_id = ?", archive.FieldID).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&models.Field{}, "id = ?", archive.FieldID).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&models.FieldArchive{}, "field_id = ?", archive.FieldID).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove expired archive of field %s: %w", archive.FieldID, err)
+		}
+		for _, value := range attachments {
+			var cell interface{}
+			if err := json.Unmarshal(value.Value, &cell); err != nil {
+				log.Printf("Failed to read archived attachments of record %s: %v", value.RecordID, err)
+				continue
+			}
+			deleteCellBlobs(s.BlobStore, &models.Record{ID: value.RecordID, TableID: archive.TableID}, cell)
+		}
+	}
+
+	var incomplete []models.FieldArchive
+	if err := s.db.Where("complete = ? AND expires_at > ?", false, now).Find(&incomplete).Error; err != nil {
+		return err
+	}
+	for _, archive := range incomplete {
+		var field models.Field
+		if err := s.db.Unscoped().First(&field, "id = ?", archive.FieldID).Error; err != nil {
+			return err
+		}
+		if err := s.purgeFieldData(field, true); err != nil {
+			return fmt.Errorf("failed to archive field %s: %w", field.ID, err)
+		}
+	}
+
+	var deleted []models.Field
+	if err := s.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND id NOT IN (?)", s.db.Model(&models.FieldArchive{}).Select("field_id")).
+		Find(&deleted).Error; err != nil {
+		return err
+	}
+	for _, field := range deleted {
+		if err := s.purgeFieldData(field, false); err != nil {
+			return fmt.Errorf("failed to purge field %s: %w", field.ID, err)
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// RunFieldCleanup calls CleanupDeletedFields every interval. It does not return.
+func (s *FieldService) RunFieldCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := s.CleanupDeletedFields(now); err != nil {
+			log.Printf("Failed to clean up deleted fields: %v", err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupFieldDeletionTables(t *testing.T, db *gorm.DB) {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS field_sequences (
+			field_id TEXT PRIMARY KEY,
+			value INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS field_archives (
+			field_id TEXT PRIMARY KEY,
+			table_id TEXT NOT NULL,
+			value_count INTEGER NOT NULL DEFAULT 0,
+			complete BOOLEAN NOT NULL DEFAULT FALSE,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS archived_values (
+			field_id TEXT NOT NULL,
+			record_id TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (field_id, record_id)
+		)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("Failed to create field deletion tables: %v", err)
+		}
+	}
+}
+
+func TestDeleteField_PurgesValues(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	notes := &models.Field{TableID: table.ID, Name: "Notes", Key: "notes", Type: models.FieldTypeText}
+	assert.NoError(t, fieldService.CreateField(title))
+	assert.NoError(t, fieldService.CreateField(notes))
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Write docs", "notes": "draft"}`))
+	assert.NoError(t, err)
+
+	assert.NoError(t, fieldService.DeleteField(notes.ID))
+	data := recordData(t, recordService, record.ID)
+	assert.NotContains(t, data, "notes")
+	assert.Equal(t, "Write docs", data["title"])
+
+	// The field is gone for good, so its key can be used again
+	var count int64
+	assert.NoError(t, db.Unscoped().Model(&models.Field{}).Where("id = ?", notes.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	assert.NoError(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Notes", Key: "notes", Type: models.FieldTypeText}))
+
+	_, err = fieldService.RestoreField(notes.ID)
+	assert.ErrorIs(t, err, ErrArchiveNotFound)
+}
+
+func TestArchiveField_Restore(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	estimate := &models.Field{TableID: table.ID, Name: "Estimate", Key: "estimate", Type: models.FieldTypeNumber}
+	assert.NoError(t, fieldService.CreateField(title))
+	assert.NoError(t, fieldService.CreateField(estimate))
+	first, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Write docs", "estimate": 3}`))
+	assert.NoError(t, err)
+	second, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Review"}`))
+	assert.NoError(t, err)
+
+	archive, err := fieldService.ArchiveField(estimate.ID)
+	assert.NoError(t, err)
+	assert.True(t, archive.Complete)
+	assert.Equal(t, 1, archive.ValueCount)
+	assert.NotContains(t, recordData(t, recordService, first.ID), "estimate")
+
+	archives, err := fieldService.GetArchivedFields(table.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, archives, 1) {
+		assert.Equal(t, "estimate", archives[0].Field.Key)
+	}
+
+	// The key stays reserved while the field can be restored
+	assert.ErrorIs(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Estimate", Key: "estimate", Type: models.FieldTypeText}), ErrDuplicateFieldKey)
+
+	restored, err := fieldService.RestoreField(estimate.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "estimate", restored.Key)
+	assert.Equal(t, 3.0, recordData(t, recordService, first.ID)["estimate"])
+	assert.NotContains(t, recordData(t, recordService, second.ID), "estimate")
+	_, err = fieldService.GetFieldByID(estimate.ID)
+	assert.NoError(t, err)
+
+	_, err = fieldService.RestoreField(estimate.ID)
+	assert.ErrorIs(t, err, ErrArchiveNotFound)
+}
+
+func TestCleanupDeletedFields(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	estimate := &models.Field{TableID: table.ID, Name: "Estimate", Key: "estimate", Type: models.FieldTypeNumber}
+	legacy := &models.Field{TableID: table.ID, Name: "Legacy", Key: "legacy", Type: models.FieldTypeText}
+	assert.NoError(t, fieldService.CreateField(estimate))
+	assert.NoError(t, fieldService.CreateField(legacy))
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"estimate": 3, "legacy": "x"}`))
+	assert.NoError(t, err)
+
+	_, err = fieldService.ArchiveField(estimate.ID)
+	assert.NoError(t, err)
+	// A field deleted without purging its values, as before archives existed
+	assert.NoError(t, db.Delete(&models.Field{}, "id = ?", legacy.ID).Error)
+
+	// Nothing has expired yet, but the unpurged field is cleaned up
+	assert.NoError(t, fieldService.CleanupDeletedFields(time.Now()))
+	assert.NotContains(t, recordData(t, recordService, record.ID), "legacy")
+	archives, err := fieldService.GetArchivedFields(table.ID)
+	assert.NoError(t, err)
+	assert.Len(t, archives, 1)
+
+	assert.NoError(t, fieldService.CleanupDeletedFields(time.Now().Add(fieldService.ArchiveRetention+time.Hour)))
+	var count int64
+	assert.NoError(t, db.Model(&models.ArchivedValue{}).Count(&count).Error)
+	assert.Zero(t, count)
+	assert.NoError(t, db.Unscoped().Model(&models.Field{}).Count(&count).Error)
+	assert.Zero(t, count)
+	_, err = fieldService.RestoreField(estimate.ID)
+	assert.ErrorIs(t, err, ErrArchiveNotFound)
+}
+
+func TestDeleteField_RemovesBlobs(t *testing.T) {
+	db := setupTestDB(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	fieldService := NewFieldService(db)
+	fieldService.BlobStore = store
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Docs"}
+	assert.NoError(t, tableService.CreateTable(table))
+	files := &models.Field{TableID: table.ID, Name: "Files", Key: "files", Type: models.FieldTypeFile}
+	scans := &models.Field{TableID: table.ID, Name: "Scans", Key: "scans", Type: models.FieldTypeFile}
+	assert.NoError(t, fieldService.CreateField(files))
+	assert.NoError(t, fieldService.CreateField(scans))
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{}`))
+	assert.NoError(t, err)
+
+	// One stored attachment in each field
+	file, scan := models.Attachment{ID: uuid.New()}, models.Attachment{ID: uuid.New()}
+	data, err := json.Marshal(map[string][]models.Attachment{"files": {file}, "scans": {scan}})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(&models.Record{}).Where("id = ?", record.ID).Update("data", json.RawMessage(data)).Error)
+	stored := func(attachment models.Attachment) bool {
+		blob, err := store.Get(context.Background(), attachmentKey(record, attachment.ID), 0, -1)
+		if err != nil {
+			return false
+		}
+		blob.Close()
+		return true
+	}
+	for _, attachment := range []models.Attachment{file, scan} {
+		assert.NoError(t, store.Put(context.Background(), attachmentKey(record, attachment.ID), strings.NewReader("x"), 1, "text/plain"))
+	}
+
+	// Deleting a file field removes its blobs
+	assert.NoError(t, fieldService.DeleteField(files.ID))
+	assert.False(t, stored(file))
+	assert.True(t, stored(scan))
+
+	// An archived one keeps them until the archive expires
+	_, err = fieldService.ArchiveField(scans.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, fieldService.CleanupDeletedFields(time.Now()))
+	assert.True(t, stored(scan))
+	assert.NoError(t, fieldService.CleanupDeletedFields(time.Now().Add(fieldService.ArchiveRetention+time.Hour)))
+	assert.False(t, stored(scan))
+
+	// An archive that expires before its values were moved out has them
+	// purged with their blobs
+	photos := &models.Field{TableID: table.ID, Name: "Photos", Key: "photos", Type: models.FieldTypeFile}
+	assert.NoError(t, fieldService.CreateField(photos))
+	photo := models.Attachment{ID: uuid.New()}
+	data, err = json.Marshal(map[string][]models.Attachment{"photos": {photo}})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(&models.Record{}).Where("id = ?", record.ID).Update("data", json.RawMessage(data)).Error)
+	assert.NoError(t, store.Put(context.Background(), attachmentKey(record, photo.ID), strings.NewReader("x"), 1, "text/plain"))
+	assert.NoError(t, db.Create(&models.FieldArchive{FieldID: photos.ID, TableID: table.ID, ExpiresAt: time.Now().Add(-time.Hour)}).Error)
+	assert.NoError(t, db.Delete(&models.Field{}, "id = ?", photos.ID).Error)
+	assert.NoError(t, fieldService.CleanupDeletedFields(time.Now()))
+	assert.NotContains(t, recordData(t, recordService, record.ID), "photos")
+	assert.False(t, stored(photo))
+	var count int64
+	assert.NoError(t, db.Model(&models.FieldArchive{}).Count(&count).Error)
+	assert.Zero(t, count)
+	assert.NoError(t, db.Unscoped().Model(&models.Field{}).Where("id = ?", photos.ID).Count(&count).Error)
+	assert.Zero(t, count)
+}
@@ -1,54 +1,53 @@
 package services
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/storage"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrDuplicateFieldKey is returned when a field key is already used in the table.
+var ErrDuplicateFieldKey = errors.New("field key already exists in this table")
+
 type FieldService struct {
 	db *gorm.DB
+
+	// ArchiveRetention is how long an archived field can be restored.
+	ArchiveRetention time.Duration
+	// BlobStore holds attachments; blobs of purged file fields are removed when set.
+	BlobStore storage.BlobStore
 }
 
 func NewFieldService(db *gorm.DB) *FieldService {
-	return &FieldService{db: db}
+	return &FieldService{db: db, ArchiveRetention: defaultArchiveRetention}
 }
 
 // CreateField creates a new field
 func (s *FieldService) CreateField(field *models.Field) error {
-	// Marshal ValidationRule to JSON before saving
-	validationJSON, err := json.Marshal(field.Validation)
-	if err != nil {
+	if field.Key == "" {
+		field.Key = field.Name
+	}
+	if err := s.ensureKeyAvailable(field); err != nil {
 		return err
 	}
-
-	// Create a temporary struct for saving
-	type FieldForSave struct {
-		ID          uuid.UUID `gorm:"type:uuid;primary_key"`
-		TableID     uuid.UUID `gorm:"type:uuid"`
-		Name        string
-		Key         string
-		Type        models.FieldType
-		Description string
-		Validation  string `gorm:"type:text"`
-		Order       int
+	if err := s.prepareField(field); err != nil {
+		return err
 	}
-
-	fieldForSave := FieldForSave{
-		ID:          field.ID,
-		TableID:     field.TableID,
-		Name:        field.Name,
-		Key:         field.Key,
-		Type:        field.Type,
-		Description: field.Description,
-		Validation:  string(validationJSON),
-		Order:       field.Order,
+	switch field.Type {
+	case models.FieldTypeLink:
+		return s.createLinkField(field)
+	case models.FieldTypeLookup, models.FieldTypeRollup:
+		return s.saveRollupField(field, true)
+	case models.FieldTypeAuto:
+		return s.saveAutoNumberField(field, true)
 	}
-
-	return s.db.Create(&fieldForSave).Error
+	return s.db.Create(field).Error
 }
 
 // GetFieldByID retrieves a field by ID
@@ -69,43 +68,103 @@ func (s *FieldService) GetFieldsByTableID(tableID uuid.UUID) ([]models.Field, er
 	return fields, nil
 }
 
-// UpdateField updates a field
+// UpdateField updates a field. Changing the type converts the stored values
+// (see ConvertField).
 func (s *FieldService) UpdateField(field *models.Field) error {
-	// Marshal ValidationRule to JSON before saving
-	validationJSON, err := json.Marshal(field.Validation)
+	_, err := s.ConvertField(field, false)
+	return err
+}
+
+// ConvertField updates a field and, when its type changes, converts the
+// values stored in the table's records. The result is nil when no values
+// needed converting. With dryRun nothing is saved and the result reports what
+// the conversion would do.
+func (s *FieldService) ConvertField(field *models.Field, dryRun bool) (*ConversionResult, error) {
+	existing, err := s.GetFieldByID(field.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Create a temporary struct for saving
-	type FieldForSave struct {
-		ID          uuid.UUID `gorm:"type:uuid;primary_key"`
-		TableID     uuid.UUID `gorm:"type:uuid"`
-		Name        string
-		Key         string
-		Type        models.FieldType
-		Description string
-		Validation  string `gorm:"type:text"`
-		Order       int
+	if (existing.Type == models.FieldTypeLink) != (field.Type == models.FieldTypeLink) {
+		return nil, &models.ValidationError{Message: "cannot change a field to or from the link type"}
+	}
+	if existing.Type != field.Type && (existing.Type == models.FieldTypeFile || field.Type == models.FieldTypeFile) {
+		return nil, &models.ValidationError{Message: "cannot change a field to or from the file type"}
+	}
+	if field.Type == models.FieldTypeLink {
+		// The relationship is fixed once created
+		field.Options.LinkedTableID = existing.Options.LinkedTableID
+		field.Options.InverseFieldID = existing.Options.InverseFieldID
+	}
+	if err := s.ensureKeyAvailable(field); err != nil {
+		return nil, err
 	}
+	if isSelectField(*existing) && isSelectField(*field) {
+		matchChoices(field, existing)
+	}
+	if err := s.prepareField(field); err != nil {
+		return nil, err
+	}
+	if existing.Type != field.Type && !field.IsComputed() {
+		return s.convertField(existing, field, dryRun)
+	}
+	if dryRun {
+		return &ConversionResult{DryRun: true}, nil
+	}
+	if existing.Key != field.Key {
+		return nil, s.renameField(existing, field)
+	}
+	return nil, s.saveField(existing, field)
+}
 
-	fieldForSave := FieldForSave{
-		ID:          field.ID,
-		TableID:     field.TableID,
-		Name:        field.Name,
-		Key:         field.Key,
-		Type:        field.Type,
-		Description: field.Description,
-		Validation:  string(validationJSON),
-		Order:       field.Order,
+// renameField saves a field whose key changed and moves its values to the new
+// key in every record of the table, in one transaction.
+func (s *FieldService) renameField(existing, field *models.Field) error {
+	var moved int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Views that name the field by its old key follow it by ID
+		if err := storeViewFieldIDs(tx, field.TableID); err != nil {
+			return err
+		}
+		var err error
+		if moved, err = renameRecordKey(tx, field.TableID, existing.Key, field.Key); err != nil {
+			return err
+		}
+		// The values already live under the new key
+		renamed := *existing
+		renamed.Key = field.Key
+		if err := (&FieldService{db: tx}).saveField(&renamed, field); err != nil {
+			return err
+		}
+		return refreshSearchDocuments(tx, field.TableID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename field %s to %s: %w", existing.Key, field.Key, err)
 	}
 
-	return s.db.Save(&fieldForSave).Error
+	publishSchemaUpdate(field.TableID, SchemaUpdateMessage{
+		Type:    "field_renamed",
+		TableID: field.TableID,
+		FieldID: field.ID,
+		Field:   field,
+		OldKey:  existing.Key,
+		Records: moved,
+	})
+	return nil
 }
 
-// DeleteField deletes a field
-func (s *FieldService) DeleteField(id uuid.UUID) error {
-	return s.db.Delete(&models.Field{}, id).Error
+// saveField saves a field whose stored values keep their type, refreshing
+// the cells that depend on its configuration.
+func (s *FieldService) saveField(existing, field *models.Field) error {
+	if isLinkedValueField(*field) {
+		return s.saveRollupField(field, false)
+	}
+	if field.Type == models.FieldTypeAuto && existing.Type != models.FieldTypeAuto {
+		return s.saveAutoNumberField(field, false)
+	}
+	if isSelectField(*field) && existing.Type == field.Type {
+		return s.saveSelectField(field, existing)
+	}
+	return s.db.Save(field).Error
 }
 
 // UpdateFieldOrder updates the order of fields
@@ -114,7 +173,7 @@ func (s *FieldService) UpdateFieldOrder(tableID uuid.UUID, fieldOrders map[uuid.
 		for fieldID, order := range fieldOrders {
 			if err := tx.Model(&models.Field{}).
 				Where("id = ? AND table_id = ?", fieldID, tableID).
-				Update("\"order\"", order).Error; err != nil {
+				Update("order", order).Error; err != nil {
 				return err
 			}
 		}
@@ -122,58 +181,93 @@ func (s *FieldService) UpdateFieldOrder(tableID uuid.UUID, fieldOrders map[uuid.
 	})
 }
 
-// ValidateFieldValue 验证字段值
-func (s *FieldService) ValidateFieldValue(fieldID uuid.UUID, value interface{}) error {
-	field, err := s.GetFieldByID(fieldID)
+// ensureKeyAvailable rejects a key that another field of the same table already uses.
+func (s *FieldService) ensureKeyAvailable(field *models.Field) error {
+	var count int64
+	// Deleted fields keep their key until their values are purged
+	err := s.db.Unscoped().Model(&models.Field{}).
+		Where("table_id = ? AND key = ? AND id != ?", field.TableID, field.Key, field.ID).
+		Count(&count).Error
 	if err != nil {
 		return err
 	}
-	return field.Validate(value)
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateFieldKey, field.Key)
+	}
+	return nil
 }
 
-// 辅助函数
-
-func isValidFieldType(fieldType models.FieldType) bool {
-	switch fieldType {
-	case models.FieldTypeText,
-		models.FieldTypeNumber,
-		models.FieldTypeBoolean,
-		models.FieldTypeDate,
-		models.FieldTypeSelect,
-		models.FieldTypeMulti,
-		models.FieldTypeFile,
-		models.FieldTypeLink,
-		models.FieldTypeFormula,
-		models.FieldTypeAuto:
-		return true
-	default:
-		return false
+// prepareField validates type-specific configuration before the field is saved.
+func (s *FieldService) prepareField(field *models.Field) error {
+	if err := field.Validation.Check(field.Type); err != nil {
+		return err
+	}
+	if field.Type != models.FieldTypeLink {
+		field.Options.LinkedTableID = nil
+		field.Options.InverseFieldID = nil
+	}
+	if field.Type != models.FieldTypeLookup && field.Type != models.FieldTypeRollup {
+		field.Options.LinkFieldID = nil
+		field.Options.LookupFieldID = nil
+		field.Options.RollupFunction = ""
+	}
+	if !isSelectField(*field) {
+		field.Options.Choices = nil
+	}
+	if err := prepareNumberOptions(field); err != nil {
+		return err
+	}
+	if err := prepareDefaultValue(field); err != nil {
+		return err
 	}
-}
 
-func getDefaultValueForType(fieldType models.FieldType) interface{} {
-	switch fieldType {
-	case models.FieldTypeText:
-		return ""
-	case models.FieldTypeNumber:
-		return 0
-	case models.FieldTypeBoolean:
-		return false
-	case models.FieldTypeDate:
-		return nil
-	case models.FieldTypeSelect:
-		return ""
-	case models.FieldTypeMulti:
-		return []string{}
-	case models.FieldTypeFile:
-		return nil
-	case models.FieldTypeLink:
-		return nil
+	switch field.Type {
+	case models.FieldTypeSelect, models.FieldTypeMulti:
+		field.Options.Formula = ""
+		field.Options.ResultType = ""
+		return prepareChoices(field)
 	case models.FieldTypeFormula:
-		return ""
-	case models.FieldTypeAuto:
-		return 0
-	default:
-		return nil
+		return s.prepareFormulaField(field)
+	case models.FieldTypeLookup, models.FieldTypeRollup:
+		field.Options.Formula = ""
+		return s.prepareRollupField(field)
+	}
+	field.Options.Formula = ""
+	field.Options.ResultType = ""
+	return nil
+}
+
+// prepareFormulaField compiles the formula and records its result type.
+func (s *FieldService) prepareFormulaField(field *models.Field) error {
+	tableFields, err := s.GetFieldsByTableID(field.TableID)
+	if err != nil {
+		return err
+	}
+	// Replace the stored version of this field with the one being saved
+	fields := make([]models.Field, 0, len(tableFields)+1)
+	for _, f := range tableFields {
+		if f.ID != field.ID {
+			fields = append(fields, f)
+		}
+	}
+
+	expr, err := compileFormula(*field, fields)
+	if err != nil {
+		return &models.ValidationError{Message: fmt.Sprintf("invalid formula: %v", err)}
+	}
+	field.Options.ResultType = models.FieldType(expr.ResultType())
+
+	if err := checkFormulaCycles(append(fields, *field)); err != nil {
+		return &models.ValidationError{Message: fmt.Sprintf("invalid formula: %v", err)}
 	}
+	return nil
+}
+
+// ValidateFieldValue 验证字段值
+func (s *FieldService) ValidateFieldValue(fieldID uuid.UUID, value interface{}) error {
+	field, err := s.GetFieldByID(fieldID)
+	if err != nil {
+		return err
+	}
+	return field.Validate(value)
 }
@@ -1,18 +1,19 @@
 package services
 
 import (
+	"encoding/json"
 	"testing"
 
+	"airtable-backend/pkg/database/dialect"
 	"airtable-backend/pkg/models"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func setupTestDB(t *testing.T) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, err := gorm.Open(dialect.OpenSQLite(":memory:"), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
@@ -23,6 +24,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		base_id TEXT NOT NULL,
 		name TEXT NOT NULL,
 		description TEXT,
+		unknown_fields TEXT NOT NULL DEFAULT 'reject',
 		created_at DATETIME,
 		updated_at DATETIME,
 		deleted_at DATETIME
@@ -40,6 +42,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		type TEXT NOT NULL,
 		description TEXT,
 		validation TEXT,
+		options TEXT,
 		"order" INTEGER NOT NULL DEFAULT 0,
 		created_at DATETIME,
 		updated_at DATETIME,
@@ -50,6 +53,12 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to create fields table: %v", err)
 	}
 
+	// Field updates rewrite record data
+	setupRecordsTable(t, db)
+	setupFieldDeletionTables(t, db)
+	// Field and table changes update the table's views
+	setupViewsTable(t, db)
+
 	return db
 }
 
@@ -192,6 +201,54 @@ func TestFieldService_UpdateField(t *testing.T) {
 	assert.Equal(t, models.FieldTypeNumber, result.Type)
 }
 
+func TestFieldService_RenameFieldKey(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, service)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Test Table"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	status := &models.Field{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Open"}, {Label: "Done"}}}}
+	assert.NoError(t, service.CreateField(title))
+	assert.NoError(t, service.CreateField(status))
+
+	first, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "First", "status": "Open"}`))
+	assert.NoError(t, err)
+	second, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"status": "Done"}`))
+	assert.NoError(t, err)
+
+	// The values move to the new key
+	title.Key = "name"
+	assert.NoError(t, service.UpdateField(title))
+	data := recordData(t, recordService, first.ID)
+	assert.Equal(t, "First", data["name"])
+	assert.NotContains(t, data, "title")
+
+	// Renaming options and the key at once
+	status.Key = "state"
+	status.Options.Choices[0].Label = "Todo"
+	assert.NoError(t, service.UpdateField(status))
+	assert.Equal(t, "Todo", recordData(t, recordService, first.ID)["state"])
+	assert.Equal(t, "Done", recordData(t, recordService, second.ID)["state"])
+
+	// Keys used by another field are rejected
+	title.Key = "state"
+	assert.ErrorIs(t, service.UpdateField(title), ErrDuplicateFieldKey)
+
+	// So are keys that records still have data under; nothing is changed
+	assert.NoError(t, db.Model(&models.Record{}).Where("id = ?", second.ID).
+		Update("data", json.RawMessage(`{"state": "Done", "legacy": 1}`)).Error)
+	title.Key = "legacy"
+	assert.ErrorIs(t, service.UpdateField(title), ErrDuplicateFieldKey)
+	stored, err := service.GetFieldByID(title.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "name", stored.Key)
+	assert.Equal(t, "First", recordData(t, recordService, first.ID)["name"])
+}
+
 func TestFieldService_DeleteField(t *testing.T) {
 	db := setupTestDB(t)
 	service := NewFieldService(db)
@@ -266,3 +323,57 @@ func TestFieldService_UpdateFieldOrder(t *testing.T) {
 	assert.Equal(t, field2.ID, fields[0].ID)
 	assert.Equal(t, field1.ID, fields[1].ID)
 }
+
+func TestFieldService_CreateFormulaField(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewFieldService(db)
+	tableService := NewTableService(db)
+
+	table := &models.Table{
+		BaseID: uuid.New(),
+		Name:   "Test Table",
+	}
+	err := tableService.CreateTable(table)
+	assert.NoError(t, err)
+
+	assert.NoError(t, service.CreateField(&models.Field{TableID: table.ID, Name: "price", Type: models.FieldTypeNumber}))
+	assert.NoError(t, service.CreateField(&models.Field{TableID: table.ID, Name: "qty", Type: models.FieldTypeNumber}))
+
+	total := &models.Field{
+		TableID: table.ID,
+		Name:    "total",
+		Type:    models.FieldTypeFormula,
+		Options: models.FieldOptions{Formula: "{price} * {qty}"},
+	}
+	err = service.CreateField(total)
+	assert.NoError(t, err)
+	assert.Equal(t, models.FieldTypeNumber, total.Options.ResultType)
+
+	stored, err := service.GetFieldByID(total.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "{price} * {qty}", stored.Options.Formula)
+
+	// Type errors are rejected
+	err = service.CreateField(&models.Field{
+		TableID: table.ID,
+		Name:    "bad",
+		Type:    models.FieldTypeFormula,
+		Options: models.FieldOptions{Formula: `{price} * "x"`},
+	})
+	var validationErr *models.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+
+	// A formula depending on total, then total rewritten to depend on it, is a cycle
+	label := &models.Field{
+		TableID: table.ID,
+		Name:    "label",
+		Type:    models.FieldTypeFormula,
+		Options: models.FieldOptions{Formula: `"Total: " & {total}`},
+	}
+	assert.NoError(t, service.CreateField(label))
+
+	total.Options.Formula = "LEN({label})"
+	err = service.UpdateField(total)
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Contains(t, err.Error(), "circular reference")
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"airtable-backend/pkg/formula"
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// compiledFormula is a formula field ready to be evaluated against records.
+type compiledFormula struct {
+	field models.Field
+	expr  *formula.Expression
+	err   error // set when the stored formula no longer compiles
+}
+
+// formulaTypeOf maps a field to the formula type its values have when
+// referenced from a formula. ok is false for fields formulas cannot use.
+func formulaTypeOf(field models.Field) (formula.Type, bool) {
+	switch field.Type.ValueType() {
+	case models.FieldTypeText, models.FieldTypeSelect:
+		return formula.TypeText, true
+	case models.FieldTypeNumber:
+		return formula.TypeNumber, true
+	case models.FieldTypeBoolean:
+		return formula.TypeBoolean, true
+	case models.FieldTypeDate:
+		return formula.TypeDate, true
+	case models.FieldTypeFormula, models.FieldTypeRollup:
+		if field.Options.ResultType == "" {
+			return "", false
+		}
+		return formula.Type(field.Options.ResultType), true
+	}
+	return "", false
+}
+
+// compileFormula parses and type-checks a formula field against the other
+// fields of its table.
+func compileFormula(field models.Field, tableFields []models.Field) (*formula.Expression, error) {
+	if strings.TrimSpace(field.Options.Formula) == "" {
+		return nil, fmt.Errorf("formula is empty")
+	}
+	expr, err := formula.Parse(field.Options.Formula)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]formula.Type)
+	unusable := make(map[string]models.FieldType)
+	for _, f := range tableFields {
+		if f.Key == field.Key || (field.ID != uuid.Nil && f.ID == field.ID) {
+			continue
+		}
+		if t, ok := formulaTypeOf(f); ok {
+			env[f.Key] = t
+		} else {
+			unusable[f.Key] = f.Type
+		}
+	}
+	for _, ref := range expr.References() {
+		if ref == field.Key {
+			return nil, fmt.Errorf("formula cannot reference its own field {%s}", ref)
+		}
+		if t, ok := unusable[ref]; ok {
+			return nil, fmt.Errorf("field {%s} of type %s cannot be used in a formula", ref, t)
+		}
+	}
+
+	if _, err := expr.Check(env); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// checkFormulaCycles rejects formula fields that depend on each other in a loop.
+func checkFormulaCycles(fields []models.Field) error {
+	deps := make(map[string][]string)
+	for _, f := range fields {
+		if f.Type != models.FieldTypeFormula {
+			continue
+		}
+		expr, err := formula.Parse(f.Options.Formula)
+		if err != nil {
+			continue // broken formulas are reported on their own
+		}
+		deps[f.Key] = expr.References()
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch state[key] {
+		case visiting:
+			start := 0
+			for i, k := range path {
+				if k == key {
+					start = i
+					break
+				}
+			}
+			return fmt.Errorf("circular reference: %s", strings.Join(append(path[start:], key), " -> "))
+		case done:
+			return nil
+		}
+		state[key] = visiting
+		path = append(path, key)
+		for _, dep := range deps[key] {
+			if _, isFormula := deps[dep]; !isFormula {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = done
+		return nil
+	}
+
+	for _, f := range fields {
+		if _, ok := deps[f.Key]; ok {
+			if err := visit(f.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileFormulas compiles every formula field of a table and returns them in
+// dependency order so formulas referencing other formulas see their values.
+func compileFormulas(fields []models.Field) []compiledFormula {
+	byKey := make(map[string]compiledFormula)
+	var keys []string
+	for _, f := range fields {
+		if f.Type != models.FieldTypeFormula {
+			continue
+		}
+		expr, err := compileFormula(f, fields)
+		byKey[f.Key] = compiledFormula{field: f, expr: expr, err: err}
+		keys = append(keys, f.Key)
+	}
+
+	var ordered []compiledFormula
+	visited := make(map[string]bool)
+	var visit func(key string)
+	visit = func(key string) {
+		if visited[key] {
+			return
+		}
+		visited[key] = true
+		cf := byKey[key]
+		if cf.expr != nil {
+			for _, dep := range cf.expr.References() {
+				if _, ok := byKey[dep]; ok {
+					visit(dep)
+				}
+			}
+		}
+		ordered = append(ordered, cf)
+	}
+	for _, key := range keys {
+		visit(key)
+	}
+	return ordered
+}
+
+// evaluateFormulas computes formula values into each record's data. A formula
+// that fails for a record leaves the cell empty and reports the message in
+// the record's CellErrors instead of failing the whole request.
+func evaluateFormulas(records []models.Record, fields []models.Field) error {
+	formulas := compileFormulas(fields)
+	if len(formulas) == 0 {
+		return nil
+	}
+
+	for i := range records {
+		record := &records[i]
+		values := make(map[string]interface{})
+		if len(record.Data) > 0 {
+			if err := json.Unmarshal(record.Data, &values); err != nil {
+				return fmt.Errorf("failed to unmarshal record data: %w", err)
+			}
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+
+		for _, cf := range formulas {
+			var (
+				value interface{}
+				err   = cf.err
+			)
+			if err == nil {
+				value, err = cf.expr.Eval(values)
+			}
+			if err != nil {
+				values[cf.field.Key] = nil
+				if record.CellErrors == nil {
+					record.CellErrors = make(map[string]string)
+				}
+				record.CellErrors[cf.field.Key] = err.Error()
+				continue
+			}
+			values[cf.field.Key] = value
+		}
+
+		data, err := json.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("failed to marshal record data: %w", err)
+		}
+		record.Data = data
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateFormulas(t *testing.T) {
+	fields := []models.Field{
+		{Key: "price", Type: models.FieldTypeNumber},
+		{Key: "qty", Type: models.FieldTypeNumber},
+		// label depends on total, which is declared after it
+		{Key: "label", Type: models.FieldTypeFormula, Options: models.FieldOptions{Formula: `"Total: " & {total}`, ResultType: models.FieldTypeText}},
+		{Key: "total", Type: models.FieldTypeFormula, Options: models.FieldOptions{Formula: "{price} * {qty}", ResultType: models.FieldTypeNumber}},
+		{Key: "unit", Type: models.FieldTypeFormula, Options: models.FieldOptions{Formula: "{price} / {qty}", ResultType: models.FieldTypeNumber}},
+	}
+	records := []models.Record{
+		{Data: json.RawMessage(`{"price": 4, "qty": 2}`)},
+		{Data: json.RawMessage(`{"price": 4, "qty": 0}`)},
+	}
+
+	err := evaluateFormulas(records, fields)
+	assert.NoError(t, err)
+
+	var first map[string]interface{}
+	assert.NoError(t, json.Unmarshal(records[0].Data, &first))
+	assert.Equal(t, 8.0, first["total"])
+	assert.Equal(t, "Total: 8", first["label"])
+	assert.Equal(t, 2.0, first["unit"])
+	assert.Empty(t, records[0].CellErrors)
+
+	// Division by zero is reported for the one cell only
+	var second map[string]interface{}
+	assert.NoError(t, json.Unmarshal(records[1].Data, &second))
+	assert.Equal(t, 0.0, second["total"])
+	assert.Nil(t, second["unit"])
+	assert.Equal(t, map[string]string{"unit": "division by zero"}, records[1].CellErrors)
+}
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recordRef identifies a record together with its table, used to publish
+// updates for records touched as a side effect of another write.
+type recordRef struct {
+	TableID  uuid.UUID
+	RecordID uuid.UUID
+}
+
+// fieldKeyFromName derives a field key the same way the field handler does.
+func fieldKeyFromName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", "_"))
+}
+
+// uniqueFieldKey returns base, or base with a numeric suffix, such that no
+// field of the table (and none of the reserved keys) uses it.
+func uniqueFieldKey(tx *gorm.DB, tableID uuid.UUID, base string, reserved ...string) (string, error) {
+	var existing []string
+	if err := tx.Model(&models.Field{}).Where("table_id = ?", tableID).Pluck("key", &existing).Error; err != nil {
+		return "", err
+	}
+	taken := make(map[string]bool)
+	for _, key := range append(existing, reserved...) {
+		taken[key] = true
+	}
+	key := base
+	for i := 2; taken[key]; i++ {
+		key = fmt.Sprintf("%s_%d", base, i)
+	}
+	return key, nil
+}
+
+// createLinkField creates a link field together with its inverse field on
+// the linked table so the relationship can be navigated from both sides.
+func (s *FieldService) createLinkField(field *models.Field) error {
+	if field.Options.LinkedTableID == nil {
+		return &models.ValidationError{Message: "link field requires options.linkedTableId"}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var source, target models.Table
+		if err := tx.First(&source, "id = ?", field.TableID).Error; err != nil {
+			return fmt.Errorf("failed to load table %s: %w", field.TableID, err)
+		}
+		if err := tx.First(&target, "id = ?", *field.Options.LinkedTableID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return &models.ValidationError{Message: "linked table not found"}
+			}
+			return err
+		}
+		if target.BaseID != source.BaseID {
+			return &models.ValidationError{Message: "linked table must belong to the same base"}
+		}
+
+		if field.ID == uuid.Nil {
+			field.ID = uuid.New()
+		}
+
+		var reserved []string
+		if target.ID == source.ID {
+			reserved = append(reserved, field.Key)
+		}
+		inverseKey, err := uniqueFieldKey(tx, target.ID, fieldKeyFromName(source.Name), reserved...)
+		if err != nil {
+			return err
+		}
+		var order int64
+		if err := tx.Model(&models.Field{}).Where("table_id = ?", target.ID).Count(&order).Error; err != nil {
+			return err
+		}
+
+		sourceID := source.ID
+		inverse := models.Field{
+			ID:      uuid.New(),
+			TableID: target.ID,
+			Name:    source.Name,
+			Key:     inverseKey,
+			Type:    models.FieldTypeLink,
+			Order:   int(order),
+			Options: models.FieldOptions{LinkedTableID: &sourceID, InverseFieldID: &field.ID},
+		}
+		field.Options = models.FieldOptions{LinkedTableID: field.Options.LinkedTableID, InverseFieldID: &inverse.ID}
+
+		if err := tx.Create(field).Error; err != nil {
+			return err
+		}
+		return tx.Create(&inverse).Error
+	})
+}
+
+// deleteInverseField removes the other side of a link field.
+func (s *FieldService) deleteInverseField(tx *gorm.DB, field *models.Field) error {
+	if field.Type != models.FieldTypeLink || field.Options.InverseFieldID == nil {
+		return nil
+	}
+	return tx.Delete(&models.Field{}, *field.Options.InverseFieldID).Error
+}
+
+// removeLinksToTable deletes the link fields of other tables that point at
+// tableID, together with the values they hold. Lookup and rollup fields that
+// read through those links, directly or through other lookups, are deleted
+// with them, since they have nothing left to compute from.
+func removeLinksToTable(tx *gorm.DB, tableID uuid.UUID) error {
+	// Links stay within a base; only the table's own fields and the fields
+	// that read through links matter
+	base := tx.Model(&models.Table{}).Select("base_id").Where("id = ?", tableID)
+	tables := tx.Model(&models.Table{}).Select("id").Where("base_id = (?)", base)
+	var fields []models.Field
+	err := tx.Where("table_id IN (?)", tables).
+		Where("table_id = ? OR type IN ?", tableID, []models.FieldType{models.FieldTypeLink, models.FieldTypeLookup, models.FieldTypeRollup}).
+		Find(&fields).Error
+	if err != nil {
+		return err
+	}
+	removed := make(map[uuid.UUID]bool)
+	for _, field := range fields {
+		if field.TableID == tableID {
+			removed[field.ID] = true
+		}
+	}
+	var dropped []models.Field
+	for grown := true; grown; {
+		grown = false
+		for _, field := range fields {
+			if removed[field.ID] {
+				continue
+			}
+			drop := field.Type == models.FieldTypeLink && field.Options.LinkedTableID != nil && *field.Options.LinkedTableID == tableID
+			if isLinkedValueField(field) {
+				drop = (field.Options.LinkFieldID != nil && removed[*field.Options.LinkFieldID]) ||
+					(field.Options.LookupFieldID != nil && removed[*field.Options.LookupFieldID])
+			}
+			if drop {
+				removed[field.ID] = true
+				dropped = append(dropped, field)
+				grown = true
+			}
+		}
+	}
+
+	keys := make(map[uuid.UUID][]string)
+	for _, field := range dropped {
+		keys[field.TableID] = append(keys[field.TableID], field.Key)
+		if err := tx.Delete(&models.Field{}, field.ID).Error; err != nil {
+			return err
+		}
+	}
+	for table, tableKeys := range keys {
+		if _, err := rewriteRecordData(tx, table, func(_ uuid.UUID, data map[string]interface{}) bool {
+			changed := false
+			for _, key := range tableKeys {
+				if _, ok := data[key]; ok {
+					delete(data, key)
+					changed = true
+				}
+			}
+			return changed
+		}); err != nil {
+			return fmt.Errorf("failed to remove links from table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// parseLinkIDs reads a link cell, which holds an array of record IDs.
+func parseLinkIDs(raw json.RawMessage) ([]uuid.UUID, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("expected an array of record IDs")
+	}
+	ids := make([]uuid.UUID, 0, len(values))
+	seen := make(map[uuid.UUID]bool)
+	for _, v := range values {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record ID %q", v)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// linkIDsFromValue reads a decoded link cell.
+func linkIDsFromValue(value interface{}) []uuid.UUID {
+	items, _ := value.([]interface{})
+	ids := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			if id, err := uuid.Parse(str); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// syncLinks normalises the link cells present in newData and updates the
+// inverse field of every record that was linked or unlinked. It returns the
+// linked records it modified. Links from a record to itself are applied to
+// newData directly, since the record is written after syncLinks returns.
+func (s *RecordService) syncLinks(tx *gorm.DB, tableID, recordID uuid.UUID, fields []models.Field, oldData, newData map[string]json.RawMessage) ([]recordRef, error) {
+	var touched []recordRef
+
+	for _, field := range fields {
+		if field.Type != models.FieldTypeLink || field.Options.LinkedTableID == nil {
+			continue
+		}
+		raw, present := newData[field.Key]
+		if !present {
+			continue
+		}
+		linkedTableID := *field.Options.LinkedTableID
+
+		newIDs, err := parseLinkIDs(raw)
+		if err != nil {
+			return nil, &models.ValidationError{Message: fmt.Sprintf("field %s: %v", field.Key, err)}
+		}
+		oldIDs, _ := parseLinkIDs(oldData[field.Key])
+
+		// All linked records must exist in the linked table
+		var lookup []uuid.UUID
+		for _, id := range newIDs {
+			if id != recordID || linkedTableID != tableID {
+				lookup = append(lookup, id)
+			}
+		}
+		if len(lookup) > 0 {
+			var count int64
+			if err := tx.Model(&models.Record{}).
+				Where("table_id = ? AND id IN ?", linkedTableID, lookup).
+				Count(&count).Error; err != nil {
+				return nil, err
+			}
+			if int(count) != len(lookup) {
+				return nil, &models.ValidationError{Message: fmt.Sprintf("field %s: linked record not found in table %s", field.Key, linkedTableID)}
+			}
+		}
+
+		encoded, err := json.Marshal(linkIDStrings(newIDs))
+		if err != nil {
+			return nil, err
+		}
+		newData[field.Key] = encoded
+
+		inverseKey, err := inverseFieldKey(tx, field)
+		if err != nil {
+			return nil, err
+		}
+		if inverseKey == "" {
+			continue
+		}
+
+		setBacklink := func(targetID uuid.UUID, add bool) error {
+			if targetID == recordID {
+				ids, _ := parseLinkIDs(newData[inverseKey])
+				if ids == nil {
+					ids, _ = parseLinkIDs(oldData[inverseKey])
+				}
+				if next, changed := toggleLinkID(ids, recordID, add); changed {
+					encoded, err := json.Marshal(next)
+					if err != nil {
+						return err
+					}
+					newData[inverseKey] = encoded
+				}
+				return nil
+			}
+			if err := updateBacklink(tx, targetID, inverseKey, recordID, add); err != nil {
+				return err
+			}
+			touched = append(touched, recordRef{TableID: linkedTableID, RecordID: targetID})
+			return nil
+		}
+
+		oldSet := make(map[uuid.UUID]bool)
+		for _, id := range oldIDs {
+			oldSet[id] = true
+		}
+		newSet := make(map[uuid.UUID]bool)
+		for _, id := range newIDs {
+			newSet[id] = true
+			if !oldSet[id] {
+				if err := setBacklink(id, true); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, id := range oldIDs {
+			if !newSet[id] {
+				if err := setBacklink(id, false); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return touched, nil
+}
+
+// unlinkRecord removes a record from the inverse field of everything it links
+// to, ahead of the record being deleted.
+func (s *RecordService) unlinkRecord(tx *gorm.DB, record *models.Record, fields []models.Field) ([]recordRef, error) {
+	data, err := decodeRecordData(record.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var touched []recordRef
+	for _, field := range fields {
+		if field.Type != models.FieldTypeLink || field.Options.LinkedTableID == nil {
+			continue
+		}
+		inverseKey, err := inverseFieldKey(tx, field)
+		if err != nil {
+			return nil, err
+		}
+		if inverseKey == "" {
+			continue
+		}
+		for _, id := range linkIDsFromValue(data[field.Key]) {
+			if id == record.ID {
+				continue
+			}
+			if err := updateBacklink(tx, id, inverseKey, record.ID, false); err != nil {
+				return nil, err
+			}
+			touched = append(touched, recordRef{TableID: *field.Options.LinkedTableID, RecordID: id})
+		}
+	}
+	return touched, nil
+}
+
+// inverseFieldKey returns the key of a link field's inverse, or "" when the
+// inverse no longer exists.
+func inverseFieldKey(tx *gorm.DB, field models.Field) (string, error) {
+	if field.Options.InverseFieldID == nil {
+		return "", nil
+	}
+	var inverse models.Field
+	if err := tx.First(&inverse, "id = ?", *field.Options.InverseFieldID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	return inverse.Key, nil
+}
+
+// updateBacklink adds or removes sourceID in the link cell key of targetID.
+func updateBacklink(tx *gorm.DB, targetID uuid.UUID, key string, sourceID uuid.UUID, add bool) error {
+	var target models.Record
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&target, "id = ?", targetID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil // linked record already gone
+		}
+		return err
+	}
+
+	data, err := decodeRecordData(target.Data)
+	if err != nil {
+		return err
+	}
+	next, changed := toggleLinkID(linkIDsFromValue(data[key]), sourceID, add)
+	if !changed {
+		return nil
+	}
+	data[key] = next
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.Record{}).Where("id = ?", targetID).Update("data", json.RawMessage(encoded)).Error
+}
+
+// toggleLinkID adds or removes id from a list of linked record IDs and
+// reports whether the list changed.
+func toggleLinkID(ids []uuid.UUID, id uuid.UUID, add bool) ([]string, bool) {
+	next := make([]uuid.UUID, 0, len(ids)+1)
+	found := false
+	for _, existing := range ids {
+		if existing == id {
+			found = true
+			if !add {
+				continue
+			}
+		}
+		next = append(next, existing)
+	}
+	if add && !found {
+		next = append(next, id)
+	}
+	return linkIDStrings(next), found != add
+}
+
+// linkIDStrings formats record IDs the way link cells store them.
+func linkIDStrings(ids []uuid.UUID) []string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.String()
+	}
+	return values
+}
+
+// publishLinkedUpdates sends record_updated events for records changed as a
+// side effect of maintaining links.
+func (s *RecordService) publishLinkedUpdates(refs []recordRef) {
+	seen := make(map[uuid.UUID]bool)
+	for _, ref := range refs {
+		if seen[ref.RecordID] {
+			continue
+		}
+		seen[ref.RecordID] = true
+
+		record, err := s.GetRecordByID(ref.RecordID)
+		if err != nil || record == nil {
+			log.Printf("Failed to load linked record %s for update notification: %v", ref.RecordID, err)
+			continue
+		}
+		s.publishUpdate(ref.TableID, RecordUpdateMessage{
+			Type:     "record_updated",
+			TableID:  ref.TableID,
+			RecordID: ref.RecordID,
+			Record:   record,
+		})
+	}
+}
+
+// ExpandLinks fills in record.Expanded with the primary field value of every
+// record referenced by the record's link fields.
+func (s *RecordService) ExpandLinks(record *models.Record) error {
+	fields, err := s.FieldService.GetFieldsByTableID(record.TableID)
+	if err != nil {
+		return fmt.Errorf("failed to get fields for table %s: %w", record.TableID, err)
+	}
+	data, err := decodeRecordData(record.Data)
+	if err != nil {
+		return err
+	}
+
+	expanded := make(map[string][]models.LinkedRecord)
+	for _, field := range fields {
+		if field.Type != models.FieldTypeLink || field.Options.LinkedTableID == nil {
+			continue
+		}
+		ids := linkIDsFromValue(data[field.Key])
+		if len(ids) == 0 {
+			expanded[field.Key] = []models.LinkedRecord{}
+			continue
+		}
+
+		linkedFields, err := s.FieldService.GetFieldsByTableID(*field.Options.LinkedTableID)
+		if err != nil {
+			return fmt.Errorf("failed to get fields for table %s: %w", *field.Options.LinkedTableID, err)
+		}
+		var linked []models.Record
+		if err := s.DB.Where("id IN ?", ids).Find(&linked).Error; err != nil {
+			return fmt.Errorf("failed to load linked records: %w", err)
+		}
+		if err := evaluateFormulas(linked, linkedFields); err != nil {
+			return fmt.Errorf("failed to evaluate formulas: %w", err)
+		}
+
+		byID := make(map[uuid.UUID]models.Record, len(linked))
+		for _, r := range linked {
+			byID[r.ID] = r
+		}
+		refs := make([]models.LinkedRecord, 0, len(ids))
+		for _, id := range ids {
+			linkedRecord, ok := byID[id]
+			if !ok {
+				continue
+			}
+			var primaryValue interface{}
+			if len(linkedFields) > 0 {
+				linkedData, err := decodeRecordData(linkedRecord.Data)
+				if err != nil {
+					return err
+				}
+				primaryValue = linkedData[linkedFields[0].Key]
+			}
+			refs = append(refs, models.LinkedRecord{ID: id, PrimaryValue: primaryValue})
+		}
+		expanded[field.Key] = refs
+	}
+
+	record.Expanded = expanded
+	return nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupRecordsTable(t *testing.T, db *gorm.DB) {
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS records (
+		id TEXT PRIMARY KEY,
+		table_id TEXT NOT NULL,
+		data TEXT,
+		position REAL NOT NULL DEFAULT 0,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create records table: %v", err)
+	}
+	err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_records_table_position
+		ON records (table_id, position) WHERE deleted_at IS NULL`).Error
+	if err != nil {
+		t.Fatalf("Failed to create position index: %v", err)
+	}
+	// Every test writes through the search triggers, as in production
+	if err := dialect.SQLite.CreateSearchIndex(db, query.SearchIndexTypes()); err != nil {
+		t.Fatalf("Failed to create search index: %v", err)
+	}
+}
+
+func recordData(t *testing.T, service *RecordService, id uuid.UUID) map[string]interface{} {
+	t.Helper()
+	record, err := service.findRecord(id)
+	if !assert.NoError(t, err) || !assert.NotNil(t, record) {
+		t.FailNow()
+	}
+	data, err := decodeRecordData(record.Data)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestLinkFields_Bidirectional(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	baseID := uuid.New()
+	projects := &models.Table{BaseID: baseID, Name: "Projects"}
+	tasks := &models.Table{BaseID: baseID, Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(projects))
+	assert.NoError(t, tableService.CreateTable(tasks))
+
+	projectName := &models.Field{TableID: projects.ID, Name: "Name", Key: "name", Type: models.FieldTypeText}
+	assert.NoError(t, fieldService.CreateField(projectName))
+	assert.NoError(t, fieldService.CreateField(&models.Field{TableID: tasks.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}))
+
+	link := &models.Field{
+		TableID: tasks.ID,
+		Name:    "Project",
+		Key:     "project",
+		Type:    models.FieldTypeLink,
+		Options: models.FieldOptions{LinkedTableID: &projects.ID},
+	}
+	assert.NoError(t, fieldService.CreateField(link))
+	if !assert.NotNil(t, link.Options.InverseFieldID) {
+		t.FailNow()
+	}
+
+	inverse, err := fieldService.GetFieldByID(*link.Options.InverseFieldID)
+	assert.NoError(t, err)
+	assert.Equal(t, "tasks", inverse.Key)
+	assert.Equal(t, models.FieldTypeLink, inverse.Type)
+	assert.Equal(t, tasks.ID, *inverse.Options.LinkedTableID)
+	assert.Equal(t, link.ID, *inverse.Options.InverseFieldID)
+
+	// Tables in other bases cannot be linked
+	other := &models.Table{BaseID: uuid.New(), Name: "Other"}
+	assert.NoError(t, tableService.CreateTable(other))
+	err = fieldService.CreateField(&models.Field{TableID: tasks.ID, Name: "Other", Type: models.FieldTypeLink, Options: models.FieldOptions{LinkedTableID: &other.ID}})
+	assert.IsType(t, &models.ValidationError{}, err)
+
+	apollo, err := recordService.CreateRecord(projects.ID, json.RawMessage(`{"name": "Apollo"}`))
+	assert.NoError(t, err)
+	gemini, err := recordService.CreateRecord(projects.ID, json.RawMessage(`{"name": "Gemini"}`))
+	assert.NoError(t, err)
+
+	task, err := recordService.CreateRecord(tasks.ID, json.RawMessage(`{"title": "Launch", "project": ["`+apollo.ID.String()+`", "`+apollo.ID.String()+`"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{apollo.ID.String()}, recordData(t, recordService, task.ID)["project"])
+	assert.Equal(t, []interface{}{task.ID.String()}, recordData(t, recordService, apollo.ID)["tasks"])
+
+	// Moving the task updates both projects
+	_, err = recordService.UpdateRecord(task.ID, json.RawMessage(`{"project": ["`+gemini.ID.String()+`"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{}, recordData(t, recordService, apollo.ID)["tasks"])
+	assert.Equal(t, []interface{}{task.ID.String()}, recordData(t, recordService, gemini.ID)["tasks"])
+
+	// Unknown records are rejected
+	_, err = recordService.UpdateRecord(task.ID, json.RawMessage(`{"project": ["`+uuid.New().String()+`"]}`))
+	assert.Error(t, err)
+
+	// Expansion returns the primary field of the linked records
+	expanded, err := recordService.GetRecordByID(task.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, recordService.ExpandLinks(expanded))
+	assert.Equal(t, []models.LinkedRecord{{ID: gemini.ID, PrimaryValue: "Gemini"}}, expanded.Expanded["project"])
+
+	// Deleting the task removes it from the project
+	assert.NoError(t, recordService.DeleteRecord(task.ID))
+	assert.Equal(t, []interface{}{}, recordData(t, recordService, gemini.ID)["tasks"])
+
+	// Lookups through the link, and rollups over those lookups, go with it
+	names := &models.Field{TableID: tasks.ID, Name: "Project Name", Key: "project_name", Type: models.FieldTypeLookup,
+		Options: models.FieldOptions{LinkFieldID: &link.ID, LookupFieldID: &projectName.ID}}
+	assert.NoError(t, fieldService.CreateField(names))
+	teams := &models.Table{BaseID: baseID, Name: "Teams"}
+	assert.NoError(t, tableService.CreateTable(teams))
+	teamTasks := &models.Field{TableID: teams.ID, Name: "Tasks", Key: "tasks", Type: models.FieldTypeLink, Options: models.FieldOptions{LinkedTableID: &tasks.ID}}
+	assert.NoError(t, fieldService.CreateField(teamTasks))
+	teamProjects := &models.Field{TableID: teams.ID, Name: "Projects", Key: "projects", Type: models.FieldTypeLookup,
+		Options: models.FieldOptions{LinkFieldID: &teamTasks.ID, LookupFieldID: &names.ID}}
+	assert.NoError(t, fieldService.CreateField(teamProjects))
+	task, err = recordService.CreateRecord(tasks.ID, json.RawMessage(`{"title": "Orbit", "project": ["`+gemini.ID.String()+`"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"Gemini"}, recordData(t, recordService, task.ID)["project_name"])
+
+	// Deleting the linked table removes the link field
+	assert.NoError(t, tableService.DeleteTable(projects.ID))
+	_, err = fieldService.GetFieldByID(link.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	for _, id := range []uuid.UUID{names.ID, teamProjects.ID} {
+		_, err = fieldService.GetFieldByID(id)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	}
+	_, err = fieldService.GetFieldByID(teamTasks.ID)
+	assert.NoError(t, err)
+	data := recordData(t, recordService, task.ID)
+	assert.NotContains(t, data, "project")
+	assert.NotContains(t, data, "project_name")
+	assert.Equal(t, "Orbit", data["title"])
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"airtable-backend/pkg/models"
+)
+
+const (
+	defaultCurrencyCode = "USD"
+	maxPrecision        = 8
+	maxRating           = 10
+)
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// prepareNumberOptions checks the options of currency, percent and rating
+// fields and clears them on other types.
+func prepareNumberOptions(field *models.Field) error {
+	if field.Type != models.FieldTypeCurrency {
+		field.Options.CurrencyCode = ""
+	}
+	if field.Type != models.FieldTypeCurrency && field.Type != models.FieldTypePercent {
+		field.Options.Precision = nil
+	}
+	if field.Type != models.FieldTypeRating {
+		field.Options.Max = 0
+	}
+
+	switch field.Type {
+	case models.FieldTypeCurrency:
+		code := strings.ToUpper(strings.TrimSpace(field.Options.CurrencyCode))
+		if code == "" {
+			code = defaultCurrencyCode
+		}
+		if !currencyCodePattern.MatchString(code) {
+			return &models.ValidationError{Message: fmt.Sprintf("invalid currency code: %s", field.Options.CurrencyCode)}
+		}
+		field.Options.CurrencyCode = code
+	case models.FieldTypeRating:
+		if field.Options.Max == 0 {
+			field.Options.Max = field.RatingMax()
+		}
+		if field.Options.Max < 1 || field.Options.Max > maxRating {
+			return &models.ValidationError{Message: fmt.Sprintf("rating max must be between 1 and %d", maxRating)}
+		}
+	}
+	if p := field.Options.Precision; p != nil && (*p < 0 || *p > maxPrecision) {
+		return &models.ValidationError{Message: fmt.Sprintf("precision must be between 0 and %d", maxPrecision)}
+	}
+	return nil
+}
+
+// coerceNumberValue converts a value of a currency, percent, rating or
+// duration field to the number that is stored. Strings may carry the usual
+// formatting: "$1,234.50", "25%", "1:30:00" or "90m".
+func coerceNumberValue(field models.Field, value interface{}) (interface{}, error) {
+	num, ok := value.(float64)
+	if str, isString := value.(string); isString {
+		var err error
+		switch field.Type {
+		case models.FieldTypeCurrency:
+			num, err = parseCurrency(str, field.Options.CurrencyCode)
+		case models.FieldTypePercent:
+			num, err = parsePercent(str)
+		case models.FieldTypeDuration:
+			num, err = parseDuration(str)
+		default:
+			num, err = strconv.ParseFloat(str, 64)
+		}
+		ok = err == nil && isFinite(num)
+	}
+	if !ok {
+		switch field.Type {
+		case models.FieldTypeCurrency:
+			return nil, &models.ValidationError{Message: "Expected an amount"}
+		case models.FieldTypePercent:
+			return nil, &models.ValidationError{Message: "Expected a percentage"}
+		case models.FieldTypeDuration:
+			return nil, &models.ValidationError{Message: "Expected a duration in seconds or h:mm:ss"}
+		}
+		return nil, &models.ValidationError{Message: "Expected a number"}
+	}
+
+	if field.Type == models.FieldTypeCurrency || field.Type == models.FieldTypePercent {
+		scale := math.Pow(10, float64(field.DecimalPlaces()))
+		num = math.Round(num*scale) / scale
+	}
+	return num, nil
+}
+
+// isFinite reports whether num can be stored in a cell; JSON has no NaN or
+// infinities.
+func isFinite(num float64) bool {
+	return !math.IsNaN(num) && !math.IsInf(num, 0)
+}
+
+// parseCurrency reads an amount, ignoring currency symbols, the field's
+// currency code and thousands separators.
+func parseCurrency(value, code string) (float64, error) {
+	s := strings.TrimSpace(value)
+	if code != "" {
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, code), code))
+	}
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	s = strings.TrimLeftFunc(s, func(r rune) bool { return unicode.Is(unicode.Sc, r) })
+	s = strings.NewReplacer(",", "", " ", "", "_", "").Replace(s)
+	num, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		num = -num
+	}
+	return num, nil
+}
+
+// parsePercent reads "25%" as 0.25; strings without a percent sign are
+// taken as fractions like numbers are.
+func parsePercent(value string) (float64, error) {
+	s := strings.TrimSpace(value)
+	if trimmed := strings.TrimSuffix(s, "%"); trimmed != s {
+		num, err := strconv.ParseFloat(strings.TrimSpace(trimmed), 64)
+		return num / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseDuration reads a number of seconds, h:mm or h:mm:ss, or a Go duration
+// such as "1h30m", and returns seconds.
+func parseDuration(value string) (float64, error) {
+	s := strings.TrimSpace(value)
+	if num, err := strconv.ParseFloat(s, 64); err == nil {
+		return num, nil
+	}
+	if parts := strings.Split(s, ":"); len(parts) == 2 || len(parts) == 3 {
+		var seconds float64
+		for i, part := range parts {
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil || n < 0 || (i > 0 && n >= 60) {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			seconds = seconds*60 + n
+		}
+		if len(parts) == 2 {
+			seconds *= 60 // h:mm
+		}
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]float64{
+		"90":      90,
+		"1:30":    5400,
+		"1:30:15": 5415,
+		"1h30m":   5400,
+		"45s":     45,
+	}
+	for input, want := range cases {
+		got, err := parseDuration(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	_, err := parseDuration("1:75")
+	assert.Error(t, err)
+}
+
+func TestScalarFieldTypes(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Deals"}
+	assert.NoError(t, tableService.CreateTable(table))
+
+	price := &models.Field{TableID: table.ID, Name: "Price", Key: "price", Type: models.FieldTypeCurrency,
+		Options: models.FieldOptions{CurrencyCode: "eur"}}
+	discount := &models.Field{TableID: table.ID, Name: "Discount", Key: "discount", Type: models.FieldTypePercent}
+	score := &models.Field{TableID: table.ID, Name: "Score", Key: "score", Type: models.FieldTypeRating}
+	contact := &models.Field{TableID: table.ID, Name: "Contact", Key: "contact", Type: models.FieldTypeEmail}
+	site := &models.Field{TableID: table.ID, Name: "Site", Key: "site", Type: models.FieldTypeURL}
+	phone := &models.Field{TableID: table.ID, Name: "Phone", Key: "phone", Type: models.FieldTypePhone}
+	call := &models.Field{TableID: table.ID, Name: "Call", Key: "call", Type: models.FieldTypeDuration}
+	for _, field := range []*models.Field{price, discount, score, contact, site, phone, call} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	assert.Equal(t, "EUR", price.Options.CurrencyCode)
+	assert.Equal(t, 5, score.Options.Max)
+
+	var validationErr *models.ValidationError
+	assert.ErrorAs(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Bad", Key: "bad", Type: models.FieldTypeCurrency,
+		Options: models.FieldOptions{CurrencyCode: "euro"}}), &validationErr)
+
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{
+		"price": "EUR 1,234.567",
+		"discount": "12.5%",
+		"score": 4,
+		"contact": "ann@example.com",
+		"site": "https://example.com",
+		"phone": "+44 20 7946 0958",
+		"call": "0:45"
+	}`))
+	assert.NoError(t, err)
+	data := recordData(t, recordService, record.ID)
+	assert.Equal(t, 1234.57, data["price"])
+	assert.Equal(t, 0.125, data["discount"])
+	assert.Equal(t, 4.0, data["score"])
+	assert.Equal(t, 2700.0, data["call"])
+
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{
+		"score": 6,
+		"contact": "ann",
+		"site": "example.com",
+		"phone": "call me",
+		"price": "NaN",
+		"discount": "Inf%",
+		"call": -5
+	}`))
+	var recordErr *models.RecordValidationError
+	if assert.ErrorAs(t, err, &recordErr) {
+		failed := make([]string, 0, len(recordErr.Errors))
+		for _, fieldErr := range recordErr.Errors {
+			failed = append(failed, fieldErr.Field)
+		}
+		assert.Equal(t, []string{"price", "discount", "score", "contact", "site", "phone", "call"}, failed)
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxPivotRows and MaxPivotColumns bound the size of a pivot; larger
+	// ones need a coarser date bucket or a filter.
+	MaxPivotRows    = 1000
+	MaxPivotColumns = 200
+)
+
+type PivotService struct {
+	db *gorm.DB
+}
+
+func NewPivotService(db *gorm.DB) *PivotService {
+	return &PivotService{db: db}
+}
+
+// pivotRow is a row of the pivot statement: a cell, a row total, a column
+// total or the grand total, as told by which keys it is grouped by.
+type pivotRow struct {
+	byRow, byColumn bool
+	row, column     *string
+	count           int64
+	measure         *float64
+}
+
+// pivotHeaders collects the rows or the columns of a pivot.
+type pivotHeaders struct {
+	level   groupLevel
+	headers []models.PivotHeader
+	index   map[string]int
+}
+
+func (h *pivotHeaders) add(key *string, count int64, total *float64) {
+	h.headers = append(h.headers, models.PivotHeader{Value: query.GroupValue(h.level.field, key), Count: count, Total: total})
+	h.index[groupMapKey(key)] = len(h.headers) - 1
+}
+
+// sort puts the headers in group order and reindexes them; empty values
+// stay last in either direction, as with grouped records.
+func (h *pivotHeaders) sort() {
+	keys := make([]string, 0, len(h.index))
+	for key := range h.index {
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := h.headers[h.index[keys[i]]].Value, h.headers[h.index[keys[j]]].Value
+		if h.level.descending && a != nil && b != nil {
+			a, b = b, a
+		}
+		return query.CompareGroupValues(h.level.field, a, b) < 0
+	})
+	sorted := make([]models.PivotHeader, len(keys))
+	for i, key := range keys {
+		sorted[i] = h.headers[h.index[key]]
+		h.index[key] = i
+	}
+	h.headers = sorted
+}
+
+// Pivot cross tabulates the records of a table as p asks, reading every
+// cell and total with a single statement. Problems with p are reported as
+// *models.ValidationError.
+func (s *PivotService) Pivot(tableID uuid.UUID, p query.Pivot) (*models.PivotResult, error) {
+	if _, err := loadTable(s.db, tableID); err != nil {
+		return nil, err
+	}
+	fields, err := NewFieldService(s.db).GetFieldsByTableID(tableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields for table %s: %w", tableID, err)
+	}
+	fieldMap := query.FieldMap(fields)
+
+	d := dialect.For(s.db)
+	if p.Rows.FieldID == "" || p.Columns.FieldID == "" {
+		return nil, &models.ValidationError{Message: "rows and columns must both name a field"}
+	}
+	levels, err := resolveGroupLevels(d, fieldMap, []query.GroupBy{p.Rows, p.Columns})
+	if err != nil {
+		return nil, err
+	}
+	var measured *models.Field
+	if p.Measure.FieldID != "" {
+		field, ok := fieldMap[p.Measure.FieldID]
+		if !ok {
+			return nil, &models.ValidationError{Message: fmt.Sprintf("unknown measure field: %s", p.Measure.FieldID)}
+		}
+		measured = &field
+	}
+	value, valueArgs, aggregate, err := query.BuildMeasure(d, measured, p.Measure)
+	if err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
+	}
+	filterClause, filterArgs, err := query.BuildFilterClause(d, fieldMap, p.Filter)
+	if err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
+	}
+
+	// cells holds the row key, column key and measured value of every
+	// record; the branches below summarise it per cell, per row, per
+	// column and overall
+	args := append(append(append([]interface{}{}, levels[0].args...), levels[1].args...), valueArgs...)
+	cells := s.db.Model(&models.Record{}).
+		Where("table_id = ?", tableID).
+		Select(fmt.Sprintf("%s AS r, %s AS c, %s AS v", levels[0].key, levels[1].key, value), args...)
+	if filterClause != "" {
+		cells = cells.Where(filterClause, filterArgs...)
+	}
+	measure := strings.ReplaceAll(aggregate, "%s", "v")
+	statement := "WITH cells AS (?) " + strings.Join([]string{
+		"SELECT 1 AS by_row, 1 AS by_column, r, c, COUNT(*) AS n, " + measure + " AS m FROM cells GROUP BY r, c",
+		"SELECT 1, 0, r, NULL, COUNT(*), " + measure + " FROM cells GROUP BY r",
+		"SELECT 0, 1, NULL, c, COUNT(*), " + measure + " FROM cells GROUP BY c",
+		"SELECT 0, 0, NULL, NULL, COUNT(*), " + measure + " FROM cells",
+	}, " UNION ALL ")
+	pivotRows, err := s.readPivot(statement, cells)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.PivotResult{
+		RowField:    levels[0].field.Key,
+		ColumnField: levels[1].field.Key,
+		Measure:     p.Measure.Name(measured),
+	}
+	rows := &pivotHeaders{level: levels[0], index: make(map[string]int)}
+	columns := &pivotHeaders{level: levels[1], index: make(map[string]int)}
+	for _, row := range pivotRows {
+		switch {
+		case row.byRow && !row.byColumn:
+			rows.add(row.row, row.count, row.measure)
+		case row.byColumn && !row.byRow:
+			columns.add(row.column, row.count, row.measure)
+		case !row.byRow && !row.byColumn:
+			result.Count, result.Total = row.count, row.measure
+		}
+	}
+	if len(rows.headers) > MaxPivotRows {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("the pivot has %d rows, at most %d are supported", len(rows.headers), MaxPivotRows)}
+	}
+	if len(columns.headers) > MaxPivotColumns {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("the pivot has %d columns, at most %d are supported", len(columns.headers), MaxPivotColumns)}
+	}
+	rows.sort()
+	columns.sort()
+	result.Rows, result.Columns = rows.headers, columns.headers
+
+	// Cells without records count and sum to zero and have no average
+	result.Values = make([][]*float64, len(rows.headers))
+	result.Counts = make([][]int64, len(rows.headers))
+	for i := range result.Values {
+		result.Values[i] = make([]*float64, len(columns.headers))
+		result.Counts[i] = make([]int64, len(columns.headers))
+		if p.Measure.Function != models.AggregateAvg {
+			for j := range result.Values[i] {
+				result.Values[i][j] = new(float64)
+			}
+		}
+	}
+	for _, row := range pivotRows {
+		if row.byRow && row.byColumn {
+			i, j := rows.index[groupMapKey(row.row)], columns.index[groupMapKey(row.column)]
+			result.Values[i][j], result.Counts[i][j] = row.measure, row.count
+		}
+	}
+	return result, nil
+}
+
+// readPivot runs the pivot statement over cells.
+func (s *PivotService) readPivot(statement string, cells *gorm.DB) ([]pivotRow, error) {
+	rows, err := s.db.Raw(statement, cells).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pivot: %w", err)
+	}
+	defer rows.Close()
+
+	var result []pivotRow
+	for rows.Next() {
+		var row pivotRow
+		var byRow, byColumn int64
+		var measure sql.NullFloat64
+		if err := rows.Scan(&byRow, &byColumn, &row.row, &row.column, &row.count, &measure); err != nil {
+			return nil, fmt.Errorf("failed to read pivot: %w", err)
+		}
+		row.byRow, row.byColumn = byRow == 1, byColumn == 1
+		if measure.Valid {
+			row.measure = &measure.Float64
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pivot: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPivot(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	pivotService := NewPivotService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Deals"}
+	assert.NoError(t, tableService.CreateTable(table))
+	stage := &models.Field{TableID: table.ID, Name: "Stage", Key: "stage", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Lead"}, {Label: "Won"}, {Label: "Lost"}}}}
+	closed := &models.Field{TableID: table.ID, Name: "Closed", Key: "closed", Type: models.FieldTypeDate}
+	amount := &models.Field{TableID: table.ID, Name: "Amount", Key: "amount", Type: models.FieldTypeNumber}
+	owner := &models.Field{TableID: table.ID, Name: "Owner", Key: "owner", Type: models.FieldTypeText}
+	for _, field := range []*models.Field{stage, closed, amount, owner} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	for _, data := range []string{
+		`{"stage": "Won", "closed": "2024-01-05", "amount": 100, "owner": "ann"}`,
+		`{"stage": "Won", "closed": "2024-01-20", "amount": 50, "owner": "bob"}`,
+		`{"stage": "Lost", "closed": "2024-01-09", "amount": 30, "owner": "ann"}`,
+		`{"stage": "Won", "closed": "2024-02-02", "amount": 10, "owner": "ann"}`,
+		`{"stage": "Lead", "amount": 70, "owner": "bob"}`,
+		`{"closed": "2024-02-10", "owner": "cy"}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	result, err := pivotService.Pivot(table.ID, query.Pivot{
+		Rows:    query.GroupBy{FieldID: "stage"},
+		Columns: query.GroupBy{FieldID: closed.ID.String(), Bucket: query.BucketMonth},
+		Measure: query.Measure{Function: models.AggregateSum, FieldID: "amount"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "stage", result.RowField)
+	assert.Equal(t, "closed", result.ColumnField)
+	assert.Equal(t, "sum:amount", result.Measure)
+
+	values := func(headers []models.PivotHeader) []interface{} {
+		out := []interface{}{}
+		for _, header := range headers {
+			out = append(out, header.Value)
+		}
+		return out
+	}
+	// Rows follow the choices, empty values come last
+	assert.Equal(t, []interface{}{"Lead", "Won", "Lost", nil}, values(result.Rows))
+	assert.Equal(t, []interface{}{"2024-01-01", "2024-02-01", nil}, values(result.Columns))
+	assert.Equal(t, [][]*float64{
+		{ptr(0.0), ptr(0.0), ptr(70.0)},
+		{ptr(150.0), ptr(10.0), ptr(0.0)},
+		{ptr(30.0), ptr(0.0), ptr(0.0)},
+		{ptr(0.0), ptr(0.0), ptr(0.0)},
+	}, result.Values)
+	assert.Equal(t, []int64{0, 1, 0}, result.Counts[3])
+	assert.Equal(t, int64(3), result.Rows[1].Count)
+	assert.Equal(t, 160.0, *result.Rows[1].Total)
+	assert.Equal(t, 180.0, *result.Columns[0].Total)
+	assert.Equal(t, int64(6), result.Count)
+	assert.Equal(t, 260.0, *result.Total)
+
+	// Averages are taken over the records, not over the cells
+	result, err = pivotService.Pivot(table.ID, query.Pivot{
+		Rows:    query.GroupBy{FieldID: "owner", Direction: "desc"},
+		Columns: query.GroupBy{FieldID: "stage"},
+		Measure: query.Measure{Function: models.AggregateAvg, FieldID: "amount"},
+		Filter:  &query.FilterGroup{Conditions: []json.RawMessage{json.RawMessage(`{"fieldId": "owner", "operator": "!=", "value": "cy"}`)}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"bob", "ann"}, values(result.Rows))
+	assert.Equal(t, []interface{}{"Lead", "Won", "Lost"}, values(result.Columns))
+	assert.Nil(t, result.Values[1][0])
+	assert.Equal(t, 55.0, *result.Values[1][1])
+	assert.InDelta(t, 46.67, *result.Rows[1].Total, 0.01)
+	assert.Equal(t, 52.0, *result.Total)
+
+	// Counting is the default measure
+	result, err = pivotService.Pivot(table.ID, query.Pivot{
+		Rows:    query.GroupBy{FieldID: "owner"},
+		Columns: query.GroupBy{FieldID: "stage"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "count", result.Measure)
+	assert.Equal(t, []*float64{ptr(0.0), ptr(2.0), ptr(1.0), ptr(0.0)}, result.Values[0])
+	assert.Equal(t, 6.0, *result.Total)
+
+	var validationErr *models.ValidationError
+	for name, p := range map[string]query.Pivot{
+		"no columns":     {Rows: query.GroupBy{FieldID: "stage"}},
+		"unknown field":  {Rows: query.GroupBy{FieldID: "missing"}, Columns: query.GroupBy{FieldID: "stage"}},
+		"bucket on text": {Rows: query.GroupBy{FieldID: "owner", Bucket: query.BucketMonth}, Columns: query.GroupBy{FieldID: "stage"}},
+		"sum of text": {Rows: query.GroupBy{FieldID: "owner"}, Columns: query.GroupBy{FieldID: "stage"},
+			Measure: query.Measure{Function: models.AggregateSum, FieldID: "owner"}},
+		"sum of nothing": {Rows: query.GroupBy{FieldID: "owner"}, Columns: query.GroupBy{FieldID: "stage"},
+			Measure: query.Measure{Function: models.AggregateSum}},
+		"median": {Rows: query.GroupBy{FieldID: "owner"}, Columns: query.GroupBy{FieldID: "stage"},
+			Measure: query.Measure{Function: models.AggregateMedian, FieldID: "amount"}},
+	} {
+		_, err := pivotService.Pivot(table.ID, p)
+		assert.ErrorAs(t, err, &validationErr, name)
+	}
+	_, err = pivotService.Pivot(uuid.New(), query.Pivot{Rows: query.GroupBy{FieldID: "stage"}, Columns: query.GroupBy{FieldID: "owner"}})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"gorm.io/gorm"
+)
+
+// queryPage reads the page of records selected by filtered that req asks
+// for, by page number or by cursor, into result along with the cursors of
+// the neighbouring pages. Cursors hold the sort values of the records at
+// the edges of the page, so pages do not shift when records are added or
+// removed in between.
+func (s *QueryService) queryPage(filtered func() *gorm.DB, fieldMap map[string]models.Field, fields []models.Field, req query.Request, result *models.QueryResult) error {
+	d := dialect.For(s.db)
+	var cursor *query.Cursor
+	if req.Cursor != "" {
+		var err error
+		if cursor, err = query.DecodeCursor(req.Cursor, req.Sort); err != nil {
+			return &models.ValidationError{Message: err.Error()}
+		}
+	}
+
+	// Pages before a cursor are read backwards and put in order afterwards
+	sorts, tiebreak := req.Sort, "position ASC, id ASC"
+	if cursor != nil && cursor.Before {
+		sorts, tiebreak = query.ReverseSorts(req.Sort), "position DESC, id DESC"
+	}
+	orderBy, orderArgs, err := query.BuildOrderClause(d, fieldMap, sorts)
+	if err != nil {
+		return &models.ValidationError{Message: err.Error()}
+	}
+	if orderBy == "" && req.RankedBySearch() {
+		orderBy = searchRankOrder
+	}
+	if orderBy != "" {
+		orderBy += ", "
+	}
+	orderBy += tiebreak
+
+	q := filtered().Order(query.OrderExpression(orderBy, orderArgs))
+	if cursor != nil {
+		keyset, keysetArgs, err := query.BuildKeysetClause(d, fieldMap, req.Sort, cursor)
+		if err != nil {
+			return &models.ValidationError{Message: err.Error()}
+		}
+		q = q.Where(keyset, keysetArgs...)
+	} else {
+		q = q.Offset(req.Offset())
+	}
+
+	// One record more than the page tells whether another page follows
+	var records []models.Record
+	if err := q.Limit(req.PageSize + 1).Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to retrieve records: %w", err)
+	}
+	more := len(records) > req.PageSize
+	if more {
+		records = records[:req.PageSize]
+	}
+	if cursor != nil && cursor.Before {
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+
+	// Going forwards there are records before the page unless it is the
+	// first; going backwards the page ends just before the cursor record
+	hasNext, hasPrev := more, cursor != nil || req.Page > 1
+	if cursor != nil && cursor.Before {
+		hasNext, hasPrev = true, more
+	}
+	// Search scores are not part of cursors
+	if len(records) > 0 && !req.RankedBySearch() {
+		if hasNext {
+			if result.NextCursor, err = s.cursorAt(d, fieldMap, req.Sort, records[len(records)-1], false); err != nil {
+				return err
+			}
+		}
+		if hasPrev {
+			if result.PrevCursor, err = s.cursorAt(d, fieldMap, req.Sort, records[0], true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := prepareRecords(records, fieldMap, fields); err != nil {
+		return err
+	}
+	if err := s.addSearchHits(records, fields, req.Search); err != nil {
+		return err
+	}
+	result.Records = records
+	return nil
+}
+
+// cursorAt returns the encoded cursor of a record, reading its sort values
+// as the database compares them.
+func (s *QueryService) cursorAt(d dialect.Dialect, fieldMap map[string]models.Field, sorts []query.Sort, record models.Record, before bool) (string, error) {
+	cursor := query.Cursor{Sort: query.SortSignature(sorts), Position: record.Position, ID: record.ID, Before: before}
+	if len(sorts) > 0 {
+		keys := make([]string, len(sorts))
+		var args []interface{}
+		for i, sort := range sorts {
+			key, keyArgs := query.BuildSortKey(d, fieldMap[sort.FieldID])
+			keys[i] = key
+			args = append(args, keyArgs...)
+		}
+		args = append(args, record.ID)
+
+		cursor.Values = make([]interface{}, len(sorts))
+		targets := make([]interface{}, len(sorts))
+		for i := range targets {
+			targets[i] = &cursor.Values[i]
+		}
+		row := s.db.Raw("SELECT "+strings.Join(keys, ", ")+" FROM records WHERE id = ?", args...).Row()
+		if err := row.Scan(targets...); err != nil {
+			return "", fmt.Errorf("failed to read cursor values: %w", err)
+		}
+		for i, value := range cursor.Values {
+			cursor.Values[i] = query.CursorValue(value)
+		}
+	}
+	return cursor.Encode(), nil
+}
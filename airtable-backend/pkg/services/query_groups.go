@@ -0,0 +1,246 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"gorm.io/gorm"
+)
+
+// groupLevel is a level of a grouped query resolved against the table's
+// fields: the SQL key the records are grouped by and how groups are sorted.
+type groupLevel struct {
+	field      models.Field
+	key        string
+	args       []interface{}
+	descending bool
+}
+
+// groupNode is a group while its levels are being read; children are
+// indexed by group key.
+type groupNode struct {
+	group    models.RecordGroup
+	children map[string]*groupNode
+}
+
+// groupMapKey tells the empty group (a NULL key) apart from every value.
+func groupMapKey(key *string) string {
+	if key == nil {
+		return "null"
+	}
+	return "=" + *key
+}
+
+// find follows a path of group keys down from n, returning nil if a group
+// on the path does not exist.
+func (n *groupNode) find(path []*string) *groupNode {
+	for _, key := range path {
+		if n = n.children[groupMapKey(key)]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// result returns the groups below n, sorted level by level.
+func (n *groupNode) result(levels []groupLevel) []models.RecordGroup {
+	if len(n.children) == 0 || len(levels) == 0 {
+		return nil
+	}
+	level := levels[0]
+	groups := make([]models.RecordGroup, 0, len(n.children))
+	for _, child := range n.children {
+		group := child.group
+		group.Groups = child.result(levels[1:])
+		groups = append(groups, group)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].Value, groups[j].Value
+		// Empty groups stay last in either direction
+		if level.descending && a != nil && b != nil {
+			a, b = b, a
+		}
+		return query.CompareGroupValues(level.field, a, b) < 0
+	})
+	return groups
+}
+
+// groupedRecord is a record read together with the keys of its groups and
+// its position within its innermost group.
+type groupedRecord struct {
+	models.Record
+	G0, G1, G2 *string
+	GroupRow   int64
+}
+
+func (r *groupedRecord) path(depth int) []*string {
+	return []*string{r.G0, r.G1, r.G2}[:depth]
+}
+
+// queryGroups groups the records selected by filtered as req.GroupBy asks.
+// Every group has its record count and req.Aggregates; the innermost groups
+// hold the requested page of their records, ordered by orderBy.
+func (s *QueryService) queryGroups(filtered func() *gorm.DB, fieldMap map[string]models.Field, fields []models.Field, req query.Request, orderBy string, orderArgs []interface{}) ([]models.RecordGroup, error) {
+	d := dialect.For(s.db)
+	levels, err := resolveGroupLevels(d, fieldMap, req.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	aggSelects, aggArgs, aggNames, err := aggregateSelects(d, fieldMap, req.Aggregates)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each level is read with its own query so that every group, not only
+	// the innermost ones, gets its count and aggregates
+	root := &groupNode{}
+	for depth := 1; depth <= len(levels); depth++ {
+		if err := loadGroupLevel(filtered(), root, levels[:depth], aggSelects, aggArgs, aggNames); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.loadGroupRecords(filtered(), root, levels, req, orderBy, orderArgs, fieldMap, fields); err != nil {
+		return nil, err
+	}
+	return root.result(levels), nil
+}
+
+func resolveGroupLevels(d dialect.Dialect, fieldMap map[string]models.Field, groupBy []query.GroupBy) ([]groupLevel, error) {
+	levels := make([]groupLevel, 0, len(groupBy))
+	for _, group := range groupBy {
+		field, ok := fieldMap[group.FieldID]
+		if !ok {
+			return nil, &models.ValidationError{Message: fmt.Sprintf("unknown group field: %s", group.FieldID)}
+		}
+		descending, err := group.Descending()
+		if err != nil {
+			return nil, &models.ValidationError{Message: err.Error()}
+		}
+		key, args, err := query.BuildGroupKey(d, field, group.Bucket)
+		if err != nil {
+			return nil, &models.ValidationError{Message: err.Error()}
+		}
+		levels = append(levels, groupLevel{field: field, key: key, args: args, descending: descending})
+	}
+	return levels, nil
+}
+
+// groupKeySelects returns the select list entries g0, g1, ... reading the
+// group keys of levels, and the arguments they bind.
+func groupKeySelects(levels []groupLevel) ([]string, []interface{}) {
+	selects := make([]string, len(levels))
+	var args []interface{}
+	for i, level := range levels {
+		selects[i] = fmt.Sprintf("%s AS g%d", level.key, i)
+		args = append(args, level.args...)
+	}
+	return selects, args
+}
+
+// loadGroupLevel reads the groups of the innermost of levels, with their
+// counts and aggregates, and adds them below their parent groups.
+func loadGroupLevel(q *gorm.DB, root *groupNode, levels []groupLevel, aggSelects []string, aggArgs []interface{}, aggNames []string) error {
+	selects, args := groupKeySelects(levels)
+	groupColumns := make([]string, len(levels))
+	for i := range levels {
+		groupColumns[i] = fmt.Sprintf("g%d", i)
+	}
+	selects = append(selects, "COUNT(*) AS group_count")
+	selects = append(selects, aggSelects...)
+	args = append(args, aggArgs...)
+
+	rows, err := q.Select(strings.Join(selects, ", "), args...).Group(strings.Join(groupColumns, ", ")).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to group records: %w", err)
+	}
+	defer rows.Close()
+
+	depth := len(levels)
+	level := levels[depth-1]
+	for rows.Next() {
+		keys := make([]*string, depth)
+		var count int64
+		values := make([]interface{}, len(aggNames))
+		targets := make([]interface{}, 0, depth+1+len(aggNames))
+		for i := range keys {
+			targets = append(targets, &keys[i])
+		}
+		targets = append(targets, &count)
+		for i := range values {
+			targets = append(targets, &values[i])
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return fmt.Errorf("failed to read groups: %w", err)
+		}
+
+		parent := root.find(keys[:depth-1])
+		if parent == nil {
+			// The record moved groups between the queries
+			continue
+		}
+		node := &groupNode{group: models.RecordGroup{
+			Field: level.field.Key,
+			Value: query.GroupValue(level.field, keys[depth-1]),
+			Count: count,
+		}}
+		if len(aggNames) > 0 {
+			node.group.Aggregates = make(map[string]interface{}, len(aggNames))
+			for i, name := range aggNames {
+				node.group.Aggregates[name] = values[i]
+			}
+		}
+		if parent.children == nil {
+			parent.children = make(map[string]*groupNode)
+		}
+		parent.children[groupMapKey(keys[depth-1])] = node
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read groups: %w", err)
+	}
+	return nil
+}
+
+// loadGroupRecords reads the requested page of every innermost group in a
+// single query, numbering the records of each group with a window function.
+func (s *QueryService) loadGroupRecords(q *gorm.DB, root *groupNode, levels []groupLevel, req query.Request, orderBy string, orderArgs []interface{}, fieldMap map[string]models.Field, fields []models.Field) error {
+	selects, args := groupKeySelects(levels)
+	partition := make([]string, len(levels))
+	for i, level := range levels {
+		partition[i] = level.key
+		args = append(args, level.args...)
+	}
+	args = append(args, orderArgs...)
+	numbered := q.Select(fmt.Sprintf("records.*, %s, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS group_row",
+		strings.Join(selects, ", "), strings.Join(partition, ", "), orderBy), args...)
+
+	var rows []groupedRecord
+	err := s.db.Table("(?) AS grouped", numbered).
+		Where("group_row > ? AND group_row <= ?", req.Offset(), req.Offset()+req.PageSize).
+		Order("group_row").
+		Find(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to retrieve records: %w", err)
+	}
+
+	records := make([]models.Record, len(rows))
+	for i := range rows {
+		records[i] = rows[i].Record
+	}
+	if err := prepareRecords(records, fieldMap, fields); err != nil {
+		return err
+	}
+	if err := s.addSearchHits(records, fields, req.Search); err != nil {
+		return err
+	}
+	for i := range rows {
+		if leaf := root.find(rows[i].path(len(levels))); leaf != nil {
+			leaf.group.Records = append(leaf.group.Records, records[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// searchRankOrder orders records by how well they match a search, for
+// requests without sorts.
+const searchRankOrder = "search_hits.score DESC"
+
+// searchJoin returns the join restricting a records query to the matches
+// of search, which exposes their scores as search_hits.score, and the
+// arguments it binds.
+func searchJoin(d dialect.Dialect, search string) (string, []interface{}) {
+	sql, args := query.BuildSearchQuery(d, search)
+	return "JOIN (" + sql + ") AS search_hits ON search_hits.record_id = records.id", args
+}
+
+// addSearchHits fills in the search scores of records and the snippets of
+// their fields containing the search.
+func (s *QueryService) addSearchHits(records []models.Record, fields []models.Field, search string) error {
+	if search == "" || len(records) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	sql, args := query.BuildSearchQuery(dialect.For(s.db), search)
+	var hits []struct {
+		RecordID uuid.UUID
+		Score    float64
+	}
+	err := s.db.Raw("SELECT record_id, score FROM ("+sql+") AS search_hits WHERE record_id IN ?", append(args, ids)...).
+		Scan(&hits).Error
+	if err != nil {
+		return fmt.Errorf("failed to read search scores: %w", err)
+	}
+	scores := make(map[uuid.UUID]float64, len(hits))
+	for _, hit := range hits {
+		scores[hit.RecordID] = hit.Score
+	}
+
+	for i := range records {
+		records[i].SearchScore = scores[records[i].ID]
+		highlights, err := searchHighlights(records[i].Data, fields, search)
+		if err != nil {
+			return err
+		}
+		records[i].Highlights = highlights
+	}
+	return nil
+}
+
+// searchHighlights returns snippets of the searchable fields of a record's
+// data that contain search, keyed by field key, or nil if none does.
+func searchHighlights(raw []byte, fields []models.Field, search string) (map[string]string, error) {
+	data, err := decodeRecordData(raw)
+	if err != nil {
+		return nil, err
+	}
+	var highlights map[string]string
+	for _, field := range fields {
+		if !query.IsSearchable(field) {
+			continue
+		}
+		text, ok := searchText(data[field.Key])
+		if !ok {
+			continue
+		}
+		if snippet, ok := query.Highlight(text, search); ok {
+			if highlights == nil {
+				highlights = make(map[string]string)
+			}
+			highlights[field.Key] = snippet
+		}
+	}
+	return highlights, nil
+}
+
+// searchText is the text a search sees in a cell: the string, or the
+// strings of a list separated by commas.
+func searchText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			if text, ok := item.(string); ok {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, ", "), len(parts) > 0
+	}
+	return "", false
+}
+
+// refreshSearchDocuments indexes the records of a table again for search.
+// Field changes that decide what is indexed, such as a new type or key,
+// call it once the field is saved. Rewriting data fires the triggers
+// maintaining the index (see dialect.Dialect.CreateSearchIndex).
+func refreshSearchDocuments(tx *gorm.DB, tableID uuid.UUID) error {
+	return tx.Exec("UPDATE records SET data = data WHERE table_id = ?", tableID).Error
+}
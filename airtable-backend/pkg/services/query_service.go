@@ -1,10 +1,13 @@
 package services
 
 import (
-	"airtable-backend/pkg/models"
 	"fmt"
 	"strings"
 
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -17,185 +20,153 @@ func NewQueryService(db *gorm.DB) *QueryService {
 	return &QueryService{db: db}
 }
 
-// QueryRecords 执行高级查询
-func (s *QueryService) QueryRecords(tableID uuid.UUID, params models.QueryParams) (*models.QueryResult, error) {
-	var result models.QueryResult
-	var total int64
+// QueryRecords runs a record query against a table: the filter and the
+// search select the records, aggregates summarise all of them and the sorted page of them is
+// returned. Problems with the request are reported as *models.ValidationError.
+func (s *QueryService) QueryRecords(tableID uuid.UUID, req query.Request) (*models.QueryResult, error) {
+	if _, err := loadTable(s.db, tableID); err != nil {
+		return nil, err
+	}
+	if err := req.Normalize(); err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
+	}
 
-	// 构建基础查询
-	query := s.db.Model(&models.Record{}).Where("table_id = ?", tableID)
+	fields, err := NewFieldService(s.db).GetFieldsByTableID(tableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields for table %s: %w", tableID, err)
+	}
+	fieldMap := query.FieldMap(fields)
+	d := dialect.For(s.db)
 
-	// 应用过滤条件
-	if err := s.applyFilters(query, params.Filters); err != nil {
-		return nil, err
+	whereClause, args, err := query.BuildFilterClause(d, fieldMap, req.Filter)
+	if err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
+	}
+	orderClause, orderArgs, err := query.BuildOrderClause(d, fieldMap, req.Sort)
+	if err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
 	}
 
-	// 计算总数
-	if err := query.Count(&total).Error; err != nil {
-		return nil, err
+	// filtered starts a new query over the records matching the filter and
+	// the search
+	filtered := func() *gorm.DB {
+		q := s.db.Model(&models.Record{}).Where("table_id = ?", tableID)
+		if req.Search != "" {
+			join, joinArgs := searchJoin(d, req.Search)
+			q = q.Joins(join, joinArgs...)
+		}
+		if whereClause != "" {
+			q = q.Where(whereClause, args...)
+		}
+		return q
 	}
 
-	// 应用排序
-	if err := s.applySort(query, params.Sort); err != nil {
-		return nil, err
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count records: %w", err)
 	}
 
-	// 应用分页
-	if params.Page > 0 && params.PageSize > 0 {
-		offset := (params.Page - 1) * params.PageSize
-		query = query.Offset(offset).Limit(params.PageSize)
+	// Records that sort equal keep their order in the table, which also
+	// orders the records when no sort is given
+	orderBy := "position ASC, id ASC"
+	if orderClause != "" {
+		orderBy = orderClause + ", " + orderBy
+	} else if req.RankedBySearch() {
+		orderBy = searchRankOrder + ", " + orderBy
 	}
 
-	// 执行查询
-	var records []models.Record
-	if err := query.Find(&records).Error; err != nil {
+	result := &models.QueryResult{
+		Records:  []models.Record{},
+		Total:    total,
+		Page:     req.Page,
+		PageSize: req.PageSize,
+	}
+	if len(req.GroupBy) > 0 {
+		result.Groups, err = s.queryGroups(filtered, fieldMap, fields, req, orderBy, orderArgs)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := s.queryPage(filtered, fieldMap, fields, req, result); err != nil {
 		return nil, err
 	}
 
-	// 计算聚合结果
-	aggregates, err := s.calculateAggregates(tableID, params)
+	result.Aggregates, err = s.calculateAggregates(filtered(), fieldMap, req.Aggregates)
 	if err != nil {
 		return nil, err
 	}
-
-	result = models.QueryResult{
-		Records:    records,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.PageSize,
-		Aggregates: aggregates,
-	}
-
-	return &result, nil
+	return result, nil
 }
 
-// applyFilters 应用过滤条件
-func (s *QueryService) applyFilters(query *gorm.DB, filters []models.FilterCondition) error {
-	for _, filter := range filters {
-		switch filter.Operator {
-		case models.FilterEqual:
-			query = query.Where(fmt.Sprintf("data->>'%s' = ?", filter.Field), filter.Value)
-		case models.FilterNotEqual:
-			query = query.Where(fmt.Sprintf("data->>'%s' != ?", filter.Field), filter.Value)
-		case models.FilterGreaterThan:
-			query = query.Where(fmt.Sprintf("data->>'%s' > ?", filter.Field), filter.Value)
-		case models.FilterLessThan:
-			query = query.Where(fmt.Sprintf("data->>'%s' < ?", filter.Field), filter.Value)
-		case models.FilterGreaterEqual:
-			query = query.Where(fmt.Sprintf("data->>'%s' >= ?", filter.Field), filter.Value)
-		case models.FilterLessEqual:
-			query = query.Where(fmt.Sprintf("data->>'%s' <= ?", filter.Field), filter.Value)
-		case models.FilterContains:
-			query = query.Where(fmt.Sprintf("data->>'%s' LIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
-		case models.FilterIn:
-			query = query.Where(fmt.Sprintf("data->>'%s' IN ?", filter.Field), filter.Value)
-		case models.FilterNotIn:
-			query = query.Where(fmt.Sprintf("data->>'%s' NOT IN ?", filter.Field), filter.Value)
-		case models.FilterIsNull:
-			query = query.Where(fmt.Sprintf("data->>'%s' IS NULL", filter.Field))
-		case models.FilterIsNotNull:
-			query = query.Where(fmt.Sprintf("data->>'%s' IS NOT NULL", filter.Field))
-		default:
-			return fmt.Errorf("unsupported filter operator: %s", filter.Operator)
+// prepareRecords turns stored records into their API form: keys are
+// resolved through fieldMap and formula fields are evaluated.
+func prepareRecords(records []models.Record, fieldMap map[string]models.Field, fields []models.Field) error {
+	for i := range records {
+		if err := transformRecordData(&records[i], fieldMap); err != nil {
+			return err
 		}
 	}
+	if err := evaluateFormulas(records, fields); err != nil {
+		return fmt.Errorf("failed to evaluate formulas: %w", err)
+	}
 	return nil
 }
 
-// applySort 应用排序条件
-func (s *QueryService) applySort(query *gorm.DB, sort []models.SortCondition) error {
-	for _, s := range sort {
-		direction := "ASC"
-		if s.Direction == models.SortDesc {
-			direction = "DESC"
-		}
-		query = query.Order(fmt.Sprintf("data->>'%s' %s", s.Field, direction))
+// calculateAggregates computes the requested aggregates over the records
+// selected by q, in a single query. Results are keyed by Aggregate.Name.
+func (s *QueryService) calculateAggregates(q *gorm.DB, fields map[string]models.Field, aggregates []query.Aggregate) (map[string]interface{}, error) {
+	if len(aggregates) == 0 {
+		return nil, nil
 	}
-	return nil
-}
 
-// calculateAggregates 计算聚合结果
-func (s *QueryService) calculateAggregates(tableID uuid.UUID, params models.QueryParams) (map[string]interface{}, error) {
-	aggregates := make(map[string]interface{})
+	selects, args, names, err := aggregateSelects(dialect.For(s.db), fields, aggregates)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Select(strings.Join(selects, ", "), args...).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate aggregates: %w", err)
+	}
+	defer rows.Close()
 
-	for _, agg := range params.Aggregates {
-		parts := strings.Split(agg, ":")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid aggregate format: %s", agg)
+	values := make([]interface{}, len(names))
+	targets := make([]interface{}, len(names))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	if rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return nil, fmt.Errorf("failed to read aggregates: %w", err)
 		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read aggregates: %w", err)
+	}
 
-		function := parts[0]
-		field := parts[1]
-
-		var result interface{}
-		var err error
-
-		switch function {
-		case string(models.AggregateCount):
-			result, err = s.calculateCount(tableID, field)
-		case string(models.AggregateSum):
-			result, err = s.calculateSum(tableID, field)
-		case string(models.AggregateAvg):
-			result, err = s.calculateAvg(tableID, field)
-		case string(models.AggregateMin):
-			result, err = s.calculateMin(tableID, field)
-		case string(models.AggregateMax):
-			result, err = s.calculateMax(tableID, field)
-		default:
-			return nil, fmt.Errorf("unsupported aggregate function: %s", function)
-		}
+	result := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		result[name] = values[i]
+	}
+	return result, nil
+}
 
+// aggregateSelects returns the select list entries computing aggregates,
+// the arguments they bind and the names of their results.
+func aggregateSelects(d dialect.Dialect, fields map[string]models.Field, aggregates []query.Aggregate) ([]string, []interface{}, []string, error) {
+	selects := make([]string, 0, len(aggregates))
+	var args []interface{}
+	names := make([]string, 0, len(aggregates))
+	for i, agg := range aggregates {
+		field, ok := fields[agg.FieldID]
+		if !ok {
+			return nil, nil, nil, &models.ValidationError{Message: fmt.Sprintf("unknown aggregate field: %s", agg.FieldID)}
+		}
+		expr, exprArgs, err := query.BuildAggregateExpr(d, field, agg.Function)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, &models.ValidationError{Message: err.Error()}
 		}
-
-		aggregates[agg] = result
+		selects = append(selects, fmt.Sprintf("%s AS agg_%d", expr, i))
+		args = append(args, exprArgs...)
+		names = append(names, agg.Name(field))
 	}
-
-	return aggregates, nil
-}
-
-// 聚合函数实现
-func (s *QueryService) calculateCount(tableID uuid.UUID, field string) (int64, error) {
-	var count int64
-	err := s.db.Model(&models.Record{}).
-		Where("table_id = ? AND data->>? IS NOT NULL", tableID, field).
-		Count(&count).Error
-	return count, err
-}
-
-func (s *QueryService) calculateSum(tableID uuid.UUID, field string) (float64, error) {
-	var sum float64
-	err := s.db.Model(&models.Record{}).
-		Where("table_id = ?", tableID).
-		Select("COALESCE(SUM((data->>?)::float), 0)", field).
-		Scan(&sum).Error
-	return sum, err
-}
-
-func (s *QueryService) calculateAvg(tableID uuid.UUID, field string) (float64, error) {
-	var avg float64
-	err := s.db.Model(&models.Record{}).
-		Where("table_id = ?", tableID).
-		Select("COALESCE(AVG((data->>?)::float), 0)", field).
-		Scan(&avg).Error
-	return avg, err
-}
-
-func (s *QueryService) calculateMin(tableID uuid.UUID, field string) (float64, error) {
-	var min float64
-	err := s.db.Model(&models.Record{}).
-		Where("table_id = ?", tableID).
-		Select("COALESCE(MIN((data->>?)::float), 0)", field).
-		Scan(&min).Error
-	return min, err
-}
-
-func (s *QueryService) calculateMax(tableID uuid.UUID, field string) (float64, error) {
-	var max float64
-	err := s.db.Model(&models.Record{}).
-		Where("table_id = ?", tableID).
-		Select("COALESCE(MAX((data->>?)::float), 0)", field).
-		Scan(&max).Error
-	return max, err
+	return selects, args, names, nil
 }
@@ -0,0 +1,529 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryRecords(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	status := &models.Field{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeText}
+	assert.NoError(t, fieldService.CreateField(title))
+	assert.NoError(t, fieldService.CreateField(status))
+	for _, data := range []string{
+		`{"title": "Write docs", "status": "Open"}`,
+		`{"title": "Fix bug", "status": "Done"}`,
+		`{"title": "Review", "status": "Open"}`,
+		`{"title": "Deploy"}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	filter, err := query.ParseFilterJSON([]byte(`{
+		"operator": "OR",
+		"conditions": [
+			{"fieldId": "status", "operator": "=", "value": "Open"},
+			{"conditions": [{"fieldId": "` + status.ID.String() + `", "operator": "is_empty"}]}
+		]
+	}`))
+	assert.NoError(t, err)
+	result, err := queryService.QueryRecords(table.ID, query.Request{
+		Filter:     filter,
+		Sort:       []query.Sort{{FieldID: "title", Direction: "desc"}},
+		PageSize:   2,
+		Aggregates: []query.Aggregate{{FieldID: "status", Function: models.AggregateCount}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Total)
+	assert.Equal(t, 1, result.Page)
+	titles := func(records []models.Record) []interface{} {
+		var out []interface{}
+		for _, record := range records {
+			data, err := decodeRecordData(record.Data)
+			assert.NoError(t, err)
+			out = append(out, data["title"])
+		}
+		return out
+	}
+	assert.Equal(t, []interface{}{"Write docs", "Review"}, titles(result.Records))
+	// Aggregates cover every filtered record, not only the page
+	assert.EqualValues(t, 2, result.Aggregates["count:status"])
+
+	result, err = queryService.QueryRecords(table.ID, query.Request{
+		Filter:   filter,
+		Sort:     []query.Sort{{FieldID: "title", Direction: "desc"}},
+		Page:     2,
+		PageSize: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"Deploy"}, titles(result.Records))
+
+	var validationErr *models.ValidationError
+	_, err = queryService.QueryRecords(table.ID, query.Request{Sort: []query.Sort{{FieldID: "missing"}}})
+	assert.ErrorAs(t, err, &validationErr)
+	_, err = queryService.QueryRecords(uuid.New(), query.Request{})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestQueryRecords_TypedFieldsOnSQLite(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	for _, field := range []*models.Field{
+		{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText},
+		{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber},
+		{TableID: table.ID, Name: "Due", Key: "due", Type: models.FieldTypeDate},
+		{TableID: table.ID, Name: "Done", Key: "done", Type: models.FieldTypeBoolean},
+		{TableID: table.ID, Name: "Tags", Key: "tags", Type: models.FieldTypeMulti,
+			Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "red"}, {Label: "blue"}}}},
+	} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	for _, data := range []string{
+		`{"title": "A", "hours": 10, "due": "2024-03-01", "done": true, "tags": ["red", "blue"]}`,
+		`{"title": "B", "hours": 2.5, "due": "2024-01-15T09:30:00Z", "done": false, "tags": ["blue"]}`,
+		`{"title": "C", "hours": 9, "due": "2024-02-01"}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	run := func(filter string, sorts ...query.Sort) []interface{} {
+		group, err := query.ParseFilterJSON([]byte(filter))
+		assert.NoError(t, err)
+		result, err := queryService.QueryRecords(table.ID, query.Request{Filter: group, Sort: sorts})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		var titles []interface{}
+		for _, record := range result.Records {
+			data, err := decodeRecordData(record.Data)
+			assert.NoError(t, err)
+			titles = append(titles, data["title"])
+		}
+		return titles
+	}
+
+	// Numbers compare as numbers, not as text ("10" < "9")
+	assert.Equal(t, []interface{}{"C", "A"}, run(`{"conditions": [{"fieldId": "hours", "operator": ">", "value": 5}]}`, query.Sort{FieldID: "hours"}))
+	// Dates in different ISO 8601 forms compare as times
+	assert.Equal(t, []interface{}{"B", "C"}, run(`{"conditions": [{"fieldId": "due", "operator": "<", "value": "2024-02-15"}]}`, query.Sort{FieldID: "due"}))
+	assert.Equal(t, []interface{}{"A"}, run(`{"conditions": [{"fieldId": "done", "operator": "=", "value": true}]}`))
+	assert.Equal(t, []interface{}{"A"}, run(`{"conditions": [{"fieldId": "tags", "operator": "has_all_of", "value": ["red", "blue"]}]}`))
+	assert.Equal(t, []interface{}{"B", "C"}, run(`{"conditions": [{"fieldId": "tags", "operator": "has_none_of", "value": ["red"]}]}`, query.Sort{FieldID: "title"}))
+
+	result, err := queryService.QueryRecords(table.ID, query.Request{Aggregates: []query.Aggregate{
+		{FieldID: "hours", Function: models.AggregateSum},
+		{FieldID: "hours", Function: models.AggregateMax},
+		{FieldID: "due", Function: models.AggregateMin},
+	}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 21.5, result.Aggregates["sum:hours"])
+	assert.EqualValues(t, 10, result.Aggregates["max:hours"])
+	assert.Equal(t, "2024-01-15 09:30:00", result.Aggregates["min:due"])
+}
+
+func TestQueryRecords_GroupBy(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	for _, field := range []*models.Field{
+		{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText},
+		{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeSelect,
+			Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Todo"}, {Label: "Doing"}, {Label: "Done"}}}},
+		{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber},
+		{TableID: table.ID, Name: "Due", Key: "due", Type: models.FieldTypeDate},
+		{TableID: table.ID, Name: "Done", Key: "done", Type: models.FieldTypeBoolean},
+	} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	for _, data := range []string{
+		`{"title": "A", "status": "Done", "hours": 1, "due": "2024-01-03", "done": true}`,
+		`{"title": "B", "status": "Todo", "hours": 2, "due": "2024-01-20T10:00:00Z"}`,
+		`{"title": "C", "status": "Todo", "hours": 3, "due": "2024-02-01"}`,
+		`{"title": "D", "status": "Todo", "hours": 4, "due": "2024-01-05"}`,
+		`{"title": "E", "hours": 5}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	titles := func(records []models.Record) []interface{} {
+		var out []interface{}
+		for _, record := range records {
+			data, err := decodeRecordData(record.Data)
+			assert.NoError(t, err)
+			out = append(out, data["title"])
+		}
+		return out
+	}
+
+	result, err := queryService.QueryRecords(table.ID, query.Request{
+		GroupBy: []query.GroupBy{
+			{FieldID: "status"},
+			{FieldID: "due", Bucket: query.BucketMonth, Direction: "desc"},
+		},
+		Sort:       []query.Sort{{FieldID: "title", Direction: "desc"}},
+		PageSize:   1,
+		Aggregates: []query.Aggregate{{FieldID: "hours", Function: models.AggregateSum}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), result.Total)
+	assert.Empty(t, result.Records)
+	assert.EqualValues(t, 15, result.Aggregates["sum:hours"])
+
+	// Select groups follow the option order, the empty group comes last
+	if assert.Len(t, result.Groups, 3) {
+		todo, done, empty := result.Groups[0], result.Groups[1], result.Groups[2]
+		assert.Equal(t, "Todo", todo.Value)
+		assert.Equal(t, int64(3), todo.Count)
+		assert.EqualValues(t, 9, todo.Aggregates["sum:hours"])
+		if assert.Len(t, todo.Groups, 2) {
+			assert.Equal(t, "2024-02-01", todo.Groups[0].Value)
+			assert.Equal(t, "2024-01-01", todo.Groups[1].Value)
+			assert.Equal(t, int64(2), todo.Groups[1].Count)
+			// One record per page, sorted by title within the group
+			assert.Equal(t, []interface{}{"D"}, titles(todo.Groups[1].Records))
+		}
+		assert.Equal(t, "Done", done.Value)
+		assert.Nil(t, empty.Value)
+		assert.Len(t, empty.Groups, 1)
+		assert.Nil(t, empty.Groups[0].Value)
+	}
+
+	result, err = queryService.QueryRecords(table.ID, query.Request{
+		GroupBy:  []query.GroupBy{{FieldID: "status"}, {FieldID: "due", Bucket: query.BucketMonth}},
+		Sort:     []query.Sort{{FieldID: "title", Direction: "desc"}},
+		Page:     2,
+		PageSize: 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"B"}, titles(result.Groups[0].Groups[0].Records))
+	assert.Empty(t, result.Groups[0].Groups[1].Records)
+
+	result, err = queryService.QueryRecords(table.ID, query.Request{GroupBy: []query.GroupBy{{FieldID: "done"}, {FieldID: "hours", Direction: "desc"}}})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Groups, 2) {
+		assert.Equal(t, true, result.Groups[0].Value)
+		assert.Nil(t, result.Groups[1].Value)
+		assert.Equal(t, []interface{}{5.0, 4.0, 3.0, 2.0}, []interface{}{
+			result.Groups[1].Groups[0].Value, result.Groups[1].Groups[1].Value, result.Groups[1].Groups[2].Value, result.Groups[1].Groups[3].Value,
+		})
+	}
+
+	var validationErr *models.ValidationError
+	_, err = queryService.QueryRecords(table.ID, query.Request{GroupBy: []query.GroupBy{{FieldID: "title", Bucket: query.BucketDay}}})
+	assert.ErrorAs(t, err, &validationErr)
+	_, err = queryService.QueryRecords(table.ID, query.Request{GroupBy: make([]query.GroupBy, query.MaxGroupLevels+1)})
+	assert.ErrorAs(t, err, &validationErr)
+}
+
+func TestQueryRecords_Aggregates(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	for _, field := range []*models.Field{
+		{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText},
+		{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber},
+		{TableID: table.ID, Name: "Due", Key: "due", Type: models.FieldTypeDate},
+		{TableID: table.ID, Name: "Total", Key: "total", Type: models.FieldTypeFormula, Options: models.FieldOptions{Formula: "{hours} * 2"}},
+	} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	for _, data := range []string{
+		`{"title": "A", "hours": 2, "due": "2024-03-01"}`,
+		`{"title": "B", "hours": 4, "due": "2024-01-15"}`,
+		`{"title": "B", "hours": 9}`,
+		`{"title": "", "hours": 1}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+	// Written before the field was a number: left out of numeric aggregates
+	assert.NoError(t, db.Create(&models.Record{TableID: table.ID, Data: json.RawMessage(`{"title": "X", "hours": "n/a"}`)}).Error)
+
+	aggregate := func(filter string, aggregates ...query.Aggregate) map[string]interface{} {
+		group, err := query.ParseFilterJSON([]byte(filter))
+		assert.NoError(t, err)
+		result, err := queryService.QueryRecords(table.ID, query.Request{Filter: group, Aggregates: aggregates})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		return result.Aggregates
+	}
+
+	result := aggregate(``,
+		query.Aggregate{FieldID: "title", Function: models.AggregateCount},
+		query.Aggregate{FieldID: "title", Function: models.AggregateCountEmpty},
+		query.Aggregate{FieldID: "title", Function: models.AggregateCountUnique},
+		query.Aggregate{FieldID: "due", Function: models.AggregatePercentFilled},
+		query.Aggregate{FieldID: "hours", Function: models.AggregateSum},
+		query.Aggregate{FieldID: "hours", Function: models.AggregateMedian},
+		query.Aggregate{FieldID: "hours", Function: models.AggregateStddev},
+		query.Aggregate{FieldID: "due", Function: models.AggregateEarliest},
+		query.Aggregate{FieldID: "due", Function: models.AggregateLatest},
+	)
+	assert.EqualValues(t, 4, result["count:title"])
+	assert.EqualValues(t, 1, result["count_empty:title"])
+	assert.EqualValues(t, 3, result["count_unique:title"])
+	assert.EqualValues(t, 40, result["percent_filled:due"])
+	assert.EqualValues(t, 16, result["sum:hours"])
+	assert.EqualValues(t, 3, result["median:hours"])
+	assert.InDelta(t, 3.559, result["stddev:hours"], 0.001)
+	assert.Equal(t, "2024-01-15 00:00:00", result["earliest:due"])
+	assert.Equal(t, "2024-03-01 00:00:00", result["latest:due"])
+
+	// Aggregates only cover the filtered records
+	result = aggregate(`{"conditions": [{"fieldId": "title", "operator": "=", "value": "B"}]}`,
+		query.Aggregate{FieldID: "hours", Function: models.AggregateMedian},
+		query.Aggregate{FieldID: "hours", Function: models.AggregateSum},
+	)
+	assert.EqualValues(t, 6.5, result["median:hours"])
+	assert.EqualValues(t, 13, result["sum:hours"])
+
+	var validationErr *models.ValidationError
+	for _, agg := range []query.Aggregate{
+		{FieldID: "title", Function: models.AggregateMedian},
+		{FieldID: "hours", Function: models.AggregateEarliest},
+		{FieldID: "total", Function: models.AggregateSum},
+		{FieldID: "hours", Function: "mode"},
+	} {
+		_, err := queryService.QueryRecords(table.ID, query.Request{Aggregates: []query.Aggregate{agg}})
+		assert.ErrorAs(t, err, &validationErr, "%s:%s", agg.Function, agg.FieldID)
+	}
+}
+
+func TestQueryRecords_Cursor(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	hours := &models.Field{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber}
+	assert.NoError(t, fieldService.CreateField(title))
+	assert.NoError(t, fieldService.CreateField(hours))
+	for _, data := range []string{
+		`{"title": "a", "hours": 3}`,
+		`{"title": "b"}`,
+		`{"title": "c", "hours": 1}`,
+		`{"title": "d", "hours": 3}`,
+		`{"title": "e", "hours": 2}`,
+		`{"title": "f"}`,
+		`{"title": "g", "hours": 1}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+	titles := func(records []models.Record) []interface{} {
+		var out []interface{}
+		for _, record := range records {
+			data, err := decodeRecordData(record.Data)
+			assert.NoError(t, err)
+			out = append(out, data["title"])
+		}
+		return out
+	}
+
+	// Descending puts empty cells first; ties keep the table order
+	sorts := []query.Sort{{FieldID: "hours", Direction: "desc"}}
+	first, err := queryService.QueryRecords(table.ID, query.Request{Sort: sorts, PageSize: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"b", "f", "a"}, titles(first.Records))
+	assert.Empty(t, first.PrevCursor)
+	assert.NotEmpty(t, first.NextCursor)
+
+	// A record added before the cursor does not shift the next page
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "h"}`))
+	assert.NoError(t, err)
+	second, err := queryService.QueryRecords(table.ID, query.Request{Sort: sorts, PageSize: 3, Cursor: first.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"d", "e", "c"}, titles(second.Records))
+	assert.NotEmpty(t, second.PrevCursor)
+
+	last, err := queryService.QueryRecords(table.ID, query.Request{Sort: sorts, PageSize: 3, Cursor: second.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"g"}, titles(last.Records))
+	assert.Empty(t, last.NextCursor)
+
+	// Going back returns the records just before the page, in order
+	back, err := queryService.QueryRecords(table.ID, query.Request{Sort: sorts, PageSize: 3, Cursor: second.PrevCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"f", "h", "a"}, titles(back.Records))
+	assert.NotEmpty(t, back.PrevCursor)
+	assert.NotEmpty(t, back.NextCursor)
+	back, err = queryService.QueryRecords(table.ID, query.Request{Sort: sorts, PageSize: 3, Cursor: back.PrevCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"b"}, titles(back.Records))
+	assert.Empty(t, back.PrevCursor)
+
+	// Without sorts, records are listed in table order
+	unsorted, err := queryService.QueryRecords(table.ID, query.Request{PageSize: 5})
+	assert.NoError(t, err)
+	unsorted, err = queryService.QueryRecords(table.ID, query.Request{PageSize: 5, Cursor: unsorted.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"f", "g", "h"}, titles(unsorted.Records))
+
+	// A cursor keeps its place when its record moves away
+	unsorted, err = queryService.QueryRecords(table.ID, query.Request{PageSize: 5})
+	assert.NoError(t, err)
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{unsorted.Records[4].ID}})
+	assert.NoError(t, err)
+	unsorted, err = queryService.QueryRecords(table.ID, query.Request{PageSize: 5, Cursor: unsorted.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"f", "g", "h", "e"}, titles(unsorted.Records))
+
+	var validationErr *models.ValidationError
+	for _, req := range []query.Request{
+		{Cursor: "not a cursor"},
+		{Cursor: first.NextCursor},
+		{Sort: sorts, Cursor: first.NextCursor, Page: 2},
+		{Sort: sorts, Cursor: first.NextCursor, GroupBy: []query.GroupBy{{FieldID: "title"}}},
+	} {
+		_, err = queryService.QueryRecords(table.ID, req)
+		assert.ErrorAs(t, err, &validationErr)
+	}
+}
+
+func TestQueryRecords_Search(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	notes := &models.Field{TableID: table.ID, Name: "Notes", Key: "notes", Type: models.FieldTypeText}
+	tags := &models.Field{TableID: table.ID, Name: "Tags", Key: "tags", Type: models.FieldTypeMulti}
+	code := &models.Field{TableID: table.ID, Name: "Code", Key: "code", Type: models.FieldTypeNumber}
+	for _, field := range []*models.Field{title, notes, tags, code} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	ids := make(map[string]uuid.UUID)
+	for name, data := range map[string]string{
+		"deploy": `{"title": "Deploy the API", "notes": "Deploy after review, then deploy docs", "code": 7}`,
+		"tagged": `{"title": "Plan release", "tags": ["deploy", "ops"]}`,
+		"other":  `{"title": "Write <docs>", "notes": "nothing to see", "code": 42}`,
+	} {
+		record, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+		ids[name] = record.ID
+	}
+
+	result, err := queryService.QueryRecords(table.ID, query.Request{Search: "  DEPLOY "})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.Total)
+	if assert.Len(t, result.Records, 2) {
+		// The record mentioning deploy most often ranks first
+		assert.Equal(t, ids["deploy"], result.Records[0].ID)
+		assert.Greater(t, result.Records[0].SearchScore, result.Records[1].SearchScore)
+		assert.Equal(t, map[string]string{
+			"title": "<mark>Deploy</mark> the API",
+			"notes": "<mark>Deploy</mark> after review, then <mark>deploy</mark> docs",
+		}, result.Records[0].Highlights)
+		assert.Equal(t, map[string]string{"tags": "<mark>deploy</mark>, ops"}, result.Records[1].Highlights)
+	}
+	assert.Empty(t, result.NextCursor)
+
+	// Every word has to match; text is escaped around the marks
+	result, err = queryService.QueryRecords(table.ID, query.Request{Search: "write docs"})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Records, 1) {
+		assert.Equal(t, "<mark>Write</mark> &lt;<mark>docs</mark>&gt;", result.Records[0].Highlights["title"])
+	}
+
+	// Numbers are not searched until the field holds text
+	result, err = queryService.QueryRecords(table.ID, query.Request{Search: "42"})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Records)
+	code.Type = models.FieldTypeText
+	assert.NoError(t, fieldService.UpdateField(code))
+	result, err = queryService.QueryRecords(table.ID, query.Request{Search: "42"})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Records, 1) {
+		assert.Equal(t, ids["other"], result.Records[0].ID)
+		assert.Equal(t, map[string]string{"code": "<mark>42</mark>"}, result.Records[0].Highlights)
+	}
+
+	// Search combines with filters, sorts and updates
+	_, err = recordService.UpdateRecord(ids["other"], json.RawMessage(`{"notes": "deploy later"}`))
+	assert.NoError(t, err)
+	filter, err := query.ParseFilterJSON([]byte(`{"conditions": [{"fieldId": "title", "operator": "contains", "value": "e"}]}`))
+	assert.NoError(t, err)
+	result, err = queryService.QueryRecords(table.ID, query.Request{
+		Search:     "deploy",
+		Filter:     filter,
+		Sort:       []query.Sort{{FieldID: "title"}},
+		PageSize:   2,
+		Aggregates: []query.Aggregate{{FieldID: "title", Function: models.AggregateCount}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Total)
+	assert.EqualValues(t, 3, result.Aggregates["count:title"])
+	if assert.Len(t, result.Records, 2) {
+		assert.Equal(t, ids["deploy"], result.Records[0].ID)
+		assert.Equal(t, ids["tagged"], result.Records[1].ID)
+	}
+	assert.NotEmpty(t, result.NextCursor)
+
+	// Deleted records drop out
+	assert.NoError(t, recordService.DeleteRecord(ids["deploy"]))
+	result, err = queryService.QueryRecords(table.ID, query.Request{Search: "deploy"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.Total)
+
+	// Query syntax of the database is matched as text
+	for _, search := range []string{`"`, "-", "deploy AND OR", "* (x"} {
+		_, err = queryService.QueryRecords(table.ID, query.Request{Search: search})
+		assert.NoError(t, err, search)
+	}
+
+	var validationErr *models.ValidationError
+	_, err = queryService.QueryRecords(table.ID, query.Request{Search: "deploy", Cursor: "x"})
+	assert.ErrorAs(t, err, &validationErr)
+}
+
+func TestSearchJoin(t *testing.T) {
+	// Every placeholder of the join has its argument, on either database
+	for _, d := range []dialect.Dialect{dialect.Postgres, dialect.SQLite} {
+		join, args := searchJoin(d, "deploy docs")
+		assert.Equal(t, strings.Count(join, "?"), len(args), join)
+	}
+}
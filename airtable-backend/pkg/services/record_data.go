@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recordBatchSize is the number of records loaded per batch when rewriting
+// the data of a whole table.
+const recordBatchSize = 500
+
+// rewriteRecordData calls fn with the decoded data of every record in a table
+// and saves the records for which fn reports a change. It returns the number
+// of records updated. The records stay locked until tx ends, so that writes
+// to them wait instead of saving data read before the rewrite.
+func rewriteRecordData(tx *gorm.DB, tableID uuid.UUID, fn func(recordID uuid.UUID, data map[string]interface{}) bool) (int, error) {
+	updated := 0
+	var batch []models.Record
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("table_id = ?", tableID).FindInBatches(&batch, recordBatchSize, func(batchTx *gorm.DB, _ int) error {
+		for _, record := range batch {
+			data, err := decodeRecordData(record.Data)
+			if err != nil {
+				return fmt.Errorf("record %s: %w", record.ID, err)
+			}
+			if !fn(record.ID, data) {
+				continue
+			}
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return fmt.Errorf("record %s: failed to marshal data: %w", record.ID, err)
+			}
+			if err := tx.Model(&models.Record{}).Where("id = ?", record.ID).Update("data", json.RawMessage(encoded)).Error; err != nil {
+				return fmt.Errorf("record %s: failed to update data: %w", record.ID, err)
+			}
+			updated++
+		}
+		return nil
+	})
+	return updated, result.Error
+}
+
+// renameRecordKey moves the value stored under oldKey to newKey in every
+// record of a table and returns the number of records changed. It fails,
+// leaving the caller to roll back, if any record already has a value under
+// newKey.
+func renameRecordKey(tx *gorm.DB, tableID uuid.UUID, oldKey, newKey string) (int, error) {
+	var conflict uuid.UUID
+	moved, err := rewriteRecordData(tx, tableID, func(recordID uuid.UUID, data map[string]interface{}) bool {
+		if conflict != uuid.Nil {
+			return false
+		}
+		if _, taken := data[newKey]; taken {
+			conflict = recordID
+			return false
+		}
+		value, ok := data[oldKey]
+		if !ok {
+			return false
+		}
+		delete(data, oldKey)
+		data[newKey] = value
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if conflict != uuid.Nil {
+		return 0, fmt.Errorf("%w: record %s already has data under %s", ErrDuplicateFieldKey, conflict, newKey)
+	}
+	return moved, nil
+}
+
+// decodeRecordData unmarshals record data into a map, treating empty or null
+// data as an empty object.
+func decodeRecordData(raw json.RawMessage) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if len(raw) == 0 {
+		return data, nil
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal record data: %w", err)
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return data, nil
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/redis"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxMovedRecords is the number of records a single move can place.
+const MaxMovedRecords = 1000
+
+// RecordMove places records of a table, in the order listed, next to
+// another record of the table or, when neither Before nor After is set,
+// at the end of the table.
+type RecordMove struct {
+	RecordIDs []uuid.UUID `json:"recordIds"`
+	Before    *uuid.UUID  `json:"before,omitempty"` // record to place the moved records just before
+	After     *uuid.UUID  `json:"after,omitempty"`  // record to place the moved records just after
+}
+
+// RecordPosition is the position of a record in its table.
+type RecordPosition struct {
+	RecordID uuid.UUID `json:"recordId"`
+	Position float64   `json:"position"`
+}
+
+// RecordsMovedMessage announces records whose position changed. When a
+// move numbers the table again, it lists every record of the table.
+type RecordsMovedMessage struct {
+	Type      string           `json:"type"` // "records_moved"
+	TableID   uuid.UUID        `json:"tableId"`
+	Positions []RecordPosition `json:"positions"`
+}
+
+// MoveRecords places records in their table as move asks and returns their
+// new positions, in the order of move.RecordIDs. Usually the records get
+// positions between their new neighbours and no other record changes.
+// Moves and record creations in a table wait for each other, so two
+// records never get the same position.
+func (s *RecordService) MoveRecords(tableID uuid.UUID, move RecordMove) ([]RecordPosition, error) {
+	if err := validateMove(move); err != nil {
+		return nil, err
+	}
+
+	var changed map[uuid.UUID]float64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockTable(tx, tableID); err != nil {
+			return err
+		}
+		var count int64
+		err := tx.Model(&models.Record{}).
+			Where("table_id = ? AND id IN ?", tableID, move.RecordIDs).
+			Count(&count).Error
+		if err != nil {
+			return fmt.Errorf("failed to count records: %w", err)
+		}
+		if count != int64(len(move.RecordIDs)) {
+			return ErrRecordNotFound
+		}
+
+		lo, hi, err := moveBounds(tx, tableID, move)
+		if err != nil {
+			return err
+		}
+		if positions, ok := spreadPositions(lo, hi, len(move.RecordIDs)); ok {
+			changed, err = placeRecords(tx, tableID, move.RecordIDs, positions)
+		} else {
+			changed, err = renumberRecords(tx, tableID, move)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to move records: %w", err)
+	}
+
+	message := RecordsMovedMessage{Type: "records_moved", TableID: tableID}
+	for id, position := range changed {
+		message.Positions = append(message.Positions, RecordPosition{RecordID: id, Position: position})
+	}
+	sort.Slice(message.Positions, func(i, j int) bool {
+		return message.Positions[i].Position < message.Positions[j].Position
+	})
+	publishRecordsMoved(message)
+
+	moved := make([]RecordPosition, len(move.RecordIDs))
+	for i, id := range move.RecordIDs {
+		moved[i] = RecordPosition{RecordID: id, Position: changed[id]}
+	}
+	return moved, nil
+}
+
+func validateMove(move RecordMove) error {
+	if len(move.RecordIDs) == 0 {
+		return &models.ValidationError{Message: "recordIds must not be empty"}
+	}
+	if len(move.RecordIDs) > MaxMovedRecords {
+		return &models.ValidationError{Message: fmt.Sprintf("at most %d records can be moved at once", MaxMovedRecords)}
+	}
+	if move.Before != nil && move.After != nil {
+		return &models.ValidationError{Message: "only one of before and after can be set"}
+	}
+	anchor := moveAnchor(move)
+	listed := make(map[uuid.UUID]bool, len(move.RecordIDs))
+	for _, id := range move.RecordIDs {
+		if listed[id] {
+			return &models.ValidationError{Message: fmt.Sprintf("record %s is listed more than once", id)}
+		}
+		if anchor != nil && *anchor == id {
+			return &models.ValidationError{Message: "a record cannot be placed next to itself"}
+		}
+		listed[id] = true
+	}
+	return nil
+}
+
+func moveAnchor(move RecordMove) *uuid.UUID {
+	if move.Before != nil {
+		return move.Before
+	}
+	return move.After
+}
+
+// lockTable locks the row of a table until tx ends, so that positions in
+// the table are handed out by one transaction at a time.
+func lockTable(tx *gorm.DB, tableID uuid.UUID) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Table{}, "id = ?", tableID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTableNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock table: %w", err)
+	}
+	return nil
+}
+
+// endPosition returns the first whole position after those of all the
+// records of a table.
+func endPosition(tx *gorm.DB, tableID uuid.UUID) (float64, error) {
+	var last float64
+	err := tx.Model(&models.Record{}).
+		Where("table_id = ?", tableID).
+		Select("COALESCE(MAX(position), 0)").
+		Row().Scan(&last)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read last position: %w", err)
+	}
+	return math.Floor(last) + 1, nil
+}
+
+// moveBounds returns the positions of the records the moved records will
+// follow and precede, nil at the start and the end of the table.
+func moveBounds(tx *gorm.DB, tableID uuid.UUID, move RecordMove) (lo, hi *float64, err error) {
+	others := tx.Model(&models.Record{}).Where("table_id = ? AND id NOT IN ?", tableID, move.RecordIDs)
+	anchor := moveAnchor(move)
+	if anchor == nil {
+		err = others.Select("MAX(position)").Row().Scan(&lo)
+		return lo, nil, err
+	}
+
+	var anchored models.Record
+	err = tx.Select("position").First(&anchored, "id = ? AND table_id = ?", *anchor, tableID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, &models.ValidationError{Message: fmt.Sprintf("record %s is not in the table", *anchor)}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load record %s: %w", *anchor, err)
+	}
+	if move.Before != nil {
+		hi = &anchored.Position
+		err = others.Where("position < ?", *hi).Select("MAX(position)").Row().Scan(&lo)
+	} else {
+		lo = &anchored.Position
+		err = others.Where("position > ?", *lo).Select("MIN(position)").Row().Scan(&hi)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read neighbouring positions: %w", err)
+	}
+	return lo, hi, nil
+}
+
+// spreadPositions returns n increasing positions between lo and hi, either
+// of which may be nil for an open end. Between two bounds the positions are
+// spread evenly; towards an open end they are whole numbers one apart. It
+// reports false when the bounds are too close for n distinct positions.
+func spreadPositions(lo, hi *float64, n int) ([]float64, bool) {
+	positions := make([]float64, n)
+	for i := range positions {
+		switch {
+		case lo != nil && hi != nil:
+			positions[i] = *lo + (*hi-*lo)*float64(i+1)/float64(n+1)
+		case lo != nil:
+			positions[i] = math.Floor(*lo) + float64(i+1)
+		case hi != nil:
+			positions[i] = math.Ceil(*hi) - float64(n-i)
+		default:
+			positions[i] = float64(i + 1)
+		}
+	}
+
+	prev := lo
+	for i := range positions {
+		if prev != nil && positions[i] <= *prev {
+			return nil, false
+		}
+		prev = &positions[i]
+	}
+	if hi != nil && positions[n-1] >= *hi {
+		return nil, false
+	}
+	return positions, true
+}
+
+// placeRecords stores the positions of the moved records. The records are
+// parked after the end of the table first, so that none of the positions
+// they move to is still held by one of them.
+func placeRecords(tx *gorm.DB, tableID uuid.UUID, ids []uuid.UUID, positions []float64) (map[uuid.UUID]float64, error) {
+	end, err := endPosition(tx, tableID)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		if err := setPosition(tx, id, end+float64(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	changed := make(map[uuid.UUID]float64, len(ids))
+	for i, id := range ids {
+		if err := setPosition(tx, id, positions[i]); err != nil {
+			return nil, err
+		}
+		changed[id] = positions[i]
+	}
+	return changed, nil
+}
+
+// renumberRecords numbers all the records of a table again, in order, with
+// the moved records placed as move asks. The new numbers start after the
+// end of the table, so none is held by a record that is yet to be updated.
+func renumberRecords(tx *gorm.DB, tableID uuid.UUID, move RecordMove) (map[uuid.UUID]float64, error) {
+	var others []uuid.UUID
+	err := tx.Model(&models.Record{}).
+		Where("table_id = ? AND id NOT IN ?", tableID, move.RecordIDs).
+		Order("position ASC, id ASC").
+		Pluck("id", &others).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record order: %w", err)
+	}
+
+	index := len(others)
+	if anchor := moveAnchor(move); anchor != nil {
+		for i, id := range others {
+			if id == *anchor {
+				index = i
+			}
+		}
+		if move.After != nil {
+			index++
+		}
+	}
+	order := append(append(others[:index:index], move.RecordIDs...), others[index:]...)
+
+	end, err := endPosition(tx, tableID)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[uuid.UUID]float64, len(order))
+	for i, id := range order {
+		if err := setPosition(tx, id, end+float64(i)); err != nil {
+			return nil, err
+		}
+		changed[id] = end + float64(i)
+	}
+	return changed, nil
+}
+
+func setPosition(tx *gorm.DB, recordID uuid.UUID, position float64) error {
+	if err := tx.Model(&models.Record{}).Where("id = ?", recordID).Update("position", position).Error; err != nil {
+		return fmt.Errorf("failed to store position of record %s: %w", recordID, err)
+	}
+	return nil
+}
+
+// publishRecordsMoved notifies subscribers of a table about changed record
+// positions.
+func publishRecordsMoved(message RecordsMovedMessage) {
+	channel := fmt.Sprintf("table_updates:%s", message.TableID.String())
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to marshal record positions for table %s: %v", message.TableID, err)
+		return
+	}
+	redis.Publish(channel, string(messageBytes))
+}
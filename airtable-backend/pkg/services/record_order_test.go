@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveRecords(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	queryService := NewQueryService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	assert.NoError(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}))
+	ids := make(map[string]uuid.UUID)
+	for i, title := range []string{"a", "b", "c", "d", "e"} {
+		record, err := recordService.CreateRecord(table.ID, json.RawMessage(fmt.Sprintf(`{"title": %q}`, title)))
+		assert.NoError(t, err)
+		// New records go to the end of the table
+		assert.Equal(t, float64(i+1), record.Position)
+		ids[title] = record.ID
+	}
+
+	order := func() []interface{} {
+		result, err := queryService.QueryRecords(table.ID, query.Request{PageSize: 100})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		out := []interface{}{}
+		for _, record := range result.Records {
+			data, err := decodeRecordData(record.Data)
+			assert.NoError(t, err)
+			out = append(out, data["title"])
+		}
+		return out
+	}
+
+	// Only the moved record changes position
+	moved, err := recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{ids["e"]}, Before: ptr(ids["b"])})
+	assert.NoError(t, err)
+	assert.Equal(t, []RecordPosition{{RecordID: ids["e"], Position: 1.5}}, moved)
+	assert.Equal(t, []interface{}{"a", "e", "b", "c", "d"}, order())
+
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{ids["a"]}, After: ptr(ids["d"])})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"e", "b", "c", "d", "a"}, order())
+
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{ids["e"]}})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"b", "c", "d", "a", "e"}, order())
+
+	// Moved records keep the order they are listed in, even past each other
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{ids["e"], ids["c"], ids["b"]}, Before: ptr(ids["d"])})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"e", "c", "b", "d", "a"}, order())
+
+	// Listing every record without an anchor reorders the whole table
+	all := []uuid.UUID{ids["a"], ids["b"], ids["c"], ids["d"], ids["e"]}
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: all})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c", "d", "e"}, order())
+
+	// Halving the same gap over and over numbers the table again
+	for i := 0; i < 60; i++ {
+		record := ids["c"]
+		if i%2 == 1 {
+			record = ids["d"]
+		}
+		_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{record}, After: ptr(ids["b"])})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []interface{}{"a", "b", "d", "c", "e"}, order())
+
+	// Records deleted from the table do not hold on to their positions
+	assert.NoError(t, recordService.DeleteRecord(ids["e"]))
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "f"}`))
+	assert.NoError(t, err)
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{record.ID}, Before: ptr(ids["a"])})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"f", "a", "b", "d", "c"}, order())
+
+	var validationErr *models.ValidationError
+	for name, move := range map[string]RecordMove{
+		"no records":     {},
+		"both anchors":   {RecordIDs: []uuid.UUID{ids["a"]}, Before: ptr(ids["b"]), After: ptr(ids["c"])},
+		"listed twice":   {RecordIDs: []uuid.UUID{ids["a"], ids["a"]}},
+		"next to self":   {RecordIDs: []uuid.UUID{ids["a"]}, After: ptr(ids["a"])},
+		"deleted anchor": {RecordIDs: []uuid.UUID{ids["a"]}, After: ptr(ids["e"])},
+	} {
+		_, err := recordService.MoveRecords(table.ID, move)
+		assert.ErrorAs(t, err, &validationErr, name)
+	}
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{uuid.New()}})
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	_, err = recordService.MoveRecords(uuid.New(), RecordMove{RecordIDs: []uuid.UUID{ids["a"]}})
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestSpreadPositions(t *testing.T) {
+	positions, ok := spreadPositions(ptr(1.0), ptr(2.0), 3)
+	assert.True(t, ok)
+	assert.Equal(t, []float64{1.25, 1.5, 1.75}, positions)
+
+	positions, _ = spreadPositions(ptr(2.5), nil, 2)
+	assert.Equal(t, []float64{3, 4}, positions)
+	positions, _ = spreadPositions(nil, ptr(2.0), 2)
+	assert.Equal(t, []float64{0, 1}, positions)
+	positions, _ = spreadPositions(nil, nil, 2)
+	assert.Equal(t, []float64{1, 2}, positions)
+
+	// No room between neighbours that are next to each other
+	_, ok = spreadPositions(ptr(1.0), ptr(1.0000000000000002), 1)
+	assert.False(t, ok)
+}
@@ -7,10 +7,11 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"airtable-backend/pkg/models"
-	"airtable-backend/pkg/query"
-	"airtable-backend/pkg/redis"     // Import redis package to use redis.Publish
+	"airtable-backend/pkg/redis" // Import redis package to use redis.Publish
+	"airtable-backend/pkg/storage"
 	"airtable-backend/pkg/websocket" // Import websocket package to access manager methods
 )
 
@@ -27,6 +28,7 @@ type RecordService struct {
 	// Removed: RedisPub    *redis.Publisher // This field is not needed
 	WSManager    *websocket.Manager // Need access to the WS Manager to broadcast
 	FieldService *FieldService      // Dependency to get table fields
+	BlobStore    storage.BlobStore  // Attachment storage; blobs of deleted records are removed when set
 }
 
 // NewRecordService initializes the RecordService.
@@ -41,7 +43,7 @@ func NewRecordService(db *gorm.DB, wsManager *websocket.Manager, fieldService *F
 }
 
 // transformRecordData converts field IDs to field names in the record data
-func (s *RecordService) transformRecordData(record *models.Record, fieldMap map[string]models.Field) error {
+func transformRecordData(record *models.Record, fieldMap map[string]models.Field) error {
 	var dataMap map[string]interface{}
 	if err := json.Unmarshal(record.Data, &dataMap); err != nil {
 		return fmt.Errorf("failed to unmarshal record data: %w", err)
@@ -75,99 +77,72 @@ func (s *RecordService) transformRecordData(record *models.Record, fieldMap map[
 	return nil
 }
 
-// GetRecords retrieves records for a table with filtering, sorting, and pagination.
-func (s *RecordService) GetRecords(
-	tableID uuid.UUID,
-	filterJSON []byte, // Raw JSON bytes for filter
-	sortJSON []byte, // Raw JSON bytes for sort
-	limit int,
-	offset int,
-) ([]models.Record, int64, error) {
-	var records []models.Record
-	var total int64
-
-	// Fetch fields for the table first to build queries correctly
+// CreateRecord creates a new record. Data should be JSON corresponding to fields;
+// it is validated against the table schema (see validateRecordData).
+func (s *RecordService) CreateRecord(tableID uuid.UUID, data json.RawMessage) (*models.Record, error) {
+	table, err := loadTable(s.DB, tableID)
+	if err != nil {
+		return nil, err
+	}
 	fields, err := s.FieldService.GetFieldsByTableID(tableID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get fields for table %s: %w", tableID, err)
+		return nil, fmt.Errorf("failed to get fields for table %s: %w", tableID, err)
 	}
-	// Create a map for easy lookup by FieldID
-	fieldMap := make(map[string]models.Field)
-	for _, field := range fields {
-		fieldMap[field.ID.String()] = field
+
+	var dataMap map[string]json.RawMessage
+	if err := json.Unmarshal(data, &dataMap); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal record data: %w", err)
+	}
+	// Check the data against the table schema
+	dataMap, err = validateRecordData(table, fields, dataMap, true)
+	if err != nil {
+		return nil, err
 	}
 
-	dbQuery := s.DB.Model(&models.Record{}).Where("table_id = ?", tableID)
+	record := models.Record{
+		ID:      uuid.New(),
+		TableID: tableID,
+	}
 
-	// Apply filter
-	if len(filterJSON) > 0 {
-		filterGroup, err := query.ParseFilterJSON(filterJSON)
+	var linked []recordRef
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// New records go to the end of the table
+		if err := lockTable(tx, tableID); err != nil {
+			return err
+		}
+		if err := checkUniqueValues(tx, tableID, uuid.Nil, fields, dataMap); err != nil {
+			return err
+		}
+		var err error
+		if record.Position, err = endPosition(tx, tableID); err != nil {
+			return err
+		}
+		linked, err = s.syncLinks(tx, tableID, record.ID, fields, nil, dataMap)
 		if err != nil {
-			return nil, 0, fmt.Errorf("invalid filter json: %w", err)
+			return err
 		}
-		if filterGroup != nil {
-			dbQuery, err = query.BuildGormFilter(dbQuery, fieldMap, filterGroup)
-			if err != nil {
-				return nil, 0, fmt.Errorf("failed to build filter query: %w", err)
-			}
+		if err := assignAutoNumbers(tx, fields, dataMap); err != nil {
+			return err
 		}
-	}
-
-	// Count total records *before* applying limit/offset
-	if err := dbQuery.Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count records: %w", err)
-	}
-
-	// Apply sort
-	if len(sortJSON) > 0 {
-		sorts, err := query.ParseSortJSON(sortJSON)
+		record.Data, err = json.Marshal(dataMap)
 		if err != nil {
-			return nil, 0, fmt.Errorf("invalid sort json: %w", err)
+			return fmt.Errorf("failed to marshal record data: %w", err)
 		}
-		if len(sorts) > 0 {
-			dbQuery, err = query.BuildGormSort(dbQuery, fieldMap, sorts)
-			if err != nil {
-				return nil, 0, fmt.Errorf("failed to build sort query: %w", err)
-			}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
 		}
-	}
-
-	// Apply pagination
-	if limit > 0 {
-		dbQuery = dbQuery.Limit(limit)
-	}
-	if offset > 0 {
-		dbQuery = dbQuery.Offset(offset)
-	}
-
-	// Execute the query with preloading
-	if err := dbQuery.Preload("Table.Fields").Find(&records).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to retrieve records: %w", err)
-	}
-
-	// Transform the data for each record
-	for i := range records {
-		if err := s.transformRecordData(&records[i], fieldMap); err != nil {
-			return nil, 0, fmt.Errorf("failed to transform record data: %w", err)
+		if linked, err = refreshDependents(tx, record.ID, linked); err != nil {
+			return err
 		}
+		// Reload to pick up lookup and rollup values
+		return tx.First(&record, "id = ?", record.ID).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create record: %w", err)
 	}
 
-	return records, total, nil
-}
-
-// CreateRecord creates a new record. Data should be JSON corresponding to fields.
-// ... (CreateRecord function remains the same) ...
-func (s *RecordService) CreateRecord(tableID uuid.UUID, data json.RawMessage) (*models.Record, error) {
-	// Optional: Validate data against table fields schema here
-	// (e.g., check if keys in data match field key_names, check value types)
-
-	record := models.Record{
-		TableID: tableID,
-		Data:    data,
-	}
-
-	if err := s.DB.Create(&record).Error; err != nil {
-		return nil, fmt.Errorf("failed to create record: %w", err)
+	if err := s.evaluateRecord(&record, fields); err != nil {
+		return nil, err
 	}
 
 	// Publish update to Redis
@@ -178,6 +153,7 @@ func (s *RecordService) CreateRecord(tableID uuid.UUID, data json.RawMessage) (*
 		Record:   &record,
 	}
 	s.publishUpdate(tableID, message) // This calls the helper
+	s.publishLinkedUpdates(linked)
 
 	return &record, nil
 }
@@ -206,18 +182,63 @@ func (s *RecordService) GetRecordByID(id uuid.UUID) (*models.Record, error) {
 	}
 
 	// Transform the data
-	if err := s.transformRecordData(&record, fieldMap); err != nil {
+	if err := transformRecordData(&record, fieldMap); err != nil {
 		return nil, fmt.Errorf("failed to transform record data: %w", err)
 	}
 
+	if err := s.evaluateRecord(&record, fields); err != nil {
+		return nil, err
+	}
+
 	return &record, nil
 }
 
+// findRecord loads a record exactly as stored, without computed values.
+func (s *RecordService) findRecord(id uuid.UUID) (*models.Record, error) {
+	var record models.Record
+	err := s.DB.First(&record, id).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil // Record not found
+		}
+		return nil, fmt.Errorf("failed to get record by ID: %w", err)
+	}
+	return &record, nil
+}
+
+// evaluateRecord fills in formula values on a single record.
+func (s *RecordService) evaluateRecord(record *models.Record, fields []models.Field) error {
+	records := []models.Record{*record}
+	if err := evaluateFormulas(records, fields); err != nil {
+		return fmt.Errorf("failed to evaluate formulas: %w", err)
+	}
+	*record = records[0]
+	return nil
+}
+
+// dropReadOnlyKeys removes client-supplied values for fields the server maintains.
+func dropReadOnlyKeys(data map[string]json.RawMessage, fields []models.Field) {
+	for _, field := range fields {
+		if field.IsReadOnly() {
+			delete(data, field.Key)
+		}
+	}
+}
+
 // UpdateRecord updates an existing record. Data should be JSON with updated fields.
 // It will merge the provided data with the existing JSONB data.
 // ... (UpdateRecord function remains the same) ...
 func (s *RecordService) UpdateRecord(id uuid.UUID, newData json.RawMessage) (*models.Record, error) {
-	existingRecord, err := s.GetRecordByID(id)
+	return s.updateRecord(id, newData, nil)
+}
+
+// updateRecord is UpdateRecord; when also is set, it runs first in the
+// transaction updating the record, so that other changes made together
+// with the update are committed with it and announced by the same
+// record_updated message.
+func (s *RecordService) updateRecord(id uuid.UUID, newData json.RawMessage, also func(tx *gorm.DB, record *models.Record) error) (*models.Record, error) {
+	// Load the stored data; GetRecordByID would merge computed values into it
+	existingRecord, err := s.findRecord(id)
 	if err != nil {
 		return nil, err // Propagate not found error etc.
 	}
@@ -225,54 +246,89 @@ func (s *RecordService) UpdateRecord(id uuid.UUID, newData json.RawMessage) (*mo
 		return nil, fmt.Errorf("record with ID %s not found", id)
 	}
 
-	// Unmarshal existing data
-	var existingMap map[string]json.RawMessage
-	if err := json.Unmarshal(existingRecord.Data, &existingMap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal existing record data: %w", err)
-	}
-
 	// Unmarshal new data
 	var newMap map[string]json.RawMessage
 	if err := json.Unmarshal(newData, &newMap); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal new record data: %w", err)
 	}
 
-	// Optional: Validate newData keys against field key_names for the record's table
-	// This prevents adding arbitrary keys to the JSONB if not defined as fields.
-	// Fetch table fields...
-	// fieldMap, err := s.getFieldMapByTableID(existingRecord.TableID) // Need a helper
-	// if err != nil { /* handle error */ }
-	// for key := range newMap {
-	//    // Check if key exists in fieldMap as a KeyName
-	//    found := false
-	//    for _, field := range fieldMap {
-	//        if field.KeyName == key {
-	//            found = true
-	//            break
-	//        }
-	//    }
-	//    if !found {
-	//       return nil, fmt.Errorf("invalid key '%s' in update data for table %s", key, existingRecord.TableID)
-	//    }
-	// }
-
-	// Merge new data into existing data
-	for key, value := range newMap {
-		existingMap[key] = value
-	}
-
-	// Marshal merged data back to JSON
-	mergedData, err := json.Marshal(existingMap)
+	table, err := loadTable(s.DB, existingRecord.TableID)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := s.FieldService.GetFieldsByTableID(existingRecord.TableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields for table %s: %w", existingRecord.TableID, err)
+	}
+	// Only the submitted keys are checked; required fields may be left out
+	newMap, err = validateRecordData(table, fields, newMap, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal merged record data: %w", err)
+		return nil, err
 	}
 
-	// Update record in DB
-	existingRecord.Data = mergedData
-	if err := s.DB.Save(existingRecord).Error; err != nil {
+	var linked []recordRef
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// Unique values are checked under the table lock, as on create
+		if hasUniqueValues(fields, newMap) {
+			if err := lockTable(tx, existingRecord.TableID); err != nil {
+				return err
+			}
+			if err := checkUniqueValues(tx, existingRecord.TableID, id, fields, newMap); err != nil {
+				return err
+			}
+		}
+		// Merge into the data as stored now, keeping the row locked, so that
+		// a concurrent rewrite of the table's records is not undone
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(existingRecord, "id = ?", id).Error; err != nil {
+			return err
+		}
+		var existingMap map[string]json.RawMessage
+		if err := json.Unmarshal(existingRecord.Data, &existingMap); err != nil {
+			return fmt.Errorf("failed to unmarshal existing record data: %w", err)
+		}
+		if existingMap == nil {
+			existingMap = make(map[string]json.RawMessage)
+		}
+		if also != nil {
+			if err := also(tx, existingRecord); err != nil {
+				return err
+			}
+		}
+		var err error
+		linked, err = s.syncLinks(tx, existingRecord.TableID, id, fields, existingMap, newMap)
+		if err != nil {
+			return err
+		}
+		for key, value := range newMap {
+			existingMap[key] = value
+		}
+
+		// Marshal merged data back to JSON
+		mergedData, err := json.Marshal(existingMap)
+		if err != nil {
+			return fmt.Errorf("failed to marshal merged record data: %w", err)
+		}
+
+		// Update record in DB
+		if err := tx.Model(existingRecord).Update("data", json.RawMessage(mergedData)).Error; err != nil {
+			return err
+		}
+		linked, err = refreshDependents(tx, id, linked)
+		return err
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to update record: %w", err)
 	}
 
+	// Reload so the response carries transformed and computed values
+	existingRecord, err = s.GetRecordByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if existingRecord == nil {
+		return nil, fmt.Errorf("record with ID %s not found", id)
+	}
+
 	// Publish update to Redis
 	message := RecordUpdateMessage{
 		Type:     "record_updated",
@@ -281,6 +337,7 @@ func (s *RecordService) UpdateRecord(id uuid.UUID, newData json.RawMessage) (*mo
 		Record:   existingRecord, // Send updated record
 	}
 	s.publishUpdate(existingRecord.TableID, message) // This calls the helper
+	s.publishLinkedUpdates(linked)
 
 	return existingRecord, nil
 }
@@ -296,9 +353,33 @@ func (s *RecordService) DeleteRecord(id uuid.UUID) error {
 		return fmt.Errorf("record with ID %s not found", id)
 	}
 
-	if err := s.DB.Delete(&models.Record{}, id).Error; err != nil {
+	fields, err := s.FieldService.GetFieldsByTableID(recordToDelete.TableID)
+	if err != nil {
+		return fmt.Errorf("failed to get fields for table %s: %w", recordToDelete.TableID, err)
+	}
+
+	var (
+		linked []recordRef
+		stored models.Record
+	)
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&stored, id).Error; err != nil {
+			return err
+		}
+		var err error
+		if linked, err = s.unlinkRecord(tx, &stored, fields); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Record{}, id).Error; err != nil {
+			return err
+		}
+		linked, err = refreshDependents(tx, id, linked)
+		return err
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete record: %w", err)
 	}
+	deleteAttachmentBlobs(s.BlobStore, &stored, fields)
 
 	// Publish update to Redis
 	message := RecordUpdateMessage{
@@ -308,6 +389,7 @@ func (s *RecordService) DeleteRecord(id uuid.UUID) error {
 		// Record is nil for delete message
 	}
 	s.publishUpdate(recordToDelete.TableID, message) // This calls the helper
+	s.publishLinkedUpdates(linked)
 
 	return nil
 }
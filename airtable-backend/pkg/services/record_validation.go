@@ -0,0 +1,325 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrTableNotFound is returned when records are written to a table that does not exist.
+var ErrTableNotFound = errors.New("table not found")
+
+// ErrRecordNotFound is returned for records that do not exist in the table
+// they are looked up in.
+var ErrRecordNotFound = errors.New("record not found")
+
+// validateRecordData checks a record write against the table's fields and
+// returns the data to store. Keys may be field keys or field IDs, and a body
+// wrapped as {"data": {...}} by older clients is unwrapped. Values are coerced
+// to their field's type and validated; on create, defaults are filled in and
+// required fields must be present. All failures are reported together as a
+// *models.RecordValidationError. Unique values are checked separately, in the
+// write transaction (see checkUniqueValues).
+func validateRecordData(table *models.Table, fields []models.Field, data map[string]json.RawMessage, create bool) (map[string]json.RawMessage, error) {
+	data = unwrapDataEnvelope(data, fields)
+
+	byKey := make(map[string]models.Field, len(fields))
+	byID := make(map[string]models.Field, len(fields))
+	for _, field := range fields {
+		byKey[field.Key] = field
+		byID[field.ID.String()] = field
+	}
+
+	var unknown []string
+	resolved := make(map[string]json.RawMessage, len(data))
+	for key, value := range data {
+		field, ok := byKey[key]
+		if !ok {
+			field, ok = byID[key]
+		}
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		resolved[field.Key] = value
+	}
+	dropReadOnlyKeys(resolved, fields)
+
+	var fieldErrors []models.FieldError
+	if table.UnknownFields != models.UnknownFieldsIgnore {
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: key, Message: "Unknown field"})
+		}
+	}
+
+	for _, field := range fields {
+		if field.IsReadOnly() {
+			continue
+		}
+		raw, present := resolved[field.Key]
+		var value interface{}
+		if present {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: field.Key, Message: "Invalid JSON value"})
+				continue
+			}
+		} else if create && field.Validation.Default != nil {
+			value, present = field.Validation.Default, true
+		}
+		if !present {
+			if create && field.Validation.Required {
+				fieldErrors = append(fieldErrors, models.FieldError{Field: field.Key, Message: "Field is required"})
+			}
+			continue
+		}
+
+		coerced, err := coerceFieldValue(field, value)
+		if err == nil {
+			err = checkFieldValue(field, coerced)
+		}
+		if err != nil {
+			var validationErr *models.ValidationError
+			if !errors.As(err, &validationErr) {
+				return nil, err
+			}
+			fieldErrors = append(fieldErrors, models.FieldError{Field: field.Key, Message: err.Error()})
+			continue
+		}
+		encoded, err := json.Marshal(coerced)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode value of field %s: %w", field.Key, err)
+		}
+		resolved[field.Key] = encoded
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, &models.RecordValidationError{Errors: fieldErrors}
+	}
+	return resolved, nil
+}
+
+// unwrapDataEnvelope returns the inner object of a {"data": {...}} body,
+// unless the table has a field whose key is "data".
+func unwrapDataEnvelope(data map[string]json.RawMessage, fields []models.Field) map[string]json.RawMessage {
+	inner, ok := data["data"]
+	if !ok || len(data) != 1 {
+		return data
+	}
+	for _, field := range fields {
+		if field.Key == "data" {
+			return data
+		}
+	}
+	var unwrapped map[string]json.RawMessage
+	if err := json.Unmarshal(inner, &unwrapped); err != nil || unwrapped == nil {
+		return data
+	}
+	return unwrapped
+}
+
+// checkFieldValue applies the field's validation rules to a coerced value.
+func checkFieldValue(field models.Field, value interface{}) error {
+	if isEmptyValue(value) {
+		if field.Validation.Required {
+			return &models.ValidationError{Message: "Field is required"}
+		}
+		return nil
+	}
+	return field.Validate(value)
+}
+
+// hasUniqueValues reports whether data, as returned by validateRecordData,
+// writes a field whose values must be unique.
+func hasUniqueValues(fields []models.Field, data map[string]json.RawMessage) bool {
+	for _, field := range fields {
+		if _, ok := data[field.Key]; ok && field.Validation.Unique {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUniqueValues rejects values of unique fields in data, as returned by
+// validateRecordData, that another record of the table already has
+// (recordID is uuid.Nil on create). tx must hold the table lock (see
+// lockTable), so that two writes cannot both store the same value. Failures
+// are reported together as a *models.RecordValidationError.
+func checkUniqueValues(tx *gorm.DB, tableID, recordID uuid.UUID, fields []models.Field, data map[string]json.RawMessage) error {
+	d := dialect.For(tx)
+	var fieldErrors []models.FieldError
+	for _, field := range fields {
+		raw, ok := data[field.Key]
+		if !ok || !field.Validation.Unique {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("failed to decode value of field %s: %w", field.Key, err)
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			continue // empty cells and lists are not compared
+		}
+		if isEmptyValue(value) {
+			continue
+		}
+		clause, args := query.BuildEqualsClause(d, field, value)
+		var count int64
+		err := tx.Model(&models.Record{}).
+			Where("table_id = ? AND id != ?", tableID, recordID).
+			Where(clause, args...).
+			Count(&count).Error
+		if err != nil {
+			return fmt.Errorf("failed to check unique value of field %s: %w", field.Key, err)
+		}
+		if count > 0 {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: field.Key, Message: "Value must be unique"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		return &models.RecordValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+// isEmptyValue reports whether a value clears a cell.
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// coerceFieldValue converts a decoded JSON value to the representation stored
+// for the field's type, e.g. the string "42" for a number field. Empty strings
+// clear non-text cells.
+func coerceFieldValue(field models.Field, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if str, ok := value.(string); ok && field.Type != models.FieldTypeText {
+		value = strings.TrimSpace(str)
+		if value == "" {
+			return nil, nil
+		}
+	}
+
+	switch field.Type {
+	case models.FieldTypeCurrency, models.FieldTypePercent, models.FieldTypeRating, models.FieldTypeDuration:
+		return coerceNumberValue(field, value)
+	}
+
+	switch field.Type.ValueType() {
+	case models.FieldTypeText:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return nil, &models.ValidationError{Message: "Expected text"}
+	case models.FieldTypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			num, err := strconv.ParseFloat(v, 64)
+			if err == nil && isFinite(num) {
+				return num, nil
+			}
+		}
+		return nil, &models.ValidationError{Message: "Expected a number"}
+	case models.FieldTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err == nil {
+				return b, nil
+			}
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+		return nil, &models.ValidationError{Message: "Expected true or false"}
+	case models.FieldTypeDate:
+		if str, ok := value.(string); ok {
+			if _, err := models.ParseDate(str); err == nil {
+				return str, nil
+			}
+		}
+		return nil, &models.ValidationError{Message: "Expected a date (YYYY-MM-DD or RFC 3339)"}
+	case models.FieldTypeSelect:
+		if str, ok := value.(string); ok {
+			return str, nil
+		}
+		return nil, &models.ValidationError{Message: "Expected an option label"}
+	case models.FieldTypeMulti:
+		switch v := value.(type) {
+		case string:
+			return []interface{}{v}, nil
+		case []interface{}:
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return nil, &models.ValidationError{Message: "Expected a list of option labels"}
+				}
+			}
+			return v, nil
+		}
+		return nil, &models.ValidationError{Message: "Expected a list of option labels"}
+	}
+	// Link values are checked when the links are synced
+	return value, nil
+}
+
+// prepareDefaultValue coerces and validates a field's default value.
+func prepareDefaultValue(field *models.Field) error {
+	if field.Validation.Default == nil {
+		return nil
+	}
+	if field.IsReadOnly() || field.Type == models.FieldTypeLink {
+		return &models.ValidationError{Message: fmt.Sprintf("fields of type %s cannot have a default value", field.Type)}
+	}
+	value, err := coerceFieldValue(*field, field.Validation.Default)
+	if err == nil && value != nil {
+		err = field.Validate(value)
+	}
+	if err != nil {
+		return &models.ValidationError{Message: fmt.Sprintf("invalid default value: %v", err)}
+	}
+	field.Validation.Default = value
+	return nil
+}
+
+// loadTable returns the table records are written to.
+func loadTable(db *gorm.DB, tableID uuid.UUID) (*models.Table, error) {
+	var table models.Table
+	if err := db.First(&table, "id = ?", tableID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTableNotFound
+		}
+		return nil, fmt.Errorf("failed to load table %s: %w", tableID, err)
+	}
+	return &table, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordValidation(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText,
+		Validation: models.ValidationRule{Required: true}}
+	hours := &models.Field{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber}
+	done := &models.Field{TableID: table.ID, Name: "Done", Key: "done", Type: models.FieldTypeBoolean,
+		Validation: models.ValidationRule{Default: "false"}}
+	due := &models.Field{TableID: table.ID, Name: "Due", Key: "due", Type: models.FieldTypeDate}
+	for _, field := range []*models.Field{title, hours, done, due} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	// Defaults are stored in their coerced form
+	assert.Equal(t, false, done.Validation.Default)
+	assert.Error(t, fieldService.CreateField(&models.Field{TableID: table.ID, Name: "Bad", Key: "bad", Type: models.FieldTypeNumber,
+		Validation: models.ValidationRule{Default: "many"}}))
+
+	// Values are coerced and defaults applied
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Write docs", "hours": "2.5", "due": "2024-05-01"}`))
+	assert.NoError(t, err)
+	data := recordData(t, recordService, record.ID)
+	assert.Equal(t, 2.5, data["hours"])
+	assert.Equal(t, false, data["done"])
+	assert.Equal(t, "2024-05-01", data["due"])
+
+	// Every failing field is reported
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"hours": "lots", "due": "tomorrow", "owner": "ann"}`))
+	var recordErr *models.RecordValidationError
+	if assert.ErrorAs(t, err, &recordErr) {
+		assert.Equal(t, []models.FieldError{
+			{Field: "owner", Message: "Unknown field"},
+			{Field: "title", Message: "Field is required"},
+			{Field: "hours", Message: "Expected a number"},
+			{Field: "due", Message: "Expected a date (YYYY-MM-DD or RFC 3339)"},
+		}, recordErr.Errors)
+	}
+
+	// Numbers JSON cannot hold are field errors, not storage failures
+	for _, value := range []string{"NaN", "Inf", "-infinity"} {
+		_, err = recordService.UpdateRecord(record.ID, json.RawMessage(`{"hours": "`+value+`"}`))
+		if assert.ErrorAs(t, err, &recordErr, value) {
+			assert.Equal(t, []models.FieldError{{Field: "hours", Message: "Expected a number"}}, recordErr.Errors)
+		}
+	}
+
+	// Updates only check submitted keys, but cannot clear required fields
+	_, err = recordService.UpdateRecord(record.ID, json.RawMessage(`{"done": "true"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, true, recordData(t, recordService, record.ID)["done"])
+	_, err = recordService.UpdateRecord(record.ID, json.RawMessage(`{"title": ""}`))
+	assert.ErrorAs(t, err, &recordErr)
+
+	// Legacy clients wrap the data and key it by field ID
+	record, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"data": {"`+title.ID.String()+`": "Legacy"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Legacy", recordData(t, recordService, record.ID)["title"])
+
+	// Tables can be set to drop unknown keys instead
+	table.UnknownFields = models.UnknownFieldsIgnore
+	assert.NoError(t, tableService.UpdateTable(table))
+	record, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Loose", "owner": "ann"}`))
+	assert.NoError(t, err)
+	_, ok := recordData(t, recordService, record.ID)["owner"]
+	assert.False(t, ok)
+
+	_, err = recordService.CreateRecord(uuid.New(), json.RawMessage(`{}`))
+	assert.ErrorIs(t, err, ErrTableNotFound)
+}
+
+func TestRecordValidation_Unique(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "People"}
+	assert.NoError(t, tableService.CreateTable(table))
+	email := &models.Field{TableID: table.ID, Name: "Email", Key: "email", Type: models.FieldTypeText,
+		Validation: models.ValidationRule{Unique: true, Format: models.FormatEmail}}
+	assert.NoError(t, fieldService.CreateField(email))
+
+	ann, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"email": "ann@example.com"}`))
+	assert.NoError(t, err)
+	bob, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"email": "bob@example.com"}`))
+	assert.NoError(t, err)
+
+	var recordErr *models.RecordValidationError
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"email": "ann@example.com"}`))
+	if assert.ErrorAs(t, err, &recordErr) {
+		assert.Equal(t, []models.FieldError{{Field: "email", Message: "Value must be unique"}}, recordErr.Errors)
+	}
+	_, err = recordService.UpdateRecord(bob.ID, json.RawMessage(`{"email": "ann@example.com"}`))
+	assert.ErrorAs(t, err, &recordErr)
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"email": "not an email"}`))
+	assert.ErrorAs(t, err, &recordErr)
+
+	// A record keeps its own value
+	_, err = recordService.UpdateRecord(ann.ID, json.RawMessage(`{"email": "ann@example.com"}`))
+	assert.NoError(t, err)
+
+	// Numbers compare as numbers, however they are written
+	badge := &models.Field{TableID: table.ID, Name: "Badge", Key: "badge", Type: models.FieldTypeNumber,
+		Validation: models.ValidationRule{Unique: true}}
+	fee := &models.Field{TableID: table.ID, Name: "Fee", Key: "fee", Type: models.FieldTypeCurrency,
+		Validation: models.ValidationRule{Unique: true}}
+	assert.NoError(t, fieldService.CreateField(badge))
+	assert.NoError(t, fieldService.CreateField(fee))
+	_, err = recordService.UpdateRecord(ann.ID, json.RawMessage(`{"badge": 7, "fee": "$12.50"}`))
+	assert.NoError(t, err)
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"badge": "7.0", "fee": 12.5}`))
+	if assert.ErrorAs(t, err, &recordErr) {
+		assert.Equal(t, []models.FieldError{
+			{Field: "badge", Message: "Value must be unique"},
+			{Field: "fee", Message: "Value must be unique"},
+		}, recordErr.Errors)
+	}
+	_, err = recordService.UpdateRecord(bob.ID, json.RawMessage(`{"badge": 7}`))
+	assert.ErrorAs(t, err, &recordErr)
+	_, err = recordService.UpdateRecord(bob.ID, json.RawMessage(`{"badge": 8}`))
+	assert.NoError(t, err)
+}
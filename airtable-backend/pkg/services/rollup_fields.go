@@ -0,0 +1,540 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxLinkedRefreshRounds bounds how many rounds of dependent records a
+// single refresh may recompute, guarding against rollups that feed each
+// other in a loop.
+const maxLinkedRefreshRounds = 100
+
+// isLinkedValueField reports whether a field's value is derived from linked records.
+func isLinkedValueField(field models.Field) bool {
+	return field.Type == models.FieldTypeLookup || field.Type == models.FieldTypeRollup
+}
+
+// valueTypeOf returns the type of the values a field holds, resolving
+// computed fields to their result type.
+func valueTypeOf(field models.Field) models.FieldType {
+	switch field.Type {
+	case models.FieldTypeFormula, models.FieldTypeLookup, models.FieldTypeRollup:
+		return field.Options.ResultType
+	}
+	return field.Type
+}
+
+// prepareRollupField validates the link and target of a lookup or rollup
+// field and records the type of the values it produces.
+func (s *FieldService) prepareRollupField(field *models.Field) error {
+	if field.Options.LinkFieldID == nil {
+		return &models.ValidationError{Message: fmt.Sprintf("%s field requires options.linkFieldId", field.Type)}
+	}
+	linkField, err := s.GetFieldByID(*field.Options.LinkFieldID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &models.ValidationError{Message: "link field not found"}
+		}
+		return err
+	}
+	if linkField.TableID != field.TableID || linkField.Type != models.FieldTypeLink || linkField.Options.LinkedTableID == nil {
+		return &models.ValidationError{Message: "options.linkFieldId must be a link field of the same table"}
+	}
+
+	var target *models.Field
+	if field.Options.LookupFieldID != nil {
+		target, err = s.GetFieldByID(*field.Options.LookupFieldID)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return &models.ValidationError{Message: "lookup field not found"}
+			}
+			return err
+		}
+		if target.TableID != *linkField.Options.LinkedTableID {
+			return &models.ValidationError{Message: "options.lookupFieldId must belong to the linked table"}
+		}
+	}
+
+	if field.Type == models.FieldTypeLookup {
+		if target == nil {
+			return &models.ValidationError{Message: "lookup field requires options.lookupFieldId"}
+		}
+		field.Options.RollupFunction = ""
+		field.Options.ResultType = valueTypeOf(*target)
+		return nil
+	}
+
+	fn := models.AggregateFunction(strings.ToLower(string(field.Options.RollupFunction)))
+	field.Options.RollupFunction = fn
+	if target == nil && fn != models.AggregateCount {
+		return &models.ValidationError{Message: fmt.Sprintf("rollup function %s requires options.lookupFieldId", fn)}
+	}
+
+	switch fn {
+	case models.AggregateCount:
+		field.Options.ResultType = models.FieldTypeNumber
+	case models.AggregateConcat:
+		field.Options.ResultType = models.FieldTypeText
+	case models.AggregateSum, models.AggregateAvg, models.AggregateMin, models.AggregateMax:
+		targetType := valueTypeOf(*target)
+		switch {
+		case targetType.ValueType() == models.FieldTypeNumber:
+			field.Options.ResultType = models.FieldTypeNumber
+		case targetType == models.FieldTypeDate && (fn == models.AggregateMin || fn == models.AggregateMax):
+			field.Options.ResultType = models.FieldTypeDate
+		default:
+			return &models.ValidationError{Message: fmt.Sprintf("rollup function %s cannot be applied to %s values", fn, targetType)}
+		}
+	default:
+		return &models.ValidationError{Message: fmt.Sprintf("unsupported rollup function: %s", field.Options.RollupFunction)}
+	}
+	return nil
+}
+
+// saveRollupField saves a lookup or rollup field and fills in its values for
+// the existing records of the table.
+func (s *FieldService) saveRollupField(field *models.Field, create bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		save := tx.Save
+		if create {
+			save = tx.Create
+		}
+		if err := save(field).Error; err != nil {
+			return err
+		}
+		var ids []uuid.UUID
+		if err := tx.Model(&models.Record{}).Where("table_id = ?", field.TableID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		_, err := newLinkedValueRefresher(tx).refresh(nil, ids)
+		return err
+	})
+}
+
+// linkedValueRefresher recomputes lookup and rollup cells. Field definitions
+// and the data of linked records are cached for the duration of one refresh.
+type linkedValueRefresher struct {
+	tx     *gorm.DB
+	fields map[uuid.UUID][]models.Field
+	data   map[uuid.UUID]map[string]interface{}
+}
+
+func newLinkedValueRefresher(tx *gorm.DB) *linkedValueRefresher {
+	return &linkedValueRefresher{
+		tx:     tx,
+		fields: make(map[uuid.UUID][]models.Field),
+		data:   make(map[uuid.UUID]map[string]interface{}),
+	}
+}
+
+// refreshLinkedValues recomputes lookup and rollup cells that may depend on
+// the changed records: the records themselves and, transitively, the records
+// linked to them. It returns the records whose stored values changed, apart
+// from the changed records themselves.
+func refreshLinkedValues(tx *gorm.DB, changed ...uuid.UUID) ([]recordRef, error) {
+	return newLinkedValueRefresher(tx).refresh(changed, nil)
+}
+
+// refreshDependents refreshes lookups and rollups after recordID and the
+// linked records whose links were updated alongside it have been written.
+// It returns linked together with the records the refresh changed.
+func refreshDependents(tx *gorm.DB, recordID uuid.UUID, linked []recordRef) ([]recordRef, error) {
+	changed := []uuid.UUID{recordID}
+	for _, ref := range linked {
+		changed = append(changed, ref.RecordID)
+	}
+	refreshed, err := refreshLinkedValues(tx, changed...)
+	if err != nil {
+		return nil, err
+	}
+	return append(linked, refreshed...), nil
+}
+
+// refresh recomputes the records in changed, whose own data was modified so
+// their links are always followed, and in stale, whose links are followed
+// only when their computed values change. Records are recomputed in rounds,
+// loaded in batches and at most once per round, and only links that some
+// lookup or rollup reads through are followed.
+func (r *linkedValueRefresher) refresh(changed, stale []uuid.UUID) ([]recordRef, error) {
+	source := make(map[uuid.UUID]bool, len(changed))
+	for _, id := range changed {
+		source[id] = true
+	}
+	round := uniqueIDs(append(append([]uuid.UUID{}, changed...), stale...))
+
+	var updated []recordRef
+	reported := make(map[uuid.UUID]bool)
+	for rounds := 0; len(round) > 0; rounds++ {
+		if rounds > maxLinkedRefreshRounds {
+			return nil, fmt.Errorf("dependent records still change after %d rounds of recomputation", maxLinkedRefreshRounds)
+		}
+		var next []uuid.UUID
+		queued := make(map[uuid.UUID]bool)
+		for start := 0; start < len(round); start += recordBatchSize {
+			var records []models.Record
+			if err := r.tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", round[start:min(start+recordBatchSize, len(round))]).Find(&records).Error; err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				data, changedValues, err := r.recompute(record)
+				if err != nil {
+					return nil, err
+				}
+				if changedValues && !source[record.ID] && !reported[record.ID] {
+					reported[record.ID] = true
+					updated = append(updated, recordRef{TableID: record.TableID, RecordID: record.ID})
+				}
+				if !changedValues && !(rounds == 0 && source[record.ID]) {
+					continue
+				}
+				linked, err := r.dependentLinks(record.ID, record.TableID, data)
+				if err != nil {
+					return nil, err
+				}
+				for _, id := range linked {
+					if !queued[id] {
+						queued[id] = true
+						next = append(next, id)
+					}
+				}
+			}
+		}
+		round = next
+	}
+	return updated, nil
+}
+
+// recompute stores the lookup and rollup values of a record. It returns the
+// record's data and whether any of the values changed.
+func (r *linkedValueRefresher) recompute(record models.Record) (map[string]interface{}, bool, error) {
+	fields, err := r.tableFields(record.TableID)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := decodeRecordData(record.Data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changedValues := false
+	for _, field := range fields {
+		if !isLinkedValueField(field) {
+			continue
+		}
+		value, err := r.compute(field, fields, data)
+		if err != nil {
+			return nil, false, err
+		}
+		if !jsonEqual(data[field.Key], value) {
+			data[field.Key] = value
+			changedValues = true
+		}
+	}
+	if !changedValues {
+		return data, false, nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := r.tx.Model(&models.Record{}).Where("id = ?", record.ID).Update("data", json.RawMessage(encoded)).Error; err != nil {
+		return nil, false, err
+	}
+	delete(r.data, record.ID)
+	return data, true, nil
+}
+
+// dependentLinks returns the records a record links to, with data, through
+// link fields whose other side some lookup or rollup reads through.
+func (r *linkedValueRefresher) dependentLinks(recordID, tableID uuid.UUID, data map[string]interface{}) ([]uuid.UUID, error) {
+	fields, err := r.tableFields(tableID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uuid.UUID
+	for _, field := range fields {
+		if field.Type != models.FieldTypeLink {
+			continue
+		}
+		read, err := r.readThrough(field)
+		if err != nil {
+			return nil, err
+		}
+		if !read {
+			continue
+		}
+		for _, id := range linkIDsFromValue(data[field.Key]) {
+			if id != recordID {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// readThrough reports whether a lookup or rollup field of the linked table
+// reads through the other side of link.
+func (r *linkedValueRefresher) readThrough(link models.Field) (bool, error) {
+	if link.Options.LinkedTableID == nil || link.Options.InverseFieldID == nil {
+		return false, nil
+	}
+	fields, err := r.tableFields(*link.Options.LinkedTableID)
+	if err != nil {
+		return false, err
+	}
+	for _, field := range fields {
+		if isLinkedValueField(field) && field.Options.LinkFieldID != nil && *field.Options.LinkFieldID == *link.Options.InverseFieldID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uniqueIDs returns ids without repeats, in their first order.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func (r *linkedValueRefresher) tableFields(tableID uuid.UUID) ([]models.Field, error) {
+	if fields, ok := r.fields[tableID]; ok {
+		return fields, nil
+	}
+	var fields []models.Field
+	if err := r.tx.Where("table_id = ?", tableID).Order("\"order\" asc").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	r.fields[tableID] = fields
+	return fields, nil
+}
+
+// compute returns the value of a lookup or rollup field for a record.
+func (r *linkedValueRefresher) compute(field models.Field, fields []models.Field, data map[string]interface{}) (interface{}, error) {
+	var linkField *models.Field
+	for i := range fields {
+		if field.Options.LinkFieldID != nil && fields[i].ID == *field.Options.LinkFieldID {
+			linkField = &fields[i]
+		}
+	}
+	if linkField == nil || linkField.Options.LinkedTableID == nil {
+		return nil, nil // the link field was removed
+	}
+
+	linkedFields, err := r.tableFields(*linkField.Options.LinkedTableID)
+	if err != nil {
+		return nil, err
+	}
+	ids := linkIDsFromValue(data[linkField.Key])
+	linked, err := r.linkedData(ids, linkedFields)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	if field.Options.LookupFieldID != nil {
+		var target *models.Field
+		for i := range linkedFields {
+			if linkedFields[i].ID == *field.Options.LookupFieldID {
+				target = &linkedFields[i]
+			}
+		}
+		if target == nil {
+			return nil, nil // the looked up field was removed
+		}
+		for _, id := range ids {
+			linkedData, ok := linked[id]
+			if !ok {
+				continue
+			}
+			values = appendLookupValue(values, linkedData[target.Key])
+		}
+	}
+
+	if field.Type == models.FieldTypeLookup {
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values, nil
+	}
+	if field.Options.LookupFieldID == nil {
+		// COUNT without a lookup field counts the linked records
+		return float64(len(linked)), nil
+	}
+	return rollup(field.Options.RollupFunction, field.Options.ResultType, values), nil
+}
+
+// linkedData returns the data of the records with the given IDs that still
+// exist, with their formula fields evaluated. fields are the fields of the
+// records' table.
+func (r *linkedValueRefresher) linkedData(ids []uuid.UUID, fields []models.Field) (map[uuid.UUID]map[string]interface{}, error) {
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := r.data[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	for start := 0; start < len(missing); start += recordBatchSize {
+		var records []models.Record
+		if err := r.tx.Where("id IN ?", missing[start:min(start+recordBatchSize, len(missing))]).Find(&records).Error; err != nil {
+			return nil, err
+		}
+		if err := evaluateFormulas(records, fields); err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			data, err := decodeRecordData(record.Data)
+			if err != nil {
+				return nil, err
+			}
+			r.data[record.ID] = data
+		}
+	}
+
+	linked := make(map[uuid.UUID]map[string]interface{}, len(ids))
+	for _, id := range ids {
+		if data, ok := r.data[id]; ok {
+			linked[id] = data
+		}
+	}
+	return linked, nil
+}
+
+// appendLookupValue adds a looked up cell to values, flattening arrays and
+// skipping blanks.
+func appendLookupValue(values []interface{}, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return values
+	case string:
+		if v == "" {
+			return values
+		}
+	case []interface{}:
+		for _, item := range v {
+			values = appendLookupValue(values, item)
+		}
+		return values
+	}
+	return append(values, value)
+}
+
+// rollup aggregates looked up values.
+func rollup(fn models.AggregateFunction, resultType models.FieldType, values []interface{}) interface{} {
+	switch fn {
+	case models.AggregateCount:
+		return float64(len(values))
+	case models.AggregateConcat:
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = fmt.Sprint(v)
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	if resultType == models.FieldTypeDate {
+		var best interface{}
+		var bestTime time.Time
+		for _, v := range values {
+			t, ok := rollupDate(v)
+			if !ok {
+				continue
+			}
+			if best == nil || (fn == models.AggregateMin && t.Before(bestTime)) || (fn == models.AggregateMax && t.After(bestTime)) {
+				best, bestTime = v, t
+			}
+		}
+		return best
+	}
+
+	var numbers []float64
+	for _, v := range values {
+		if n, ok := rollupNumber(v); ok {
+			numbers = append(numbers, n)
+		}
+	}
+	switch fn {
+	case models.AggregateSum:
+		sum := 0.0
+		for _, n := range numbers {
+			sum += n
+		}
+		return sum
+	case models.AggregateAvg:
+		if len(numbers) == 0 {
+			return nil
+		}
+		sum := 0.0
+		for _, n := range numbers {
+			sum += n
+		}
+		return sum / float64(len(numbers))
+	case models.AggregateMin, models.AggregateMax:
+		if len(numbers) == 0 {
+			return nil
+		}
+		best := numbers[0]
+		for _, n := range numbers[1:] {
+			if fn == models.AggregateMin {
+				best = math.Min(best, n)
+			} else {
+				best = math.Max(best, n)
+			}
+		}
+		return best
+	}
+	return nil
+}
+
+func rollupNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func rollupDate(v interface{}) (time.Time, bool) {
+	str, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// jsonEqual compares a decoded cell with a computed value by their JSON form.
+func jsonEqual(a, b interface{}) bool {
+	ea, errA := json.Marshal(a)
+	eb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ea) == string(eb)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupFields_Recompute(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	baseID := uuid.New()
+	projects := &models.Table{BaseID: baseID, Name: "Projects"}
+	tasks := &models.Table{BaseID: baseID, Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(projects))
+	assert.NoError(t, tableService.CreateTable(tasks))
+
+	title := &models.Field{TableID: tasks.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	hours := &models.Field{TableID: tasks.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber}
+	assert.NoError(t, fieldService.CreateField(title))
+	assert.NoError(t, fieldService.CreateField(hours))
+	link := &models.Field{TableID: tasks.ID, Name: "Project", Key: "project", Type: models.FieldTypeLink, Options: models.FieldOptions{LinkedTableID: &projects.ID}}
+	assert.NoError(t, fieldService.CreateField(link))
+	inverseID := *link.Options.InverseFieldID
+
+	project, err := recordService.CreateRecord(projects.ID, json.RawMessage(`{}`))
+	assert.NoError(t, err)
+	first, err := recordService.CreateRecord(tasks.ID, json.RawMessage(`{"title": "Design", "hours": 3, "project": ["`+project.ID.String()+`"]}`))
+	assert.NoError(t, err)
+
+	// Creating the fields fills in values for existing records
+	total := &models.Field{TableID: projects.ID, Name: "Total Hours", Key: "total_hours", Type: models.FieldTypeRollup,
+		Options: models.FieldOptions{LinkFieldID: &inverseID, LookupFieldID: &hours.ID, RollupFunction: "SUM"}}
+	assert.NoError(t, fieldService.CreateField(total))
+	assert.Equal(t, models.AggregateSum, total.Options.RollupFunction)
+	assert.Equal(t, models.FieldTypeNumber, total.Options.ResultType)
+
+	titles := &models.Field{TableID: projects.ID, Name: "Task Titles", Key: "task_titles", Type: models.FieldTypeLookup,
+		Options: models.FieldOptions{LinkFieldID: &inverseID, LookupFieldID: &title.ID}}
+	assert.NoError(t, fieldService.CreateField(titles))
+
+	count := &models.Field{TableID: projects.ID, Name: "Task Count", Key: "task_count", Type: models.FieldTypeRollup,
+		Options: models.FieldOptions{LinkFieldID: &inverseID, RollupFunction: "count"}}
+	assert.NoError(t, fieldService.CreateField(count))
+
+	data := recordData(t, recordService, project.ID)
+	assert.Equal(t, 3.0, data["total_hours"])
+	assert.Equal(t, []interface{}{"Design"}, data["task_titles"])
+	assert.Equal(t, 1.0, data["task_count"])
+
+	// Linking and editing tasks recomputes the project
+	_, err = recordService.CreateRecord(tasks.ID, json.RawMessage(`{"title": "Build", "hours": 5, "project": ["`+project.ID.String()+`"]}`))
+	assert.NoError(t, err)
+	_, err = recordService.UpdateRecord(first.ID, json.RawMessage(`{"hours": 4}`))
+	assert.NoError(t, err)
+
+	data = recordData(t, recordService, project.ID)
+	assert.Equal(t, 9.0, data["total_hours"])
+	assert.Equal(t, []interface{}{"Design", "Build"}, data["task_titles"])
+	assert.Equal(t, 2.0, data["task_count"])
+
+	// Computed values cannot be written by clients
+	_, err = recordService.UpdateRecord(project.ID, json.RawMessage(`{"total_hours": 100}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 9.0, recordData(t, recordService, project.ID)["total_hours"])
+
+	assert.NoError(t, recordService.DeleteRecord(first.ID))
+	data = recordData(t, recordService, project.ID)
+	assert.Equal(t, 5.0, data["total_hours"])
+	assert.Equal(t, 1.0, data["task_count"])
+
+	// Rollups must aggregate values of a compatible type
+	err = fieldService.CreateField(&models.Field{TableID: projects.ID, Name: "Bad", Key: "bad", Type: models.FieldTypeRollup,
+		Options: models.FieldOptions{LinkFieldID: &inverseID, LookupFieldID: &title.ID, RollupFunction: "sum"}})
+	assert.IsType(t, &models.ValidationError{}, err)
+}
+
+func TestRollupFields_ManyLinks(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	baseID := uuid.New()
+	projects := &models.Table{BaseID: baseID, Name: "Projects"}
+	tasks := &models.Table{BaseID: baseID, Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(projects))
+	assert.NoError(t, tableService.CreateTable(tasks))
+	name := &models.Field{TableID: projects.ID, Name: "Name", Key: "name", Type: models.FieldTypeText}
+	assert.NoError(t, fieldService.CreateField(name))
+	link := &models.Field{TableID: tasks.ID, Name: "Project", Key: "project", Type: models.FieldTypeLink, Options: models.FieldOptions{LinkedTableID: &projects.ID}}
+	assert.NoError(t, fieldService.CreateField(link))
+
+	// More tasks link to the project than a refresh used to allow
+	project, err := recordService.CreateRecord(projects.ID, json.RawMessage(`{"name": "Apollo"}`))
+	assert.NoError(t, err)
+	taskIDs := make([]string, 10001)
+	records := make([]models.Record, len(taskIDs))
+	for i := range records {
+		records[i] = models.Record{ID: uuid.New(), TableID: tasks.ID, Position: float64(i + 1),
+			Data: json.RawMessage(`{"project": ["` + project.ID.String() + `"]}`)}
+		taskIDs[i] = records[i].ID.String()
+	}
+	assert.NoError(t, db.CreateInBatches(records, recordBatchSize).Error)
+	links, err := json.Marshal(taskIDs)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(&models.Record{}).Where("id = ?", project.ID).
+		Update("data", json.RawMessage(`{"name": "Apollo", "tasks": `+string(links)+`}`)).Error)
+
+	projectName := &models.Field{TableID: tasks.ID, Name: "Project Name", Key: "project_name", Type: models.FieldTypeLookup,
+		Options: models.FieldOptions{LinkFieldID: &link.ID, LookupFieldID: &name.ID}}
+	assert.NoError(t, fieldService.CreateField(projectName))
+	count := &models.Field{TableID: projects.ID, Name: "Task Count", Key: "task_count", Type: models.FieldTypeRollup,
+		Options: models.FieldOptions{LinkFieldID: link.Options.InverseFieldID, RollupFunction: "count"}}
+	assert.NoError(t, fieldService.CreateField(count))
+	assert.Equal(t, 10001.0, recordData(t, recordService, project.ID)["task_count"])
+
+	// Renaming the project recomputes every task once
+	_, err = recordService.UpdateRecord(project.ID, json.RawMessage(`{"name": "Artemis"}`))
+	assert.NoError(t, err)
+	last := uuid.MustParse(taskIDs[len(taskIDs)-1])
+	assert.Equal(t, []interface{}{"Artemis"}, recordData(t, recordService, last)["project_name"])
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultSearchLimit is the number of records a base search returns per
+	// table when the request does not set a limit.
+	DefaultSearchLimit = 5
+	// MaxSearchLimit is the largest number of records per table a base
+	// search may ask for.
+	MaxSearchLimit = 50
+)
+
+// ErrBaseNotFound is returned when a base that does not exist is searched.
+var ErrBaseNotFound = errors.New("base not found")
+
+// BaseSearchOptions adjusts a base search.
+type BaseSearchOptions struct {
+	// Limit is the number of records returned per table, DefaultSearchLimit
+	// when 0.
+	Limit int
+	// CanRead reports whether the caller may read a table. Tables it
+	// rejects are not searched; nil allows every table.
+	CanRead func(models.Table) bool
+}
+
+type SearchService struct {
+	db *gorm.DB
+}
+
+func NewSearchService(db *gorm.DB) *SearchService {
+	return &SearchService{db: db}
+}
+
+// searchedRecord is a record matching a base search, with its score, its
+// position among the matches of its table and the number of those matches.
+type searchedRecord struct {
+	models.Record
+	Score        float64
+	TableRow     int64
+	TableMatches int64
+}
+
+// SearchBase searches the names of a base's tables and fields and the
+// records of its tables. Records are found by full-text search (see
+// query.Request.Search) in a single query over all tables; every table
+// returns its best opts.Limit matches. Problems with the request are
+// reported as *models.ValidationError.
+func (s *SearchService) SearchBase(baseID uuid.UUID, search string, opts BaseSearchOptions) (*models.BaseSearchResult, error) {
+	search = strings.TrimSpace(search)
+	if search == "" {
+		return nil, &models.ValidationError{Message: "search query is required"}
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultSearchLimit
+	}
+	if opts.Limit < 1 || opts.Limit > MaxSearchLimit {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("limit must be between 1 and %d", MaxSearchLimit)}
+	}
+
+	if err := s.db.First(&models.Base{}, "id = ?", baseID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBaseNotFound
+		}
+		return nil, fmt.Errorf("failed to load base %s: %w", baseID, err)
+	}
+	var tables []models.Table
+	if err := s.db.Where("base_id = ?", baseID).Order("created_at ASC").Find(&tables).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tables: %w", err)
+	}
+	readable := tables[:0]
+	for _, table := range tables {
+		if opts.CanRead == nil || opts.CanRead(table) {
+			readable = append(readable, table)
+		}
+	}
+
+	result := &models.BaseSearchResult{Query: search, Tables: []models.TableSearchHit{}}
+	if len(readable) == 0 {
+		return result, nil
+	}
+	tableIDs := make([]uuid.UUID, len(readable))
+	for i, table := range readable {
+		tableIDs[i] = table.ID
+	}
+
+	var fields []models.Field
+	if err := s.db.Where("table_id IN ?", tableIDs).Order("\"order\" asc").Find(&fields).Error; err != nil {
+		return nil, fmt.Errorf("failed to load fields: %w", err)
+	}
+	tableFields := make(map[uuid.UUID][]models.Field)
+	for _, field := range fields {
+		tableFields[field.TableID] = append(tableFields[field.TableID], field)
+	}
+
+	records, err := s.searchRecords(tableIDs, search, opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+	tableRecords := make(map[uuid.UUID][]searchedRecord)
+	for _, record := range records {
+		tableRecords[record.TableID] = append(tableRecords[record.TableID], record)
+	}
+
+	// best is the highest score of each table's hits, to order the tables
+	best := make(map[uuid.UUID]float64)
+	for _, table := range readable {
+		hit := models.TableSearchHit{
+			TableID: table.ID,
+			Name:    table.Name,
+			Score:   query.NameScore(table.Name, search),
+			Fields:  []models.FieldSearchHit{},
+			Records: []models.RecordSearchHit{},
+		}
+		best[table.ID] = hit.Score
+		for _, field := range tableFields[table.ID] {
+			if score := query.NameScore(field.Name, search); score > 0 {
+				hit.Fields = append(hit.Fields, models.FieldSearchHit{FieldID: field.ID, Key: field.Key, Name: field.Name, Score: score})
+				best[table.ID] = max(best[table.ID], score)
+			}
+		}
+		sort.SliceStable(hit.Fields, func(i, j int) bool { return hit.Fields[i].Score > hit.Fields[j].Score })
+		for _, record := range tableRecords[table.ID] {
+			highlights, err := searchHighlights(record.Data, tableFields[table.ID], search)
+			if err != nil {
+				return nil, err
+			}
+			hit.Records = append(hit.Records, models.RecordSearchHit{RecordID: record.ID, Score: record.Score, Highlights: highlights})
+			hit.TotalRecords = record.TableMatches
+			best[table.ID] = max(best[table.ID], record.Score)
+		}
+		if hit.Score > 0 || len(hit.Fields) > 0 || len(hit.Records) > 0 {
+			result.Tables = append(result.Tables, hit)
+		}
+	}
+	sort.SliceStable(result.Tables, func(i, j int) bool {
+		return best[result.Tables[i].TableID] > best[result.Tables[j].TableID]
+	})
+	return result, nil
+}
+
+// searchRecords returns the best limit records of each table matching
+// search, ordered by table and score.
+func (s *SearchService) searchRecords(tableIDs []uuid.UUID, search string, limit int) ([]searchedRecord, error) {
+	join, args := searchJoin(dialect.For(s.db), search)
+	ranked := s.db.Model(&models.Record{}).
+		Joins(join, args...).
+		Where("table_id IN ?", tableIDs).
+		Select("records.*, search_hits.score AS score, " +
+			"ROW_NUMBER() OVER (PARTITION BY table_id ORDER BY search_hits.score DESC, position ASC, id ASC) AS table_row, " +
+			"COUNT(*) OVER (PARTITION BY table_id) AS table_matches")
+
+	var records []searchedRecord
+	err := s.db.Table("(?) AS ranked", ranked).
+		Where("table_row <= ?", limit).
+		Order("table_id, table_row").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search records: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupBasesTable(t *testing.T, db *gorm.DB) {
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS bases (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		user_id TEXT,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create bases table: %v", err)
+	}
+}
+
+func TestSearchBase(t *testing.T) {
+	db := setupTestDB(t)
+	setupBasesTable(t, db)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	searchService := NewSearchService(db)
+
+	base := &models.Base{Name: "Work"}
+	assert.NoError(t, NewBaseService(db).CreateBase(base))
+	tasks := &models.Table{BaseID: base.ID, Name: "Tasks"}
+	releases := &models.Table{BaseID: base.ID, Name: "Releases"}
+	secret := &models.Table{BaseID: base.ID, Name: "Deploy keys"}
+	elsewhere := &models.Table{BaseID: uuid.New(), Name: "Deploy log"}
+	for _, table := range []*models.Table{tasks, releases, secret, elsewhere} {
+		assert.NoError(t, tableService.CreateTable(table))
+	}
+	taskTitle := &models.Field{TableID: tasks.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	deployDate := &models.Field{TableID: releases.ID, Name: "Deploy date", Key: "date", Type: models.FieldTypeDate}
+	releaseNotes := &models.Field{TableID: releases.ID, Name: "Notes", Key: "notes", Type: models.FieldTypeText}
+	for _, field := range []*models.Field{taskTitle, deployDate, releaseNotes,
+		{TableID: secret.ID, Name: "Key", Key: "key", Type: models.FieldTypeText},
+		{TableID: elsewhere.ID, Name: "Entry", Key: "entry", Type: models.FieldTypeText},
+	} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+
+	var taskIDs []uuid.UUID
+	for _, data := range []string{
+		`{"title": "Deploy"}`,
+		`{"title": "Deploy the API, then deploy the docs after the review"}`,
+		`{"title": "Deploy the web app"}`,
+		`{"title": "Review"}`,
+	} {
+		record, err := recordService.CreateRecord(tasks.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+		taskIDs = append(taskIDs, record.ID)
+	}
+	for table, data := range map[uuid.UUID]string{
+		releases.ID:  `{"notes": "Nothing yet"}`,
+		secret.ID:    `{"key": "deploy"}`,
+		elsewhere.ID: `{"entry": "deploy"}`,
+	} {
+		_, err := recordService.CreateRecord(table, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	result, err := searchService.SearchBase(base.ID, " deploy ", BaseSearchOptions{
+		Limit:   2,
+		CanRead: func(table models.Table) bool { return table.ID != secret.ID },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "deploy", result.Query)
+	hits := make(map[uuid.UUID]models.TableSearchHit)
+	for _, hit := range result.Tables {
+		hits[hit.TableID] = hit
+	}
+	assert.Len(t, hits, 2)
+
+	hit := hits[tasks.ID]
+	assert.Zero(t, hit.Score)
+	assert.Empty(t, hit.Fields)
+	assert.Equal(t, int64(3), hit.TotalRecords)
+	if assert.Len(t, hit.Records, 2) {
+		// The record that is just the word matches best
+		assert.Equal(t, taskIDs[0], hit.Records[0].RecordID)
+		assert.Equal(t, map[string]string{"title": "<mark>Deploy</mark>"}, hit.Records[0].Highlights)
+		assert.Greater(t, hit.Records[0].Score, hit.Records[1].Score)
+	}
+
+	// Releases only matches by a field name
+	hit = hits[releases.ID]
+	assert.Empty(t, hit.Records)
+	assert.Zero(t, hit.TotalRecords)
+	if assert.Len(t, hit.Fields, 1) {
+		assert.Equal(t, deployDate.ID, hit.Fields[0].FieldID)
+		assert.Equal(t, "date", hit.Fields[0].Key)
+		assert.InDelta(t, 6.0/11, hit.Fields[0].Score, 1e-9)
+	}
+
+	// Table names match too
+	result, err = searchService.SearchBase(base.ID, "releases", BaseSearchOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Tables, 1) {
+		assert.Equal(t, 1.0, result.Tables[0].Score)
+	}
+
+	var validationErr *models.ValidationError
+	_, err = searchService.SearchBase(base.ID, "  ", BaseSearchOptions{})
+	assert.ErrorAs(t, err, &validationErr)
+	_, err = searchService.SearchBase(base.ID, "deploy", BaseSearchOptions{Limit: MaxSearchLimit + 1})
+	assert.ErrorAs(t, err, &validationErr)
+	_, err = searchService.SearchBase(uuid.New(), "deploy", BaseSearchOptions{})
+	assert.ErrorIs(t, err, ErrBaseNotFound)
+}
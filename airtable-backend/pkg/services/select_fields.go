@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// isSelectField reports whether a field stores option labels.
+func isSelectField(field models.Field) bool {
+	return field.Type == models.FieldTypeSelect || field.Type == models.FieldTypeMulti
+}
+
+// prepareChoices validates the options of a select field and gives new
+// options an ID. Fields configured with the older validation.options list
+// have it turned into choices.
+func prepareChoices(field *models.Field) error {
+	if len(field.Options.Choices) == 0 && len(field.Validation.Options) > 0 {
+		for _, label := range field.Validation.Options {
+			field.Options.Choices = append(field.Options.Choices, models.SelectOption{Label: label})
+		}
+	}
+	field.Validation.Options = nil
+
+	labels := make(map[string]bool)
+	ids := make(map[string]bool)
+	for i := range field.Options.Choices {
+		choice := &field.Options.Choices[i]
+		choice.Label = strings.TrimSpace(choice.Label)
+		if choice.Label == "" {
+			return &models.ValidationError{Message: "option label cannot be empty"}
+		}
+		if labels[choice.Label] {
+			return &models.ValidationError{Message: fmt.Sprintf("duplicate option label: %s", choice.Label)}
+		}
+		labels[choice.Label] = true
+		if choice.ID == "" {
+			choice.ID = uuid.New().String()
+		}
+		if ids[choice.ID] {
+			return &models.ValidationError{Message: fmt.Sprintf("duplicate option id: %s", choice.ID)}
+		}
+		ids[choice.ID] = true
+	}
+	return nil
+}
+
+// matchChoices gives the submitted options of a select field that have no
+// ID the ID of the existing option with the same label, so that clients
+// sending only labels keep their options instead of replacing them.
+func matchChoices(field *models.Field, existing *models.Field) {
+	used := make(map[string]bool)
+	for _, choice := range field.Options.Choices {
+		if choice.ID != "" {
+			used[choice.ID] = true
+		}
+	}
+	byLabel := make(map[string]string)
+	for _, choice := range existing.Options.Choices {
+		if !used[choice.ID] {
+			byLabel[choice.Label] = choice.ID
+		}
+	}
+	for i := range field.Options.Choices {
+		choice := &field.Options.Choices[i]
+		if id, ok := byLabel[strings.TrimSpace(choice.Label)]; ok && choice.ID == "" {
+			choice.ID = id
+			delete(byLabel, strings.TrimSpace(choice.Label))
+		}
+	}
+}
+
+// saveSelectField saves a select field and applies option changes to the
+// table's records: renamed options are rewritten to the new label and
+// deleted options are removed from cells.
+func (s *FieldService) saveSelectField(field *models.Field, existing *models.Field) error {
+	newLabels := make(map[string]string)
+	for _, choice := range field.Options.Choices {
+		newLabels[choice.ID] = choice.Label
+	}
+	renamed := make(map[string]string)
+	removed := make(map[string]bool)
+	for _, choice := range existing.Options.Choices {
+		label, ok := newLabels[choice.ID]
+		switch {
+		case !ok:
+			removed[choice.Label] = true
+		case label != choice.Label:
+			renamed[choice.Label] = label
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(field).Error; err != nil {
+			return err
+		}
+		if len(renamed) == 0 && len(removed) == 0 {
+			return nil
+		}
+		_, err := rewriteRecordData(tx, field.TableID, func(_ uuid.UUID, data map[string]interface{}) bool {
+			value, ok := data[field.Key]
+			if !ok {
+				return false
+			}
+			next, changed := remapSelectValue(value, renamed, removed)
+			if !changed {
+				return false
+			}
+			if next == nil {
+				delete(data, field.Key)
+			} else {
+				data[field.Key] = next
+			}
+			return true
+		})
+		return err
+	})
+}
+
+// remapSelectValue applies option renames and deletions to a select or
+// multi-select cell. A nil result means the cell should be cleared.
+func remapSelectValue(value interface{}, renamed map[string]string, removed map[string]bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if removed[v] {
+			return nil, true
+		}
+		if label, ok := renamed[v]; ok {
+			return label, true
+		}
+	case []interface{}:
+		next := make([]interface{}, 0, len(v))
+		seen := make(map[string]bool)
+		changed := false
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				next = append(next, item)
+				continue
+			}
+			if removed[str] {
+				changed = true
+				continue
+			}
+			if label, ok := renamed[str]; ok {
+				str = label
+				changed = true
+			}
+			if seen[str] {
+				changed = true
+				continue
+			}
+			seen[str] = true
+			next = append(next, str)
+		}
+		return next, changed
+	}
+	return value, false
+}
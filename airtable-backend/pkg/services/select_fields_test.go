@@ -0,0 +1,81 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectFields_Options(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+
+	status := &models.Field{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Todo"}, {Label: "Done", Color: "green"}}}}
+	assert.NoError(t, fieldService.CreateField(status))
+	tags := &models.Field{TableID: table.ID, Name: "Tags", Key: "tags", Type: models.FieldTypeMulti,
+		Validation: models.ValidationRule{Options: []string{"red", "blue", "green"}}}
+	assert.NoError(t, fieldService.CreateField(tags))
+
+	// Options get IDs, and the legacy validation list is converted
+	for _, choice := range status.Options.Choices {
+		assert.NotEmpty(t, choice.ID)
+	}
+	assert.Len(t, tags.Options.Choices, 3)
+	assert.Empty(t, tags.Validation.Options)
+
+	dup := &models.Field{TableID: table.ID, Name: "Dup", Key: "dup", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "A"}, {Label: "A"}}}}
+	var validationErr *models.ValidationError
+	assert.ErrorAs(t, fieldService.CreateField(dup), &validationErr)
+
+	// Values are checked against the options, including decoded JSON arrays
+	var decoded interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`["red", "purple"]`), &decoded))
+	assert.Error(t, tags.Validate(decoded))
+	assert.NoError(t, tags.Validate([]interface{}{"red", "blue"}))
+	assert.Error(t, status.Validate("Blocked"))
+
+	first, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"status": "Todo", "tags": ["red", "blue"]}`))
+	assert.NoError(t, err)
+	second, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"status": "Done", "tags": ["green"]}`))
+	assert.NoError(t, err)
+
+	// Renaming "Todo" and deleting "Done" rewrites the cells
+	stored, err := fieldService.GetFieldByID(status.ID)
+	assert.NoError(t, err)
+	stored.Options.Choices = []models.SelectOption{{ID: status.Options.Choices[0].ID, Label: "To do"}}
+	assert.NoError(t, fieldService.UpdateField(stored))
+	assert.Equal(t, "To do", recordData(t, recordService, first.ID)["status"])
+	_, ok := recordData(t, recordService, second.ID)["status"]
+	assert.False(t, ok)
+
+	// Renamed and removed options are applied to multi-select arrays
+	stored, err = fieldService.GetFieldByID(tags.ID)
+	assert.NoError(t, err)
+	choices := stored.Options.Choices
+	stored.Options.Choices = []models.SelectOption{{ID: choices[0].ID, Label: "warm"}, {ID: choices[2].ID, Label: "green"}}
+	assert.NoError(t, fieldService.UpdateField(stored))
+	assert.Equal(t, []interface{}{"warm"}, recordData(t, recordService, first.ID)["tags"])
+	assert.Equal(t, []interface{}{"green"}, recordData(t, recordService, second.ID)["tags"])
+
+	// Options sent without IDs keep the existing options with their label
+	stored, err = fieldService.GetFieldByID(tags.ID)
+	assert.NoError(t, err)
+	stored.Options.Choices = []models.SelectOption{{Label: "warm"}, {Label: "green"}, {Label: "cold"}}
+	assert.NoError(t, fieldService.UpdateField(stored))
+	assert.Equal(t, choices[0].ID, stored.Options.Choices[0].ID)
+	assert.Equal(t, choices[2].ID, stored.Options.Choices[1].ID)
+	assert.NotEmpty(t, stored.Options.Choices[2].ID)
+	assert.Equal(t, []interface{}{"warm"}, recordData(t, recordService, first.ID)["tags"])
+	assert.Equal(t, []interface{}{"green"}, recordData(t, recordService, second.ID)["tags"])
+}
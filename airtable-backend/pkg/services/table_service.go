@@ -5,10 +5,12 @@ import (
 	"gorm.io/gorm"
 
 	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/storage"
 )
 
 type TableService struct {
-	DB *gorm.DB
+	DB        *gorm.DB
+	BlobStore storage.BlobStore // Attachment storage; blobs of deleted records are removed when set
 }
 
 func NewTableService(db *gorm.DB) *TableService {
@@ -42,15 +44,48 @@ func (s *TableService) UpdateTable(table *models.Table) error {
 }
 
 func (s *TableService) DeleteTable(id uuid.UUID) error {
-	// Consider cascade delete for fields and records
-	// Or handle deletion of related objects here (Fields and Records first).
-	// Delete associated fields
-	if err := s.DB.Where("table_id = ?", id).Delete(&models.Field{}).Error; err != nil {
+	var fields []models.Field
+	var attached []models.Record
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// Remove link fields in other tables that point at this table
+		if err := removeLinksToTable(tx, id); err != nil {
+			return err
+		}
+		// Remember records with attachments, their blobs go after commit
+		if s.BlobStore != nil {
+			if err := tx.Where("table_id = ? AND type = ?", id, models.FieldTypeFile).Find(&fields).Error; err != nil {
+				return err
+			}
+			if len(fields) > 0 {
+				var err error
+				if attached, err = recordsWithAttachments(tx, id, fields); err != nil {
+					return err
+				}
+			}
+		}
+		// Delete associated fields
+		if err := tx.Where("table_id = ?", id).Delete(&models.Field{}).Error; err != nil {
+			return err
+		}
+		// Delete associated records
+		if err := tx.Where("table_id = ?", id).Delete(&models.Record{}).Error; err != nil {
+			return err
+		}
+		// Delete the table's views and the record positions saved in them
+		views := tx.Unscoped().Model(&models.View{}).Select("id").Where("table_id = ?", id)
+		if err := tx.Where("view_id IN (?)", views).Delete(&models.ViewPosition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("table_id = ?", id).Delete(&models.View{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Table{}, id).Error
+	})
+	if err != nil {
 		return err
 	}
-	// Delete associated records
-	if err := s.DB.Where("table_id = ?", id).Delete(&models.Record{}).Error; err != nil {
-		return err
+	for i := range attached {
+		deleteAttachmentBlobs(s.BlobStore, &attached[i], fields)
 	}
-	return s.DB.Delete(&models.Table{}, id).Error
+	return nil
 }
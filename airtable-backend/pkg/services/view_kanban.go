@@ -0,0 +1,457 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultStackSize is the number of records read per kanban stack when a
+// request does not set one.
+const DefaultStackSize = 25
+
+const (
+	// positionJoin attaches the positions records were moved to in a view.
+	positionJoin = "LEFT JOIN view_positions ON view_positions.record_id = records.id AND view_positions.view_id = ?"
+	// stackOrder orders the records of a stack: moved records by position,
+	// then the others in their order in the table.
+	stackOrder = "view_positions.position IS NULL, view_positions.position ASC, records.position ASC, records.id ASC"
+)
+
+// KanbanOptions selects what is read of a kanban view.
+type KanbanOptions struct {
+	// PageSize is the number of records read per stack, DefaultStackSize
+	// when 0.
+	PageSize int
+	// Cursor is the NextCursor of a stack. When set, only the records of
+	// that stack following the cursor are read.
+	Cursor string
+}
+
+// KanbanMove places a record in a kanban view: in the stack of a choice,
+// and next to a record of that stack or, when neither Before nor After is
+// set, at its end.
+type KanbanMove struct {
+	Stack  *string    `json:"stack"`            // label of the choice; nil for the stack of records without one
+	Before *uuid.UUID `json:"before,omitempty"` // record to place the moved record just before
+	After  *uuid.UUID `json:"after,omitempty"`  // record to place the moved record just after
+}
+
+// stackCursor continues a stack after the record it was taken at. It holds
+// the record's positions in the view and in the table, so the stack reads
+// on from the same place after the record has moved or been deleted.
+type stackCursor struct {
+	Stack          *string   `json:"s"`
+	Position       *float64  `json:"p,omitempty"` // position in the view
+	RecordPosition float64   `json:"r"`           // position in the table
+	ID             uuid.UUID `json:"id"`
+}
+
+func (c stackCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeStackCursor(encoded string) (*stackCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, &models.ValidationError{Message: "invalid cursor"}
+	}
+	var cursor stackCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, &models.ValidationError{Message: "invalid cursor"}
+	}
+	return &cursor, nil
+}
+
+// kanbanView is a kanban view resolved against the fields of its table.
+type kanbanView struct {
+	view     *models.View
+	fields   []models.Field
+	fieldMap map[string]models.Field
+	stack    models.Field  // the select field records are stacked by
+	key      string        // SQL key of the stack of a record
+	keyArgs  []interface{} // arguments of key
+}
+
+// stackedRecord is a record read together with its stack and position.
+type stackedRecord struct {
+	models.Record
+	Stack         *string
+	StackPosition *float64
+	StackRow      int64
+	StackCount    int64
+}
+
+// stackEntry is a record of a stack while a move places another one.
+type stackEntry struct {
+	ID       uuid.UUID
+	Position *float64
+}
+
+func (s *ViewService) loadKanban(viewID uuid.UUID) (*kanbanView, error) {
+	view, err := s.GetViewByID(viewID)
+	if err != nil {
+		return nil, err
+	}
+	if view.Type != models.ViewTypeKanban || view.Options.StackFieldID == nil {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("view %s is not a kanban view", view.Name)}
+	}
+	fields, err := NewFieldService(s.db).GetFieldsByTableID(view.TableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields for table %s: %w", view.TableID, err)
+	}
+	fieldMap := query.FieldMap(fields)
+	// The field may have been deleted or converted since the view was saved
+	stack, ok := fieldMap[view.Options.StackFieldID.String()]
+	if !ok || stack.Type != models.FieldTypeSelect {
+		return nil, &models.ValidationError{Message: "the stack field of the view is no longer a select field"}
+	}
+	key, keyArgs, err := query.BuildGroupKey(dialect.For(s.db), stack, "")
+	if err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
+	}
+	return &kanbanView{view: view, fields: fields, fieldMap: fieldMap, stack: stack, key: key, keyArgs: keyArgs}, nil
+}
+
+// inStack restricts q to the records of a stack.
+func (k *kanbanView) inStack(q *gorm.DB, stack *string) *gorm.DB {
+	if stack == nil {
+		return q.Where(k.key+" IS NULL", k.keyArgs...)
+	}
+	return q.Where(k.key+" = ?", append(append([]interface{}{}, k.keyArgs...), *stack)...)
+}
+
+// newStack returns an empty stack for a choice label, or for records
+// without a choice when label is nil.
+func (k *kanbanView) newStack(label *string) models.KanbanStack {
+	stack := models.KanbanStack{Value: label, Records: []models.Record{}}
+	if label != nil {
+		for _, choice := range k.stack.Options.Choices {
+			if choice.Label == *label {
+				stack.Color = choice.Color
+			}
+		}
+	}
+	return stack
+}
+
+// KanbanStacks reads the records of a kanban view stacked by the choice of
+// its stack field, keeping to the view's filter. Every choice has a stack,
+// in the order of the choices, and the stack of records without a choice
+// comes last. Within a stack, records moved with MoveKanbanRecord come
+// first in the order they were placed in, the others follow in their order
+// in the table.
+func (s *ViewService) KanbanStacks(viewID uuid.UUID, opts KanbanOptions) (*models.KanbanStacks, error) {
+	if opts.PageSize == 0 {
+		opts.PageSize = DefaultStackSize
+	}
+	if opts.PageSize < 1 || opts.PageSize > query.MaxPageSize {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("pageSize must be between 1 and %d", query.MaxPageSize)}
+	}
+	var cursor *stackCursor
+	if opts.Cursor != "" {
+		var err error
+		if cursor, err = decodeStackCursor(opts.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	k, err := s.loadKanban(viewID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := viewRequest(k.view)
+	if err != nil {
+		return nil, err
+	}
+	whereClause, args, err := query.BuildFilterClause(dialect.For(s.db), k.fieldMap, stored.Filter)
+	if err != nil {
+		return nil, &models.ValidationError{Message: err.Error()}
+	}
+	filtered := func() *gorm.DB {
+		q := s.db.Model(&models.Record{}).
+			Joins(positionJoin, k.view.ID).
+			Where("records.table_id = ?", k.view.TableID)
+		if whereClause != "" {
+			q = q.Where(whereClause, args...)
+		}
+		return q
+	}
+
+	result := &models.KanbanStacks{View: k.view, Fields: visibleFields(k.fields, k.view.Options)}
+	if cursor != nil {
+		stack, err := s.readStack(k, filtered, cursor, opts.PageSize)
+		if err != nil {
+			return nil, err
+		}
+		result.Stacks = []models.KanbanStack{stack}
+		return result, nil
+	}
+	if result.Stacks, err = s.readStacks(k, filtered, opts.PageSize); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readStacks reads the first page of every stack in a single query,
+// numbering and counting the records of each stack with window functions.
+func (s *ViewService) readStacks(k *kanbanView, filtered func() *gorm.DB, pageSize int) ([]models.KanbanStack, error) {
+	var args []interface{}
+	for i := 0; i < 3; i++ {
+		args = append(args, k.keyArgs...)
+	}
+	numbered := filtered().Select(fmt.Sprintf("records.*, %s AS stack, view_positions.position AS stack_position, "+
+		"ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS stack_row, "+
+		"COUNT(*) OVER (PARTITION BY %s) AS stack_count", k.key, k.key, stackOrder, k.key), args...)
+
+	var rows []stackedRecord
+	err := s.db.Table("(?) AS stacked", numbered).
+		Where("stack_row <= ?", pageSize).
+		Order("stack_row").
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve records: %w", err)
+	}
+
+	records := make([]models.Record, len(rows))
+	for i := range rows {
+		records[i] = rows[i].Record
+	}
+	if err := prepareRecords(records, k.fieldMap, k.fields); err != nil {
+		return nil, err
+	}
+
+	stacks := make([]models.KanbanStack, 0, len(k.stack.Options.Choices)+1)
+	index := make(map[string]int)
+	for _, choice := range k.stack.Options.Choices {
+		label := choice.Label
+		index[groupMapKey(&label)] = len(stacks)
+		stacks = append(stacks, k.newStack(&label))
+	}
+	empty := k.newStack(nil)
+	for i, row := range rows {
+		stack := &empty
+		if row.Stack != nil {
+			position, ok := index[groupMapKey(row.Stack)]
+			if !ok {
+				// A value that is not a choice gets a stack of its own
+				position = len(stacks)
+				index[groupMapKey(row.Stack)] = position
+				stacks = append(stacks, k.newStack(row.Stack))
+			}
+			stack = &stacks[position]
+		}
+		stack.Records = append(stack.Records, records[i])
+		stack.Count = row.StackCount
+		if row.StackCount > int64(len(stack.Records)) && len(stack.Records) == pageSize {
+			stack.NextCursor = stackCursor{Stack: row.Stack, Position: row.StackPosition, RecordPosition: row.Position, ID: row.ID}.encode()
+		}
+	}
+	return append(stacks, empty), nil
+}
+
+// readStack reads the records of a single stack following cursor.
+func (s *ViewService) readStack(k *kanbanView, filtered func() *gorm.DB, cursor *stackCursor, pageSize int) (models.KanbanStack, error) {
+	stack := k.newStack(cursor.Stack)
+	if err := k.inStack(filtered(), cursor.Stack).Count(&stack.Count).Error; err != nil {
+		return stack, fmt.Errorf("failed to count records: %w", err)
+	}
+
+	// Records after the cursor: placed further down, not placed at all, or
+	// at the same position and later in the table
+	after := "(records.position, records.id) > (?, ?)"
+	var keyset string
+	var keysetArgs []interface{}
+	if cursor.Position == nil {
+		keyset, keysetArgs = "view_positions.position IS NULL AND "+after, []interface{}{cursor.RecordPosition, cursor.ID}
+	} else {
+		keyset = "(view_positions.position > ? OR view_positions.position IS NULL OR (view_positions.position = ? AND " + after + "))"
+		keysetArgs = []interface{}{*cursor.Position, *cursor.Position, cursor.RecordPosition, cursor.ID}
+	}
+
+	var rows []stackedRecord
+	err := k.inStack(filtered(), cursor.Stack).
+		Where(keyset, keysetArgs...).
+		Select("records.*, view_positions.position AS stack_position").
+		Order(stackOrder).
+		Limit(pageSize + 1).
+		Find(&rows).Error
+	if err != nil {
+		return stack, fmt.Errorf("failed to retrieve records: %w", err)
+	}
+	more := len(rows) > pageSize
+	if more {
+		rows = rows[:pageSize]
+		last := rows[len(rows)-1]
+		stack.NextCursor = stackCursor{Stack: cursor.Stack, Position: last.StackPosition, RecordPosition: last.Position, ID: last.ID}.encode()
+	}
+
+	records := make([]models.Record, len(rows))
+	for i := range rows {
+		records[i] = rows[i].Record
+	}
+	if err := prepareRecords(records, k.fieldMap, k.fields); err != nil {
+		return stack, err
+	}
+	stack.Records = records
+	return stack, nil
+}
+
+// MoveKanbanRecord moves a record of a kanban view to a place in a stack.
+// The record's choice and its position in the stack change in one
+// transaction and are announced by a single record_updated message.
+// Moves within a view are serialised, so concurrent moves never place two
+// records at the same position.
+func (s *ViewService) MoveKanbanRecord(viewID, recordID uuid.UUID, move KanbanMove) (*models.Record, error) {
+	k, err := s.loadKanban(viewID)
+	if err != nil {
+		return nil, err
+	}
+	if move.Before != nil && move.After != nil {
+		return nil, &models.ValidationError{Message: "only one of before and after can be set"}
+	}
+	anchor := move.Before
+	if anchor == nil {
+		anchor = move.After
+	}
+	if anchor != nil && *anchor == recordID {
+		return nil, &models.ValidationError{Message: "a record cannot be placed next to itself"}
+	}
+	if move.Stack != nil && !hasChoice(k.stack, *move.Stack) {
+		return nil, &models.ValidationError{Message: fmt.Sprintf("unknown stack: %s", *move.Stack)}
+	}
+	if err := s.db.First(&models.Record{}, "id = ? AND table_id = ?", recordID, k.view.TableID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to load record %s: %w", recordID, err)
+	}
+
+	value, err := json.Marshal(move.Stack)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stack: %w", err)
+	}
+	data, err := json.Marshal(map[string]json.RawMessage{k.stack.Key: value})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal record data: %w", err)
+	}
+	records := NewRecordService(s.db, nil, NewFieldService(s.db))
+	return records.updateRecord(recordID, data, func(tx *gorm.DB, _ *models.Record) error {
+		return placeInStack(tx, k, recordID, move.Stack, anchor, move.After != nil)
+	})
+}
+
+func hasChoice(field models.Field, label string) bool {
+	for _, choice := range field.Options.Choices {
+		if choice.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// placeInStack stores the position of a record moved into a stack: just
+// before anchor, or just after it when after is set, or at the end of the
+// stack when there is no anchor.
+func placeInStack(tx *gorm.DB, k *kanbanView, recordID uuid.UUID, label *string, anchor *uuid.UUID, after bool) error {
+	// Moves wait for each other here, so none reads neighbours another one
+	// is about to change
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.View{}, "id = ?", k.view.ID).Error; err != nil {
+		return fmt.Errorf("failed to lock view: %w", err)
+	}
+
+	var stack []stackEntry
+	q := tx.Model(&models.Record{}).
+		Joins(positionJoin, k.view.ID).
+		Where("records.table_id = ? AND records.id <> ?", k.view.TableID, recordID)
+	err := k.inStack(q, label).
+		Select("records.id AS id, view_positions.position AS position").
+		Order(stackOrder).
+		Scan(&stack).Error
+	if err != nil {
+		return fmt.Errorf("failed to read stack: %w", err)
+	}
+
+	index := len(stack)
+	if anchor != nil {
+		index = -1
+		for i, entry := range stack {
+			if entry.ID == *anchor {
+				index = i
+			}
+		}
+		if index < 0 {
+			return &models.ValidationError{Message: fmt.Sprintf("record %s is not in the target stack", *anchor)}
+		}
+		if after {
+			index++
+		}
+	}
+
+	positions := stackPositions(k.view.ID, recordID, stack, index)
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "view_id"}, {Name: "record_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"position"}),
+	}).Create(&positions).Error
+	if err != nil {
+		return fmt.Errorf("failed to store positions: %w", err)
+	}
+	return nil
+}
+
+// stackPositions returns the positions to store to place a record at index
+// in a stack, given the other records of the stack in order. Usually only
+// the record gets a position, halfway between its neighbours. When a record
+// before it has no position yet, or its neighbours are too close for a
+// position between them, the records up to it are numbered again from 1.
+func stackPositions(viewID, recordID uuid.UUID, stack []stackEntry, index int) []models.ViewPosition {
+	var prev, next *float64
+	if index > 0 {
+		prev = stack[index-1].Position
+	}
+	if index < len(stack) {
+		next = stack[index].Position
+	}
+	if index == 0 || prev != nil {
+		var position float64
+		switch {
+		case prev == nil && next == nil:
+			position = 1
+		case prev == nil:
+			position = *next - 1
+		case next == nil:
+			position = *prev + 1
+		default:
+			position = *prev + (*next-*prev)/2
+		}
+		if (prev == nil || position > *prev) && (next == nil || position < *next) {
+			return []models.ViewPosition{{ViewID: viewID, RecordID: recordID, Position: position}}
+		}
+	}
+
+	// Records with positions come first, so they all get renumbered
+	end := index
+	for i, entry := range stack {
+		if entry.Position != nil && i >= end {
+			end = i + 1
+		}
+	}
+	positions := make([]models.ViewPosition, 0, end+1)
+	for i := 0; i < end; i++ {
+		position := float64(i + 1)
+		if i >= index {
+			position++
+		}
+		positions = append(positions, models.ViewPosition{ViewID: viewID, RecordID: stack[i].ID, Position: position})
+	}
+	return append(positions, models.ViewPosition{ViewID: viewID, RecordID: recordID, Position: float64(index + 1)})
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKanbanStacks(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	viewService := NewViewService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	status := &models.Field{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Todo"}, {Label: "Doing", Color: "blue"}, {Label: "Done"}}}}
+	assert.NoError(t, fieldService.CreateField(title))
+	assert.NoError(t, fieldService.CreateField(status))
+	ids := make(map[string]uuid.UUID)
+	for _, data := range []string{
+		`{"title": "a", "status": "Todo"}`,
+		`{"title": "b", "status": "Todo"}`,
+		`{"title": "c", "status": "Todo"}`,
+		`{"title": "d", "status": "Doing"}`,
+		`{"title": "e"}`,
+		`{"title": "hidden", "status": "Todo"}`,
+	} {
+		record, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+		values, err := decodeRecordData(record.Data)
+		assert.NoError(t, err)
+		ids[values["title"].(string)] = record.ID
+	}
+
+	board := &models.View{TableID: table.ID, Name: "Board", Type: models.ViewTypeKanban,
+		Filter:  json.RawMessage(`{"conditions": [{"fieldId": "title", "operator": "!=", "value": "hidden"}]}`),
+		Options: models.ViewOptions{StackFieldID: &status.ID}}
+	assert.NoError(t, viewService.CreateView(board))
+
+	titles := func(records []models.Record) []interface{} {
+		out := []interface{}{}
+		for _, record := range records {
+			data, err := decodeRecordData(record.Data)
+			assert.NoError(t, err)
+			out = append(out, data["title"])
+		}
+		return out
+	}
+	stacks := func() []models.KanbanStack {
+		result, err := viewService.KanbanStacks(board.ID, KanbanOptions{PageSize: 2})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return result.Stacks
+	}
+
+	// Every choice has a stack, the empty stack comes last
+	result := stacks()
+	if assert.Len(t, result, 4) {
+		assert.Equal(t, "Todo", *result[0].Value)
+		assert.Equal(t, int64(3), result[0].Count)
+		assert.Equal(t, []interface{}{"a", "b"}, titles(result[0].Records))
+		assert.Equal(t, "blue", result[1].Color)
+		assert.Equal(t, []interface{}{"d"}, titles(result[1].Records))
+		assert.Empty(t, result[1].NextCursor)
+		assert.Equal(t, int64(0), result[2].Count)
+		assert.Empty(t, result[2].Records)
+		assert.Nil(t, result[3].Value)
+		assert.Equal(t, []interface{}{"e"}, titles(result[3].Records))
+	}
+
+	// A stack continues from its cursor
+	more, err := viewService.KanbanStacks(board.ID, KanbanOptions{PageSize: 2, Cursor: result[0].NextCursor})
+	assert.NoError(t, err)
+	if assert.Len(t, more.Stacks, 1) {
+		assert.Equal(t, []interface{}{"c"}, titles(more.Stacks[0].Records))
+		assert.Empty(t, more.Stacks[0].NextCursor)
+	}
+
+	// The cursor keeps its place when its record moves to the end of the
+	// table, where the stack meets it again
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{ids["b"]}})
+	assert.NoError(t, err)
+	more, err = viewService.KanbanStacks(board.ID, KanbanOptions{PageSize: 2, Cursor: result[0].NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"c", "b"}, titles(more.Stacks[0].Records))
+	_, err = recordService.MoveRecords(table.ID, RecordMove{RecordIDs: []uuid.UUID{ids["b"]}, Before: ptr(ids["c"])})
+	assert.NoError(t, err)
+
+	// Moving into another stack changes the choice
+	todo, doing := "Todo", "Doing"
+	moved, err := viewService.MoveKanbanRecord(board.ID, ids["a"], KanbanMove{Stack: &doing, Before: ptr(ids["d"])})
+	assert.NoError(t, err)
+	assert.Equal(t, "Doing", recordData(t, recordService, moved.ID)["status"])
+	result = stacks()
+	assert.Equal(t, []interface{}{"a", "d"}, titles(result[1].Records))
+	assert.Equal(t, []interface{}{"b", "c"}, titles(result[0].Records))
+
+	// Moves within a stack between records that were never placed
+	_, err = viewService.MoveKanbanRecord(board.ID, ids["c"], KanbanMove{Stack: &todo, Before: ptr(ids["b"])})
+	assert.NoError(t, err)
+	_, err = viewService.MoveKanbanRecord(board.ID, ids["a"], KanbanMove{Stack: &todo, After: ptr(ids["c"])})
+	assert.NoError(t, err)
+	result = stacks()
+	assert.Equal(t, []interface{}{"c", "a"}, titles(result[0].Records))
+	more, err = viewService.KanbanStacks(board.ID, KanbanOptions{PageSize: 2, Cursor: result[0].NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"b"}, titles(more.Stacks[0].Records))
+
+	// Into the empty stack, at its end
+	_, err = viewService.MoveKanbanRecord(board.ID, ids["d"], KanbanMove{})
+	assert.NoError(t, err)
+	assert.Nil(t, recordData(t, recordService, ids["d"])["status"])
+	result = stacks()
+	assert.Equal(t, []interface{}{"e", "d"}, titles(result[3].Records))
+
+	var validationErr *models.ValidationError
+	for name, move := range map[string]KanbanMove{
+		"unknown stack":    {Stack: ptr("Later")},
+		"both neighbours":  {Stack: &todo, Before: ptr(ids["a"]), After: ptr(ids["c"])},
+		"other stack":      {Stack: &todo, Before: ptr(ids["e"])},
+		"next to itself":   {Stack: &todo, Before: ptr(ids["b"])},
+		"unknown neighbor": {Stack: &todo, After: ptr(uuid.New())},
+	} {
+		_, err := viewService.MoveKanbanRecord(board.ID, ids["b"], move)
+		assert.ErrorAs(t, err, &validationErr, name)
+	}
+	_, err = viewService.MoveKanbanRecord(board.ID, uuid.New(), KanbanMove{Stack: &todo})
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	_, err = viewService.KanbanStacks(board.ID, KanbanOptions{Cursor: "nope"})
+	assert.ErrorAs(t, err, &validationErr)
+}
+
+func TestStackPositions(t *testing.T) {
+	view, record := uuid.New(), uuid.New()
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	at := func(p float64) *float64 { return &p }
+	positions := func(stack []stackEntry, index int) map[uuid.UUID]float64 {
+		out := make(map[uuid.UUID]float64)
+		for _, position := range stackPositions(view, record, stack, index) {
+			assert.Equal(t, view, position.ViewID)
+			out[position.RecordID] = position.Position
+		}
+		return out
+	}
+
+	placed := []stackEntry{{a, at(1)}, {b, at(2)}, {c, nil}}
+	assert.Equal(t, map[uuid.UUID]float64{record: 0}, positions(placed, 0))
+	assert.Equal(t, map[uuid.UUID]float64{record: 1.5}, positions(placed, 1))
+	assert.Equal(t, map[uuid.UUID]float64{record: 3}, positions(placed, 2))
+	// After a record without a position, the stack is numbered up to it
+	assert.Equal(t, map[uuid.UUID]float64{a: 1, b: 2, c: 3, record: 4}, positions(placed, 3))
+	// Neighbours too close together are spread out again
+	crowded := []stackEntry{{a, at(1)}, {b, at(1)}, {c, at(2)}}
+	assert.Equal(t, map[uuid.UUID]float64{a: 1, record: 2, b: 3, c: 4}, positions(crowded, 1))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"airtable-backend/pkg/database/dialect"
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+	"airtable-backend/pkg/redis"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrViewNotFound is returned for views that do not exist.
+var ErrViewNotFound = errors.New("view not found")
+
+// ViewUpdateMessage is published to a table's subscribers when one of its
+// views is created, changed or deleted.
+type ViewUpdateMessage struct {
+	Type    string       `json:"type"` // "view_created", "view_updated" or "view_deleted"
+	TableID uuid.UUID    `json:"tableId"`
+	ViewID  uuid.UUID    `json:"viewId"`
+	View    *models.View `json:"view,omitempty"`
+}
+
+type ViewService struct {
+	db *gorm.DB
+}
+
+func NewViewService(db *gorm.DB) *ViewService {
+	return &ViewService{db: db}
+}
+
+// CreateView saves a new view after checking it against the table's fields.
+// Views are added after the table's existing views.
+func (s *ViewService) CreateView(view *models.View) error {
+	if _, err := loadTable(s.db, view.TableID); err != nil {
+		return err
+	}
+	if err := s.validateView(view); err != nil {
+		return err
+	}
+	var last struct{ Order *int }
+	if err := s.db.Model(&models.View{}).Select(`MAX("order") AS "order"`).Where("table_id = ?", view.TableID).Scan(&last).Error; err != nil {
+		return fmt.Errorf("failed to read view order: %w", err)
+	}
+	view.Order = 0
+	if last.Order != nil {
+		view.Order = *last.Order + 1
+	}
+	if err := s.db.Create(view).Error; err != nil {
+		return fmt.Errorf("failed to create view: %w", err)
+	}
+	publishViewUpdate(ViewUpdateMessage{Type: "view_created", TableID: view.TableID, ViewID: view.ID, View: view})
+	return nil
+}
+
+// GetViewByID returns a view, or ErrViewNotFound.
+func (s *ViewService) GetViewByID(id uuid.UUID) (*models.View, error) {
+	var view models.View
+	if err := s.db.First(&view, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrViewNotFound
+		}
+		return nil, fmt.Errorf("failed to load view %s: %w", id, err)
+	}
+	return &view, nil
+}
+
+// GetViewsByTableID returns the views of a table in their order.
+func (s *ViewService) GetViewsByTableID(tableID uuid.UUID) ([]models.View, error) {
+	views := []models.View{}
+	if err := s.db.Where("table_id = ?", tableID).Order("\"order\" asc").Find(&views).Error; err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+// UpdateView saves changes to a view after checking it against the table's
+// fields. A view keeps its table and its place among the table's views.
+func (s *ViewService) UpdateView(view *models.View) error {
+	existing, err := s.GetViewByID(view.ID)
+	if err != nil {
+		return err
+	}
+	view.TableID = existing.TableID
+	view.Order = existing.Order
+	view.CreatedAt = existing.CreatedAt
+	if err := s.validateView(view); err != nil {
+		return err
+	}
+	if err := s.db.Save(view).Error; err != nil {
+		return fmt.Errorf("failed to update view: %w", err)
+	}
+	publishViewUpdate(ViewUpdateMessage{Type: "view_updated", TableID: view.TableID, ViewID: view.ID, View: view})
+	return nil
+}
+
+// DeleteView deletes a view.
+func (s *ViewService) DeleteView(id uuid.UUID) error {
+	view, err := s.GetViewByID(id)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("view_id = ?", id).Delete(&models.ViewPosition{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.View{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete view: %w", err)
+	}
+	publishViewUpdate(ViewUpdateMessage{Type: "view_deleted", TableID: view.TableID, ViewID: view.ID})
+	return nil
+}
+
+// QueryViewRecords runs the stored query of a view. The view's filter,
+// sorts and groups replace those of req; the page, search and aggregates
+// of req apply. Fields are returned in the view's order without hidden
+// fields.
+func (s *ViewService) QueryViewRecords(viewID uuid.UUID, req query.Request) (*models.ViewRecords, error) {
+	view, err := s.GetViewByID(viewID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := viewRequest(view)
+	if err != nil {
+		return nil, err
+	}
+	req.Filter, req.Sort, req.GroupBy = stored.Filter, stored.Sort, stored.GroupBy
+
+	result, err := NewQueryService(s.db).QueryRecords(view.TableID, req)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := NewFieldService(s.db).GetFieldsByTableID(view.TableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields for table %s: %w", view.TableID, err)
+	}
+	return &models.ViewRecords{View: view, Fields: visibleFields(fields, view.Options), QueryResult: *result}, nil
+}
+
+// viewRequest reads the stored query of a view.
+func viewRequest(view *models.View) (query.Request, error) {
+	var req query.Request
+	var err error
+	if req.Filter, err = query.ParseFilterJSON(nullableJSON(view.Filter)); err != nil {
+		return req, &models.ValidationError{Message: err.Error()}
+	}
+	if req.Sort, err = query.ParseSortJSON(nullableJSON(view.Sort)); err != nil {
+		return req, &models.ValidationError{Message: err.Error()}
+	}
+	if raw := nullableJSON(view.GroupBy); len(raw) > 0 {
+		if err := json.Unmarshal(raw, &req.GroupBy); err != nil {
+			return req, &models.ValidationError{Message: fmt.Sprintf("invalid groupBy JSON format: %v", err)}
+		}
+	}
+	return req, nil
+}
+
+// nullableJSON treats a JSON null like a missing value.
+func nullableJSON(raw json.RawMessage) json.RawMessage {
+	if string(raw) == "null" {
+		return nil
+	}
+	return raw
+}
+
+// validateView fills in the defaults of a view and checks its type, query
+// and options against the fields of its table.
+func (s *ViewService) validateView(view *models.View) error {
+	if view.Name == "" {
+		return &models.ValidationError{Message: "view name is required"}
+	}
+	switch view.Type {
+	case "":
+		view.Type = models.ViewTypeGrid
+	case models.ViewTypeGrid, models.ViewTypeKanban, models.ViewTypeCalendar, models.ViewTypeGallery:
+	default:
+		return &models.ValidationError{Message: fmt.Sprintf("invalid view type: %s", view.Type)}
+	}
+	switch view.Options.RowHeight {
+	case "", models.RowHeightShort, models.RowHeightMedium, models.RowHeightTall, models.RowHeightExtraTall:
+	default:
+		return &models.ValidationError{Message: fmt.Sprintf("invalid row height: %s", view.Options.RowHeight)}
+	}
+
+	fields, err := NewFieldService(s.db).GetFieldsByTableID(view.TableID)
+	if err != nil {
+		return fmt.Errorf("failed to get fields for table %s: %w", view.TableID, err)
+	}
+	fieldMap := query.FieldMap(fields)
+
+	// The stored query has to run against the table as it is now
+	req, err := viewRequest(view)
+	if err != nil {
+		return err
+	}
+	if len(req.GroupBy) > query.MaxGroupLevels {
+		return &models.ValidationError{Message: fmt.Sprintf("at most %d group levels are supported", query.MaxGroupLevels)}
+	}
+	d := dialect.For(s.db)
+	if _, _, err := query.BuildFilterClause(d, fieldMap, req.Filter); err != nil {
+		return &models.ValidationError{Message: err.Error()}
+	}
+	if _, _, err := query.BuildOrderClause(d, fieldMap, req.Sort); err != nil {
+		return &models.ValidationError{Message: err.Error()}
+	}
+	if _, err := resolveGroupLevels(d, fieldMap, req.GroupBy); err != nil {
+		return err
+	}
+
+	options := view.Options
+	for _, ids := range [][]uuid.UUID{options.HiddenFields, options.FieldOrder} {
+		for _, id := range ids {
+			if _, ok := fieldMap[id.String()]; !ok {
+				return &models.ValidationError{Message: fmt.Sprintf("unknown field: %s", id)}
+			}
+		}
+	}
+	for id, width := range options.ColumnWidths {
+		if _, ok := fieldMap[id.String()]; !ok {
+			return &models.ValidationError{Message: fmt.Sprintf("unknown field: %s", id)}
+		}
+		if width <= 0 {
+			return &models.ValidationError{Message: fmt.Sprintf("invalid column width for field %s: %d", id, width)}
+		}
+	}
+
+	// Fields the view type is laid out by
+	checks := []struct {
+		id       *uuid.UUID
+		name     string
+		types    []models.FieldType
+		required bool
+	}{
+		{options.StackFieldID, "stackFieldId", []models.FieldType{models.FieldTypeSelect}, view.Type == models.ViewTypeKanban},
+		{options.DateFieldID, "dateFieldId", []models.FieldType{models.FieldTypeDate}, view.Type == models.ViewTypeCalendar},
+		{options.EndDateFieldID, "endDateFieldId", []models.FieldType{models.FieldTypeDate}, false},
+		{options.CoverFieldID, "coverFieldId", []models.FieldType{models.FieldTypeFile}, false},
+	}
+	for _, check := range checks {
+		if check.id == nil {
+			if check.required {
+				return &models.ValidationError{Message: fmt.Sprintf("%s is required for %s views", check.name, view.Type)}
+			}
+			continue
+		}
+		field, ok := fieldMap[check.id.String()]
+		if !ok {
+			return &models.ValidationError{Message: fmt.Sprintf("%s: unknown field %s", check.name, check.id)}
+		}
+		if !containsFieldType(check.types, field.Type) {
+			return &models.ValidationError{Message: fmt.Sprintf("%s: field %s is %s", check.name, field.Name, field.Type)}
+		}
+	}
+	return storeFieldIDs(view, fieldMap)
+}
+
+// storeFieldIDs makes the stored query of a view refer to fields by ID
+// instead of key, so that it keeps working when a field is renamed or its
+// key is reused. References to unknown fields are left as they are.
+func storeFieldIDs(view *models.View, fieldMap map[string]models.Field) error {
+	req, err := viewRequest(view)
+	if err != nil {
+		return err
+	}
+	ref := func(id string) string {
+		if field, ok := fieldMap[id]; ok {
+			return field.ID.String()
+		}
+		return id
+	}
+	if req.Filter != nil {
+		if err := req.Filter.MapFields(ref); err != nil {
+			return &models.ValidationError{Message: err.Error()}
+		}
+		if view.Filter, err = json.Marshal(req.Filter); err != nil {
+			return err
+		}
+	}
+	if len(req.Sort) > 0 {
+		for i := range req.Sort {
+			req.Sort[i].FieldID = ref(req.Sort[i].FieldID)
+		}
+		if view.Sort, err = json.Marshal(req.Sort); err != nil {
+			return err
+		}
+	}
+	if len(req.GroupBy) > 0 {
+		for i := range req.GroupBy {
+			req.GroupBy[i].FieldID = ref(req.GroupBy[i].FieldID)
+		}
+		if view.GroupBy, err = json.Marshal(req.GroupBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeViewFieldIDs rewrites the views of a table that still refer to
+// fields by key to use field IDs. It runs before a field's key changes or
+// is given up, while the key still names the field.
+func storeViewFieldIDs(tx *gorm.DB, tableID uuid.UUID) error {
+	var views []models.View
+	if err := tx.Where("table_id = ?", tableID).Find(&views).Error; err != nil {
+		return fmt.Errorf("failed to load views of table %s: %w", tableID, err)
+	}
+	if len(views) == 0 {
+		return nil
+	}
+	var fields []models.Field
+	if err := tx.Where("table_id = ?", tableID).Find(&fields).Error; err != nil {
+		return fmt.Errorf("failed to get fields for table %s: %w", tableID, err)
+	}
+	fieldMap := query.FieldMap(fields)
+	for i := range views {
+		view := &views[i]
+		filter, sorts, groupBy := string(view.Filter), string(view.Sort), string(view.GroupBy)
+		if err := storeFieldIDs(view, fieldMap); err != nil {
+			return fmt.Errorf("failed to update view %s: %w", view.ID, err)
+		}
+		if string(view.Filter) == filter && string(view.Sort) == sorts && string(view.GroupBy) == groupBy {
+			continue
+		}
+		err := tx.Model(&models.View{}).Where("id = ?", view.ID).
+			Updates(map[string]interface{}{"filter": view.Filter, "sort": view.Sort, "group_by": view.GroupBy}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update view %s: %w", view.ID, err)
+		}
+	}
+	return nil
+}
+
+func containsFieldType(types []models.FieldType, t models.FieldType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleFields returns the fields a view shows: those listed in
+// FieldOrder first, in that order, then the others in their table order,
+// leaving out hidden fields.
+func visibleFields(fields []models.Field, options models.ViewOptions) []models.Field {
+	position := make(map[uuid.UUID]int, len(options.FieldOrder))
+	for i, id := range options.FieldOrder {
+		position[id] = i
+	}
+	hidden := make(map[uuid.UUID]bool, len(options.HiddenFields))
+	for _, id := range options.HiddenFields {
+		hidden[id] = true
+	}
+
+	visible := make([]models.Field, 0, len(fields))
+	for _, field := range fields {
+		if !hidden[field.ID] {
+			visible = append(visible, field)
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		pi, iListed := position[visible[i].ID]
+		pj, jListed := position[visible[j].ID]
+		switch {
+		case iListed && jListed:
+			return pi < pj
+		case iListed != jListed:
+			return iListed
+		}
+		return false
+	})
+	return visible
+}
+
+// publishViewUpdate notifies subscribers of a table about a view change.
+func publishViewUpdate(message ViewUpdateMessage) {
+	channel := fmt.Sprintf("table_updates:%s", message.TableID.String())
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to marshal view update for table %s: %v", message.TableID, err)
+		return
+	}
+	redis.Publish(channel, string(messageBytes))
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"airtable-backend/pkg/models"
+	"airtable-backend/pkg/query"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func setupViewsTable(t *testing.T, db *gorm.DB) {
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS views (
+		id TEXT PRIMARY KEY,
+		table_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		filter TEXT,
+		sort TEXT,
+		group_by TEXT,
+		options TEXT,
+		"order" INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create views table: %v", err)
+	}
+	err = db.Exec(`CREATE TABLE IF NOT EXISTS view_positions (
+		view_id TEXT NOT NULL,
+		record_id TEXT NOT NULL,
+		position REAL NOT NULL,
+		PRIMARY KEY (view_id, record_id)
+	)`).Error
+	if err != nil {
+		t.Fatalf("Failed to create view_positions table: %v", err)
+	}
+}
+
+func TestViewService(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	viewService := NewViewService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	status := &models.Field{TableID: table.ID, Name: "Status", Key: "status", Type: models.FieldTypeSelect,
+		Options: models.FieldOptions{Choices: []models.SelectOption{{Label: "Open"}, {Label: "Done"}}}}
+	hours := &models.Field{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber}
+	for _, field := range []*models.Field{title, status, hours} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	for _, data := range []string{
+		`{"title": "Write docs", "status": "Open", "hours": 3}`,
+		`{"title": "Fix bug", "status": "Done", "hours": 1}`,
+		`{"title": "Review", "status": "Open", "hours": 1}`,
+		`{"title": "Deploy", "status": "Open", "hours": 2}`,
+	} {
+		_, err := recordService.CreateRecord(table.ID, json.RawMessage(data))
+		assert.NoError(t, err)
+	}
+
+	open := &models.View{
+		TableID: table.ID,
+		Name:    "Open work",
+		Filter:  json.RawMessage(`{"conditions": [{"fieldId": "status", "operator": "=", "value": "Open"}]}`),
+		Sort:    json.RawMessage(`[{"fieldId": "hours", "direction": "desc"}]`),
+		Options: models.ViewOptions{
+			HiddenFields: []uuid.UUID{status.ID},
+			FieldOrder:   []uuid.UUID{hours.ID},
+			ColumnWidths: map[uuid.UUID]int{title.ID: 240},
+			RowHeight:    models.RowHeightTall,
+		},
+	}
+	board := &models.View{TableID: table.ID, Name: "Board", Type: models.ViewTypeKanban,
+		Options: models.ViewOptions{StackFieldID: &status.ID}}
+	assert.NoError(t, viewService.CreateView(open))
+	assert.NoError(t, viewService.CreateView(board))
+	assert.Equal(t, models.ViewTypeGrid, open.Type)
+	assert.Equal(t, 0, open.Order)
+	assert.Equal(t, 1, board.Order)
+
+	views, err := viewService.GetViewsByTableID(table.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, views, 2) {
+		assert.Equal(t, open.ID, views[0].ID)
+		assert.Equal(t, 240, views[0].Options.ColumnWidths[title.ID])
+		assert.Equal(t, status.ID, *views[1].Options.StackFieldID)
+	}
+
+	// The stored query replaces the request's; paging still applies
+	result, err := viewService.QueryViewRecords(open.ID, query.Request{
+		Filter:   &query.FilterGroup{},
+		Sort:     []query.Sort{{FieldID: "title"}},
+		PageSize: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.Total)
+	var titles []interface{}
+	for _, record := range result.Records {
+		data, err := decodeRecordData(record.Data)
+		assert.NoError(t, err)
+		titles = append(titles, data["title"])
+	}
+	assert.Equal(t, []interface{}{"Write docs", "Deploy"}, titles)
+	var keys []string
+	for _, field := range result.Fields {
+		keys = append(keys, field.Key)
+	}
+	assert.Equal(t, []string{"hours", "title"}, keys)
+
+	// Updates keep the table and order of the view
+	open.Name = "Open"
+	open.TableID = uuid.New()
+	open.Order = 7
+	assert.NoError(t, viewService.UpdateView(open))
+	updated, err := viewService.GetViewByID(open.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Open", updated.Name)
+	assert.Equal(t, table.ID, updated.TableID)
+	assert.Equal(t, 0, updated.Order)
+
+	var validationErr *models.ValidationError
+	for name, view := range map[string]*models.View{
+		"unknown type":        {Name: "x", Type: "timeline"},
+		"missing name":        {},
+		"unknown filter":      {Name: "x", Filter: json.RawMessage(`{"conditions": [{"fieldId": "missing", "operator": "=", "value": 1}]}`)},
+		"unknown sort":        {Name: "x", Sort: json.RawMessage(`[{"fieldId": "missing"}]`)},
+		"hidden unknown":      {Name: "x", Options: models.ViewOptions{HiddenFields: []uuid.UUID{uuid.New()}}},
+		"bad width":           {Name: "x", Options: models.ViewOptions{ColumnWidths: map[uuid.UUID]int{title.ID: 0}}},
+		"kanban without":      {Name: "x", Type: models.ViewTypeKanban},
+		"kanban on text":      {Name: "x", Type: models.ViewTypeKanban, Options: models.ViewOptions{StackFieldID: &title.ID}},
+		"calendar without":    {Name: "x", Type: models.ViewTypeCalendar},
+		"invalid row height":  {Name: "x", Options: models.ViewOptions{RowHeight: "huge"}},
+		"cover on non-file":   {Name: "x", Type: models.ViewTypeGallery, Options: models.ViewOptions{CoverFieldID: &hours.ID}},
+		"group on unknown id": {Name: "x", GroupBy: json.RawMessage(`[{"fieldId": "missing"}]`)},
+	} {
+		view.TableID = table.ID
+		assert.ErrorAs(t, viewService.CreateView(view), &validationErr, name)
+	}
+	assert.ErrorIs(t, viewService.CreateView(&models.View{TableID: uuid.New(), Name: "x"}), ErrTableNotFound)
+
+	assert.NoError(t, viewService.DeleteView(board.ID))
+	_, err = viewService.GetViewByID(board.ID)
+	assert.ErrorIs(t, err, ErrViewNotFound)
+	_, err = viewService.QueryViewRecords(board.ID, query.Request{})
+	assert.ErrorIs(t, err, ErrViewNotFound)
+}
+
+func TestViewService_FieldReferences(t *testing.T) {
+	db := setupTestDB(t)
+	fieldService := NewFieldService(db)
+	tableService := NewTableService(db)
+	recordService := NewRecordService(db, nil, fieldService)
+	viewService := NewViewService(db)
+
+	table := &models.Table{BaseID: uuid.New(), Name: "Tasks"}
+	assert.NoError(t, tableService.CreateTable(table))
+	title := &models.Field{TableID: table.ID, Name: "Title", Key: "title", Type: models.FieldTypeText}
+	hours := &models.Field{TableID: table.ID, Name: "Hours", Key: "hours", Type: models.FieldTypeNumber}
+	for _, field := range []*models.Field{title, hours} {
+		assert.NoError(t, fieldService.CreateField(field))
+	}
+	record, err := recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Write docs", "hours": 3}`))
+	assert.NoError(t, err)
+	_, err = recordService.CreateRecord(table.ID, json.RawMessage(`{"title": "Review", "hours": 1}`))
+	assert.NoError(t, err)
+
+	// Views name fields by key but are saved with field IDs
+	view := &models.View{
+		TableID: table.ID,
+		Name:    "Long",
+		Filter:  json.RawMessage(`{"conditions": [{"operator": "OR", "conditions": [{"fieldId": "hours", "operator": ">", "value": 2}]}]}`),
+		Sort:    json.RawMessage(`[{"fieldId": "title", "direction": "desc"}]`),
+		GroupBy: json.RawMessage(`[{"fieldId": "hours"}]`),
+	}
+	assert.NoError(t, viewService.CreateView(view))
+	saved, err := viewService.GetViewByID(view.ID)
+	assert.NoError(t, err)
+	assert.Contains(t, string(saved.Filter), hours.ID.String())
+	assert.Contains(t, string(saved.Sort), title.ID.String())
+	assert.Contains(t, string(saved.GroupBy), hours.ID.String())
+
+	// Views saved with keys follow a renamed field
+	legacy := &models.View{
+		TableID: table.ID,
+		Name:    "Legacy",
+		Type:    models.ViewTypeGrid,
+		Filter:  json.RawMessage(`{"conditions": [{"fieldId": "hours", "operator": ">", "value": 2}]}`),
+		Sort:    json.RawMessage(`[{"fieldId": "title"}]`),
+	}
+	assert.NoError(t, db.Create(legacy).Error)
+	renamed := *hours
+	renamed.Key = "effort"
+	_, err = fieldService.ConvertField(&renamed, false)
+	assert.NoError(t, err)
+	for _, id := range []uuid.UUID{view.ID, legacy.ID} {
+		result, err := viewService.QueryViewRecords(id, query.Request{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.Total)
+	}
+
+	// A deleted field's key is not picked up by a later field
+	db.Model(&models.View{}).Where("id = ?", legacy.ID).Update("sort", json.RawMessage(`[{"fieldId": "title"}]`))
+	assert.NoError(t, fieldService.DeleteField(title.ID))
+	saved, err = viewService.GetViewByID(legacy.ID)
+	assert.NoError(t, err)
+	assert.Contains(t, string(saved.Sort), title.ID.String())
+
+	// Deleting the table deletes its views and their positions
+	assert.NoError(t, db.Create(&models.ViewPosition{ViewID: view.ID, RecordID: record.ID, Position: 1}).Error)
+	assert.NoError(t, tableService.DeleteTable(table.ID))
+	views, err := viewService.GetViewsByTableID(table.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, views)
+	var positions int64
+	assert.NoError(t, db.Model(&models.ViewPosition{}).Where("view_id = ?", view.ID).Count(&positions).Error)
+	assert.Zero(t, positions)
+}